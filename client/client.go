@@ -2,14 +2,13 @@ package client
 
 import (
 	"container/list"
-	"encoding/binary"
+	"crypto/tls"
 	"errors"
-	"fmt"
-	"io"
 	"net"
-	"strings"
+	"strconv"
 	"sync"
-	"crypto/tls"
+
+	"github.com/2tvenom/kv/protocol"
 )
 
 type (
@@ -24,24 +23,17 @@ type (
 		keyPath  string
 		isSecure bool
 
+		// user and password are sent by AUTH on every new connection if user is not empty
+		user     string
+		password string
+
 		maxIdleConns int
 	}
 )
 
-const (
-	header   = 0x11
-	ok       = 0x22
-	notFound = 0x44
-	errHead  = 0x99
-
-	typeNone   = 0x50
-	typeString = 0x51
-	typeList   = 0x52
-	typeDict   = 0x53
-)
-
 var (
-	NotFoundErr = errors.New("Not found")
+	NotFoundErr      = errors.New("Not found")
+	SubscribeModeErr = errors.New("Subscribe commands are supported by Subscribe and PSubscribe only")
 )
 
 type PoolConn struct {
@@ -49,8 +41,14 @@ type PoolConn struct {
 	c *Client
 }
 
+type clientConn struct {
+	net.Conn
+	enc *protocol.Encoder
+	dec *protocol.Decoder
+}
+
 func (c *PoolConn) Close() {
-	c.c.put(c.Conn)
+	c.c.put(c.Conn.(*clientConn))
 }
 
 func (c *PoolConn) Finalize() {
@@ -74,13 +72,29 @@ func NewSecureClient(addr string, port int, certPath string, keyPath string) *Cl
 	return client
 }
 
+// NewAuthClient returns client of server with users, every new connection is authenticated by AUTH
+func NewAuthClient(addr string, port int, user string, password string) *Client {
+	client := NewClient(addr, port)
+	client.user = user
+	client.password = password
+	return client
+}
+
+// NewSecureAuthClient returns TLS client of server with users, every new connection is authenticated by AUTH
+func NewSecureAuthClient(addr string, port int, certPath string, keyPath string, user string, password string) *Client {
+	client := NewSecureClient(addr, port, certPath, keyPath)
+	client.user = user
+	client.password = password
+	return client
+}
+
 func (c *Client) Close() {
 	c.Lock()
 	defer c.Unlock()
 
 	for c.conns.Len() > 0 {
 		e := c.conns.Front()
-		co := e.Value.(net.Conn)
+		co := e.Value.(*clientConn)
 		c.conns.Remove(e)
 		co.Close()
 	}
@@ -95,8 +109,30 @@ func (c *Client) Get() (*PoolConn, error) {
 	return &PoolConn{co, c}, err
 }
 
-func (c *Client) newConn() (co net.Conn, err error) {
-	addr := fmt.Sprintf("%s:%d", c.addr, c.port)
+// newConn dials server and authenticates connection by AUTH of client user
+func (c *Client) newConn() (*clientConn, error) {
+	co, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	conn := &clientConn{co, protocol.NewEncoder(co), protocol.NewDecoder(co)}
+	if c.user == "" {
+		return conn, nil
+	}
+
+	if err := conn.enc.EncodeRequest([]byte("AUTH " + c.user + " " + c.password)); err != nil {
+		co.Close()
+		return nil, err
+	}
+	if _, err := conn.dec.DecodeResponse(); err != nil {
+		co.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *Client) dial() (co net.Conn, err error) {
+	addr := net.JoinHostPort(c.addr, strconv.Itoa(c.port))
 
 	if c.isSecure {
 		cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
@@ -111,30 +147,29 @@ func (c *Client) newConn() (co net.Conn, err error) {
 	return net.Dial("tcp", addr)
 }
 
-func (c *Client) get() (co net.Conn, err error) {
+func (c *Client) get() (*clientConn, error) {
 	c.Lock()
 	if c.conns.Len() == 0 {
 		c.Unlock()
-		co, err = c.newConn()
-	} else {
-		e := c.conns.Front()
-		co = e.Value.(net.Conn)
-		c.conns.Remove(e)
-
-		c.Unlock()
+		return c.newConn()
 	}
 
-	return
+	e := c.conns.Front()
+	co := e.Value.(*clientConn)
+	c.conns.Remove(e)
+	c.Unlock()
+
+	return co, nil
 }
 
-func (c *Client) put(conn net.Conn) {
+func (c *Client) put(conn *clientConn) {
 	c.Lock()
 	defer c.Unlock()
 
 	for c.conns.Len() >= c.maxIdleConns {
 		// remove back
 		e := c.conns.Back()
-		co := e.Value.(net.Conn)
+		co := e.Value.(*clientConn)
 		c.conns.Remove(e)
 		co.Close()
 	}
@@ -142,136 +177,96 @@ func (c *Client) put(conn net.Conn) {
 	c.conns.PushFront(conn)
 }
 
+// Do executes command. Missing key returns NotFoundErr,
+// other server errors are *protocol.Error with error code
 func (c *Client) Do(cmd string) (interface{}, error) {
 	conn, err := c.get()
 	if err != nil {
 		return nil, err
 	}
 
-	defer c.put(conn)
-
-	data := uint32ToBytesClientConvert(uint32(len(cmd)))
-	_, err = conn.Write(append([]byte{header}, data...))
+	err = conn.enc.EncodeRequest([]byte(cmd))
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	buff := strings.NewReader(cmd)
-	_, err = io.Copy(conn, buff)
-
-	if err != nil {
+	out, reusable, err := decodeResult(conn)
+	if !reusable {
+		conn.Close()
 		return nil, err
 	}
 
-	header := make([]byte, 1)
-	_, err = conn.Read(header)
-	if err != nil {
-		return nil, err
-	}
+	c.put(conn)
+	//log.Printf("Get %+v:", out)
+	return out, err
+}
 
-	//log.Printf("Get % x:", header)
-	switch header[0] {
-	case ok:
-		dataType := make([]byte, 1)
-		_, err = conn.Read(dataType)
-		if err != nil {
-			return nil, err
+// Pipeline sends all commands at once over one connection and reads responses in the same order.
+// Results and errors are returned by command position, errors are like Do errors
+func (c *Client) Pipeline(cmds []string) ([]interface{}, []error) {
+	out := make([]interface{}, len(cmds))
+	errs := make([]error, len(cmds))
+	fail := func(from int, err error) {
+		for i := from; i < len(cmds); i++ {
+			errs[i] = err
 		}
+	}
 
-		switch dataType[0] {
-		case typeNone:
-			return true, nil
-		case typeString:
-			buff, err := readData(conn)
-			if err != nil {
-				return nil, err
-			}
-			return string(buff), nil
-		case typeList:
-			cnt, err := readUInt(conn)
-			if err != nil {
-				return err, nil
-			}
-
-			out := make([]string, cnt)
-			for i := 0; i < int(cnt); i++ {
-				buff, err := readData(conn)
-				if err != nil {
-					return nil, err
-				}
-				out[i] = string(buff)
-			}
-
-			return out, nil
-		case typeDict:
-			cnt, err := readUInt(conn)
-			if err != nil {
-				return err, nil
-			}
+	conn, err := c.get()
+	if err != nil {
+		fail(0, err)
+		return out, errs
+	}
 
-			out := map[string]string{}
-
-			for i := 0; i < int(cnt); i++ {
-				key, err := readData(conn)
-				if err != nil {
-					return nil, err
-				}
-				value, err := readData(conn)
-				if err != nil {
-					return nil, err
-				}
-				out[string(key)] = string(value)
+	//requests are written while responses are read, server is not blocked by full socket buffer
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for _, cmd := range cmds {
+			if conn.enc.EncodeRequest([]byte(cmd)) != nil {
+				return
 			}
-
-			return out, nil
 		}
-
-		return nil, nil
-	case notFound:
-		return nil, NotFoundErr
-	case errHead:
-		errBuff, err := readData(conn)
-		if err != nil {
-			return nil, err
+	}()
+
+	for i := range cmds {
+		var reusable bool
+		out[i], reusable, errs[i] = decodeResult(conn)
+		if !reusable {
+			conn.Close()
+			<-written
+			fail(i+1, errs[i])
+			return out, errs
 		}
-
-		return nil, errors.New(string(errBuff))
-	default:
-		return nil, nil
 	}
-}
-
-func bytesToUint32ClientConvert(data []byte) uint32 {
-	return binary.LittleEndian.Uint32(data[0:4])
-}
-
-func uint32ToBytesClientConvert(v uint32) []byte {
-	out := make([]byte, 4)
-	binary.LittleEndian.PutUint32(out, v)
 
-	return out
+	<-written
+	c.put(conn)
+	return out, errs
 }
 
-func readUInt(conn net.Conn) (uint32, error) {
-	lenHeader := make([]byte, 4)
-	_, err := conn.Read(lenHeader)
-	if err != nil {
-		return 0, err
+// decodeResult decodes command response, false is returned if connection can not be reused
+func decodeResult(conn *clientConn) (interface{}, bool, error) {
+	out, err := conn.dec.DecodeResponse()
+	switch err {
+	case nil:
+	case protocol.ErrNotFound:
+		return nil, true, NotFoundErr
+	default:
+		if _, ok := err.(*protocol.Error); ok {
+			return nil, true, err
+		}
+		return nil, false, err
 	}
-	return bytesToUint32ClientConvert(lenHeader), nil
-}
 
-func readData(conn net.Conn) ([]byte, error) {
-	l, err := readUInt(conn)
-	if err != nil {
-		return nil, err
+	if _, ok := out.(protocol.Push); ok {
+		//connection is switched to subscribe mode
+		return nil, false, SubscribeModeErr
 	}
 
-	buff := make([]byte, int(l))
-	_, err = conn.Read(buff)
-	if err != nil {
-		return nil, err
+	if out == nil {
+		return true, true, nil
 	}
-
-	return buff, nil
+	return out, true, nil
 }
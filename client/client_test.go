@@ -1,23 +1,31 @@
 package client
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
 	"github.com/2tvenom/kv/server"
 )
 
 func TestClient_Secure(t *testing.T) {
-	addr, port := "127.0.0.1", 4502
+	addr, port := "127.0.0.1", 4503
 	cache := kv.NewCacheDb()
 
 	ts := server.NewTcpServer(cache, addr, port)
 	go func() {
 		err := ts.ListenSecure("../ca.crt", "../ca.key")
 		if err != nil {
-			t.Fatalf("Server err: %s\n", err.Error())
+			t.Errorf("Server err: %s\n", err.Error())
 		}
 	}()
 
@@ -51,7 +59,6 @@ func TestClient_Secure(t *testing.T) {
 	}
 }
 
-
 func TestClient_Do(t *testing.T) {
 	addr, port := "127.0.0.1", 4502
 	cache := kv.NewCacheDb()
@@ -95,6 +102,15 @@ func TestClient_Do(t *testing.T) {
 		t.Fatal("Expected error", "got nil")
 	}
 
+	if e, ok := err.(*protocol.Error); !ok || e.Code != protocol.CodeBadRequest {
+		t.Fatal("Incorrect error", "expected bad request", "got", err)
+	}
+
+	_, err = client.Do("GET unknown")
+	if err != NotFoundErr {
+		t.Fatal("Incorrect error", "expected", NotFoundErr, "got", err)
+	}
+
 	data, err = client.Do("SETLIST keylist foo bar baz")
 	if err != nil {
 		t.Fatal("Setlist error", err.Error())
@@ -152,3 +168,206 @@ func TestClient_Do(t *testing.T) {
 	t.Log("Dict response", outStrList)
 }
 
+func TestClient_Iterate(t *testing.T) {
+	addr, port := "127.0.0.1", 4504
+	cache := kv.NewCacheDb()
+
+	ts := server.NewTcpServer(cache, addr, port)
+	go ts.Listen()
+
+	time.Sleep(time.Second * 2)
+
+	client := NewClient(addr, port)
+
+	_, err := client.Do("SETLIST keylist foo bar baz")
+	if err != nil {
+		t.Fatal("Setlist error", err.Error())
+	}
+
+	it, err := client.Iterate("GETLIST keylist")
+	if err != nil {
+		t.Fatal("Getlist error", err.Error())
+	}
+
+	outStrList := []string{}
+	for it.Next() {
+		outStrList = append(outStrList, it.Elem())
+	}
+
+	if it.Err() != nil {
+		t.Fatal("Iterate error", it.Err())
+	}
+
+	expectingList := []string{"foo", "bar", "baz"}
+	if !reflect.DeepEqual(outStrList, expectingList) {
+		t.Fatal("Incorrect response", "expected", expectingList, "got", outStrList)
+	}
+
+	_, err = client.Do("SETDICT keydict foo:baz bar:bar")
+	if err != nil {
+		t.Fatal("Setdict error", err.Error())
+	}
+
+	it, err = client.Iterate("GETDICT keydict")
+	if err != nil {
+		t.Fatal("Getdict error", err.Error())
+	}
+
+	outStrDict := map[string]string{}
+	for it.Next() {
+		outStrDict[it.Key()] = it.Value()
+	}
+
+	expectingDict := map[string]string{"foo": "baz", "bar": "bar"}
+	if !reflect.DeepEqual(outStrDict, expectingDict) {
+		t.Fatal("Incorrect response", "expected", expectingDict, "got", outStrDict)
+	}
+
+	it, err = client.Iterate("KEYS")
+	if err != nil {
+		t.Fatal("Keys error", err.Error())
+	}
+
+	keys := 0
+	for it.Next() {
+		keys++
+	}
+
+	if keys != 2 {
+		t.Fatal("Incorrect keys count", "expected", 2, "got", keys)
+	}
+
+	_, err = client.Iterate("GET keylist")
+	if err == nil {
+		t.Fatal("Expected error", "got nil")
+	}
+
+	data, err := client.Do("GETLIST keylist")
+	if err != nil {
+		t.Fatal("Getlist error", err.Error())
+	}
+
+	if !reflect.DeepEqual(data, expectingList) {
+		t.Fatal("Incorrect response", "expected", expectingList, "got", data)
+	}
+}
+
+func TestClient_BlockingPop(t *testing.T) {
+	addr, port := "127.0.0.1", 4506
+	cache := kv.NewCacheDb()
+
+	ts := server.NewTcpServer(cache, addr, port)
+	go ts.Listen()
+
+	time.Sleep(time.Second * 2)
+
+	client := NewClient(addr, port)
+
+	_, err := client.Do("BLPOP queue 0.1")
+	if err != NotFoundErr {
+		t.Fatal("Incorrect timeout response", "expected", NotFoundErr, "got", err)
+	}
+
+	//disconnected client does not take element
+	conn, err := net.Dial("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	protocol.NewEncoder(conn).EncodeRequest([]byte("BLPOP queue 0"))
+	time.Sleep(time.Millisecond * 100)
+	conn.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	result := make(chan interface{})
+	go func() {
+		data, err := client.Do("BRPOP empty queue 0")
+		if err != nil {
+			t.Error("Brpop error", err.Error())
+		}
+		result <- data
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	data, err := client.Do("RPUSH queue foo bar")
+	if err != nil {
+		t.Fatal("Rpush error", err.Error())
+	}
+	if data != "2" {
+		t.Fatal("Incorrect response", "expected", "2", "got", data)
+	}
+
+	expected := []string{"queue", "bar"}
+	if out := <-result; !reflect.DeepEqual(out, expected) {
+		t.Fatal("Incorrect response", "expected", expected, "got", out)
+	}
+
+	data, err = client.Do("LPOP queue")
+	if err != nil || data != "foo" {
+		t.Fatal("Incorrect response", "expected", "foo", "got", data, err)
+	}
+}
+
+func TestClient_Auth(t *testing.T) {
+	addr, port := "127.0.0.1", 4547
+	hash, _ := server.HashPassword("secret")
+	path := filepath.Join(t.TempDir(), "users.json")
+	os.WriteFile(path, []byte(fmt.Sprintf(`{"alice": {"password": %q}}`, hash)), 0600)
+
+	caches := []*kv.CacheDb{kv.NewCacheDb(), kv.NewCacheDb()}
+	for i, cache := range caches {
+		if err := server.LoadUsers(cache, path); err != nil {
+			t.Fatal("Load error", err.Error())
+		}
+		ts := server.NewTcpServer(cache, addr, port+i)
+		go ts.Listen()
+		defer ts.Close()
+	}
+	node := server.EnableCluster(caches[1], net.JoinHostPort(addr, strconv.Itoa(port+1)))
+	defer node.Close()
+	node.AddSlots(0, protocol.ClusterSlots-1)
+	time.Sleep(time.Millisecond * 100)
+
+	//every pooled connection is authenticated
+	client := NewAuthClient(addr, port, "alice", "secret")
+	defer client.Close()
+	w := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		w.Add(1)
+		go func(i int) {
+			defer w.Done()
+			if _, err := client.Do(fmt.Sprintf("SET key%d value", i)); err != nil {
+				t.Error("Set error", err.Error())
+			}
+		}(i)
+	}
+	w.Wait()
+
+	sub, err := client.Subscribe("news")
+	if err != nil {
+		t.Fatal("Subscribe error", err.Error())
+	}
+	sub.Close()
+
+	var protoErr *protocol.Error
+	if _, err := NewClient(addr, port).Do("GET key0"); !errors.As(err, &protoErr) || protoErr.Code != protocol.CodeUnauthorized {
+		t.Fatal("Incorrect not authenticated error", "expected", protocol.CodeUnauthorized, "got", err)
+	}
+
+	cluster, err := NewAuthCluster([]string{net.JoinHostPort(addr, strconv.Itoa(port))}, "alice", "secret")
+	if err != nil {
+		t.Fatal("Cluster error", err.Error())
+	}
+	defer cluster.Close()
+	if out, err := cluster.Do("GET key0"); err != nil || out != "value" {
+		t.Fatal("Incorrect cluster response", "expected", "value", "got", out, err)
+	}
+
+	slots, err := NewAuthSlotClient([]string{net.JoinHostPort(addr, strconv.Itoa(port+1))}, "alice", "secret")
+	if err != nil {
+		t.Fatal("Slot client error", err.Error())
+	}
+	defer slots.Close()
+	if _, err := slots.Do("SET foo bar"); err != nil {
+		t.Fatal("Slot client set error", err.Error())
+	}
+}
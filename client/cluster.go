@@ -0,0 +1,530 @@
+package client
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// Cluster distributes keys between kv-servers by consistent hash ring with virtual nodes
+	Cluster struct {
+		lock  sync.RWMutex
+		ring  []ringPoint
+		nodes map[string]*Client
+
+		newClient func(addr string, port int) *Client
+	}
+
+	ringPoint struct {
+		hash uint32
+		node string
+	}
+
+	// movedKey is a key copied to node which owns it by new ring, record is DUMP of key restored to node
+	movedKey struct {
+		key    string
+		record string
+		from   *Client
+		to     *Client
+	}
+)
+
+const (
+	// virtualNodes is a count of ring points of every node
+	virtualNodes = 160
+)
+
+var (
+	NoNodesErr       = errors.New("Cluster has no nodes")
+	NodeExistsErr    = errors.New("Node already exists")
+	NodeNotFoundErr  = errors.New("Node not found")
+	CrossNodeKeysErr = errors.New("Command keys belong to different nodes")
+)
+
+// NewCluster returns cluster of servers with "host:port" addresses
+func NewCluster(addrs []string) (*Cluster, error) {
+	return newCluster(addrs, NewClient)
+}
+
+// NewSecureCluster returns cluster of TLS servers with "host:port" addresses
+func NewSecureCluster(addrs []string, certPath string, keyPath string) (*Cluster, error) {
+	return newCluster(addrs, func(addr string, port int) *Client {
+		return NewSecureClient(addr, port, certPath, keyPath)
+	})
+}
+
+// NewAuthCluster returns cluster of servers with users, connections are authenticated by AUTH of user and password
+func NewAuthCluster(addrs []string, user string, password string) (*Cluster, error) {
+	return newCluster(addrs, func(addr string, port int) *Client {
+		return NewAuthClient(addr, port, user, password)
+	})
+}
+
+// NewSecureAuthCluster returns cluster of TLS servers with users, connections are authenticated by AUTH of user and password
+func NewSecureAuthCluster(addrs []string, certPath string, keyPath string, user string, password string) (*Cluster, error) {
+	return newCluster(addrs, func(addr string, port int) *Client {
+		return NewSecureAuthClient(addr, port, certPath, keyPath, user, password)
+	})
+}
+
+func newCluster(addrs []string, newClient func(addr string, port int) *Client) (*Cluster, error) {
+	c := &Cluster{nodes: map[string]*Client{}, newClient: newClient}
+	for _, addr := range addrs {
+		if err := c.addNode(addr); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Close closes connections of all nodes
+func (c *Cluster) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, client := range c.nodes {
+		client.Close()
+	}
+}
+
+// Nodes returns addresses of cluster nodes
+func (c *Cluster) Nodes() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	out := make([]string, 0, len(c.nodes))
+	for addr := range c.nodes {
+		out = append(out, addr)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Node returns address of node which owns key
+func (c *Cluster) Node(key string) (string, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if len(c.ring) == 0 {
+		return "", NoNodesErr
+	}
+	return owner(c.ring, key), nil
+}
+
+// Client returns client of node which owns key, e.g. for pub/sub channel or iteration
+func (c *Cluster) Client(key string) (*Client, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if len(c.ring) == 0 {
+		return nil, NoNodesErr
+	}
+	return c.nodes[owner(c.ring, key)], nil
+}
+
+// Do executes command on node of command key. KEYS is executed on all nodes,
+// blocking pops of several keys require keys of one node
+func (c *Cluster) Do(cmd string) (interface{}, error) {
+	fields := strings.Fields(cmd)
+	if len(fields) > 0 && fields[0] == "KEYS" {
+		return c.Keys()
+	}
+
+	key := ""
+	if len(fields) > 1 {
+		key = fields[1]
+	}
+
+	client, err := c.Client(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) > 3 && (fields[0] == "BLPOP" || fields[0] == "BRPOP") {
+		if len(c.split(fields[1:len(fields)-1])) > 1 {
+			return nil, CrossNodeKeysErr
+		}
+	}
+
+	return client.Do(cmd)
+}
+
+// Keys returns keys of all nodes
+func (c *Cluster) Keys() ([]string, error) {
+	out := []string{}
+	var lock sync.Mutex
+	err := c.each(func(addr string, client *Client) error {
+		keys, err := nodeKeys(client)
+		if err != nil {
+			return err
+		}
+
+		lock.Lock()
+		out = append(out, keys...)
+		lock.Unlock()
+		return nil
+	})
+	return out, err
+}
+
+// MGet returns values of keys, missing keys are not returned
+func (c *Cluster) MGet(keys ...string) (map[string]string, error) {
+	out := map[string]string{}
+	var lock sync.Mutex
+	err := c.pipeline(keys, func(key string) string {
+		return "GET " + key
+	}, func(key string, data interface{}, err error) error {
+		if err == NotFoundErr {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		lock.Lock()
+		out[key], _ = data.(string)
+		lock.Unlock()
+		return nil
+	})
+	return out, err
+}
+
+// MSet sets values of keys, zero ttl means no expiration
+func (c *Cluster) MSet(values map[string]string, ttl int64) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	return c.pipeline(keys, func(key string) string {
+		if ttl > 0 {
+			return fmt.Sprintf("SET %s %d %s", key, ttl, values[key])
+		}
+		return fmt.Sprintf("SET %s %s", key, values[key])
+	}, func(key string, data interface{}, err error) error {
+		return err
+	})
+}
+
+// MRemove removes keys
+func (c *Cluster) MRemove(keys ...string) error {
+	return c.pipeline(keys, func(key string) string {
+		return "REMOVE " + key
+	}, func(key string, data interface{}, err error) error {
+		return err
+	})
+}
+
+// AddNode adds node to cluster and moves keys owned by node now from other nodes.
+// Returns count of moved keys. Keys are copied to node before ring is switched and removed from
+// old nodes after, key changed after copy is copied again. Copies are removed if keys can not be copied
+func (c *Cluster) AddNode(addr string) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.nodes[addr]; ok {
+		return 0, NodeExistsErr
+	}
+
+	client, err := c.nodeClient(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	ring := addPoints(c.ring, addr)
+	var copies []movedKey
+	for from, fromClient := range c.nodes {
+		nodeCopies, err := copyKeys(fromClient, ring, from, map[string]*Client{addr: client})
+		copies = append(copies, nodeCopies...)
+		if err != nil {
+			rollback(copies)
+			client.Close()
+			return 0, err
+		}
+	}
+
+	c.nodes[addr] = client
+	c.ring = ring
+	return removeMoved(copies)
+}
+
+// RemoveNode moves keys of node to other nodes and removes node from cluster.
+// Returns count of moved keys, keys are moved like by AddNode
+func (c *Cluster) RemoveNode(addr string) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	client, ok := c.nodes[addr]
+	if !ok {
+		return 0, NodeNotFoundErr
+	}
+
+	ring := []ringPoint{}
+	for _, point := range c.ring {
+		if point.node != addr {
+			ring = append(ring, point)
+		}
+	}
+
+	targets := map[string]*Client{}
+	for node, nodeClient := range c.nodes {
+		if node != addr {
+			targets[node] = nodeClient
+		}
+	}
+	if len(targets) == 0 {
+		return 0, NoNodesErr
+	}
+
+	copies, err := copyKeys(client, ring, addr, targets)
+	if err != nil {
+		rollback(copies)
+		return 0, err
+	}
+
+	delete(c.nodes, addr)
+	c.ring = ring
+	moved, err := removeMoved(copies)
+	client.Close()
+	return moved, err
+}
+
+func (c *Cluster) addNode(addr string) error {
+	if _, ok := c.nodes[addr]; ok {
+		return NodeExistsErr
+	}
+
+	client, err := c.nodeClient(addr)
+	if err != nil {
+		return err
+	}
+
+	c.nodes[addr] = client
+	c.ring = addPoints(c.ring, addr)
+	return nil
+}
+
+func (c *Cluster) nodeClient(addr string) (*Client, error) {
+	return addrClient(addr, c.newClient)
+}
+
+// addrClient returns client of "host:port" address
+func addrClient(addr string, newClient func(addr string, port int) *Client) (*Client, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(host, port), nil
+}
+
+// split groups keys by node client
+func (c *Cluster) split(keys []string) map[*Client][]string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	out := map[*Client][]string{}
+	for _, key := range keys {
+		client := c.nodes[owner(c.ring, key)]
+		out[client] = append(out[client], key)
+	}
+	return out
+}
+
+// pipeline executes command of every key, commands of one node are pipelined,
+// nodes are called concurrently. First error is returned
+func (c *Cluster) pipeline(keys []string, cmd func(key string) string, result func(key string, data interface{}, err error) error) error {
+	if len(c.Nodes()) == 0 {
+		return NoNodesErr
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(keys))
+	for client, nodeKeys := range c.split(keys) {
+		wg.Add(1)
+		go func(client *Client, keys []string) {
+			defer wg.Done()
+
+			cmds := make([]string, len(keys))
+			for i, key := range keys {
+				cmds[i] = cmd(key)
+			}
+
+			out, cmdErrs := client.Pipeline(cmds)
+			for i, key := range keys {
+				if err := result(key, out[i], cmdErrs[i]); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(client, nodeKeys)
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// each calls fn for every node concurrently, first error is returned
+func (c *Cluster) each(fn func(addr string, client *Client) error) error {
+	c.lock.RLock()
+	nodes := make(map[string]*Client, len(c.nodes))
+	for addr, client := range c.nodes {
+		nodes[addr] = client
+	}
+	c.lock.RUnlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(nodes))
+	for addr, client := range nodes {
+		wg.Add(1)
+		go func(addr string, client *Client) {
+			defer wg.Done()
+			if err := fn(addr, client); err != nil {
+				errs <- err
+			}
+		}(addr, client)
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// copyKeys copies keys of node from which are owned by other node in ring to targets by DUMP and RESTORE.
+// Copied keys are returned on error too
+func copyKeys(from *Client, ring []ringPoint, fromAddr string, targets map[string]*Client) ([]movedKey, error) {
+	keys, err := nodeKeys(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var copies []movedKey
+	for _, key := range keys {
+		node := owner(ring, key)
+		to, ok := targets[node]
+		if !ok || node == fromAddr {
+			continue
+		}
+
+		record, err := from.Do("DUMP " + key)
+		if err == NotFoundErr {
+			continue
+		}
+		if err != nil {
+			return copies, err
+		}
+
+		m := movedKey{key: key, from: from, to: to}
+		m.record, _ = record.(string)
+		if _, err := to.Do(fmt.Sprintf("RESTORE %s %s", key, m.record)); err != nil {
+			return copies, err
+		}
+		copies = append(copies, m)
+	}
+	return copies, nil
+}
+
+// rollback removes copies of keys which are not changed after copy
+func rollback(copies []movedKey) {
+	for _, m := range copies {
+		m.to.Do(fmt.Sprintf("REMOVEIF %s %s", m.key, m.record))
+	}
+}
+
+// removeMoved removes copied keys from old nodes and returns count of moved keys
+func removeMoved(copies []movedKey) (int, error) {
+	moved := 0
+	for _, m := range copies {
+		ok, err := m.remove()
+		if err != nil {
+			return moved, err
+		}
+		if ok {
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// remove removes key from old node if it is not changed after copy, changed key is copied again.
+// Key removed from old node after copy is removed from new node too, returns false in this case
+func (m movedKey) remove() (bool, error) {
+	for {
+		_, err := m.from.Do(fmt.Sprintf("REMOVEIF %s %s", m.key, m.record))
+		if err != NotFoundErr {
+			return err == nil, err
+		}
+
+		record, err := m.from.Do("DUMP " + m.key)
+		if err == NotFoundErr {
+			_, err = m.to.Do(fmt.Sprintf("REMOVEIF %s %s", m.key, m.record))
+			if err == NotFoundErr {
+				err = nil
+			}
+			return false, err
+		}
+		if err != nil {
+			return false, err
+		}
+
+		m.record, _ = record.(string)
+		if _, err := m.to.Do(fmt.Sprintf("RESTORE %s %s", m.key, m.record)); err != nil {
+			return false, err
+		}
+	}
+}
+
+func nodeKeys(client *Client) ([]string, error) {
+	data, err := client.Do("KEYS")
+	if err != nil {
+		return nil, err
+	}
+
+	keys, _ := data.([]string)
+	return keys, nil
+}
+
+// addPoints returns ring with virtual nodes of node
+func addPoints(ring []ringPoint, node string) []ringPoint {
+	out := make([]ringPoint, len(ring), len(ring)+virtualNodes)
+	copy(out, ring)
+	for i := 0; i < virtualNodes; i++ {
+		out = append(out, ringPoint{hash: ringHash(node + "#" + strconv.Itoa(i)), node: node})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].hash < out[j].hash
+	})
+	return out
+}
+
+// owner returns node of first ring point clockwise from key hash
+func owner(ring []ringPoint, key string) string {
+	hash := ringHash(key)
+	i := sort.Search(len(ring), func(i int) bool {
+		return ring[i].hash >= hash
+	})
+	if i == len(ring) {
+		i = 0
+	}
+	return ring[i].node
+}
+
+// ringHash returns first bytes of md5, it spreads similar node names better than short hashes
+func ringHash(s string) uint32 {
+	sum := md5.Sum([]byte(s))
+	return binary.LittleEndian.Uint32(sum[:4])
+}
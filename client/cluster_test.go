@@ -0,0 +1,198 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/server"
+)
+
+func TestCluster(t *testing.T) {
+	addr := "127.0.0.1"
+	ports := []int{4511, 4512, 4513}
+
+	caches := map[string]*kv.CacheDb{}
+	addrs := []string{}
+	for _, port := range ports {
+		cache := kv.NewCacheDb()
+		ts := server.NewTcpServer(cache, addr, port)
+		go ts.Listen()
+
+		nodeAddr := net.JoinHostPort(addr, strconv.Itoa(port))
+		caches[nodeAddr] = cache
+		addrs = append(addrs, nodeAddr)
+	}
+
+	time.Sleep(time.Second * 2)
+
+	cluster, err := NewCluster(addrs[:2])
+	if err != nil {
+		t.Fatal("Cluster error", err.Error())
+	}
+	defer cluster.Close()
+
+	values := map[string]string{}
+	for i := 0; i < 300; i++ {
+		values[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+	}
+
+	if err := cluster.MSet(values, 0); err != nil {
+		t.Fatal("MSet error", err.Error())
+	}
+
+	for _, node := range addrs[:2] {
+		if n := len(caches[node].Keys()); n < 100 {
+			t.Fatal("Incorrect distribution", "expected > 100 keys on", node, "got", n)
+		}
+	}
+
+	out, err := cluster.MGet(append(keysOf(values), "missing")...)
+	if err != nil {
+		t.Fatal("MGet error", err.Error())
+	}
+	if !reflect.DeepEqual(out, values) {
+		t.Fatal("Incorrect response", "expected", len(values), "values", "got", len(out))
+	}
+
+	owners := map[string]string{}
+	for key := range values {
+		owners[key], _ = cluster.Node(key)
+	}
+
+	moved, err := cluster.AddNode(addrs[2])
+	if err != nil {
+		t.Fatal("Add node error", err.Error())
+	}
+
+	keys := caches[addrs[2]].Keys()
+	if moved != len(keys) || moved == 0 {
+		t.Fatal("Incorrect moved keys", "expected", len(keys), "got", moved)
+	}
+	for key := range values {
+		node, _ := cluster.Node(key)
+		if node != addrs[2] && node != owners[key] {
+			t.Fatal("Incorrect key owner", "expected", owners[key], "got", node)
+		}
+	}
+
+	data, err := cluster.Do("GET key1")
+	if err != nil || data != "value1" {
+		t.Fatal("Incorrect response", "expected", "value1", "got", data, err)
+	}
+
+	all, err := cluster.Keys()
+	if err != nil {
+		t.Fatal("Keys error", err.Error())
+	}
+	sort.Strings(all)
+	if expected := keysOf(values); !reflect.DeepEqual(all, expected) {
+		t.Fatal("Incorrect keys", "expected", len(expected), "got", len(all))
+	}
+
+	if _, err := cluster.RemoveNode(addrs[0]); err != nil {
+		t.Fatal("Remove node error", err.Error())
+	}
+	if n := len(caches[addrs[0]].Keys()); n != 0 {
+		t.Fatal("Incorrect removed node keys", "expected", 0, "got", n)
+	}
+
+	out, err = cluster.MGet(keysOf(values)...)
+	if err != nil {
+		t.Fatal("MGet error", err.Error())
+	}
+	if !reflect.DeepEqual(out, values) {
+		t.Fatal("Incorrect response", "expected", len(values), "values", "got", len(out))
+	}
+
+	if err := cluster.MRemove(keysOf(values)...); err != nil {
+		t.Fatal("MRemove error", err.Error())
+	}
+	if all, _ := cluster.Keys(); len(all) != 0 {
+		t.Fatal("Incorrect keys", "expected", 0, "got", len(all))
+	}
+}
+
+func keysOf(values map[string]string) []string {
+	out := make([]string, 0, len(values))
+	for key := range values {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestClusterMoveRollback(t *testing.T) {
+	addr := "127.0.0.1"
+	ports := []int{4538, 4539}
+
+	caches := []*kv.CacheDb{}
+	addrs := []string{}
+	for _, port := range ports {
+		cache := kv.NewCacheDb()
+		ts := server.NewTcpServer(cache, addr, port)
+		go ts.Listen()
+
+		caches = append(caches, cache)
+		addrs = append(addrs, net.JoinHostPort(addr, strconv.Itoa(port)))
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	cluster, err := NewCluster(addrs[:1])
+	if err != nil {
+		t.Fatal("Cluster error", err.Error())
+	}
+	defer cluster.Close()
+
+	for i := 0; i < 100; i++ {
+		caches[0].Set(fmt.Sprintf("key%d", i), 0, []byte("value"))
+	}
+
+	//key longer than maximum key length of command can not be moved to new node
+	ring := addPoints(cluster.ring, addrs[1])
+	long := strings.Repeat("k", 300)
+	for i := 0; owner(ring, long) != addrs[1]; i++ {
+		long = strings.Repeat("k", 300) + strconv.Itoa(i)
+	}
+	caches[0].Set(long, 0, []byte("value"))
+
+	if _, err := cluster.AddNode(addrs[1]); err == nil {
+		t.Fatal("Expected add node error")
+	}
+	if keys := caches[1].Keys(); len(keys) != 0 {
+		t.Fatal("Incorrect keys of not added node", "expected", 0, "got", len(keys))
+	}
+	if keys := caches[0].Keys(); len(keys) != 101 {
+		t.Fatal("Incorrect keys", "expected", 101, "got", len(keys))
+	}
+	if nodes := cluster.Nodes(); !reflect.DeepEqual(nodes, addrs[:1]) {
+		t.Fatal("Incorrect nodes", "expected", addrs[:1], "got", nodes)
+	}
+
+	caches[0].Remove(long)
+	moved, err := cluster.AddNode(addrs[1])
+	if err != nil {
+		t.Fatal("Add node error", err.Error())
+	}
+	if moved == 0 || moved != len(caches[1].Keys()) || moved+len(caches[0].Keys()) != 100 {
+		t.Fatal("Incorrect moved keys", moved)
+	}
+
+	//changed key is not removed
+	client, _ := cluster.Client("key1")
+	record, _ := client.Do("DUMP key1")
+	client.Do("SET key1 changed")
+	if _, err := client.Do(fmt.Sprintf("REMOVEIF key1 %s", record)); err != NotFoundErr {
+		t.Fatal("Incorrect error", "expected", NotFoundErr, "got", err)
+	}
+	record, _ = client.Do("DUMP key1")
+	if _, err := client.Do(fmt.Sprintf("REMOVEIF key1 %s", record)); err != nil {
+		t.Fatal("Remove error", err)
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"github.com/2tvenom/kv/protocol"
+)
+
+type (
+	// Iterator reads list or dictionary response element by element.
+	// Connection is returned to pool when all elements are read
+	Iterator struct {
+		*protocol.StreamReader
+		conn *clientConn
+		c    *Client
+	}
+)
+
+// Iterate executes command which returns list or dictionary (KEYS, GETLIST, GETDICT)
+// and returns iterator over streamed response
+func (c *Client) Iterate(cmd string) (*Iterator, error) {
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.enc.EncodeStreamRequest([]byte(cmd))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s, err := conn.dec.DecodeStream()
+	switch err {
+	case nil:
+	case protocol.ErrNotFound:
+		c.put(conn)
+		return nil, NotFoundErr
+	case protocol.ErrIncorrectDataType:
+		c.put(conn)
+		return nil, err
+	default:
+		if _, ok := err.(*protocol.Error); ok {
+			c.put(conn)
+			return nil, err
+		}
+		conn.Close()
+		return nil, err
+	}
+
+	return &Iterator{s, conn, c}, nil
+}
+
+func (i *Iterator) Next() bool {
+	if i.StreamReader.Next() {
+		return true
+	}
+	i.Close()
+	return false
+}
+
+// Close releases connection, not finished response is dropped with connection
+func (i *Iterator) Close() {
+	if i.conn == nil {
+		return
+	}
+
+	if i.Done() {
+		i.c.put(i.conn)
+	} else {
+		i.conn.Close()
+	}
+	i.conn = nil
+}
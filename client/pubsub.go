@@ -0,0 +1,163 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/2tvenom/kv/protocol"
+)
+
+type (
+	Message struct {
+		// Pattern is a matched pattern of PSUBSCRIBE subscription
+		Pattern string
+		Channel string
+		Payload string
+		// Err is an error reply of server to subscription command, other fields are empty
+		Err error
+	}
+
+	// Subscription holds dedicated connection in subscribe mode.
+	// C is closed when connection is closed
+	Subscription struct {
+		C <-chan *Message
+
+		c    chan *Message
+		conn *clientConn
+		lock sync.Mutex
+		err  error
+	}
+)
+
+const (
+	subscriptionBuffer = 128
+
+	keyspacePrefix = "__keyspace__:"
+	keyeventPrefix = "__keyevent__:"
+)
+
+// KeyspaceChannel returns channel of key events, messages are event names
+// ("set", "setlist", "setdict", "remove", "expired")
+func KeyspaceChannel(key string) string {
+	return keyspacePrefix + key
+}
+
+// KeyeventChannel returns channel of event, messages are keys
+func KeyeventChannel(event string) string {
+	return keyeventPrefix + event
+}
+
+// Subscribe opens dedicated connection subscribed to channels
+func (c *Client) Subscribe(channels ...string) (*Subscription, error) {
+	return c.subscribe("SUBSCRIBE", channels)
+}
+
+// PSubscribe opens dedicated connection subscribed to channels matched by glob patterns
+func (c *Client) PSubscribe(patterns ...string) (*Subscription, error) {
+	return c.subscribe("PSUBSCRIBE", patterns)
+}
+
+// Publish sends message to channel and returns receivers count
+func (c *Client) Publish(channel string, message string) (int, error) {
+	out, err := c.Do("PUBLISH " + channel + " " + message)
+	if err != nil {
+		return 0, err
+	}
+
+	cnt, _ := out.(string)
+	return strconv.Atoi(cnt)
+}
+
+func (c *Client) subscribe(cmd string, names []string) (*Subscription, error) {
+	conn, err := c.newConn()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *Message, subscriptionBuffer)
+	s := &Subscription{
+		C:    ch,
+		c:    ch,
+		conn: conn,
+	}
+
+	if err := s.send(cmd, names); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go s.readLoop()
+	return s, nil
+}
+
+func (s *Subscription) Subscribe(channels ...string) error {
+	return s.send("SUBSCRIBE", channels)
+}
+
+// Unsubscribe removes channels subscriptions, all channels if called without arguments
+func (s *Subscription) Unsubscribe(channels ...string) error {
+	return s.send("UNSUBSCRIBE", channels)
+}
+
+func (s *Subscription) PSubscribe(patterns ...string) error {
+	return s.send("PSUBSCRIBE", patterns)
+}
+
+// PUnsubscribe removes patterns subscriptions, all patterns if called without arguments
+func (s *Subscription) PUnsubscribe(patterns ...string) error {
+	return s.send("PUNSUBSCRIBE", patterns)
+}
+
+func (s *Subscription) Close() error {
+	return s.conn.Close()
+}
+
+// Err returns error which closed subscription
+func (s *Subscription) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+func (s *Subscription) send(cmd string, names []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(names) > 0 {
+		cmd += " " + strings.Join(names, " ")
+	}
+	return s.conn.enc.EncodeRequest([]byte(cmd))
+}
+
+func (s *Subscription) readLoop() {
+	defer close(s.c)
+
+	for {
+		out, err := s.conn.dec.DecodeResponse()
+		if err != nil {
+			if _, ok := err.(*protocol.Error); ok {
+				s.c <- &Message{Err: err}
+				continue
+			}
+
+			s.lock.Lock()
+			s.err = err
+			s.lock.Unlock()
+			s.conn.Close()
+			return
+		}
+
+		push, ok := out.(protocol.Push)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case len(push) == 3 && push[0] == "message":
+			s.c <- &Message{Channel: push[1], Payload: push[2]}
+		case len(push) == 4 && push[0] == "pmessage":
+			s.c <- &Message{Pattern: push[1], Channel: push[2], Payload: push[3]}
+		}
+	}
+}
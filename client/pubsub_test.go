@@ -0,0 +1,93 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+	"github.com/2tvenom/kv/server"
+)
+
+func TestClient_Subscribe(t *testing.T) {
+	addr, port := "127.0.0.1", 4505
+	cache := kv.NewCacheDb()
+
+	ts := server.NewTcpServer(cache, addr, port)
+	go ts.Listen()
+
+	time.Sleep(time.Second * 2)
+
+	client := NewClient(addr, port)
+
+	sub, err := client.Subscribe("news")
+	if err != nil {
+		t.Fatal("Subscribe error", err.Error())
+	}
+	defer sub.Close()
+
+	err = sub.PSubscribe("user.*")
+	if err != nil {
+		t.Fatal("PSubscribe error", err.Error())
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	expected := []*Message{
+		{Channel: "news", Payload: "hello world"},
+		{Pattern: "user.*", Channel: "user.1", Payload: "bar"},
+	}
+
+	for _, m := range expected {
+		n, err := client.Publish(m.Channel, m.Payload)
+		if err != nil {
+			t.Fatal("Publish error", err.Error())
+		}
+
+		if n != 1 {
+			t.Fatal("Incorrect receivers count", "expected", 1, "got", n)
+		}
+
+		select {
+		case message := <-sub.C:
+			if *message != *m {
+				t.Fatal("Incorrect message", "expected", m, "got", message)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected message", m)
+		}
+	}
+
+	//error reply is delivered to subscriber, subscription is kept
+	if err := sub.Subscribe(); err != nil {
+		t.Fatal("Subscribe error", err.Error())
+	}
+	select {
+	case message := <-sub.C:
+		if e, ok := message.Err.(*protocol.Error); !ok || e.Code != protocol.CodeBadRequest {
+			t.Fatal("Incorrect message error", "expected", protocol.CodeBadRequest, "got", message.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected error message")
+	}
+	if n, err := client.Publish("news", "after error"); err != nil || n != 1 {
+		t.Fatal("Incorrect receivers count", "expected", 1, "got", n, err)
+	}
+	if message := <-sub.C; message.Payload != "after error" {
+		t.Fatal("Incorrect message", "expected", "after error", "got", message)
+	}
+
+	sub.Unsubscribe()
+	sub.PUnsubscribe()
+	time.Sleep(time.Millisecond * 100)
+
+	n, err := client.Publish("news", "foo")
+	if err != nil || n != 0 {
+		t.Fatal("Incorrect receivers count", "expected", 0, "got", n, err)
+	}
+
+	_, err = client.Do("SUBSCRIBE news")
+	if err != SubscribeModeErr {
+		t.Fatal("Incorrect error", "expected", SubscribeModeErr, "got", err)
+	}
+}
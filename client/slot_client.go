@@ -0,0 +1,218 @@
+package client
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/2tvenom/kv/protocol"
+)
+
+type (
+	// SlotClient executes commands on cluster of kv-servers with hash slots.
+	// Slot map is cached, MOVED and ASK redirects are followed
+	SlotClient struct {
+		lock    sync.RWMutex
+		slots   [protocol.ClusterSlots]string
+		clients map[string]*Client
+		seeds   []string
+
+		newClient func(addr string, port int) *Client
+	}
+)
+
+const (
+	maxRedirects = 5
+)
+
+var (
+	TooManyRedirectsErr = errors.New("Too many cluster redirects")
+	IncorrectSlotsErr   = errors.New("Incorrect cluster slots")
+)
+
+// NewSlotClient returns client of cluster, slot map is requested from seed "host:port" nodes
+func NewSlotClient(seeds []string) (*SlotClient, error) {
+	return newSlotClient(seeds, NewClient)
+}
+
+// NewSecureSlotClient returns client of TLS cluster, slot map is requested from seed "host:port" nodes
+func NewSecureSlotClient(seeds []string, certPath string, keyPath string) (*SlotClient, error) {
+	return newSlotClient(seeds, func(addr string, port int) *Client {
+		return NewSecureClient(addr, port, certPath, keyPath)
+	})
+}
+
+// NewAuthSlotClient returns client of cluster with users, connections are authenticated by AUTH of user and password
+func NewAuthSlotClient(seeds []string, user string, password string) (*SlotClient, error) {
+	return newSlotClient(seeds, func(addr string, port int) *Client {
+		return NewAuthClient(addr, port, user, password)
+	})
+}
+
+// NewSecureAuthSlotClient returns client of TLS cluster with users, connections are authenticated by AUTH of user and password
+func NewSecureAuthSlotClient(seeds []string, certPath string, keyPath string, user string, password string) (*SlotClient, error) {
+	return newSlotClient(seeds, func(addr string, port int) *Client {
+		return NewSecureAuthClient(addr, port, certPath, keyPath, user, password)
+	})
+}
+
+func newSlotClient(seeds []string, newClient func(addr string, port int) *Client) (*SlotClient, error) {
+	if len(seeds) == 0 {
+		return nil, NoNodesErr
+	}
+
+	c := &SlotClient{clients: map[string]*Client{}, seeds: seeds, newClient: newClient}
+	if err := c.Refresh(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes connections of all nodes
+func (c *SlotClient) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, client := range c.clients {
+		client.Close()
+	}
+}
+
+// Refresh loads slot map from the first available seed or known node
+func (c *SlotClient) Refresh() error {
+	c.lock.RLock()
+	addrs := append([]string{}, c.seeds...)
+	for addr := range c.clients {
+		addrs = append(addrs, addr)
+	}
+	c.lock.RUnlock()
+
+	var err error
+	for _, addr := range addrs {
+		var client *Client
+		if client, err = c.client(addr); err != nil {
+			continue
+		}
+
+		var out interface{}
+		if out, err = client.Do("CLUSTER SLOTS"); err != nil {
+			continue
+		}
+
+		ranges, _ := out.([]string)
+		var slots [protocol.ClusterSlots]string
+		for _, r := range ranges {
+			// from-to id host:port
+			fields := strings.Fields(r)
+			if len(fields) != 3 {
+				return IncorrectSlotsErr
+			}
+			fromStr, toStr, _ := strings.Cut(fields[0], "-")
+			from, errFrom := strconv.Atoi(fromStr)
+			to, errTo := strconv.Atoi(toStr)
+			if errFrom != nil || errTo != nil || from > to || to >= protocol.ClusterSlots {
+				return IncorrectSlotsErr
+			}
+			for slot := from; slot <= to; slot++ {
+				slots[slot] = fields[2]
+			}
+		}
+
+		c.lock.Lock()
+		c.slots = slots
+		c.lock.Unlock()
+		return nil
+	}
+	return err
+}
+
+// Node returns address of node which serves key by cached slot map, empty if slot owner is unknown
+func (c *SlotClient) Node(key string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.slots[protocol.KeySlot(key)]
+}
+
+// Do executes command on node of command key and follows redirects.
+// Commands without key are executed on the first seed node
+func (c *SlotClient) Do(cmd string) (interface{}, error) {
+	addr := c.seeds[0]
+	if fields := strings.Fields(cmd); len(fields) > 1 && fields[0] != "KEYS" && fields[0] != "CLUSTER" {
+		if node := c.Node(fields[1]); node != "" {
+			addr = node
+		}
+	}
+
+	asking := false
+	for i := 0; i <= maxRedirects; i++ {
+		client, err := c.client(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		var out interface{}
+		if asking {
+			outs, errs := client.Pipeline([]string{"ASKING", cmd})
+			out, err = outs[1], errs[1]
+		} else {
+			out, err = client.Do(cmd)
+		}
+
+		code, slot, target, ok := redirect(err)
+		if !ok {
+			return out, err
+		}
+
+		if code == protocol.CodeMoved {
+			c.lock.Lock()
+			c.slots[slot] = target
+			c.lock.Unlock()
+		}
+		addr, asking = target, code == protocol.CodeAsk
+	}
+	return nil, TooManyRedirectsErr
+}
+
+func (c *SlotClient) client(addr string) (*Client, error) {
+	c.lock.RLock()
+	client, ok := c.clients[addr]
+	c.lock.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	client, err := addrClient(addr, c.newClient)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if current, ok := c.clients[addr]; ok {
+		return current, nil
+	}
+	c.clients[addr] = client
+	return client, nil
+}
+
+// redirect returns code, slot and address of MOVED or ASK error.
+// Error message ends with "MOVED <slot> <host:port>" or "ASK <slot> <host:port>"
+func redirect(err error) (byte, uint16, string, bool) {
+	e, ok := err.(*protocol.Error)
+	if !ok || (e.Code != protocol.CodeMoved && e.Code != protocol.CodeAsk) {
+		return 0, 0, "", false
+	}
+
+	fields := strings.Fields(e.Message)
+	if len(fields) < 2 {
+		return 0, 0, "", false
+	}
+
+	slot, err := strconv.ParseUint(fields[len(fields)-2], 10, 16)
+	if err != nil || slot >= protocol.ClusterSlots {
+		return 0, 0, "", false
+	}
+	return e.Code, uint16(slot), fields[len(fields)-1], true
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+	"github.com/2tvenom/kv/server"
+)
+
+func TestSlotClient(t *testing.T) {
+	addrs := []string{"127.0.0.1:4523", "127.0.0.1:4524"}
+	caches := make([]*kv.CacheDb, len(addrs))
+	nodes := make([]*server.ClusterNode, len(addrs))
+	for i, addr := range addrs {
+		caches[i] = kv.NewCacheDb()
+		ts := server.NewTcpServer(caches[i], "127.0.0.1", 4523+i)
+		go ts.Listen()
+
+		nodes[i] = server.EnableCluster(caches[i], addr)
+		defer nodes[i].Close()
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	nodes[0].AddSlots(0, 8191)
+	nodes[1].AddSlots(8192, protocol.ClusterSlots-1)
+	if err := nodes[0].Meet(addrs[1]); err != nil {
+		t.Fatal("Meet error", err.Error())
+	}
+
+	client, err := NewSlotClient(addrs[:1])
+	if err != nil {
+		t.Fatal("Client error", err.Error())
+	}
+	defer client.Close()
+
+	for i := 0; i < 100; i++ {
+		if _, err := client.Do(fmt.Sprintf("SET key%d value%d", i, i)); err != nil {
+			t.Fatal("Set error", err.Error())
+		}
+	}
+	if n := len(caches[0].Keys()) + len(caches[1].Keys()); n != 100 || len(caches[1].Keys()) == 0 {
+		t.Fatal("Incorrect distribution", "expected", 100, "got", len(caches[0].Keys()), len(caches[1].Keys()))
+	}
+
+	//cached slot map is stale after migration, client follows MOVED
+	slot := protocol.KeySlot("foo")
+	client.Do("SET foo bar")
+	if client.Node("foo") != addrs[1] {
+		t.Fatal("Incorrect slot owner", "expected", addrs[1], "got", client.Node("foo"))
+	}
+	if _, err := nodes[1].MigrateSlot(slot, addrs[0]); err != nil {
+		t.Fatal("Migrate error", err.Error())
+	}
+
+	data, err := client.Do("GET foo")
+	if err != nil || data != "bar" {
+		t.Fatal("Incorrect response", "expected", "bar", "got", data, err)
+	}
+	if client.Node("foo") != addrs[0] {
+		t.Fatal("Incorrect updated slot owner", "expected", addrs[0], "got", client.Node("foo"))
+	}
+
+	if _, err := client.Do("GET missing"); err != NotFoundErr {
+		t.Fatal("Incorrect response", "expected", NotFoundErr, "got", err)
+	}
+}
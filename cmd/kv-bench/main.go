@@ -183,12 +183,10 @@ func main() {
 
 	if *number <= 0 {
 		panic("invalid number")
-		return
 	}
 
 	if *clients <= 0 || *number < *clients {
 		panic("invalid kvClient number")
-		return
 	}
 
 	loop = *number / *clients
@@ -200,7 +198,6 @@ func main() {
 	kvClient = client.NewClient(*ip, *port)
 	kvClient.Do("KEYS")
 
-
 	ts := strings.Split(*tests, ",")
 
 	for i := 0; i < *round; i++ {
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/server"
+)
+
+const (
+	envPrefix = "KV_"
+)
+
+var (
+	// commandLine are flags set by command line, they are not changed by config reload
+	commandLine = map[string]bool{}
+)
+
+// loadConfig sets flags which are not set by command line from environment variables and JSON config file.
+// Config file is an object of flag names and values, environment variable of flag is KV_<FLAG_NAME>
+// with "-" replaced by "_". Command line flags win over environment variables, environment variables
+// win over config file
+func loadConfig(path string) error {
+	flag.Visit(func(f *flag.Flag) {
+		commandLine[f.Name] = true
+	})
+
+	values, err := configValues(path)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range values {
+		if commandLine[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("Incorrect %s value %q: %s", name, value, err.Error())
+		}
+	}
+	return validateConfig()
+}
+
+// reloadConfig applies runtime tunable values of config file and environment variables,
+// changes of other options are logged as ignored until restart
+func reloadConfig(cache *kv.CacheDb, path string) error {
+	values, err := configValues(path)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range values {
+		if commandLine[name] {
+			continue
+		}
+		if _, ok := server.GetConfig(cache, name); !ok {
+			if value != flag.Lookup(name).Value.String() {
+				slog.Warn("Config option change requires restart", "option", name, "value", value)
+			}
+			continue
+		}
+		if err := server.SetConfig(cache, name, value); err != nil {
+			return fmt.Errorf("Incorrect %s value %q: %s", name, value, err.Error())
+		}
+	}
+	return nil
+}
+
+// configValues returns flag values of config file overridden by environment variables
+func configValues(path string) (map[string]string, error) {
+	values := map[string]string{}
+	if path != "" {
+		var err error
+		if values, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			values[f.Name] = value
+		}
+	})
+	return values, nil
+}
+
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// readConfigFile returns flag values of config file, list value is joined by ","
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.UseNumber()
+	raw := map[string]interface{}{}
+	if err := d.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("Incorrect config file %s: %s", path, err.Error())
+	}
+
+	values := map[string]string{}
+	for name, v := range raw {
+		if flag.Lookup(name) == nil || name == "config" || name == "hash-password" {
+			return nil, fmt.Errorf("Unknown config option %s", name)
+		}
+
+		value, err := configValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("Incorrect %s value: %s", name, err.Error())
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func configValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case []interface{}:
+		elems := make([]string, len(value))
+		for i, elem := range value {
+			s, ok := elem.(string)
+			if !ok {
+				return "", fmt.Errorf("list elements must be strings")
+			}
+			elems[i] = s
+		}
+		return strings.Join(elems, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// validateConfig checks flag values which are not checked on server start
+func validateConfig() error {
+	for name, port := range map[string]int{"http-port": *httpPort, "tcp-port": *tcpPort, "tcp-port-ncat": *tcpPortNcat} {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("Incorrect %s %d, port must be in range 1-65535", name, port)
+		}
+	}
+
+	if *secure && (*certPath == "" || *keyPath == "") {
+		return fmt.Errorf("Secure mode requires cert-path and key-path")
+	}
+	if *maxConnections < 0 {
+		return fmt.Errorf("Incorrect max-connections %d, it must not be negative", *maxConnections)
+	}
+	if *slowLogMaxLen < 0 {
+		return fmt.Errorf("Incorrect slowlog-max-len %d, it must not be negative", *slowLogMaxLen)
+	}
+	if *expireInterval <= 0 {
+		return fmt.Errorf("Incorrect expire-interval %s, it must be positive", *expireInterval)
+	}
+	if *idleTimeout < 0 || *shutdownTimeout < 0 {
+		return fmt.Errorf("Incorrect timeout, idle-timeout and shutdown-timeout must not be negative")
+	}
+	if *raftPeers != "" {
+		if peers := strings.Split(*raftPeers, ","); *raftID < 0 || *raftID >= len(peers) {
+			return fmt.Errorf("Incorrect raft-id %d, it must be index of raft-peers", *raftID)
+		}
+		if *raftDir == "" {
+			return fmt.Errorf("Raft mode requires not empty raft-dir")
+		}
+		if *snapshotPath != "" {
+			return fmt.Errorf("Raft mode does not use snapshot-path, cache is restored from raft-dir")
+		}
+		if *raftSecure && (*raftCAPath == "" || *raftCertPath == "" || *raftKeyPath == "") {
+			return fmt.Errorf("Raft secure mode requires raft-ca-path, raft-cert-path and raft-key-path")
+		}
+	}
+	if *logFormat != "text" && *logFormat != "json" {
+		return fmt.Errorf("Incorrect log-format %s, it must be text or json", *logFormat)
+	}
+	return nil
+}
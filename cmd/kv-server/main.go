@@ -1,15 +1,29 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/2tvenom/kv/kv"
 	"github.com/2tvenom/kv/server"
 )
 
 var (
+	configPath  = flag.String("config", "", "JSON config file of flag values, command line flags and KV_<FLAG_NAME> environment variables override it")
 	httpPort    = flag.Int("http-port", 4500, "Http server port")
 	httpAddr    = flag.String("http-addr", "127.0.0.1", "Http server listen address")
 	useHttp     = flag.Bool("use-http", true, "Use http server")
@@ -21,15 +35,204 @@ var (
 	tcpAddr     = flag.String("tcp-addr", "127.0.0.1", "TCP server listen address")
 	certPath    = flag.String("cert-path", "", "Server cert path")
 	keyPath     = flag.String("key-path", "", "Server key path")
+	wsOrigins   = flag.String("ws-origins", "", "Origins allowed to open websocket events of other host pages: origin[,origin...], * allows every origin")
+
+	notifyKeyspaceEvents = flag.String("notify-keyspace-events", "", "Keyspace notification classes: K - keyspace, E - keyevent, g - remove, s - set, l - setlist, d - setdict, t - stream, x - expired, A - all events")
+	expireInterval       = flag.Duration("expire-interval", 100*time.Millisecond, "Active expiration cycle interval")
+	replicaOf            = flag.String("replica-of", "", "Primary binary tcp server address host:port, server is read only replica of primary")
+	replicaUser          = flag.String("replica-user", "", "User of replica connection to primary with users-file, user requires admin and dangerous categories")
+	replicaPasswordFile  = flag.String("replica-password-file", "", "File of password of replica-user")
+	replicaSecure        = flag.Bool("replica-secure", false, "Connect to -secure primary by TLS")
+	replicaCAPath        = flag.String("replica-ca-path", "", "CA certificate of primary certificate, system roots are used if empty")
+	replicaCertPath      = flag.String("replica-cert-path", "", "Replica client cert path, -secure primary requires client certificate")
+	replicaKeyPath       = flag.String("replica-key-path", "", "Replica client key path")
+	cluster              = flag.Bool("cluster", false, "Enable cluster mode, node is announced by tcp-addr and tcp-port")
+	clusterSlots         = flag.String("cluster-slots", "", "Hash slots served by node: from-to[,from-to...]")
+	clusterMeet          = flag.String("cluster-meet", "", "Cluster node address host:port to join")
+	clusterSecretFile    = flag.String("cluster-secret-file", "", "File of secret shared by cluster nodes, connections of nodes are authenticated by it, required with users-file")
+	raftPeers            = flag.String("raft-peers", "", "Raft group members addresses host:port[,host:port...], write commands are replicated by Raft")
+	raftID               = flag.Int("raft-id", 0, "Index of this server in raft-peers")
+	raftDir              = flag.String("raft-dir", "", "Directory of raft log and snapshot, required with raft-peers")
+	raftSecretFile       = flag.String("raft-secret-file", "", "File of secret shared by raft members, connections of members are authenticated by it, required with users-file")
+	raftSecure           = flag.Bool("raft-secure", false, "Connect raft members by TLS, members verify certificates of each other")
+	raftCAPath           = flag.String("raft-ca-path", "", "CA certificate of raft members certificates")
+	raftCertPath         = flag.String("raft-cert-path", "", "Raft member cert path, certificate is used by listener and by connections to other members")
+	raftKeyPath          = flag.String("raft-key-path", "", "Raft member key path")
+	snapshotPath         = flag.String("snapshot-path", "", "Cache snapshot file, snapshot is loaded on start and saved on shutdown")
+	shutdownTimeout      = flag.Duration("shutdown-timeout", 10*time.Second, "Time to finish requests in progress on SIGTERM or SIGINT")
+	maxConnections       = flag.Int("max-connections", 0, "Maximum open connections count of every tcp server, 0 is unlimited")
+	idleTimeout          = flag.Duration("idle-timeout", time.Minute, "Tcp connection timeout of waiting for the next request and of response write, 0 disables timeout")
+	slowLogThreshold     = flag.Duration("slowlog-threshold", 10*time.Millisecond, "Execution duration of commands logged by slow log, 0 logs every command, negative disables slow log")
+	slowLogMaxLen        = flag.Int("slowlog-max-len", 128, "Maximum count of slow log entries")
+	logLevel             = flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	logFormat            = flag.String("log-format", "text", "Log format: text or json")
+	logRequests          = flag.Bool("log-requests", false, "Log every command at debug level, command values are redacted")
+	usersFile            = flag.String("users-file", "", "JSON users file of credentials and permissions, connections must be authenticated by AUTH command, HTTP Basic or Bearer authorization or TLS client certificate")
+	hashPassword         = flag.Bool("hash-password", false, "Print hash of password read from stdin for users file and exit")
+)
+
+type (
+	shutdowner interface {
+		Shutdown(ctx context.Context) error
+	}
+
+	// tlsReloader is a server started by ListenSecure
+	tlsReloader interface {
+		ReloadTLS() error
+	}
+
+	// limiter is a tcp server with runtime tunable limits
+	limiter interface {
+		SetIdleTimeout(timeout time.Duration)
+		IdleTimeout() time.Duration
+		SetMaxConnections(n int)
+		MaxConnections() int
+	}
 )
 
 func main() {
 	flag.Parse()
+	if *hashPassword {
+		printPasswordHash()
+		return
+	}
+
+	path := *configPath
+	if path == "" {
+		path = os.Getenv(envName("config"))
+	}
+	if err := loadConfig(path); err != nil {
+		fatal("Config error", err)
+	}
 	cache := kv.NewCacheDb()
 
+	level := &slog.LevelVar{}
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fatal("Config error", err)
+	}
+	logger := newLogger(level, *logFormat)
+	slog.SetDefault(logger)
+	server.SetLogger(cache, logger)
+	server.SetLogRequests(cache, *logRequests)
+
+	if *snapshotPath != "" {
+		if err := server.LoadSnapshot(cache, *snapshotPath); err != nil {
+			fatal("Snapshot load error", err)
+		}
+	}
+
+	stopExpire := make(chan struct{})
+	go cache.ActiveExpire(*expireInterval, stopExpire)
+
+	server.SetSlowLog(cache, *slowLogThreshold, *slowLogMaxLen)
+
+	if *usersFile != "" {
+		if err := server.LoadUsers(cache, *usersFile); err != nil {
+			fatal("Users file error", err)
+		}
+	}
+
+	if err := server.SetKeyspaceEvents(cache, *notifyKeyspaceEvents); err != nil {
+		fatal("Keyspace events error", err)
+	}
+
+	//closers are called on shutdown after servers are stopped
+	closers := []func(){}
+	if *replicaOf != "" {
+		tlsConfig, err := replicaTLS()
+		if err != nil {
+			fatal("Replica TLS error", err)
+		}
+		password := ""
+		if *replicaPasswordFile != "" {
+			data, err := os.ReadFile(*replicaPasswordFile)
+			if err != nil {
+				fatal("Replica password error", err)
+			}
+			password = strings.TrimSpace(string(data))
+		}
+		if *replicaUser != "" && password == "" {
+			fatal("Replica password error", fmt.Errorf("Replica user requires not empty replica-password-file"))
+		}
+		closers = append(closers, server.ReplicaOf(cache, *replicaOf, tlsConfig, *replicaUser, password).Close)
+	}
+
+	if *cluster {
+		node := server.EnableCluster(cache, net.JoinHostPort(*tcpAddr, strconv.Itoa(*tcpPort)))
+		closers = append(closers, node.Close)
+		secret := ""
+		if *clusterSecretFile != "" {
+			data, err := os.ReadFile(*clusterSecretFile)
+			if err != nil {
+				fatal("Cluster secret error", err)
+			}
+			secret = strings.TrimSpace(string(data))
+		}
+		if secret == "" && *usersFile != "" {
+			fatal("Cluster secret error", fmt.Errorf("Cluster with users requires not empty cluster-secret-file"))
+		}
+		node.SetSecret(secret)
+		if *clusterSlots != "" {
+			for _, slots := range strings.Split(*clusterSlots, ",") {
+				from, to, _ := strings.Cut(slots, "-")
+				if to == "" {
+					to = from
+				}
+
+				fromSlot, errFrom := strconv.ParseUint(from, 10, 16)
+				toSlot, errTo := strconv.ParseUint(to, 10, 16)
+				if errFrom != nil || errTo != nil {
+					fatal("Cluster slots error", fmt.Errorf("Incorrect cluster slots %s", slots))
+				}
+				if err := node.AddSlots(uint16(fromSlot), uint16(toSlot)); err != nil {
+					fatal("Cluster slots error", err)
+				}
+			}
+		}
+
+		if *clusterMeet != "" {
+			if err := node.Meet(*clusterMeet); err != nil {
+				fatal("Cluster meet error", err)
+			}
+		}
+	}
+
+	if *raftPeers != "" {
+		tlsConfig, err := raftTLS()
+		if err != nil {
+			fatal("Raft TLS error", err)
+		}
+		secret := ""
+		if *raftSecretFile != "" {
+			data, err := os.ReadFile(*raftSecretFile)
+			if err != nil {
+				fatal("Raft secret error", err)
+			}
+			secret = strings.TrimSpace(string(data))
+		}
+		if secret == "" && *usersFile != "" {
+			fatal("Raft secret error", fmt.Errorf("Raft with users requires not empty raft-secret-file"))
+		}
+		node, err := server.StartRaft(cache, strings.Split(*raftPeers, ","), *raftID, *raftDir, secret, tlsConfig)
+		if err != nil {
+			fatal("Raft error", err)
+		}
+		closers = append(closers, node.Close)
+	}
+
+	servers := []shutdowner{}
+	limiters := []limiter{}
+	reloaders := []tlsReloader{}
 	w := sync.WaitGroup{}
 	if *useHttp {
 		httpServer := server.NewHttpServer(cache, *httpAddr, *httpPort)
+		if *wsOrigins != "" {
+			httpServer.SetWebsocketOrigins(strings.Split(*wsOrigins, ","))
+		}
+		servers = append(servers, httpServer)
+		if *secure {
+			reloaders = append(reloaders, httpServer)
+		}
 		w.Add(1)
 		go func() {
 			var err error
@@ -38,8 +241,8 @@ func main() {
 			} else {
 				err = httpServer.Listen()
 			}
-			if err != nil {
-				log.Fatalf("Http server error: %s", err.Error())
+			if err != nil && err != server.ErrServerClosed {
+				fatal("Http server error", err)
 			}
 			w.Done()
 		}()
@@ -50,12 +253,16 @@ func main() {
 
 		tcpServer := server.NewTcpServer(cache, *tcpAddr, *tcpPortNcat)
 		tcpServer.IsHuman(true)
+		tcpServer.SetMaxConnections(*maxConnections)
+		tcpServer.SetIdleTimeout(*idleTimeout)
+		servers = append(servers, tcpServer)
+		limiters = append(limiters, tcpServer)
 
 		go func() {
 			err := tcpServer.Listen()
 
-			if err != nil {
-				log.Fatalf("TCP server error: %s", err.Error())
+			if err != nil && err != server.ErrServerClosed {
+				fatal("TCP server error", err)
 			}
 			w.Done()
 		}()
@@ -65,6 +272,13 @@ func main() {
 		w.Add(1)
 
 		tcpServer := server.NewTcpServer(cache, *tcpAddr, *tcpPort)
+		tcpServer.SetMaxConnections(*maxConnections)
+		tcpServer.SetIdleTimeout(*idleTimeout)
+		servers = append(servers, tcpServer)
+		limiters = append(limiters, tcpServer)
+		if *secure {
+			reloaders = append(reloaders, tcpServer)
+		}
 
 		go func() {
 			var err error
@@ -74,12 +288,199 @@ func main() {
 				err = tcpServer.Listen()
 			}
 
-			if err != nil {
-				log.Fatalf("TCP server error: %s", err.Error())
+			if err != nil && err != server.ErrServerClosed {
+				fatal("TCP server error", err)
 			}
 			w.Done()
 		}()
 	}
 
+	setConfigParams(cache, level, limiters)
+
+	//SIGHUP reloads certificates, users and runtime tunable config, connections are not dropped
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reload(cache, path, reloaders)
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	logger.Info("Shutdown", "signal", (<-sig).String())
+	//the second signal terminates server immediately
+	signal.Stop(sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	for _, s := range servers {
+		w.Add(1)
+		go func(s shutdowner) {
+			if err := s.Shutdown(ctx); err != nil {
+				logger.Error("Shutdown error", "err", err)
+			}
+			w.Done()
+		}(s)
+	}
 	w.Wait()
+
+	for _, closer := range closers {
+		closer()
+	}
+	close(stopExpire)
+
+	if *snapshotPath != "" {
+		if err := server.SaveSnapshot(cache, *snapshotPath); err != nil {
+			fatal("Snapshot save error", err)
+		}
+	}
+}
+
+// reload reloads certificates of secure servers, users and config, errors keep previous certificates, users and values.
+// Reloaded permissions apply to authenticated connections
+func reload(cache *kv.CacheDb, path string, reloaders []tlsReloader) {
+	for _, r := range reloaders {
+		if err := r.ReloadTLS(); err != nil {
+			slog.Error("Certificate reload error", "err", err)
+		}
+	}
+	if *usersFile != "" {
+		if err := server.LoadUsers(cache, *usersFile); err != nil {
+			slog.Error("Users file reload error", "err", err)
+		}
+	}
+	if err := reloadConfig(cache, path); err != nil {
+		slog.Error("Config reload error", "err", err)
+	}
+	slog.Info("Reloaded")
+}
+
+// printPasswordHash prints hash of the first stdin line
+func printPasswordHash() {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fatal("Password read error", err)
+	}
+	hash, err := server.HashPassword(strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		fatal("Password hash error", err)
+	}
+	fmt.Println(hash)
+}
+
+// replicaTLS returns TLS config of replica connection to -secure primary, nil if replica-secure is not set
+func replicaTLS() (*tls.Config, error) {
+	if !*replicaSecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if *replicaCAPath != "" {
+		caCert, err := os.ReadFile(*replicaCAPath)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("Incorrect replica CA certificate %s", *replicaCAPath)
+		}
+	}
+	if *replicaCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(*replicaCertPath, *replicaKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// raftTLS returns TLS config of raft members, member certificate is verified by listener and dialer
+func raftTLS() (*tls.Config, error) {
+	if !*raftSecure {
+		return nil, nil
+	}
+
+	caCert, err := os.ReadFile(*raftCAPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("Incorrect raft CA certificate %s", *raftCAPath)
+	}
+	cert, err := tls.LoadX509KeyPair(*raftCertPath, *raftKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// newLogger returns logger of text or json format which writes records of level and above to stderr
+func newLogger(level *slog.LevelVar, format string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, options))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, options))
+}
+
+// setConfigParams registers runtime tunable log level and tcp servers limits of CONFIG SET
+func setConfigParams(cache *kv.CacheDb, level *slog.LevelVar, limiters []limiter) {
+	server.SetConfigParam(cache, "log-level", server.ConfigParam{
+		Get: func() string {
+			return strings.ToLower(level.Level().String())
+		},
+		Set: func(value string) error {
+			return level.UnmarshalText([]byte(value))
+		},
+	})
+
+	if len(limiters) == 0 {
+		return
+	}
+
+	server.SetConfigParam(cache, "idle-timeout", server.ConfigParam{
+		Get: func() string {
+			return limiters[0].IdleTimeout().String()
+		},
+		Set: func(value string) error {
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout < 0 {
+				return fmt.Errorf("Incorrect idle-timeout %s", value)
+			}
+			for _, l := range limiters {
+				l.SetIdleTimeout(timeout)
+			}
+			return nil
+		},
+	})
+	server.SetConfigParam(cache, "max-connections", server.ConfigParam{
+		Get: func() string {
+			return strconv.Itoa(limiters[0].MaxConnections())
+		},
+		Set: func(value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("Incorrect max-connections %s", value)
+			}
+			for _, l := range limiters {
+				l.SetMaxConnections(n)
+			}
+			return nil
+		},
+	})
+}
+
+// fatal logs error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -12,7 +13,17 @@ import (
 type (
 	CacheDb struct {
 		blocks [blocks]map[string][]byte
-		locks  [blocks]sync.RWMutex
+		locks  [blocks]blockLock
+
+		events       eventBus
+		expireCursor uint32
+		waiters      popWaiters
+
+		expired atomic.Uint64
+
+		// attached is a state of cache user, see Attached
+		attachOnce sync.Once
+		attached   interface{}
 	}
 )
 
@@ -28,6 +39,15 @@ func NewCacheDb() *CacheDb {
 	return c
 }
 
+// Attached returns value attached to cache, value is created by init on the first call.
+// Server keeps its state of cache by it for cache lifetime
+func (c *CacheDb) Attached(init func() interface{}) interface{} {
+	c.attachOnce.Do(func() {
+		c.attached = init()
+	})
+	return c.attached
+}
+
 func (c *CacheDb) Keys() []string {
 	out := []string{}
 	for i, block := range c.blocks {
@@ -43,60 +63,126 @@ func (c *CacheDb) Keys() []string {
 func (c *CacheDb) Remove(key string) {
 	id := blockByKey(key)
 	c.locks[id].Lock()
+	data, ok := c.blocks[id][key]
 	delete(c.blocks[id], key)
 	c.locks[id].Unlock()
+
+	if ok {
+		c.emit(EventRemove, key, readEntry(data).keyType)
+	}
+}
+
+// Exists returns true if key exists and is not expired, value is not copied
+func (c *CacheDb) Exists(key string) bool {
+	id := blockByKey(key)
+	c.locks[id].RLock()
+	data, ok := c.blocks[id][key]
+	ok = ok && !readEntry(data).expired(time.Now().Unix())
+	c.locks[id].RUnlock()
+	return ok
 }
 
 func (c *CacheDb) get(key string, keyType uint8) ([]byte, error) {
 	id := blockByKey(key)
 	c.locks[id].RLock()
-	if data, ok := c.blocks[id][key]; ok {
-		header := make([]byte, headerLen)
-		copy(header, data[:headerLen])
-		entry := (*entry)(unsafe.Pointer(&header[0]))
-		if entry.keyType != keyType {
-			return nil, incorrectSelectKeyType
-		}
-		now := time.Now().Unix()
-
-		if entry.ttl > 0 && entry.ttl <= uint64(now) {
-			c.locks[id].RUnlock()
-			c.locks[id].Lock()
-			delete(c.blocks[id], key)
-			c.locks[id].Unlock()
-			return nil, notFoundErr
-		}
-		out := make([]byte, entry.length)
-		copy(out, data[headerLen:])
+	data, ok := c.blocks[id][key]
+	if !ok {
 		c.locks[id].RUnlock()
-		return out, nil
-	} else {
+		return nil, ErrNotFound
+	}
+
+	entry := readEntry(data)
+	if entry.expired(time.Now().Unix()) {
+		c.locks[id].RUnlock()
+		c.expire(id, key)
+		return nil, ErrNotFound
+	}
+
+	if entry.keyType != keyType {
 		c.locks[id].RUnlock()
-		return nil, notFoundErr
+		return nil, ErrWrongType
 	}
+
+	out := make([]byte, entry.length)
+	copy(out, data[headerLen:])
+	c.locks[id].RUnlock()
+	return out, nil
 }
 
-func (c *CacheDb) set(key string, keyType uint8, ttl int64, value []byte) error {
-	elem := &entry{uint64(len(value)), getTTL(ttl), keyType}
-	data := *(*[headerLen]byte)(unsafe.Pointer(elem))
+// expire removes expired key, key is checked again because it could be overwritten between locks.
+// Returns false if key is not removed
+func (c *CacheDb) expire(id uint8, key string) bool {
+	c.locks[id].Lock()
+	data, ok := c.blocks[id][key]
+	if !ok {
+		c.locks[id].Unlock()
+		return false
+	}
 
-	nVal := make([]byte, len(value))
-	copy(nVal, value)
+	entry := readEntry(data)
+	if !entry.expired(time.Now().Unix()) {
+		c.locks[id].Unlock()
+		return false
+	}
+
+	delete(c.blocks[id], key)
+	c.locks[id].Unlock()
+	c.emit(EventExpire, key, entry.keyType)
+	return true
+}
+
+func (c *CacheDb) set(key string, keyType uint8, ttl int64, value []byte) error {
+	data := newEntry(keyType, getTTL(ttl), value)
 
 	id := blockByKey(key)
 	c.locks[id].Lock()
-	c.blocks[id][key] = append(data[:], nVal...)
+	c.blocks[id][key] = data
 	c.locks[id].Unlock()
+
+	c.emit(EventSet, key, keyType)
 	return nil
 }
 
+// newEntry returns record of header and value copy
+func newEntry(keyType uint8, ttl uint64, value []byte) []byte {
+	elem := &entry{uint64(len(value)), ttl, keyType}
+	header := *(*[headerLen]byte)(unsafe.Pointer(elem))
+
+	data := make([]byte, headerLen+len(value))
+	copy(data, header[:])
+	copy(data[headerLen:], value)
+	return data
+}
+
+// setValueLength updates value length in header of entry data changed in place
+func setValueLength(data []byte) {
+	elem := readEntry(data)
+	elem.length = uint64(len(data) - headerLen)
+	header := *(*[headerLen]byte)(unsafe.Pointer(&elem))
+	copy(data, header[:])
+}
+
 func (c *CacheDb) setList(key string, keyType uint8, ttl int64, values [][]byte) error {
+	buff, err := encodeList(keyType, values)
+	if err != nil {
+		return err
+	}
+
+	return c.set(key, keyType, ttl, buff)
+}
+
+// encodeList encodes list or dictionary elements:
+// elements count, elements lengths and elements data
+func encodeList(keyType uint8, values [][]byte) ([]byte, error) {
 	if len(values) > maxListElemennts {
-		return tooMatchListElementsErr
+		return nil, tooMatchListElementsErr
 	}
 	off := (len(values) * 2) + 2
 	lenBuff := off
 	for _, val := range values {
+		if len(val)+2 > maxElementLength {
+			return nil, tooLargeElementErr
+		}
 		lenBuff += len(val)
 	}
 
@@ -129,7 +215,7 @@ func (c *CacheDb) setList(key string, keyType uint8, ttl int64, values [][]byte)
 		off += elemLen
 	}
 
-	return c.set(key, keyType, ttl, buff)
+	return buff, nil
 }
 
 func (c *CacheDb) SetList(key string, ttl int64, values [][]byte) error {
@@ -150,6 +236,11 @@ func (c *CacheDb) getList(key string, keyType uint8) ([][]byte, error) {
 		return nil, err
 	}
 
+	return decodeList(data), nil
+}
+
+// decodeList returns copies of elements encoded by encodeList
+func decodeList(data []byte) [][]byte {
 	elemCount := uint16UnsafeConvert(data)
 	out := make([][]byte, elemCount)
 
@@ -162,7 +253,7 @@ func (c *CacheDb) getList(key string, keyType uint8) ([][]byte, error) {
 		off += elemLen
 	}
 
-	return out, nil
+	return out
 }
 
 func (c *CacheDb) GetList(key string) ([][]byte, error) {
@@ -221,10 +312,10 @@ func (c *CacheDb) GetDictElement(key string, dictKey []byte) ([]byte, error) {
 		if bytes.Equal(data[off+2:off+2+separatorPosition], dictKey) {
 			return data[off+2+1+separatorPosition: off+elemLen], nil
 		} else {
-			return nil, notFoundErr
+			return nil, ErrNotFound
 		}
 	} else {
-		return nil, notFoundErr
+		return nil, ErrNotFound
 	}
 }
 
@@ -242,7 +333,7 @@ func sliceUnsafeConvert(val uint16) []byte {
 func getElemByPosition(data []byte, position uint16) (uint64, uint64, error) {
 	elemCount := uint16UnsafeConvert(data)
 	if position >= elemCount {
-		return 0, 0, notFoundErr
+		return 0, 0, ErrNotFound
 	}
 
 	off := uint64(elemCount)*2 + 2
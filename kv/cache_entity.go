@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"time"
+	"unsafe"
 )
 
 type (
@@ -13,6 +14,12 @@ type (
 		ttl     uint64
 		keyType uint8
 	}
+
+	// Error is a detailed error of one of Err* kinds, errors.Is matches its kind
+	Error struct {
+		Kind    error
+		Message string
+	}
 )
 
 const (
@@ -20,19 +27,62 @@ const (
 
 	headerLen        = 17
 	maxListElemennts = (1 << 16) - 1
+	maxElementLength = (1 << 16) - 1
 
 	keyString = 1
 	keyList   = 2
 	keyDict   = 3
+	keyStream = 4
 )
 
 var (
-	notFoundErr             = errors.New("Not found")
-	incorrectSelectKeyType  = errors.New("Incorrect select key type")
-	incorrectDictElementErr = errors.New("Incorrect dictionary element")
-	tooMatchListElementsErr = errors.New(fmt.Sprintf("Maximum list/distionary elements is %d", maxListElemennts))
+	ErrNotFound   = errors.New("Not found")
+	ErrWrongType  = errors.New("Incorrect select key type")
+	ErrBadRequest = errors.New("Bad request")
+	ErrTooLarge   = errors.New("Too large")
+
+	incorrectDictElementErr = NewError(ErrBadRequest, "Incorrect dictionary element")
+	tooMatchListElementsErr = NewError(ErrTooLarge, fmt.Sprintf("Maximum list/distionary elements is %d", maxListElemennts))
+	tooLargeElementErr      = NewError(ErrTooLarge, fmt.Sprintf("Maximum list/distionary element length is %d", maxElementLength-2))
 )
 
+func NewError(kind error, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+func readEntry(data []byte) entry {
+	header := make([]byte, headerLen)
+	copy(header, data[:headerLen])
+	return *(*entry)(unsafe.Pointer(&header[0]))
+}
+
+func (e entry) expired(now int64) bool {
+	return e.ttl > 0 && e.ttl <= uint64(now)
+}
+
+func keyTypeName(keyType uint8) string {
+	switch keyType {
+	case keyString:
+		return "string"
+	case keyList:
+		return "list"
+	case keyDict:
+		return "dict"
+	case keyStream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
 func blockByKey(key string) uint8 {
 	hash := fnv.New64()
 	hash.Write([]byte(key))
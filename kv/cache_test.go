@@ -1,6 +1,7 @@
 package kv
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -26,15 +27,44 @@ func TestGetSetTTLSimpleCache(t *testing.T) {
 
 	val := "baz"
 	cache.Set("foo", 2, []byte(val))
+	if !cache.Exists("foo") {
+		t.Fatal("Expected existing key")
+	}
 	time.Sleep(time.Second * 3)
 
+	if cache.Exists("foo") || cache.Exists("unknown") {
+		t.Fatal("Expected not existing key")
+	}
+
 	data, err := cache.Get("foo")
 	if err == nil {
 		t.Fatal("Expected Error", "got nil", "Data", data)
 	}
 
-	if err != notFoundErr {
-		t.Fatal("Incorrect Error", "expected", notFoundErr, "got", err)
+	if err != ErrNotFound {
+		t.Fatal("Incorrect Error", "expected", ErrNotFound, "got", err)
+	}
+}
+
+func TestIncorrectTypeUnlock(t *testing.T) {
+	cache := NewCacheDb()
+	cache.Set("foo", 0, []byte("baz"))
+
+	if _, err := cache.GetList("foo"); err != ErrWrongType {
+		t.Fatal("Incorrect Error", "expected", ErrWrongType, "got", err)
+	}
+
+	//read lock of key block is released after type error, write does not wait forever
+	done := make(chan struct{})
+	go func() {
+		cache.Set("foo", 0, []byte("bar"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Set is blocked by read lock of incorrect type get")
 	}
 }
 
@@ -77,8 +107,8 @@ func TestGetSetListCache(t *testing.T) {
 	}
 
 	_, err = cache.GetListElement("foo", 6)
-	if err != notFoundErr {
-		t.Fatal("Expected Error", notFoundErr.Error(), "got", err)
+	if err != ErrNotFound {
+		t.Fatal("Expected Error", ErrNotFound.Error(), "got", err)
 	}
 }
 
@@ -127,8 +157,8 @@ func TestGetSetDictCache(t *testing.T) {
 	}
 
 	_, err = cache.GetDictElement("foo", []byte("hello"))
-	if err != notFoundErr {
-		t.Fatal("Expected Error", notFoundErr.Error(), "got", err)
+	if err != ErrNotFound {
+		t.Fatal("Expected Error", ErrNotFound.Error(), "got", err)
 	}
 }
 
@@ -371,3 +401,76 @@ func BenchmarkGetDictElemParallel(b *testing.B) {
 		}
 	})
 }
+
+func TestIterators(t *testing.T) {
+	cache := NewCacheDb()
+
+	list := []string{"baz", "bar", "foo"}
+	cache.SetList("list", 0, [][]byte{[]byte("baz"), []byte("bar"), []byte("foo")})
+	cache.SetDict("dict", 0, [][]byte{[]byte("foo:baz"), []byte("bar:BAR")})
+
+	it, err := cache.ListIterator("list")
+	if err != nil {
+		t.Fatal("Get key Error", err.Error())
+	}
+
+	i := 0
+	for it.Next() {
+		if string(it.Elem()) != list[i] {
+			t.Fatal("Incorrect element", "expected", list[i], "got", string(it.Elem()))
+		}
+		i++
+	}
+
+	if i != len(list) {
+		t.Fatal("Incorrect elements count", "expected", len(list), "got", i)
+	}
+
+	it, err = cache.DictIterator("dict")
+	if err != nil {
+		t.Fatal("Get key Error", err.Error())
+	}
+
+	dict := [][2]string{{"bar", "BAR"}, {"foo", "baz"}}
+	i = 0
+	for it.Next() {
+		k, v := it.Field()
+		if string(k) != dict[i][0] || string(v) != dict[i][1] {
+			t.Fatal("Incorrect element", "expected", dict[i], "got", string(k), string(v))
+		}
+		i++
+	}
+
+	if _, err = cache.ListIterator("dict"); err != ErrWrongType {
+		t.Fatal("Expected Error", ErrWrongType.Error(), "got", err)
+	}
+
+	keys := 0
+	cache.EachKey(func(key string) error {
+		keys++
+		return nil
+	})
+
+	if keys != 2 {
+		t.Fatal("Incorrect keys count", "expected", 2, "got", keys)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	cache := NewCacheDb()
+
+	err := cache.SetDict("foo", 0, [][]byte{[]byte("foo")})
+	if !errors.Is(err, ErrBadRequest) {
+		t.Fatal("Incorrect Error", "expected", ErrBadRequest, "got", err)
+	}
+
+	err = cache.SetList("foo", 0, [][]byte{make([]byte, maxElementLength)})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatal("Incorrect Error", "expected", ErrTooLarge, "got", err)
+	}
+
+	cache.Set("foo", 0, []byte("bar"))
+	if _, err = cache.GetList("foo"); err != ErrWrongType {
+		t.Fatal("Incorrect Error", "expected", ErrWrongType, "got", err)
+	}
+}
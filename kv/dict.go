@@ -1,6 +1,9 @@
 package kv
 
-import "bytes"
+import (
+	"bytes"
+	"sort"
+)
 
 type (
 	dictionary [][]byte
@@ -19,3 +22,90 @@ func (s dictionary) Swap(i, j int) {
 func (s dictionary) Less(i, j int) bool {
 	return bytes.Compare(s[i][0:bytes.Index(s[i], dictionarySeparator)], s[j][0:bytes.Index(s[j], dictionarySeparator)]) < 0
 }
+
+// search returns position of field in sorted dictionary and true if field exists
+func (s dictionary) search(field []byte) (int, bool) {
+	i := sort.Search(len(s), func(i int) bool {
+		return bytes.Compare(s[i][:bytes.Index(s[i], dictionarySeparator)], field) >= 0
+	})
+	return i, i < len(s) && bytes.Equal(s[i][:bytes.Index(s[i], dictionarySeparator)], field)
+}
+
+// SetDictElement sets value of dictionary field.
+// Dictionary is created if key does not exist, TTL of existing dictionary is kept
+func (c *CacheDb) SetDictElement(key string, field []byte, value []byte) error {
+	if len(field) == 0 || bytes.Contains(field, dictionarySeparator) {
+		return incorrectDictElementErr
+	}
+	elem := append(append(append([]byte{}, field...), dictionarySeparator...), value...)
+
+	id := blockByKey(key)
+	c.locks[id].Lock()
+	elems, ttl, expired, err := c.readElements(id, key, keyDict)
+	if err != nil {
+		c.locks[id].Unlock()
+		return err
+	}
+
+	dict := dictionary(elems)
+	i, ok := dict.search(field)
+	if ok {
+		dict[i] = elem
+	} else {
+		dict = append(dict, nil)
+		copy(dict[i+1:], dict[i:])
+		dict[i] = elem
+	}
+
+	buff, err := encodeList(keyDict, dict)
+	if err != nil {
+		c.locks[id].Unlock()
+		if expired {
+			c.emit(EventExpire, key, keyDict)
+		}
+		return err
+	}
+	c.blocks[id][key] = newEntry(keyDict, ttl, buff)
+	c.locks[id].Unlock()
+
+	if expired {
+		c.emit(EventExpire, key, keyDict)
+	}
+	c.emit(EventSet, key, keyDict)
+	return nil
+}
+
+// RemoveDictElement removes dictionary field, dictionary is removed with its last field.
+// Returns ErrNotFound if dictionary or field does not exist
+func (c *CacheDb) RemoveDictElement(key string, field []byte) error {
+	id := blockByKey(key)
+	c.locks[id].Lock()
+	elems, ttl, expired, err := c.readElements(id, key, keyDict)
+	dict := dictionary(elems)
+	i, ok := dict.search(field)
+	if err != nil || !ok {
+		c.locks[id].Unlock()
+		if expired {
+			c.emit(EventExpire, key, keyDict)
+		}
+		if err == nil {
+			err = ErrNotFound
+		}
+		return err
+	}
+
+	dict = append(dict[:i], dict[i+1:]...)
+	eventType := EventSet
+	if len(dict) == 0 {
+		delete(c.blocks[id], key)
+		eventType = EventRemove
+	} else {
+		//elements are checked by SetDict and SetDictElement
+		buff, _ := encodeList(keyDict, dict)
+		c.blocks[id][key] = newEntry(keyDict, ttl, buff)
+	}
+	c.locks[id].Unlock()
+
+	c.emit(eventType, key, keyDict)
+	return nil
+}
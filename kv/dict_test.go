@@ -2,6 +2,7 @@ package kv
 
 import (
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +23,50 @@ func TestDictionarySort(t *testing.T) {
 	}
 
 }
+
+func TestDictElement(t *testing.T) {
+	cache := NewCacheDb()
+	cache.SetDict("dict", 100, [][]byte{[]byte("b:2"), []byte("d:4")})
+
+	for _, field := range []string{"c", "a", "e", "b"} {
+		if err := cache.SetDictElement("dict", []byte(field), []byte(field+field)); err != nil {
+			t.Fatal("Incorrect set of dictionary element", field, err)
+		}
+	}
+
+	dict, _ := cache.GetDict("dict")
+	got := []string{}
+	for _, elem := range dict {
+		got = append(got, string(elem[2:]))
+	}
+	if strings.Join(got, " ") != "a:aa b:bb c:cc d:4 e:ee" {
+		t.Fatal("Incorrect dictionary", "expected", "a:aa b:bb c:cc d:4 e:ee", "got", strings.Join(got, " "))
+	}
+	if value, err := cache.GetDictElement("dict", []byte("c")); err != nil || string(value) != "cc" {
+		t.Fatal("Incorrect dictionary element", "expected", "cc", "got", string(value), err)
+	}
+	if readEntry(cache.blocks[blockByKey("dict")]["dict"]).ttl == 0 {
+		t.Fatal("Expected kept dictionary ttl")
+	}
+
+	if err := cache.SetDictElement("dict", []byte("a:b"), []byte("1")); err != incorrectDictElementErr {
+		t.Fatal("Incorrect set of field with separator", "expected", incorrectDictElementErr, "got", err)
+	}
+	if err := cache.RemoveDictElement("dict", []byte("x")); err != ErrNotFound {
+		t.Fatal("Incorrect remove of not existing field", "expected", ErrNotFound, "got", err)
+	}
+
+	for _, field := range []string{"a", "b", "c", "d", "e"} {
+		if err := cache.RemoveDictElement("dict", []byte(field)); err != nil {
+			t.Fatal("Incorrect remove of dictionary element", field, err)
+		}
+	}
+	if len(cache.Keys()) != 0 {
+		t.Fatal("Expected removed dictionary", cache.Keys())
+	}
+
+	cache.Set("string", 0, []byte("value"))
+	if err := cache.SetDictElement("string", []byte("a"), []byte("1")); err != ErrWrongType {
+		t.Fatal("Incorrect set of string field", "expected", ErrWrongType, "got", err)
+	}
+}
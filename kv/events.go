@@ -0,0 +1,158 @@
+package kv
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	EventType uint8
+
+	// Event is a keyspace change notification
+	Event struct {
+		Type    EventType
+		Key     string
+		KeyType string
+	}
+
+	// Watcher receives events of keys matched by pattern.
+	// Events are dropped when watcher buffer is full
+	Watcher struct {
+		C <-chan Event
+
+		c       chan Event
+		pattern string
+		cache   *CacheDb
+		dropped uint64
+	}
+
+	eventBus struct {
+		lock     sync.RWMutex
+		count    int32
+		watchers map[*Watcher]struct{}
+	}
+)
+
+const (
+	expireCycleBlocks = 16
+)
+
+const (
+	EventSet EventType = iota + 1
+	EventRemove
+	EventExpire
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventRemove:
+		return "remove"
+	case EventExpire:
+		return "expire"
+	default:
+		return "unknown"
+	}
+}
+
+// Watch subscribes to events of keys matched by glob pattern, see Match
+func (c *CacheDb) Watch(pattern string, buffer int) *Watcher {
+	ch := make(chan Event, buffer)
+	w := &Watcher{C: ch, c: ch, pattern: pattern, cache: c}
+
+	c.events.lock.Lock()
+	if c.events.watchers == nil {
+		c.events.watchers = map[*Watcher]struct{}{}
+	}
+	c.events.watchers[w] = struct{}{}
+	atomic.StoreInt32(&c.events.count, int32(len(c.events.watchers)))
+	c.events.lock.Unlock()
+
+	return w
+}
+
+// Close unsubscribes watcher and closes its channel
+func (w *Watcher) Close() {
+	bus := &w.cache.events
+	bus.lock.Lock()
+	if _, ok := bus.watchers[w]; ok {
+		delete(bus.watchers, w)
+		close(w.c)
+	}
+	atomic.StoreInt32(&bus.count, int32(len(bus.watchers)))
+	bus.lock.Unlock()
+}
+
+// Dropped returns count of events dropped because of full buffer
+func (w *Watcher) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+func (c *CacheDb) emit(eventType EventType, key string, keyType uint8) {
+	if eventType == EventExpire {
+		c.expired.Add(1)
+	}
+
+	if atomic.LoadInt32(&c.events.count) == 0 {
+		return
+	}
+
+	event := Event{Type: eventType, Key: key, KeyType: keyTypeName(keyType)}
+
+	c.events.lock.RLock()
+	for w := range c.events.watchers {
+		if !Match(w.pattern, key) {
+			continue
+		}
+
+		select {
+		case w.c <- event:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+		}
+	}
+	c.events.lock.RUnlock()
+}
+
+// ExpireCycle removes expired keys of next expireCycleBlocks blocks and returns removed keys count.
+// Expired keys are removed on access too, active expiration frees memory of keys which are never accessed
+func (c *CacheDb) ExpireCycle() int {
+	removed := 0
+	now := time.Now().Unix()
+	for i := 0; i < expireCycleBlocks; i++ {
+		id := uint8(atomic.AddUint32(&c.expireCursor, 1))
+
+		expired := []string{}
+		c.locks[id].RLock()
+		for key, data := range c.blocks[id] {
+			if readEntry(data).expired(now) {
+				expired = append(expired, key)
+			}
+		}
+		c.locks[id].RUnlock()
+
+		for _, key := range expired {
+			if c.expire(id, key) {
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
+// ActiveExpire runs ExpireCycle with interval until stop is closed
+func (c *CacheDb) ActiveExpire(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.ExpireCycle()
+		}
+	}
+}
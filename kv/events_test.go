@@ -0,0 +1,93 @@
+package kv
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	cache := NewCacheDb()
+
+	w := cache.Watch("foo*", 10)
+	defer w.Close()
+
+	cache.Set("foo", 1, []byte("bar"))
+	cache.SetList("foolist", 0, [][]byte{[]byte("bar")})
+	cache.Set("bar", 0, []byte("bar"))
+	cache.Remove("foolist")
+	cache.Remove("unknown")
+
+	time.Sleep(time.Second * 2)
+	cache.Get("foo")
+
+	expected := []Event{
+		{EventSet, "foo", "string"},
+		{EventSet, "foolist", "list"},
+		{EventRemove, "foolist", "list"},
+		{EventExpire, "foo", "string"},
+	}
+
+	for _, e := range expected {
+		select {
+		case event := <-w.C:
+			if event != e {
+				t.Fatal("Incorrect event", "expected", e, "got", event)
+			}
+		default:
+			t.Fatal("Expected event", e)
+		}
+	}
+
+	select {
+	case event := <-w.C:
+		t.Fatal("Unexpected event", event)
+	default:
+	}
+
+	full := cache.Watch("*", 1)
+	cache.Set("a", 0, []byte("a"))
+	cache.Set("b", 0, []byte("b"))
+	if full.Dropped() != 1 {
+		t.Fatal("Incorrect dropped events", "expected", 1, "got", full.Dropped())
+	}
+
+	full.Close()
+	if _, ok := <-full.C; !ok {
+		t.Fatal("Expected buffered event")
+	}
+	if _, ok := <-full.C; ok {
+		t.Fatal("Expected closed channel")
+	}
+}
+
+func TestExpireCycle(t *testing.T) {
+	cache := NewCacheDb()
+
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), 1, []byte("value"))
+	}
+	cache.Set("foo", 0, []byte("bar"))
+
+	w := cache.Watch("*", 200)
+	defer w.Close()
+
+	time.Sleep(time.Second * 2)
+
+	removed := 0
+	for i := 0; i < blocks/expireCycleBlocks; i++ {
+		removed += cache.ExpireCycle()
+	}
+
+	if removed != 100 || len(w.C) != 100 {
+		t.Fatal("Incorrect removed keys", "expected", 100, "got", removed, len(w.C))
+	}
+
+	if event := <-w.C; event.Type != EventExpire {
+		t.Fatal("Incorrect event", "expected", EventExpire, "got", event.Type)
+	}
+
+	if keys := cache.Keys(); len(keys) != 1 {
+		t.Fatal("Incorrect keys", "expected", "[foo]", "got", keys)
+	}
+}
@@ -0,0 +1,94 @@
+package kv
+
+// Match reports whether name matches glob pattern.
+// Pattern supports '*' (any sequence), '?' (any byte), '[abc]', '[a-z]', '[^a]' classes
+// and '\' escape. Unlike path.Match '*' matches '/' too
+func Match(pattern string, name string) bool {
+	// position to return on '*' mismatch
+	starP, starN := -1, -1
+	p, n := 0, 0
+
+	for n < len(name) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starN = p, n
+				p++
+				continue
+			case '?':
+				p++
+				n++
+				continue
+			case '[':
+				if matched, end, ok := matchClass(pattern, p, name[n]); ok {
+					if matched {
+						p = end
+						n++
+						continue
+					}
+				} else if name[n] == '[' {
+					p++
+					n++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == name[n] {
+					p += 2
+					n++
+					continue
+				}
+			default:
+				if pattern[p] == name[n] {
+					p++
+					n++
+					continue
+				}
+			}
+		}
+
+		if starP == -1 {
+			return false
+		}
+		starN++
+		p, n = starP+1, starN
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches byte by class started at pattern[start] == '[',
+// returns match result, position after class and false for unclosed class
+func matchClass(pattern string, start int, b byte) (bool, int, bool) {
+	p := start + 1
+	negate := false
+	if p < len(pattern) && pattern[p] == '^' {
+		negate = true
+		p++
+	}
+
+	matched := false
+	for first := true; p < len(pattern); first = false {
+		if pattern[p] == ']' && !first {
+			return matched != negate, p + 1, true
+		}
+
+		lo := pattern[p]
+		if lo == '\\' && p+1 < len(pattern) {
+			p++
+			lo = pattern[p]
+		}
+		hi := lo
+		if p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']' {
+			hi = pattern[p+2]
+			p += 2
+		}
+		if lo <= b && b <= hi {
+			matched = true
+		}
+		p++
+	}
+	return false, 0, false
+}
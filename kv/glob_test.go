@@ -0,0 +1,40 @@
+package kv
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	type (
+		testCase struct {
+			pattern string
+			name    string
+			result  bool
+		}
+	)
+
+	testCases := []*testCase{
+		{"*", "", true},
+		{"*", "foo/bar", true},
+		{"foo", "foo", true},
+		{"foo", "foobar", false},
+		{"foo*", "foobar", true},
+		{"*bar", "foobar", true},
+		{"f*o*r", "foobar", true},
+		{"f*o*z", "foobar", false},
+		{"f?o", "foo", true},
+		{"f?o", "fo", false},
+		{"user:[0-9]*", "user:42", true},
+		{"user:[0-9]*", "user:x", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[ae]llo", "hello", true},
+		{`foo\*`, "foo*", true},
+		{`foo\*`, "foox", false},
+		{"foo[", "foo[", true},
+	}
+
+	for _, tc := range testCases {
+		if Match(tc.pattern, tc.name) != tc.result {
+			t.Fatal("Incorrect match", tc.pattern, tc.name, "expected", tc.result)
+		}
+	}
+}
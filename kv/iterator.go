@@ -0,0 +1,85 @@
+package kv
+
+type (
+	// Iterator walks list or dictionary elements without copying the whole value
+	Iterator struct {
+		data    []byte
+		keyType uint8
+		count   uint16
+		pos     uint16
+		off     uint64
+		elem    []byte
+	}
+)
+
+func (c *CacheDb) iterator(key string, keyType uint8) (*Iterator, error) {
+	data, err := c.get(key, keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	count := uint16UnsafeConvert(data)
+	return &Iterator{
+		data:    data,
+		keyType: keyType,
+		count:   count,
+		off:     uint64(count)*2 + 2,
+	}, nil
+}
+
+func (c *CacheDb) ListIterator(key string) (*Iterator, error) {
+	return c.iterator(key, keyList)
+}
+
+func (c *CacheDb) DictIterator(key string) (*Iterator, error) {
+	return c.iterator(key, keyDict)
+}
+
+// EachKey calls fn for every key, block by block. Iteration stops on first fn error
+func (c *CacheDb) EachKey(fn func(key string) error) error {
+	keys := []string{}
+	for i, block := range c.blocks {
+		keys = keys[:0]
+		c.locks[i].RLock()
+		for key := range block {
+			keys = append(keys, key)
+		}
+		c.locks[i].RUnlock()
+
+		for _, key := range keys {
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Len returns elements count
+func (i *Iterator) Len() int {
+	return int(i.count)
+}
+
+func (i *Iterator) Next() bool {
+	if i.pos >= i.count {
+		i.elem = nil
+		return false
+	}
+
+	elemLen := uint64(uint16UnsafeConvert(i.data[i.pos*2+2 : i.pos*2+4]))
+	i.elem = i.data[i.off : i.off+elemLen]
+	i.off += elemLen
+	i.pos++
+	return true
+}
+
+// Elem returns current list element
+func (i *Iterator) Elem() []byte {
+	return i.elem
+}
+
+// Field returns current dictionary element key and value
+func (i *Iterator) Field() ([]byte, []byte) {
+	separatorPosition := uint64(uint16UnsafeConvert(i.elem))
+	return i.elem[2 : separatorPosition+2], i.elem[separatorPosition+2+1:]
+}
@@ -0,0 +1,418 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// popWaiter is a BlockingPop call parked on one or more keys
+	popWaiter struct {
+		left  bool
+		state int32
+		c     chan poppedElem
+	}
+
+	poppedElem struct {
+		key   string
+		value []byte
+	}
+
+	// popWaiters are parked BlockingPop calls by key in arrival order
+	popWaiters struct {
+		lock sync.Mutex
+		keys map[string][]*popWaiter
+	}
+)
+
+const (
+	waiterParked = iota
+	waiterServed
+	waiterCancelled
+)
+
+// Push adds values to list head (left) or tail and returns list length.
+// List is created if key does not exist, TTL of existing list is kept.
+// Pushed elements are handed to parked BlockingPop calls first, one element per call
+func (c *CacheDb) Push(key string, left bool, values [][]byte) (int, error) {
+	for _, val := range values {
+		if len(val)+2 > maxElementLength {
+			return 0, tooLargeElementErr
+		}
+	}
+
+	id := blockByKey(key)
+	c.locks[id].Lock()
+	record, ttl, expired, err := c.readListRecord(id, key)
+	if err != nil {
+		c.locks[id].Unlock()
+		return 0, err
+	}
+
+	length := listLength(record) + len(values)
+	if length > maxListElemennts {
+		c.locks[id].Unlock()
+		return 0, tooMatchListElementsErr
+	}
+
+	record = c.handOff(key, pushElements(record, values, left))
+	eventType := c.storeList(id, key, ttl, record)
+	c.locks[id].Unlock()
+
+	if expired {
+		c.emit(EventExpire, key, keyList)
+	}
+	if eventType != 0 {
+		c.emit(eventType, key, keyList)
+	}
+	return length, nil
+}
+
+// Pop removes and returns list head (left) or tail element, list is removed with its last element
+func (c *CacheDb) Pop(key string, left bool) ([]byte, error) {
+	id := blockByKey(key)
+	c.locks[id].Lock()
+	record, ttl, expired, err := c.readListRecord(id, key)
+	if err != nil || listLength(record) == 0 {
+		c.locks[id].Unlock()
+		if expired {
+			c.emit(EventExpire, key, keyList)
+		}
+		if err == nil {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+
+	elem, record := popElement(record, left)
+	eventType := c.storeList(id, key, ttl, record)
+	c.locks[id].Unlock()
+
+	c.emit(eventType, key, keyList)
+	return elem, nil
+}
+
+// BlockingPop pops element of first non empty list of keys like Pop.
+// If all lists are empty, call is parked until element is pushed to one of keys or ctx is done.
+// Parked calls are served in arrival order. Returns ctx error if ctx is done first
+func (c *CacheDb) BlockingPop(ctx context.Context, keys []string, left bool) (string, []byte, error) {
+	w := &popWaiter{left: left, c: make(chan poppedElem, 1)}
+	parked := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		id := blockByKey(key)
+		c.locks[id].Lock()
+		record, ttl, expired, err := c.readListRecord(id, key)
+		if err != nil {
+			c.locks[id].Unlock()
+			return "", nil, c.cancelPop(w, parked, err)
+		}
+
+		if listLength(record) > 0 {
+			//element could be handed by push to one of previous keys
+			if !atomic.CompareAndSwapInt32(&w.state, waiterParked, waiterServed) {
+				c.locks[id].Unlock()
+				break
+			}
+
+			elem, record := popElement(record, left)
+			eventType := c.storeList(id, key, ttl, record)
+			c.locks[id].Unlock()
+
+			c.unpark(w, parked)
+			c.emit(eventType, key, keyList)
+			return key, elem, nil
+		}
+
+		c.park(key, w)
+		parked = append(parked, key)
+		c.locks[id].Unlock()
+
+		if expired {
+			c.emit(EventExpire, key, keyList)
+		}
+	}
+
+	select {
+	case elem := <-w.c:
+		c.unpark(w, parked)
+		return elem.key, elem.value, nil
+	case <-ctx.Done():
+		return "", nil, c.cancelPop(w, parked, ctx.Err())
+	}
+}
+
+// cancelPop cancels parked call and returns err.
+// Element handed to call in between is pushed back to its list, Push error is returned if it fails
+func (c *CacheDb) cancelPop(w *popWaiter, parked []string, err error) error {
+	cancelled := atomic.CompareAndSwapInt32(&w.state, waiterParked, waiterCancelled)
+	c.unpark(w, parked)
+	if cancelled {
+		return err
+	}
+
+	//served by push in between, element is sent right after waiter is claimed
+	elem := <-w.c
+	if _, pushErr := c.Push(elem.key, w.left, [][]byte{elem.value}); pushErr != nil {
+		return fmt.Errorf("%w, popped element of %s is lost: %w", err, elem.key, pushErr)
+	}
+	return err
+}
+
+// readListRecord returns encoded elements and ttl of list like readList, nil record is returned for not existing key
+func (c *CacheDb) readListRecord(id uint8, key string) ([]byte, uint64, bool, error) {
+	data, ok := c.blocks[id][key]
+	if !ok {
+		return nil, 0, false, nil
+	}
+
+	entry := readEntry(data)
+	if entry.expired(time.Now().Unix()) {
+		delete(c.blocks[id], key)
+		return nil, 0, true, nil
+	}
+
+	if entry.keyType != keyList {
+		return nil, 0, false, ErrWrongType
+	}
+	return data[headerLen:], entry.ttl, false, nil
+}
+
+// readList returns elements and ttl of list, block lock must be held for write.
+// Expired key is removed, nil list is returned for not existing key
+func (c *CacheDb) readList(id uint8, key string) ([][]byte, uint64, bool, error) {
+	return c.readElements(id, key, keyList)
+}
+
+// readElements returns elements and ttl of list or dictionary like readList,
+// dictionary elements are "field:value" without separator index
+func (c *CacheDb) readElements(id uint8, key string, keyType uint8) ([][]byte, uint64, bool, error) {
+	data, ok := c.blocks[id][key]
+	if !ok {
+		return nil, 0, false, nil
+	}
+
+	entry := readEntry(data)
+	if entry.expired(time.Now().Unix()) {
+		delete(c.blocks[id], key)
+		return nil, 0, true, nil
+	}
+
+	if entry.keyType != keyType {
+		return nil, 0, false, ErrWrongType
+	}
+
+	elems := decodeList(data[headerLen:])
+	if keyType == keyDict {
+		for i, elem := range elems {
+			elems[i] = elem[2:]
+		}
+	}
+	return elems, entry.ttl, false, nil
+}
+
+// SetListElement replaces list element at position, TTL of list is kept.
+// Returns ErrNotFound if list does not exist or position is out of range
+func (c *CacheDb) SetListElement(key string, position uint16, value []byte) error {
+	if len(value)+2 > maxElementLength {
+		return tooLargeElementErr
+	}
+
+	id := blockByKey(key)
+	c.locks[id].Lock()
+	list, ttl, expired, err := c.readList(id, key)
+	if err != nil || int(position) >= len(list) {
+		c.locks[id].Unlock()
+		if expired {
+			c.emit(EventExpire, key, keyList)
+		}
+		if err == nil {
+			err = ErrNotFound
+		}
+		return err
+	}
+
+	list[position] = value
+	record, _ := encodeList(keyList, list)
+	eventType := c.storeList(id, key, ttl, record)
+	c.locks[id].Unlock()
+
+	c.emit(eventType, key, keyList)
+	return nil
+}
+
+// RemoveListElement removes list element at position, list is removed with its last element.
+// Returns ErrNotFound if list does not exist or position is out of range
+func (c *CacheDb) RemoveListElement(key string, position uint16) error {
+	id := blockByKey(key)
+	c.locks[id].Lock()
+	list, ttl, expired, err := c.readList(id, key)
+	if err != nil || int(position) >= len(list) {
+		c.locks[id].Unlock()
+		if expired {
+			c.emit(EventExpire, key, keyList)
+		}
+		if err == nil {
+			err = ErrNotFound
+		}
+		return err
+	}
+
+	list = append(list[:position], list[position+1:]...)
+	record, _ := encodeList(keyList, list)
+	eventType := c.storeList(id, key, ttl, record)
+	c.locks[id].Unlock()
+
+	c.emit(eventType, key, keyList)
+	return nil
+}
+
+// storeList writes encoded list with absolute ttl, empty list is removed.
+// Block lock must be held for write, returns event to emit, zero if nothing is stored or removed
+func (c *CacheDb) storeList(id uint8, key string, ttl uint64, record []byte) EventType {
+	if listLength(record) == 0 {
+		if _, ok := c.blocks[id][key]; !ok {
+			//pushed elements are handed to parked calls
+			return 0
+		}
+		delete(c.blocks[id], key)
+		return EventRemove
+	}
+
+	c.blocks[id][key] = newEntry(keyList, ttl, record)
+	return EventSet
+}
+
+// handOff serves parked calls of key with encoded list elements, one element per call.
+// Block lock of key must be held, returns rest of list
+func (c *CacheDb) handOff(key string, record []byte) []byte {
+	c.waiters.lock.Lock()
+	defer c.waiters.lock.Unlock()
+
+	queue := c.waiters.keys[key]
+	for len(queue) > 0 && listLength(record) > 0 {
+		w := queue[0]
+		queue = queue[1:]
+		//waiter could be served by other key or cancelled
+		if !atomic.CompareAndSwapInt32(&w.state, waiterParked, waiterServed) {
+			continue
+		}
+
+		var elem []byte
+		elem, record = popElement(record, w.left)
+		w.c <- poppedElem{key: key, value: elem}
+	}
+
+	if len(queue) == 0 {
+		delete(c.waiters.keys, key)
+	} else {
+		c.waiters.keys[key] = queue
+	}
+	return record
+}
+
+func (c *CacheDb) park(key string, w *popWaiter) {
+	c.waiters.lock.Lock()
+	if c.waiters.keys == nil {
+		c.waiters.keys = map[string][]*popWaiter{}
+	}
+	c.waiters.keys[key] = append(c.waiters.keys[key], w)
+	c.waiters.lock.Unlock()
+}
+
+func (c *CacheDb) unpark(w *popWaiter, keys []string) {
+	c.waiters.lock.Lock()
+	for _, key := range keys {
+		queue := c.waiters.keys[key]
+		for i, parked := range queue {
+			if parked == w {
+				queue = append(queue[:i:i], queue[i+1:]...)
+				break
+			}
+		}
+
+		if len(queue) == 0 {
+			delete(c.waiters.keys, key)
+		} else {
+			c.waiters.keys[key] = queue
+		}
+	}
+	c.waiters.lock.Unlock()
+}
+
+// listLength returns elements count of encoded list, zero for nil record
+func listLength(record []byte) int {
+	if len(record) < 2 {
+		return 0
+	}
+	return int(uint16UnsafeConvert(record))
+}
+
+// pushElements returns encoded list with values added to head (left) or tail.
+// Elements are copied as byte ranges without decoding, values are added to head in reverse order
+// like pushed one by one
+func pushElements(record []byte, values [][]byte, left bool) []byte {
+	count := listLength(record)
+	lengths, data := record, record
+	if count > 0 {
+		lengths, data = record[2:2+count*2], record[2+count*2:]
+	}
+
+	added := make([][]byte, len(values))
+	size := 0
+	for i, val := range values {
+		if left {
+			added[len(values)-1-i] = val
+		} else {
+			added[i] = val
+		}
+		size += 2 + len(val)
+	}
+
+	buff := make([]byte, 0, 2+count*2+len(data)+size)
+	buff = append(buff, sliceUnsafeConvert(uint16(count+len(values)))...)
+	if !left && count > 0 {
+		buff = append(buff, lengths...)
+	}
+	for _, val := range added {
+		buff = append(buff, sliceUnsafeConvert(uint16(len(val)))...)
+	}
+	if left && count > 0 {
+		buff = append(buff, lengths...)
+	}
+
+	if !left && count > 0 {
+		buff = append(buff, data...)
+	}
+	for _, val := range added {
+		buff = append(buff, val...)
+	}
+	if left && count > 0 {
+		buff = append(buff, data...)
+	}
+	return buff
+}
+
+// popElement returns copy of head (left) or tail element of not empty encoded list and rest of list
+func popElement(record []byte, left bool) ([]byte, []byte) {
+	count := listLength(record)
+	lengths, data := record[2:2+count*2], record[2+count*2:]
+
+	var elem []byte
+	if left {
+		elemLen := int(uint16UnsafeConvert(lengths))
+		elem, lengths, data = data[:elemLen], lengths[2:], data[elemLen:]
+	} else {
+		elemLen := int(uint16UnsafeConvert(lengths[len(lengths)-2:]))
+		elem, lengths, data = data[len(data)-elemLen:], lengths[:len(lengths)-2], data[:len(data)-elemLen]
+	}
+
+	rest := make([]byte, 0, 2+len(lengths)+len(data))
+	rest = append(rest, sliceUnsafeConvert(uint16(count-1))...)
+	rest = append(rest, lengths...)
+	rest = append(rest, data...)
+	return append([]byte(nil), elem...), rest
+}
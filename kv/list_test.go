@@ -0,0 +1,247 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPushPop(t *testing.T) {
+	cache := NewCacheDb()
+
+	length, err := cache.Push("queue", false, [][]byte{[]byte("b"), []byte("c")})
+	if err != nil || length != 2 {
+		t.Fatal("Incorrect push", "expected", 2, "got", length, err)
+	}
+
+	length, err = cache.Push("queue", true, [][]byte{[]byte("a"), []byte("0")})
+	if err != nil || length != 4 {
+		t.Fatal("Incorrect push", "expected", 4, "got", length, err)
+	}
+
+	list, _ := cache.GetList("queue")
+	if fmt.Sprintf("%s", list) != "[0 a b c]" {
+		t.Fatal("Incorrect list", "expected", "[0 a b c]", "got", fmt.Sprintf("%s", list))
+	}
+
+	type (
+		testCase struct {
+			left     bool
+			expected string
+		}
+	)
+
+	for _, c := range []testCase{{true, "0"}, {false, "c"}, {false, "b"}, {true, "a"}} {
+		elem, err := cache.Pop("queue", c.left)
+		if err != nil || string(elem) != c.expected {
+			t.Fatal("Incorrect pop", "expected", c.expected, "got", string(elem), err)
+		}
+	}
+
+	if _, err := cache.Pop("queue", true); err != ErrNotFound {
+		t.Fatal("Incorrect pop of empty list", "expected", ErrNotFound, "got", err)
+	}
+	if len(cache.Keys()) != 0 {
+		t.Fatal("Expected removed list", cache.Keys())
+	}
+
+	cache.Set("string", 0, []byte("value"))
+	if _, err := cache.Push("string", true, [][]byte{[]byte("a")}); err != ErrWrongType {
+		t.Fatal("Incorrect push to string", "expected", ErrWrongType, "got", err)
+	}
+	if _, err := cache.Pop("string", true); err != ErrWrongType {
+		t.Fatal("Incorrect pop of string", "expected", ErrWrongType, "got", err)
+	}
+
+	cache.SetList("ttl", 100, [][]byte{[]byte("a")})
+	cache.Push("ttl", false, [][]byte{[]byte("b")})
+	id := blockByKey("ttl")
+	if readEntry(cache.blocks[id]["ttl"]).ttl == 0 {
+		t.Fatal("Expected kept list ttl")
+	}
+}
+
+func TestBlockingPop(t *testing.T) {
+	cache := NewCacheDb()
+	cache.Push("ready", false, [][]byte{[]byte("a")})
+
+	key, elem, err := cache.BlockingPop(context.Background(), []string{"empty", "ready"}, true)
+	if err != nil || key != "ready" || string(elem) != "a" {
+		t.Fatal("Incorrect pop", "expected", "ready a", "got", key, string(elem), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if _, _, err := cache.BlockingPop(ctx, []string{"empty"}, true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Incorrect timeout", "expected", context.DeadlineExceeded, "got", err)
+	}
+
+	const waiters = 10
+	var wg sync.WaitGroup
+	results := make(chan string, waiters)
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, elem, err := cache.BlockingPop(context.Background(), []string{"a", "b"}, true)
+			if err != nil {
+				t.Error("Unexpected error", err)
+				return
+			}
+			results <- string(elem)
+		}()
+	}
+
+	//wait until all calls are parked
+	for {
+		cache.waiters.lock.Lock()
+		parked := len(cache.waiters.keys["b"])
+		cache.waiters.lock.Unlock()
+		if parked == waiters {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	values := [][]byte{}
+	for i := 0; i < waiters/2; i++ {
+		values = append(values, []byte(fmt.Sprint(i)))
+	}
+	cache.Push("a", false, values)
+	cache.Push("b", false, append(values, []byte("rest")))
+	wg.Wait()
+	close(results)
+
+	got := map[string]int{}
+	for elem := range results {
+		got[elem]++
+	}
+	for i := 0; i < waiters/2; i++ {
+		if got[fmt.Sprint(i)] != 2 {
+			t.Fatal("Incorrect served elements", got)
+		}
+	}
+
+	rest, _ := cache.GetList("b")
+	if len(rest) != 1 || string(rest[0]) != "rest" {
+		t.Fatal("Incorrect rest of list", "expected", "[rest]", "got", fmt.Sprintf("%s", rest))
+	}
+	if len(cache.waiters.keys) != 0 {
+		t.Fatal("Expected no parked calls", cache.waiters.keys)
+	}
+}
+
+func TestBlockingPopCancel(t *testing.T) {
+	cache := NewCacheDb()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, _, err := cache.BlockingPop(ctx, []string{"queue"}, true)
+		done <- err
+	}()
+
+	time.Sleep(time.Millisecond * 20)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatal("Incorrect cancel", "expected", context.Canceled, "got", err)
+	}
+
+	cache.Push("queue", false, [][]byte{[]byte("a")})
+	list, _ := cache.GetList("queue")
+	if len(list) != 1 {
+		t.Fatal("Expected element is not handed to cancelled call")
+	}
+
+	cache.Set("string", 0, []byte("value"))
+	if _, _, err := cache.BlockingPop(context.Background(), []string{"string"}, true); err != ErrWrongType {
+		t.Fatal("Incorrect pop of string", "expected", ErrWrongType, "got", err)
+	}
+}
+
+func TestBlockingPopHandOff(t *testing.T) {
+	cache := NewCacheDb()
+	w := cache.Watch("*", 10)
+	defer w.Close()
+
+	done := make(chan []byte)
+	go func() {
+		_, elem, _ := cache.BlockingPop(context.Background(), []string{"queue"}, true)
+		done <- elem
+	}()
+	time.Sleep(time.Millisecond * 20)
+
+	//element is handed to parked call, list is not stored
+	cache.Push("queue", false, [][]byte{[]byte("a")})
+	if elem := <-done; string(elem) != "a" {
+		t.Fatal("Incorrect pop", "expected", "a", "got", string(elem))
+	}
+	cache.Set("marker", 0, []byte("1"))
+	if event := <-w.C; event != (Event{EventSet, "marker", "string"}) {
+		t.Fatal("Incorrect event", "expected", "set of marker", "got", event)
+	}
+
+	//element handed to cancelled call can not be pushed back to key of other type
+	waiter := &popWaiter{left: true, state: waiterServed, c: make(chan poppedElem, 1)}
+	waiter.c <- poppedElem{key: "marker", value: []byte("b")}
+	if err := cache.cancelPop(waiter, nil, context.Canceled); !errors.Is(err, context.Canceled) || !errors.Is(err, ErrWrongType) {
+		t.Fatal("Incorrect cancel", "expected", ErrWrongType, "got", err)
+	}
+}
+
+func TestListRecord(t *testing.T) {
+	record := pushElements(nil, [][]byte{[]byte("b"), []byte("cc")}, false)
+	record = pushElements(record, [][]byte{[]byte("a"), []byte("")}, true)
+	record = pushElements(record, [][]byte{[]byte("ddd")}, false)
+
+	if list := decodeList(record); fmt.Sprintf("%q", list) != `["" "a" "b" "cc" "ddd"]` {
+		t.Fatal("Incorrect list", "expected", `["" "a" "b" "cc" "ddd"]`, "got", fmt.Sprintf("%q", list))
+	}
+
+	elem, record := popElement(record, false)
+	if string(elem) != "ddd" {
+		t.Fatal("Incorrect pop", "expected", "ddd", "got", string(elem))
+	}
+	elem, record = popElement(record, true)
+	if string(elem) != "" || listLength(record) != 3 {
+		t.Fatal("Incorrect pop", "expected", "", "got", string(elem), listLength(record))
+	}
+	if list := decodeList(record); fmt.Sprintf("%q", list) != `["a" "b" "cc"]` {
+		t.Fatal("Incorrect list", "expected", `["a" "b" "cc"]`, "got", fmt.Sprintf("%q", list))
+	}
+}
+
+func TestListElement(t *testing.T) {
+	cache := NewCacheDb()
+	cache.SetList("list", 100, [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+
+	if err := cache.SetListElement("list", 1, []byte("bb")); err != nil {
+		t.Fatal("Incorrect set of list element", err)
+	}
+	if err := cache.SetListElement("list", 3, []byte("d")); err != ErrNotFound {
+		t.Fatal("Incorrect set out of range", "expected", ErrNotFound, "got", err)
+	}
+	if err := cache.RemoveListElement("list", 0); err != nil {
+		t.Fatal("Incorrect remove of list element", err)
+	}
+
+	list, _ := cache.GetList("list")
+	if fmt.Sprintf("%s", list) != "[bb c]" {
+		t.Fatal("Incorrect list", "expected", "[bb c]", "got", fmt.Sprintf("%s", list))
+	}
+	if readEntry(cache.blocks[blockByKey("list")]["list"]).ttl == 0 {
+		t.Fatal("Expected kept list ttl")
+	}
+
+	cache.RemoveListElement("list", 1)
+	cache.RemoveListElement("list", 0)
+	if len(cache.Keys()) != 0 {
+		t.Fatal("Expected removed list", cache.Keys())
+	}
+	if err := cache.RemoveListElement("list", 0); err != ErrNotFound {
+		t.Fatal("Incorrect remove of not existing list", "expected", ErrNotFound, "got", err)
+	}
+}
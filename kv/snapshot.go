@@ -0,0 +1,253 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	snapshotMagic = "KVS1"
+
+	snapshotRecord = 1
+	snapshotEnd    = 0
+
+	snapshotBufferSize = 32 * 1024
+)
+
+var (
+	incorrectRecordErr   = NewError(ErrBadRequest, "Incorrect dump record")
+	incorrectSnapshotErr = NewError(ErrBadRequest, "Incorrect snapshot")
+)
+
+// Dump returns serialized record of key with type and absolute expiration time, see Restore
+func (c *CacheDb) Dump(key string) ([]byte, error) {
+	id := blockByKey(key)
+	c.locks[id].RLock()
+	data, ok := c.blocks[id][key]
+	if !ok || readEntry(data).expired(time.Now().Unix()) {
+		c.locks[id].RUnlock()
+		return nil, ErrNotFound
+	}
+
+	out := make([]byte, len(data))
+	copy(out, data)
+	c.locks[id].RUnlock()
+	return out, nil
+}
+
+// Restore sets key to record returned by Dump, existing key is overwritten
+func (c *CacheDb) Restore(key string, record []byte) error {
+	if !validRecord(record) {
+		return incorrectRecordErr
+	}
+
+	data := make([]byte, len(record))
+	copy(data, record)
+
+	id := blockByKey(key)
+	c.locks[id].Lock()
+	c.blocks[id][key] = data
+	c.locks[id].Unlock()
+
+	c.emit(EventSet, key, readEntry(data).keyType)
+	return nil
+}
+
+// CompareAndRemove removes key if its record is equal to record returned by Dump.
+// Returns false if key is changed or removed after Dump
+func (c *CacheDb) CompareAndRemove(key string, record []byte) bool {
+	id := blockByKey(key)
+	c.locks[id].Lock()
+	data, ok := c.blocks[id][key]
+	if !ok || !bytes.Equal(data, record) {
+		c.locks[id].Unlock()
+		return false
+	}
+
+	delete(c.blocks[id], key)
+	c.locks[id].Unlock()
+
+	c.emit(EventRemove, key, readEntry(data).keyType)
+	return true
+}
+
+// Snapshot writes all not expired keys to w. Blocks are encoded one by one under read lock and written
+// after unlock to not block writers by slow w, keys changed while snapshot is written may be written
+// with old or new value
+func (c *CacheDb) Snapshot(w io.Writer) error {
+	bw := bufio.NewWriterSize(w, snapshotBufferSize)
+	bw.WriteString(snapshotMagic)
+
+	now := time.Now().Unix()
+	var buff []byte
+	for id := range c.blocks {
+		buff = buff[:0]
+		c.locks[id].RLock()
+		for key, data := range c.blocks[id] {
+			if readEntry(data).expired(now) {
+				continue
+			}
+
+			buff = append(buff, snapshotRecord)
+			buff = binary.LittleEndian.AppendUint32(buff, uint32(len(key)))
+			buff = binary.LittleEndian.AppendUint32(buff, uint32(len(data)))
+			buff = append(buff, key...)
+			buff = append(buff, data...)
+		}
+		c.locks[id].RUnlock()
+
+		if _, err := bw.Write(buff); err != nil {
+			return err
+		}
+	}
+
+	bw.WriteByte(snapshotEnd)
+	return bw.Flush()
+}
+
+// LoadSnapshot replaces all keys by keys of snapshot written by Snapshot.
+// Cache is not changed if snapshot is incorrect
+func (c *CacheDb) LoadSnapshot(r io.Reader) error {
+	br := bufio.NewReaderSize(r, snapshotBufferSize)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return err
+	}
+	if string(magic) != snapshotMagic {
+		return incorrectSnapshotErr
+	}
+
+	var blocks [blocks]map[string][]byte
+	for i := range blocks {
+		blocks[i] = map[string][]byte{}
+	}
+
+	header := make([]byte, 8)
+	for {
+		kind, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if kind == snapshotEnd {
+			break
+		}
+		if kind != snapshotRecord {
+			return incorrectSnapshotErr
+		}
+
+		if _, err := io.ReadFull(br, header); err != nil {
+			return err
+		}
+		key := make([]byte, binary.LittleEndian.Uint32(header[0:4]))
+		data := make([]byte, binary.LittleEndian.Uint32(header[4:8]))
+		if _, err := io.ReadFull(br, key); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(br, data); err != nil {
+			return err
+		}
+		if !validRecord(data) {
+			return incorrectSnapshotErr
+		}
+
+		blocks[blockByKey(string(key))][string(key)] = data
+	}
+
+	type (
+		change struct {
+			eventType EventType
+			key       string
+			keyType   uint8
+		}
+	)
+
+	for id := range c.blocks {
+		//changes are collected under lock, loaded block may be changed after unlock
+		var changes []change
+		c.locks[id].Lock()
+		old := c.blocks[id]
+		c.blocks[id] = blocks[id]
+		for key, data := range old {
+			if _, ok := blocks[id][key]; !ok {
+				changes = append(changes, change{EventRemove, key, readEntry(data).keyType})
+			}
+		}
+		for key, data := range blocks[id] {
+			if oldData, ok := old[key]; !ok || !bytes.Equal(oldData, data) {
+				changes = append(changes, change{EventSet, key, readEntry(data).keyType})
+			}
+		}
+		c.locks[id].Unlock()
+
+		for _, ch := range changes {
+			c.emit(ch.eventType, ch.key, ch.keyType)
+		}
+	}
+	return nil
+}
+
+// validRecord returns true if record is an entry with correct encoding of value of its type
+func validRecord(data []byte) bool {
+	if len(data) < headerLen {
+		return false
+	}
+
+	entry := readEntry(data)
+	if entry.length != uint64(len(data)-headerLen) {
+		return false
+	}
+	switch entry.keyType {
+	case keyString:
+		return true
+	case keyList, keyDict:
+		return validList(data[headerLen:], entry.keyType)
+	case keyStream:
+		return validStream(data) == nil
+	}
+	return false
+}
+
+// validList returns true if value is encoded list or dictionary: elements count, elements lengths, elements.
+// Dictionary element starts with separator index, fields are ordered
+func validList(value []byte, keyType uint8) bool {
+	if len(value) < 2 {
+		return false
+	}
+
+	count := int(uint16UnsafeConvert(value))
+	off := 2 + count*2
+	if off > len(value) {
+		return false
+	}
+
+	var prev []byte
+	for i := 0; i < count; i++ {
+		elemLen := int(uint16UnsafeConvert(value[2+i*2:]))
+		if elemLen > len(value)-off {
+			return false
+		}
+		elem := value[off : off+elemLen]
+		off += elemLen
+		if keyType != keyDict {
+			continue
+		}
+
+		if elemLen < 2 {
+			return false
+		}
+		sep := int(uint16UnsafeConvert(elem))
+		if bytes.Index(elem[2:], dictionarySeparator) != sep {
+			return false
+		}
+		field := elem[2 : 2+sep]
+		if i > 0 && bytes.Compare(prev, field) > 0 {
+			return false
+		}
+		prev = field
+	}
+	return off == len(value)
+}
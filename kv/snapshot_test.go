@@ -0,0 +1,198 @@
+package kv
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type (
+	// blockedWriter blocks writes until released
+	blockedWriter struct {
+		once    sync.Once
+		started chan struct{}
+		release chan struct{}
+	}
+)
+
+func (w *blockedWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.started)
+	})
+	<-w.release
+	return len(p), nil
+}
+
+func TestDumpRestore(t *testing.T) {
+	cache := NewCacheDb()
+	cache.SetList("list", 100, [][]byte{[]byte("a"), []byte("b")})
+
+	record, err := cache.Dump("list")
+	if err != nil {
+		t.Fatal("Dump error", err)
+	}
+	if _, err := cache.Dump("unknown"); err != ErrNotFound {
+		t.Fatal("Incorrect dump error", "expected", ErrNotFound, "got", err)
+	}
+
+	other := NewCacheDb()
+	if err := other.Restore("copy", record); err != nil {
+		t.Fatal("Restore error", err)
+	}
+
+	list, _ := other.GetList("copy")
+	if !reflect.DeepEqual(list, [][]byte{[]byte("a"), []byte("b")}) {
+		t.Fatal("Incorrect restored list", list)
+	}
+	if copied, _ := other.Dump("copy"); !bytes.Equal(copied, record) {
+		t.Fatal("Expected kept expiration time")
+	}
+
+	if err := other.Restore("bad", record[:len(record)-1]); err != incorrectRecordErr {
+		t.Fatal("Incorrect restore error", "expected", incorrectRecordErr, "got", err)
+	}
+
+	cache.SetList("list", 100, [][]byte{[]byte("c")})
+	if cache.CompareAndRemove("list", record) {
+		t.Fatal("Expected changed key is not removed")
+	}
+	record, _ = cache.Dump("list")
+	if !cache.CompareAndRemove("list", record) {
+		t.Fatal("Expected unchanged key is removed")
+	}
+	if _, err := cache.Dump("list"); err != ErrNotFound {
+		t.Fatal("Incorrect removed key error", "expected", ErrNotFound, "got", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	cache := NewCacheDb()
+	cache.Set("string", 0, []byte("value"))
+	cache.SetDict("dict", 0, [][]byte{[]byte("a:1")})
+	cache.StreamAdd("stream", StreamID{Ms: 1}, [][]byte{[]byte("f"), []byte("v")}, 0)
+
+	buff := &bytes.Buffer{}
+	if err := cache.Snapshot(buff); err != nil {
+		t.Fatal("Snapshot error", err)
+	}
+
+	other := NewCacheDb()
+	other.Set("old", 0, []byte("value"))
+	other.Set("string", 0, []byte("old value"))
+
+	w := other.Watch("*", 10)
+	defer w.Close()
+
+	if err := other.LoadSnapshot(bytes.NewReader(buff.Bytes()[:buff.Len()-1])); err == nil {
+		t.Fatal("Expected truncated snapshot error")
+	}
+	if value, _ := other.Get("old"); string(value) != "value" {
+		t.Fatal("Expected unchanged cache")
+	}
+
+	if err := other.LoadSnapshot(buff); err != nil {
+		t.Fatal("Load snapshot error", err)
+	}
+
+	for _, key := range []string{"string", "dict", "stream"} {
+		expected, _ := cache.Dump(key)
+		got, _ := other.Dump(key)
+		if !bytes.Equal(expected, got) {
+			t.Fatal("Incorrect loaded key", key)
+		}
+	}
+	if _, err := other.Get("old"); err != ErrNotFound {
+		t.Fatal("Expected removed key", "got", err)
+	}
+	if len(w.C) != 4 {
+		t.Fatal("Incorrect events count", "expected", 4, "got", len(w.C))
+	}
+}
+
+func TestSnapshotWriter(t *testing.T) {
+	cache := NewCacheDb()
+	cache.Set("big", 0, make([]byte, 2*snapshotBufferSize))
+
+	w := &blockedWriter{started: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- cache.Snapshot(w)
+	}()
+	<-w.started
+
+	//block of key is not locked while snapshot is written
+	set := make(chan error)
+	go func() {
+		set <- cache.Set("big", 0, []byte("value"))
+	}()
+	select {
+	case <-set:
+	case <-time.After(time.Second):
+		t.Fatal("Set is blocked by snapshot writer")
+	}
+
+	close(w.release)
+	if err := <-done; err != nil {
+		t.Fatal("Snapshot error", err)
+	}
+}
+
+func TestRestoreMalformed(t *testing.T) {
+	cache := NewCacheDb()
+	cache.SetList("list", 0, [][]byte{[]byte("a"), []byte("b")})
+	cache.SetDict("dict", 0, dictionary{[]byte("a:1"), []byte("b:2")})
+	cache.StreamAdd("stream", StreamID{Ms: 5}, [][]byte{[]byte("n"), []byte("1")}, 0)
+	cache.StreamGroupCreate("stream", "workers", StreamID{}, false)
+
+	changed := func(key string, change func(data []byte) []byte) []byte {
+		record, _ := cache.Dump(key)
+		data := change(record)
+		//header length is kept correct to check value encoding
+		setValueLength(data)
+		return data
+	}
+	unsorted, _ := encodeList(keyDict, [][]byte{[]byte("b:2"), []byte("a:1")})
+	noSeparator, _ := encodeList(keyDict, [][]byte{[]byte("ab")})
+
+	testCases := map[string][]byte{
+		"short header": []byte("short"),
+		"length": func() []byte {
+			record, _ := cache.Dump("list")
+			return record[:len(record)-1]
+		}(),
+		"unknown type":       newEntry(9, 0, []byte("value")),
+		"list count":         changed("list", func(data []byte) []byte { data[headerLen] = 3; return data }),
+		"list element":       changed("list", func(data []byte) []byte { data[headerLen+2] = 0xff; return data }),
+		"list trailing":      changed("list", func(data []byte) []byte { return append(data, 0) }),
+		"list truncated":     changed("list", func(data []byte) []byte { return data[:len(data)-1] }),
+		"empty list":         newEntry(keyList, 0, nil),
+		"dict separator":     changed("dict", func(data []byte) []byte { data[headerLen+6] = 0; return data }),
+		"dict order":         newEntry(keyDict, 0, unsorted),
+		"dict no separator":  newEntry(keyDict, 0, noSeparator),
+		"stream count":       changed("stream", func(data []byte) []byte { data[headerLen+16]++; return data }),
+		"stream last id":     changed("stream", func(data []byte) []byte { data[headerLen] = 0; return data }),
+		"stream groups":      changed("stream", func(data []byte) []byte { data[headerLen+20] = 0xff; return data }),
+		"stream field count": changed("stream", func(data []byte) []byte { data[streamEntries+16] = 3; return data }),
+		"stream truncated":   changed("stream", func(data []byte) []byte { return data[:len(data)-1] }),
+		"stream trailing":    changed("stream", func(data []byte) []byte { return append(data, 0) }),
+	}
+
+	other := NewCacheDb()
+	for name, record := range testCases {
+		if err := other.Restore(name, record); err != incorrectRecordErr {
+			t.Fatal("Incorrect restore error", name, "expected", incorrectRecordErr, "got", err)
+		}
+	}
+	if keys := other.Keys(); len(keys) != 0 {
+		t.Fatal("Expected not restored keys", keys)
+	}
+
+	for _, key := range []string{"list", "dict", "stream"} {
+		record, _ := cache.Dump(key)
+		if err := other.Restore(key, record); err != nil {
+			t.Fatal("Restore error", key, err)
+		}
+	}
+}
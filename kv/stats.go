@@ -0,0 +1,82 @@
+package kv
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Stats is a keyspace summary of not expired keys
+	Stats struct {
+		// Keys is a count of keys by type name: string, list, dict, stream
+		Keys map[string]int
+		// Expires is a count of keys with ttl
+		Expires int
+		// Bytes is a size of keys and stored records
+		Bytes int64
+		// Expired is a count of keys removed by expiration since cache creation
+		Expired uint64
+	}
+
+	// blockLock is a lock of keys block which counts acquisitions waiting for other holder
+	blockLock struct {
+		sync.RWMutex
+		contended atomic.Uint64
+	}
+)
+
+// Stats returns keyspace summary, blocks are scanned one by one
+func (c *CacheDb) Stats() Stats {
+	stats := Stats{
+		Keys:    map[string]int{},
+		Expired: c.Expired(),
+	}
+
+	now := time.Now().Unix()
+	for id := range c.blocks {
+		c.locks[id].RLock()
+		for key, data := range c.blocks[id] {
+			entry := readEntry(data)
+			if entry.expired(now) {
+				continue
+			}
+
+			stats.Keys[keyTypeName(entry.keyType)]++
+			if entry.ttl > 0 {
+				stats.Expires++
+			}
+			stats.Bytes += int64(len(key) + len(data))
+		}
+		c.locks[id].RUnlock()
+	}
+	return stats
+}
+
+// Expired returns count of keys removed by expiration since cache creation, keys are not scanned
+func (c *CacheDb) Expired() uint64 {
+	return c.expired.Load()
+}
+
+// LockContention returns count of lock acquisitions of every keys block which waited for other holder
+func (c *CacheDb) LockContention() []uint64 {
+	out := make([]uint64, blocks)
+	for id := range c.locks {
+		out[id] = c.locks[id].contended.Load()
+	}
+	return out
+}
+
+func (l *blockLock) Lock() {
+	if !l.TryLock() {
+		l.contended.Add(1)
+		l.RWMutex.Lock()
+	}
+}
+
+func (l *blockLock) RLock() {
+	if !l.TryRLock() {
+		l.contended.Add(1)
+		l.RWMutex.RLock()
+	}
+}
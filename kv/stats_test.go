@@ -0,0 +1,44 @@
+package kv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	cache := NewCacheDb()
+	cache.Set("foo", 1, []byte("bar"))
+	cache.Set("bar", 100, []byte("baz"))
+	cache.SetList("list", 0, [][]byte{[]byte("a"), []byte("b")})
+	cache.SetDict("dict", 0, [][]byte{[]byte("a:b")})
+
+	stats := cache.Stats()
+	if stats.Keys["string"] != 2 || stats.Keys["list"] != 1 || stats.Keys["dict"] != 1 || stats.Expires != 2 {
+		t.Fatal("Incorrect stats", "expected", "2 strings, 1 list, 1 dict, 2 expires", "got", stats)
+	}
+	if stats.Bytes < int64(4*headerLen) {
+		t.Fatal("Incorrect stored bytes", "got", stats.Bytes)
+	}
+
+	time.Sleep(time.Second * 2)
+	cache.Get("foo")
+	if stats := cache.Stats(); stats.Keys["string"] != 1 || stats.Expired != 1 || cache.Expired() != 1 {
+		t.Fatal("Incorrect expired stats", "expected", 1, "got", stats)
+	}
+
+	//reader waits for writer of the same block
+	id := blockByKey("bar")
+	cache.locks[id].Lock()
+	done := make(chan struct{})
+	go func() {
+		cache.Get("bar")
+		close(done)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	cache.locks[id].Unlock()
+	<-done
+
+	if contention := cache.LockContention(); contention[id] != 1 {
+		t.Fatal("Incorrect lock contention", "expected", 1, "got", contention[id])
+	}
+}
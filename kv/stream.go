@@ -0,0 +1,758 @@
+package kv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// StreamID is a stream entry id of milliseconds timestamp and sequence number
+	StreamID struct {
+		Ms  uint64
+		Seq uint64
+	}
+
+	// StreamEntry is a stream entry, Fields are field value pairs: field, value, field, value...
+	StreamEntry struct {
+		ID     StreamID
+		Fields [][]byte
+	}
+
+	// PendingEntry is an entry delivered to consumer of group and not acknowledged yet
+	PendingEntry struct {
+		ID         StreamID
+		Consumer   string
+		Delivered  time.Time
+		Deliveries uint32
+	}
+
+	// streamHeader is a header of stream value: last id, entries count and offset of groups in value.
+	// Entries are encoded between header and groups to append entry in place
+	streamHeader struct {
+		lastID StreamID
+		count  int
+		groups int
+	}
+
+	streamGroup struct {
+		name          string
+		lastDelivered StreamID
+		// pending entries are ordered by id
+		pending []PendingEntry
+	}
+
+	// streamReader reads stream encoding, reading out of data sets err
+	streamReader struct {
+		data []byte
+		off  int
+		err  error
+	}
+)
+
+const (
+	// streamHeaderLen is a length of last id, entries count and groups offset of stream value
+	streamHeaderLen = 24
+	// streamEntries is an offset of the first entry in stream data
+	streamEntries = headerLen + streamHeaderLen
+
+	// minimal encoded lengths of field, group and pending entry
+	minFieldLen   = 2
+	minGroupLen   = 2 + 16 + 4
+	minPendingLen = 16 + 2 + 8 + 4
+)
+
+var (
+	// MaxStreamID is greater or equal to any stream id
+	MaxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+
+	incorrectStreamIDErr = NewError(ErrBadRequest, "Incorrect stream ID")
+	smallStreamIDErr     = NewError(ErrBadRequest, "Stream ID must be greater than last stream ID")
+	streamFieldsErr      = NewError(ErrBadRequest, "Stream entry requires field value pairs")
+	groupExistsErr       = NewError(ErrBadRequest, "Consumer group already exists")
+	groupNotFoundErr     = NewError(ErrNotFound, "Consumer group not found")
+)
+
+// ParseStreamID parses "ms-seq" id, seq is used for id without sequence part
+func ParseStreamID(s string, seq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, incorrectStreamIDErr
+	}
+
+	if hasSeq {
+		seq, err = strconv.ParseUint(seqPart, 10, 64)
+		if err != nil {
+			return StreamID{}, incorrectStreamIDErr
+		}
+	}
+	return StreamID{ms, seq}, nil
+}
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || id.Ms == other.Ms && id.Seq < other.Seq
+}
+
+func (id StreamID) IsZero() bool {
+	return id == StreamID{}
+}
+
+// StreamAdd appends entry to stream and returns its id, stream is created if not exists.
+// Zero id is generated from current time, explicit id must be greater than last stream id.
+// Positive maxLen trims stream to maxLen newest entries
+func (c *CacheDb) StreamAdd(key string, id StreamID, fields [][]byte, maxLen int) (StreamID, error) {
+	return c.streamAdd(key, id, time.Now(), fields, maxLen)
+}
+
+// StreamAddAt appends entry with id generated for now time, it is used to generate
+// the same ids by replicas applying command in order
+func (c *CacheDb) StreamAddAt(key string, now time.Time, fields [][]byte, maxLen int) (StreamID, error) {
+	return c.streamAdd(key, StreamID{}, now, fields, maxLen)
+}
+
+func (c *CacheDb) streamAdd(key string, id StreamID, now time.Time, fields [][]byte, maxLen int) (StreamID, error) {
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return StreamID{}, streamFieldsErr
+	}
+	if len(fields) > maxListElemennts {
+		return StreamID{}, tooMatchListElementsErr
+	}
+	for _, field := range fields {
+		if len(field) > maxElementLength {
+			return StreamID{}, tooLargeElementErr
+		}
+	}
+
+	err := c.updateStream(key, true, func(data []byte, h *streamHeader) ([]byte, error) {
+		if id.IsZero() {
+			id = h.nextID(uint64(now.UnixMilli()))
+		} else if !h.lastID.Less(id) {
+			return nil, smallStreamIDErr
+		}
+
+		//oldest entries are trimmed before append to not change data on error
+		if maxLen > 0 && h.count >= maxLen {
+			var err error
+			if data, err = h.trim(data, h.count-maxLen+1); err != nil {
+				return nil, err
+			}
+		}
+		return h.appendEntry(data, StreamEntry{ID: id, Fields: fields}), nil
+	})
+	if err != nil {
+		return StreamID{}, err
+	}
+
+	c.emit(EventSet, key, keyStream)
+	return id, nil
+}
+
+// StreamRange returns entries with ids from start to end inclusive, newest first if reverse.
+// Positive count limits returned entries
+func (c *CacheDb) StreamRange(key string, start StreamID, end StreamID, count int, reverse bool) ([]StreamEntry, error) {
+	entries := []StreamEntry{}
+	err := c.viewStream(key, func(data []byte, h *streamHeader) error {
+		r := h.entries(data)
+		for r.more() && (reverse || count <= 0 || len(entries) < count) {
+			id := r.streamID()
+			if id.Less(start) {
+				r.skipFields()
+				continue
+			}
+			if end.Less(id) {
+				break
+			}
+			entries = append(entries, StreamEntry{ID: id, Fields: r.fields()})
+		}
+		return r.err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reverse {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+	return entries, nil
+}
+
+// StreamLen returns entries count of stream, not existing stream is empty
+func (c *CacheDb) StreamLen(key string) (int, error) {
+	length := 0
+	err := c.viewStream(key, func(data []byte, h *streamHeader) error {
+		length = h.count
+		return nil
+	})
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	return length, err
+}
+
+// StreamTrimLen removes oldest entries over maxLen and returns removed entries count
+func (c *CacheDb) StreamTrimLen(key string, maxLen int) (int, error) {
+	return c.streamTrim(key, func(data []byte, h *streamHeader) (int, error) {
+		return max(h.count-maxLen, 0), nil
+	})
+}
+
+// StreamTrimMinID removes entries with id less than minID and returns removed entries count
+func (c *CacheDb) StreamTrimMinID(key string, minID StreamID) (int, error) {
+	return c.streamTrim(key, func(data []byte, h *streamHeader) (int, error) {
+		removed := 0
+		r := h.entries(data)
+		for r.more() && r.streamID().Less(minID) {
+			r.skipFields()
+			removed++
+		}
+		return removed, r.err
+	})
+}
+
+// streamTrim removes count of oldest entries returned by trimmed
+func (c *CacheDb) streamTrim(key string, trimmed func(data []byte, h *streamHeader) (int, error)) (int, error) {
+	removed := 0
+	err := c.updateStream(key, false, func(data []byte, h *streamHeader) ([]byte, error) {
+		var err error
+		if removed, err = trimmed(data, h); err != nil || removed == 0 {
+			return data, err
+		}
+		return h.trim(data, removed)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if removed > 0 {
+		c.emit(EventSet, key, keyStream)
+	}
+	return removed, nil
+}
+
+// StreamGroupCreate creates consumer group which delivers entries with ids greater than start,
+// start greater than last stream id means new entries only. Stream is created if create is true
+func (c *CacheDb) StreamGroupCreate(key string, group string, start StreamID, create bool) error {
+	if len(group) > maxElementLength {
+		return tooLargeElementErr
+	}
+
+	return c.updateGroups(key, create, func(data []byte, h *streamHeader, groups []*streamGroup) ([]*streamGroup, error) {
+		if findGroup(groups, group) != nil {
+			return nil, groupExistsErr
+		}
+
+		if h.lastID.Less(start) {
+			start = h.lastID
+		}
+		return append(groups, &streamGroup{name: group, lastDelivered: start}), nil
+	})
+}
+
+// StreamGroupDestroy removes consumer group with its pending entries
+func (c *CacheDb) StreamGroupDestroy(key string, group string) error {
+	return c.updateGroups(key, false, func(data []byte, h *streamHeader, groups []*streamGroup) ([]*streamGroup, error) {
+		for i, g := range groups {
+			if g.name == group {
+				return append(groups[:i], groups[i+1:]...), nil
+			}
+		}
+		return nil, groupNotFoundErr
+	})
+}
+
+// StreamReadGroup delivers entries never delivered to group to consumer,
+// entries are pending until acknowledged. Positive count limits delivered entries
+func (c *CacheDb) StreamReadGroup(key string, group string, consumer string, count int) ([]StreamEntry, error) {
+	if len(consumer) > maxElementLength {
+		return nil, tooLargeElementErr
+	}
+
+	var out []StreamEntry
+	err := c.updateGroups(key, false, func(data []byte, h *streamHeader, groups []*streamGroup) ([]*streamGroup, error) {
+		g := findGroup(groups, group)
+		if g == nil {
+			return nil, groupNotFoundErr
+		}
+
+		now := time.Now()
+		lastDelivered := g.lastDelivered
+		r := h.entries(data)
+		for r.more() && (count <= 0 || len(out) < count) {
+			id := r.streamID()
+			if !lastDelivered.Less(id) {
+				r.skipFields()
+				continue
+			}
+
+			out = append(out, StreamEntry{ID: id, Fields: r.fields()})
+			g.pending = append(g.pending, PendingEntry{ID: id, Consumer: consumer, Delivered: now, Deliveries: 1})
+			g.lastDelivered = id
+		}
+		return groups, r.err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []StreamEntry{}
+	}
+	return out, nil
+}
+
+// StreamReadPending delivers again consumer pending entries with ids greater than after.
+// Entries removed from stream are returned without fields
+func (c *CacheDb) StreamReadPending(key string, group string, consumer string, after StreamID, count int) ([]StreamEntry, error) {
+	out := []StreamEntry{}
+	err := c.updateGroups(key, false, func(data []byte, h *streamHeader, groups []*streamGroup) ([]*streamGroup, error) {
+		g := findGroup(groups, group)
+		if g == nil {
+			return nil, groupNotFoundErr
+		}
+
+		var delivered []*PendingEntry
+		for i := range g.pending {
+			p := &g.pending[i]
+			if p.Consumer != consumer || !after.Less(p.ID) {
+				continue
+			}
+			if count > 0 && len(delivered) >= count {
+				break
+			}
+			delivered = append(delivered, p)
+		}
+		if len(delivered) == 0 {
+			return groups, nil
+		}
+
+		//pending entries are ordered by id as entries, fields are read by one pass
+		r := h.entries(data)
+		next := 0
+		for r.more() && next < len(delivered) {
+			id := r.streamID()
+			for next < len(delivered) && delivered[next].ID.Less(id) {
+				out = append(out, StreamEntry{ID: delivered[next].ID})
+				next++
+			}
+			if next < len(delivered) && delivered[next].ID == id {
+				out = append(out, StreamEntry{ID: id, Fields: r.fields()})
+				next++
+				continue
+			}
+			r.skipFields()
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		for ; next < len(delivered); next++ {
+			out = append(out, StreamEntry{ID: delivered[next].ID})
+		}
+
+		now := time.Now()
+		for _, p := range delivered {
+			p.Delivered = now
+			p.Deliveries++
+		}
+		return groups, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StreamAck removes entries from group pending entries and returns removed entries count
+func (c *CacheDb) StreamAck(key string, group string, ids []StreamID) (int, error) {
+	acked := 0
+	err := c.updateGroups(key, false, func(data []byte, h *streamHeader, groups []*streamGroup) ([]*streamGroup, error) {
+		g := findGroup(groups, group)
+		if g == nil {
+			return nil, groupNotFoundErr
+		}
+
+		for _, id := range ids {
+			i := sort.Search(len(g.pending), func(i int) bool {
+				return !g.pending[i].ID.Less(id)
+			})
+			if i < len(g.pending) && g.pending[i].ID == id {
+				g.pending = append(g.pending[:i], g.pending[i+1:]...)
+				acked++
+			}
+		}
+		return groups, nil
+	})
+	return acked, err
+}
+
+// StreamPending returns group pending entries of consumer, empty consumer returns entries of all consumers
+func (c *CacheDb) StreamPending(key string, group string, consumer string) ([]PendingEntry, error) {
+	out := []PendingEntry{}
+	err := c.viewStream(key, func(data []byte, h *streamHeader) error {
+		groups, err := h.readGroups(data)
+		if err != nil {
+			return err
+		}
+
+		g := findGroup(groups, group)
+		if g == nil {
+			return groupNotFoundErr
+		}
+		for _, p := range g.pending {
+			if consumer == "" || p.Consumer == consumer {
+				out = append(out, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// viewStream calls fn with stream data under read lock, fn must copy data it returns
+func (c *CacheDb) viewStream(key string, fn func(data []byte, h *streamHeader) error) error {
+	id := blockByKey(key)
+	c.locks[id].RLock()
+	data, ok := c.blocks[id][key]
+	if !ok {
+		c.locks[id].RUnlock()
+		return ErrNotFound
+	}
+
+	entry := readEntry(data)
+	if entry.expired(time.Now().Unix()) {
+		c.locks[id].RUnlock()
+		c.expire(id, key)
+		return ErrNotFound
+	}
+	if entry.keyType != keyStream {
+		c.locks[id].RUnlock()
+		return ErrWrongType
+	}
+
+	h, err := readStreamHeader(data)
+	if err == nil {
+		err = fn(data, &h)
+	}
+	c.locks[id].RUnlock()
+	return err
+}
+
+// updateStream applies fn to stream data and stores returned data if fn succeeds, TTL of stream is kept.
+// fn changes data in place, so it must return error before data is changed.
+// Not existing stream is created if create is true
+func (c *CacheDb) updateStream(key string, create bool, fn func(data []byte, h *streamHeader) ([]byte, error)) error {
+	id := blockByKey(key)
+	c.locks[id].Lock()
+
+	var expired bool
+	data, ok := c.blocks[id][key]
+	if ok {
+		entry := readEntry(data)
+		switch {
+		case entry.expired(time.Now().Unix()):
+			delete(c.blocks[id], key)
+			ok, expired = false, true
+		case entry.keyType != keyStream:
+			c.locks[id].Unlock()
+			return ErrWrongType
+		}
+	}
+
+	var err error
+	if !ok && !create {
+		err = ErrNotFound
+	} else {
+		if !ok {
+			data = newEntry(keyStream, 0, emptyStream())
+		}
+
+		var h streamHeader
+		if h, err = readStreamHeader(data); err == nil {
+			if data, err = fn(data, &h); err == nil {
+				setValueLength(data)
+				c.blocks[id][key] = data
+			}
+		}
+	}
+	c.locks[id].Unlock()
+
+	if expired {
+		c.emit(EventExpire, key, keyStream)
+	}
+	return err
+}
+
+// updateGroups applies fn to consumer groups of stream and replaces groups by returned groups if fn succeeds,
+// entries are not changed
+func (c *CacheDb) updateGroups(key string, create bool,
+	fn func(data []byte, h *streamHeader, groups []*streamGroup) ([]*streamGroup, error)) error {
+	return c.updateStream(key, create, func(data []byte, h *streamHeader) ([]byte, error) {
+		groups, err := h.readGroups(data)
+		if err != nil {
+			return nil, err
+		}
+		if groups, err = fn(data, h, groups); err != nil {
+			return nil, err
+		}
+		return h.writeGroups(data, groups), nil
+	})
+}
+
+func findGroup(groups []*streamGroup, name string) *streamGroup {
+	for _, g := range groups {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// emptyStream returns stream value without entries and groups
+func emptyStream() []byte {
+	value := make([]byte, streamHeaderLen+2)
+	binary.LittleEndian.PutUint32(value[20:], streamHeaderLen)
+	return value
+}
+
+// readStreamHeader returns header of stream data, groups offset out of data returns error
+func readStreamHeader(data []byte) (streamHeader, error) {
+	value := data[headerLen:]
+	if len(value) < streamHeaderLen+2 {
+		return streamHeader{}, incorrectRecordErr
+	}
+
+	h := streamHeader{
+		lastID: StreamID{binary.LittleEndian.Uint64(value), binary.LittleEndian.Uint64(value[8:])},
+		count:  int(binary.LittleEndian.Uint32(value[16:])),
+		groups: int(binary.LittleEndian.Uint32(value[20:])),
+	}
+	if h.groups < streamHeaderLen || h.groups > len(value)-2 {
+		return streamHeader{}, incorrectRecordErr
+	}
+	return h, nil
+}
+
+// put writes header to stream data
+func (h *streamHeader) put(data []byte) {
+	value := data[headerLen:]
+	binary.LittleEndian.PutUint64(value, h.lastID.Ms)
+	binary.LittleEndian.PutUint64(value[8:], h.lastID.Seq)
+	binary.LittleEndian.PutUint32(value[16:], uint32(h.count))
+	binary.LittleEndian.PutUint32(value[20:], uint32(h.groups))
+}
+
+// nextID returns id generated from ms greater than last stream id
+func (h *streamHeader) nextID(ms uint64) StreamID {
+	if ms > h.lastID.Ms {
+		return StreamID{ms, 0}
+	}
+	return StreamID{h.lastID.Ms, h.lastID.Seq + 1}
+}
+
+// entries returns reader of entries of stream data: id, fields count, fields
+func (h *streamHeader) entries(data []byte) *streamReader {
+	return &streamReader{data: data[:headerLen+h.groups], off: streamEntries}
+}
+
+// appendEntry appends entry to entries of stream data in place, groups are moved after it
+func (h *streamHeader) appendEntry(data []byte, entry StreamEntry) []byte {
+	buff := appendStreamID(nil, entry.ID)
+	buff = binary.LittleEndian.AppendUint16(buff, uint16(len(entry.Fields)))
+	for _, field := range entry.Fields {
+		buff = appendBytes(buff, field)
+	}
+
+	groups := headerLen + h.groups
+	data = append(data, buff...)
+	copy(data[groups+len(buff):], data[groups:len(data)-len(buff)])
+	copy(data[groups:], buff)
+
+	h.lastID, h.count, h.groups = entry.ID, h.count+1, h.groups+len(buff)
+	h.put(data)
+	return data
+}
+
+// trim removes removed oldest entries of stream data. Headers are moved over removed entries in place,
+// memory of removed entries is released when data is reallocated by append
+func (h *streamHeader) trim(data []byte, removed int) ([]byte, error) {
+	r := h.entries(data)
+	for i := 0; i < removed; i++ {
+		r.streamID()
+		r.skipFields()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	cut := r.off - streamEntries
+	copy(data[cut:cut+streamEntries], data[:streamEntries])
+	data = data[cut:]
+
+	h.count, h.groups = h.count-removed, h.groups-cut
+	h.put(data)
+	return data, nil
+}
+
+// readGroups decodes groups of stream data: groups count, groups with last delivered id and pending entries
+func (h *streamHeader) readGroups(data []byte) ([]*streamGroup, error) {
+	r := &streamReader{data: data, off: headerLen + h.groups}
+	groups := make([]*streamGroup, r.elements(int(r.uint16()), minGroupLen))
+	for i := range groups {
+		g := &streamGroup{name: string(r.bytes()), lastDelivered: r.streamID()}
+		g.pending = make([]PendingEntry, r.elements(int(r.uint32()), minPendingLen))
+		for j := range g.pending {
+			g.pending[j] = PendingEntry{
+				ID:         r.streamID(),
+				Consumer:   string(r.bytes()),
+				Delivered:  time.UnixMilli(int64(r.uint64())),
+				Deliveries: r.uint32(),
+			}
+		}
+		groups[i] = g
+	}
+
+	if r.err == nil && r.more() {
+		return nil, incorrectRecordErr
+	}
+	return groups, r.err
+}
+
+// writeGroups replaces groups of stream data in place
+func (h *streamHeader) writeGroups(data []byte, groups []*streamGroup) []byte {
+	buff := binary.LittleEndian.AppendUint16(data[:headerLen+h.groups], uint16(len(groups)))
+	for _, g := range groups {
+		buff = appendBytes(buff, []byte(g.name))
+		buff = appendStreamID(buff, g.lastDelivered)
+		buff = binary.LittleEndian.AppendUint32(buff, uint32(len(g.pending)))
+		for _, p := range g.pending {
+			buff = appendStreamID(buff, p.ID)
+			buff = appendBytes(buff, []byte(p.Consumer))
+			buff = binary.LittleEndian.AppendUint64(buff, uint64(p.Delivered.UnixMilli()))
+			buff = binary.LittleEndian.AppendUint32(buff, p.Deliveries)
+		}
+	}
+	return buff
+}
+
+// validStream returns error if value of stream data is not a correct stream encoding
+func validStream(data []byte) error {
+	h, err := readStreamHeader(data)
+	if err != nil {
+		return err
+	}
+
+	r := h.entries(data)
+	count := 0
+	for last := (StreamID{}); r.more(); count++ {
+		id := r.streamID()
+		if count > 0 && !last.Less(id) || h.lastID.Less(id) {
+			return incorrectRecordErr
+		}
+		r.skipFields()
+		last = id
+	}
+	if r.err != nil || count != h.count {
+		return incorrectRecordErr
+	}
+
+	_, err = h.readGroups(data)
+	return err
+}
+
+func appendStreamID(buff []byte, id StreamID) []byte {
+	buff = binary.LittleEndian.AppendUint64(buff, id.Ms)
+	return binary.LittleEndian.AppendUint64(buff, id.Seq)
+}
+
+func appendBytes(buff []byte, data []byte) []byte {
+	buff = binary.LittleEndian.AppendUint16(buff, uint16(len(data)))
+	return append(buff, data...)
+}
+
+// more returns true if data is not read to the end
+func (r *streamReader) more() bool {
+	return r.err == nil && r.off < len(r.data)
+}
+
+// next returns n bytes of data, n out of data sets err
+func (r *streamReader) next(n int) []byte {
+	if r.err != nil || n > len(r.data)-r.off {
+		r.err = incorrectRecordErr
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+// elements returns count of elements of minLen if they fit rest of data
+func (r *streamReader) elements(count int, minLen int) int {
+	if r.err == nil && count > (len(r.data)-r.off)/minLen {
+		r.err = incorrectRecordErr
+	}
+	if r.err != nil {
+		return 0
+	}
+	return count
+}
+
+func (r *streamReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *streamReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *streamReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *streamReader) streamID() StreamID {
+	return StreamID{r.uint64(), r.uint64()}
+}
+
+func (r *streamReader) bytes() []byte {
+	b := r.next(int(r.uint16()))
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+// fields reads field value pairs of entry
+func (r *streamReader) fields() [][]byte {
+	fields := make([][]byte, r.elements(int(r.uint16()), minFieldLen))
+	for i := range fields {
+		fields[i] = r.bytes()
+	}
+	return fields
+}
+
+func (r *streamReader) skipFields() {
+	for i := r.elements(int(r.uint16()), minFieldLen); i > 0; i-- {
+		r.next(int(r.uint16()))
+	}
+}
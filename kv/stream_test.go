@@ -0,0 +1,245 @@
+package kv
+
+import (
+	"fmt"
+	"testing"
+)
+
+func streamFields(fields ...string) [][]byte {
+	out := make([][]byte, len(fields))
+	for i, field := range fields {
+		out[i] = []byte(field)
+	}
+	return out
+}
+
+func streamIDs(entries []StreamEntry) string {
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID.String()
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestStream(t *testing.T) {
+	cache := NewCacheDb()
+
+	for i := 1; i <= 5; i++ {
+		id, err := cache.StreamAdd("log", StreamID{Ms: uint64(i)}, streamFields("n", fmt.Sprint(i)), 0)
+		if err != nil {
+			t.Fatal("Add error", err)
+		}
+		if id != (StreamID{Ms: uint64(i)}) {
+			t.Fatal("Incorrect id", "expected", i, "got", id)
+		}
+	}
+
+	if _, err := cache.StreamAdd("log", StreamID{Ms: 5}, streamFields("n", "5"), 0); err != smallStreamIDErr {
+		t.Fatal("Incorrect error", "expected", smallStreamIDErr, "got", err)
+	}
+	if _, err := cache.StreamAdd("log", StreamID{}, streamFields("n"), 0); err != streamFieldsErr {
+		t.Fatal("Incorrect error", "expected", streamFieldsErr, "got", err)
+	}
+
+	//generated ids are monotonic
+	prev := StreamID{Ms: 5}
+	for i := 0; i < 3; i++ {
+		id, _ := cache.StreamAdd("auto", StreamID{}, streamFields("n", "1"), 0)
+		if !prev.Less(id) {
+			t.Fatal("Incorrect generated id", "expected greater than", prev, "got", id)
+		}
+		prev = id
+	}
+
+	type (
+		testCase struct {
+			start    StreamID
+			end      StreamID
+			count    int
+			reverse  bool
+			expected string
+		}
+	)
+
+	testCases := []testCase{
+		{StreamID{}, MaxStreamID, 0, false, "[1-0 2-0 3-0 4-0 5-0]"},
+		{StreamID{Ms: 2}, StreamID{Ms: 3, Seq: 5}, 0, false, "[2-0 3-0]"},
+		{StreamID{}, MaxStreamID, 2, true, "[5-0 4-0]"},
+		{StreamID{Ms: 4}, StreamID{Ms: 2}, 0, false, "[]"},
+	}
+
+	for _, c := range testCases {
+		entries, err := cache.StreamRange("log", c.start, c.end, c.count, c.reverse)
+		if err != nil || streamIDs(entries) != c.expected {
+			t.Fatal("Incorrect range", "expected", c.expected, "got", streamIDs(entries), err)
+		}
+	}
+
+	entries, _ := cache.StreamRange("log", StreamID{Ms: 3}, StreamID{Ms: 3}, 0, false)
+	if fmt.Sprintf("%s", entries[0].Fields) != "[n 3]" {
+		t.Fatal("Incorrect fields", "expected", "[n 3]", "got", fmt.Sprintf("%s", entries[0].Fields))
+	}
+
+	removed, _ := cache.StreamTrimMinID("log", StreamID{Ms: 2})
+	if removed != 1 {
+		t.Fatal("Incorrect removed entries", "expected", 1, "got", removed)
+	}
+	removed, _ = cache.StreamTrimLen("log", 2)
+	if removed != 2 {
+		t.Fatal("Incorrect removed entries", "expected", 2, "got", removed)
+	}
+	cache.StreamAdd("log", StreamID{}, streamFields("n", "6"), 2)
+
+	if length, _ := cache.StreamLen("log"); length != 2 {
+		t.Fatal("Incorrect length", "expected", 2, "got", length)
+	}
+	if length, err := cache.StreamLen("unknown"); length != 0 || err != nil {
+		t.Fatal("Incorrect length of not existing stream", length, err)
+	}
+
+	cache.Set("string", 0, []byte("value"))
+	if _, err := cache.StreamAdd("string", StreamID{}, streamFields("n", "1"), 0); err != ErrWrongType {
+		t.Fatal("Incorrect error", "expected", ErrWrongType, "got", err)
+	}
+}
+
+func TestStreamGroups(t *testing.T) {
+	cache := NewCacheDb()
+
+	if err := cache.StreamGroupCreate("jobs", "workers", StreamID{}, false); err != ErrNotFound {
+		t.Fatal("Incorrect error", "expected", ErrNotFound, "got", err)
+	}
+	if err := cache.StreamGroupCreate("jobs", "workers", StreamID{}, true); err != nil {
+		t.Fatal("Group create error", err)
+	}
+	if err := cache.StreamGroupCreate("jobs", "workers", StreamID{}, false); err != groupExistsErr {
+		t.Fatal("Incorrect error", "expected", groupExistsErr, "got", err)
+	}
+
+	for i := 1; i <= 4; i++ {
+		cache.StreamAdd("jobs", StreamID{Ms: uint64(i)}, streamFields("job", fmt.Sprint(i)), 0)
+	}
+
+	//new group delivers new entries only
+	cache.StreamGroupCreate("jobs", "late", MaxStreamID, false)
+	if entries, _ := cache.StreamReadGroup("jobs", "late", "a", 0); len(entries) != 0 {
+		t.Fatal("Incorrect entries", "expected", "[]", "got", streamIDs(entries))
+	}
+
+	entries, _ := cache.StreamReadGroup("jobs", "workers", "a", 3)
+	if streamIDs(entries) != "[1-0 2-0 3-0]" {
+		t.Fatal("Incorrect entries", "expected", "[1-0 2-0 3-0]", "got", streamIDs(entries))
+	}
+	entries, _ = cache.StreamReadGroup("jobs", "workers", "b", 0)
+	if streamIDs(entries) != "[4-0]" {
+		t.Fatal("Incorrect entries", "expected", "[4-0]", "got", streamIDs(entries))
+	}
+
+	acked, _ := cache.StreamAck("jobs", "workers", []StreamID{{Ms: 2}, {Ms: 2}, {Ms: 9}})
+	if acked != 1 {
+		t.Fatal("Incorrect acked entries", "expected", 1, "got", acked)
+	}
+
+	pending, _ := cache.StreamPending("jobs", "workers", "")
+	if len(pending) != 3 || pending[0].Consumer != "a" || pending[2].Consumer != "b" {
+		t.Fatal("Incorrect pending entries", pending)
+	}
+
+	//pending entries are delivered again
+	cache.StreamTrimMinID("jobs", StreamID{Ms: 3})
+	entries, _ = cache.StreamReadPending("jobs", "workers", "a", StreamID{}, 0)
+	if streamIDs(entries) != "[1-0 3-0]" || entries[0].Fields != nil || entries[1].Fields == nil {
+		t.Fatal("Incorrect pending entries", "expected", "[1-0 3-0]", "got", streamIDs(entries))
+	}
+
+	pending, _ = cache.StreamPending("jobs", "workers", "a")
+	if len(pending) != 2 || pending[0].Deliveries != 2 {
+		t.Fatal("Incorrect pending entries", pending)
+	}
+
+	if err := cache.StreamGroupDestroy("jobs", "workers"); err != nil {
+		t.Fatal("Group destroy error", err)
+	}
+	if _, err := cache.StreamPending("jobs", "workers", ""); err != groupNotFoundErr {
+		t.Fatal("Incorrect error", "expected", groupNotFoundErr, "got", err)
+	}
+}
+
+func TestStreamAppend(t *testing.T) {
+	cache := NewCacheDb()
+	cache.StreamGroupCreate("log", "workers", StreamID{}, true)
+
+	//groups are moved after appended entries and trimmed entries are cut from head
+	for i := 1; i <= 100; i++ {
+		if _, err := cache.StreamAdd("log", StreamID{Ms: uint64(i)}, streamFields("n", fmt.Sprint(i)), 10); err != nil {
+			t.Fatal("Add error", err)
+		}
+		if i%7 == 0 {
+			cache.StreamReadGroup("log", "workers", "a", 2)
+		}
+	}
+
+	entries, _ := cache.StreamRange("log", StreamID{}, MaxStreamID, 0, false)
+	if streamIDs(entries) != "[91-0 92-0 93-0 94-0 95-0 96-0 97-0 98-0 99-0 100-0]" {
+		t.Fatal("Incorrect entries", streamIDs(entries))
+	}
+	if fmt.Sprintf("%s", entries[9].Fields) != "[n 100]" {
+		t.Fatal("Incorrect fields", "expected", "[n 100]", "got", fmt.Sprintf("%s", entries[9].Fields))
+	}
+	if pending, _ := cache.StreamPending("log", "workers", "a"); len(pending) != 28 || pending[27].ID != (StreamID{Ms: 90}) {
+		t.Fatal("Incorrect pending entries", pending)
+	}
+
+	record, _ := cache.Dump("log")
+	if entry := readEntry(record); entry.length != uint64(len(record)-headerLen) {
+		t.Fatal("Incorrect record length", "expected", len(record)-headerLen, "got", entry.length)
+	}
+}
+
+func TestStreamCorrupt(t *testing.T) {
+	cache := NewCacheDb()
+	cache.StreamAdd("log", StreamID{Ms: 1}, streamFields("n", "1"), 0)
+	cache.StreamGroupCreate("log", "workers", StreamID{}, false)
+	record, _ := cache.Dump("log")
+	value := record[headerLen:]
+
+	corrupt := func(change func(value []byte) []byte) {
+		data := append([]byte(nil), value...)
+		cache.blocks[blockByKey("log")]["log"] = newEntry(keyStream, 0, change(data))
+	}
+
+	type (
+		testCase struct {
+			change func(value []byte) []byte
+			// groups are corrupt, entries are read
+			groups bool
+		}
+	)
+
+	testCases := map[string]testCase{
+		"short header":  {func(value []byte) []byte { return value[:10] }, false},
+		"groups offset": {func(value []byte) []byte { value[20] = 0xff; return value }, false},
+		"fields count":  {func(value []byte) []byte { value[streamHeaderLen+16] = 0xff; return value }, false},
+		"field length":  {func(value []byte) []byte { value[streamHeaderLen+18] = 0xff; return value }, false},
+		"group name":    {func(value []byte) []byte { value[len(value)-29] = 0xff; return value }, true},
+		"truncated":     {func(value []byte) []byte { return value[:len(value)-1] }, true},
+	}
+
+	for name, c := range testCases {
+		corrupt(c.change)
+		_, rangeErr := cache.StreamRange("log", StreamID{}, MaxStreamID, 0, false)
+		_, addErr := cache.StreamAdd("log", StreamID{}, streamFields("n", "2"), 1)
+		_, readErr := cache.StreamReadGroup("log", "workers", "a", 0)
+		_, pendingErr := cache.StreamPending("log", "workers", "")
+
+		errs := []error{rangeErr, addErr, readErr}
+		if c.groups {
+			errs = []error{readErr, pendingErr}
+		}
+		for _, err := range errs {
+			if err != incorrectRecordErr {
+				t.Fatal("Incorrect error of corrupt stream", name, "expected", incorrectRecordErr, "got", err)
+			}
+		}
+	}
+}
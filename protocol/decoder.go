@@ -0,0 +1,217 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+type (
+	// Decoder reads protocol frames
+	Decoder struct {
+		r         *bufio.Reader
+		maxLength uint32
+	}
+)
+
+// NewDecoder returns decoder of frames with strings up to DefaultMaxLength
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), maxLength: DefaultMaxLength}
+}
+
+// SetMaxLength limits length of strings in frames, longer strings fail with ErrTooLarge.
+// Zero length means no limit
+func (d *Decoder) SetMaxLength(l uint32) {
+	d.maxLength = l
+}
+
+// DecodeRequest returns command bytes of next request frame
+// and true if client accepts streamed responses
+func (d *Decoder) DecodeRequest() ([]byte, bool, error) {
+	header, err := d.r.ReadByte()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if header != RequestHeader && header != StreamRequestHeader {
+		return nil, false, ErrIncorrectHeader
+	}
+
+	cmd, err := d.readBytes()
+	return cmd, header == StreamRequestHeader, err
+}
+
+// Peek waits until next frame is available without reading it, returns read error
+func (d *Decoder) Peek() error {
+	_, err := d.r.Peek(1)
+	return err
+}
+
+// DecodeResponse returns data of next response frame.
+// Result is nil, string, []string or map[string]string by data type,
+// streamed responses are read completely, push frame is returned as Push.
+// Not found frame returns ErrNotFound, error frame returns *Error
+func (d *Decoder) DecodeResponse() (interface{}, error) {
+	dataType, err := d.decodeHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	if dataType == pushDataType {
+		data, err := d.decodeData(TypeList)
+		if err != nil {
+			return nil, err
+		}
+		return Push(data.([]string)), nil
+	}
+
+	return d.decodeData(dataType)
+}
+
+// DecodeStream returns reader of list or dictionary response elements.
+// Not streamed list and dictionary responses are read completely.
+func (d *Decoder) DecodeStream() (*StreamReader, error) {
+	dataType, err := d.decodeHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	switch dataType {
+	case TypeListStream, TypeDictStream:
+		return &StreamReader{d: d, dataType: dataType}, nil
+	case TypeList, TypeDict:
+		data, err := d.decodeData(dataType)
+		if err != nil {
+			return nil, err
+		}
+		return newBufferedStreamReader(data), nil
+	default:
+		d.decodeData(dataType)
+		return nil, ErrIncorrectDataType
+	}
+}
+
+// decodeHeader reads response header and returns data type of success response
+func (d *Decoder) decodeHeader() (byte, error) {
+	header, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch header {
+	case OkHeader:
+		return d.r.ReadByte()
+	case PushHeader:
+		return pushDataType, nil
+	case NotFoundHeader:
+		return 0, ErrNotFound
+	case ErrHeader:
+		code, err := d.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		message, err := d.readBytes()
+		if err != nil {
+			return 0, err
+		}
+		return 0, &Error{Code: code, Message: string(message)}
+	default:
+		return 0, ErrIncorrectHeader
+	}
+}
+
+func (d *Decoder) decodeData(dataType byte) (interface{}, error) {
+	switch dataType {
+	case TypeNone:
+		return nil, nil
+	case TypeString:
+		data, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case TypeList:
+		cnt, err := d.readUint32()
+		if err != nil {
+			return nil, err
+		}
+
+		out := make([]string, 0, min(cnt, maxPreallocCount))
+		for i := 0; i < int(cnt); i++ {
+			data, err := d.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, string(data))
+		}
+		return out, nil
+	case TypeDict:
+		cnt, err := d.readUint32()
+		if err != nil {
+			return nil, err
+		}
+
+		out := map[string]string{}
+		for i := 0; i < int(cnt); i++ {
+			key, err := d.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			out[string(key)] = string(value)
+		}
+		return out, nil
+	case TypeListStream:
+		out := []string{}
+		s := &StreamReader{d: d, dataType: dataType}
+		for s.Next() {
+			out = append(out, s.Elem())
+		}
+		return out, s.Err()
+	case TypeDictStream:
+		out := map[string]string{}
+		s := &StreamReader{d: d, dataType: dataType}
+		for s.Next() {
+			out[s.Key()] = s.Value()
+		}
+		return out, s.Err()
+	default:
+		return nil, ErrIncorrectDataType
+	}
+}
+
+func (d *Decoder) readUint32() (uint32, error) {
+	data := make([]byte, 4)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return 0, err
+	}
+	return BytesToUint32(data), nil
+}
+
+func (d *Decoder) readBytes() ([]byte, error) {
+	l, err := d.readUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.readN(l)
+}
+
+func (d *Decoder) readN(l uint32) ([]byte, error) {
+	if d.maxLength > 0 && l > d.maxLength {
+		return nil, ErrTooLarge
+	}
+
+	//buffer grows with received data, length prefix alone does not allocate memory
+	buff := bytes.NewBuffer(make([]byte, 0, min(l, maxPreallocLength)))
+	if _, err := io.CopyN(buff, d.r, int64(l)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
@@ -0,0 +1,110 @@
+/*
+Package protocol implements the binary wire protocol spoken by kv-server
+tcp listener and the Go client.
+
+All integers are unsigned 32 bit little-endian values (further "uint32").
+Strings are encoded as uint32 length followed by raw bytes.
+
+# Request
+
+A request is a single frame carrying a text command
+(see README for command syntax, for example "SET key 10 value"):
+
+	0x11 | uint32 command length | command bytes
+
+Header 0x12 instead of 0x11 marks that client accepts streamed responses.
+
+# Response
+
+The first byte of a response frame is a header:
+
+	0x22 | data type | payload      - success
+	0x33 | uint32 count | count * string - push message
+	0x44                            - key not found
+	0x99 | code | string            - error
+
+Error code is a single byte:
+
+	0x01 - internal error
+	0x02 - bad request (incorrect command, arguments or ttl)
+	0x03 - not found
+	0x04 - wrong key type
+	0x05 - too large request or value
+	0x06 - write command sent to read only replica
+	0x07 - key slot belongs to other cluster node, see Cluster
+	0x08 - key slot is migrating to other cluster node, see Cluster
+	0x09 - maximum connections count is reached, server closes connection after error
+	0x0a - connection is not authenticated or credentials are incorrect, see Authentication
+	0x0b - authenticated user has no permission of command or key, see Authentication
+
+Success payload depends on data type byte:
+
+	0x50                                      - no data
+	0x51 | string                             - string
+	0x52 | uint32 count | count * string      - list
+	0x53 | uint32 count | count * (string, string) - dictionary as key/value pairs
+
+Dictionary pairs order is not defined.
+
+Streamed responses are sent only for requests with 0x12 header,
+elements are written as they are produced and terminated by end marker 0xffffffff:
+
+	0x54 | string * n | 0xffffffff           - list
+	0x55 | (string, string) * n | 0xffffffff - dictionary
+
+# Push messages
+
+Connection subscribed by SUBSCRIBE or PSUBSCRIBE command receives push frames only,
+the first string is a message kind:
+
+	"subscribe", channel, subscriptions count
+	"unsubscribe", channel, subscriptions count
+	"psubscribe", pattern, subscriptions count
+	"punsubscribe", pattern, subscriptions count
+	"message", channel, payload
+	"pmessage", pattern, channel, payload
+
+Connection returns to request/response mode when subscriptions count is zero.
+
+# Monitor
+
+MONITOR is answered with empty response, then connection receives push message "monitor", command line
+for every command executed by server. Other requests are answered with bad request error.
+
+# Authentication
+
+Server with configured users answers every request except "AUTH <user> <password>" with error
+code 0x0a until connection is authenticated. Successful AUTH is answered with empty response,
+authentication lasts until connection is closed. TLS connection with client certificate of user
+subject common name is authenticated without AUTH. Commands and keys which are not granted
+to user are answered with error code 0x0b.
+
+# Replication
+
+Replica sends request "SYNC <replication id> <offset>", "?" id requests full snapshot.
+Primary answers with push message "FULLRESYNC", replication id, offset, followed by
+streamed list of snapshot chunks, or with push message "CONTINUE", replication id
+if commands after offset are still in replication backlog. Then connection receives push frames:
+
+	"RESTORE", key, dump record - key is set to record
+	"REMOVE", key               - key is removed
+	"PING"                      - heartbeat
+
+Every RESTORE and REMOVE message increments replica offset.
+
+# Cluster
+
+Keys of cluster are distributed between nodes by 16384 hash slots, slot is CRC-16/XMODEM
+of key (or of non empty "{tag}" part of key) modulo 16384, see KeySlot.
+Node answers command of key owned by other node with error code 0x07 and message ending
+with "MOVED <slot> <host:port>", client has to send the command to the node and may update
+its slot map. Error code 0x08 with message ending with "ASK <slot> <host:port>" means
+that slot is migrating and key has to be requested once from the node with "ASKING" request
+sent just before the command on the same connection.
+
+Nodes exchange their views of the cluster by "CLUSTER GOSSIP <json>" requests.
+
+A connection may carry any number of request/response pairs,
+responses are sent in the same order as requests.
+*/
+package protocol
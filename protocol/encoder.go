@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+type (
+	// Encoder writes protocol frames, every frame is written by single Write call
+	Encoder struct {
+		w    io.Writer
+		buff []byte
+	}
+)
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func (e *Encoder) EncodeRequest(cmd []byte) error {
+	e.buff = append(e.buff[:0], RequestHeader)
+	e.appendBytes(cmd)
+	return e.flush()
+}
+
+// EncodeStreamRequest writes request which accepts streamed list and dictionary responses
+func (e *Encoder) EncodeStreamRequest(cmd []byte) error {
+	e.buff = append(e.buff[:0], StreamRequestHeader)
+	e.appendBytes(cmd)
+	return e.flush()
+}
+
+func (e *Encoder) EncodeNone() error {
+	e.buff = append(e.buff[:0], OkHeader, TypeNone)
+	return e.flush()
+}
+
+func (e *Encoder) EncodeString(data string) error {
+	e.buff = append(e.buff[:0], OkHeader, TypeString)
+	e.appendString(data)
+	return e.flush()
+}
+
+func (e *Encoder) EncodeList(data []string) error {
+	e.buff = append(e.buff[:0], OkHeader, TypeList)
+	e.appendUint32(uint32(len(data)))
+	for _, elem := range data {
+		e.appendString(elem)
+	}
+	return e.flush()
+}
+
+func (e *Encoder) EncodeDict(data map[string]string) error {
+	e.buff = append(e.buff[:0], OkHeader, TypeDict)
+	e.appendUint32(uint32(len(data)))
+	for k, v := range data {
+		e.appendString(k)
+		e.appendString(v)
+	}
+	return e.flush()
+}
+
+// BeginList starts streamed list response, elements are written by EncodeElement
+// and response is finished by End
+func (e *Encoder) BeginList() {
+	e.buff = append(e.buff[:0], OkHeader, TypeListStream)
+}
+
+// BeginDict starts streamed dictionary response, pairs are written by EncodePair
+// and response is finished by End
+func (e *Encoder) BeginDict() {
+	e.buff = append(e.buff[:0], OkHeader, TypeDictStream)
+}
+
+func (e *Encoder) EncodeElement(elem string) error {
+	e.appendString(elem)
+	return e.flushStream()
+}
+
+func (e *Encoder) EncodePair(key string, value string) error {
+	e.appendString(key)
+	e.appendString(value)
+	return e.flushStream()
+}
+
+func (e *Encoder) End() error {
+	e.appendUint32(streamEnd)
+	return e.flush()
+}
+
+// EncodePush writes push message frame
+func (e *Encoder) EncodePush(data []string) error {
+	e.buff = append(e.buff[:0], PushHeader)
+	e.appendUint32(uint32(len(data)))
+	for _, elem := range data {
+		e.appendString(elem)
+	}
+	return e.flush()
+}
+
+func (e *Encoder) EncodeNotFound() error {
+	e.buff = append(e.buff[:0], NotFoundHeader)
+	return e.flush()
+}
+
+func (e *Encoder) EncodeError(code byte, message string) error {
+	e.buff = append(e.buff[:0], ErrHeader, code)
+	e.appendString(message)
+	return e.flush()
+}
+
+// Encode writes success response by value type, unknown types are sent as no data
+func (e *Encoder) Encode(v interface{}) error {
+	switch data := v.(type) {
+	case string:
+		return e.EncodeString(data)
+	case []string:
+		return e.EncodeList(data)
+	case map[string]string:
+		return e.EncodeDict(data)
+	default:
+		return e.EncodeNone()
+	}
+}
+
+func (e *Encoder) appendUint32(v uint32) {
+	e.buff = binary.LittleEndian.AppendUint32(e.buff, v)
+}
+
+func (e *Encoder) appendString(data string) {
+	e.appendUint32(uint32(len(data)))
+	e.buff = append(e.buff, data...)
+}
+
+func (e *Encoder) appendBytes(data []byte) {
+	e.appendUint32(uint32(len(data)))
+	e.buff = append(e.buff, data...)
+}
+
+func (e *Encoder) flush() error {
+	_, err := e.w.Write(e.buff)
+	e.buff = e.buff[:0]
+	return err
+}
+
+func (e *Encoder) flushStream() error {
+	if len(e.buff) < streamFlushSize {
+		return nil
+	}
+	return e.flush()
+}
@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	RequestHeader       = 0x11
+	StreamRequestHeader = 0x12
+	OkHeader            = 0x22
+	PushHeader          = 0x33
+	NotFoundHeader      = 0x44
+	ErrHeader           = 0x99
+
+	TypeNone   = 0x50
+	TypeString = 0x51
+	TypeList   = 0x52
+	TypeDict   = 0x53
+
+	TypeListStream = 0x54
+	TypeDictStream = 0x55
+
+	CodeInternal     = 0x01
+	CodeBadRequest   = 0x02
+	CodeNotFound     = 0x03
+	CodeWrongType    = 0x04
+	CodeTooLarge     = 0x05
+	CodeReadOnly     = 0x06
+	CodeMoved        = 0x07
+	CodeAsk          = 0x08
+	CodeMaxClients   = 0x09
+	CodeUnauthorized = 0x0a
+	CodeNoPermission = 0x0b
+
+	// pushDataType is internal data type of push frame payload
+	pushDataType = 0x00
+
+	// streamEnd is a length value which finishes streamed response
+	streamEnd = 0xffffffff
+	// streamFlushSize is a buffered size of streamed response which is flushed to writer
+	streamFlushSize = 32 * 1024
+
+	// DefaultMaxLength is a default limit of string length in decoded frames
+	DefaultMaxLength = 64 << 20
+
+	// maxPreallocLength and maxPreallocCount limit memory allocated by length and count prefixes before data is read
+	maxPreallocLength = 64 << 10
+	maxPreallocCount  = 1024
+)
+
+var (
+	ErrNotFound          = errors.New("Not found")
+	ErrTooLarge          = errors.New("Frame is too large")
+	ErrIncorrectHeader   = errors.New("Incorrect frame header")
+	ErrIncorrectDataType = errors.New("Incorrect data type")
+)
+
+type (
+	// Push is a message pushed by server to subscribed connection
+	Push []string
+
+	// Error is a error frame sent by server
+	Error struct {
+		Code    byte
+		Message string
+	}
+)
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func BytesToUint32(data []byte) uint32 {
+	return binary.LittleEndian.Uint32(data[0:4])
+}
+
+func Uint32ToBytes(v uint32) []byte {
+	out := make([]byte, 4)
+	binary.LittleEndian.PutUint32(out, v)
+
+	return out
+}
@@ -0,0 +1,268 @@
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	f := func(cmd []byte) bool {
+		buff := &bytes.Buffer{}
+		if err := NewEncoder(buff).EncodeRequest(cmd); err != nil {
+			t.Fatal("Encode error", err)
+		}
+
+		out, stream, err := NewDecoder(buff).DecodeRequest()
+		if err != nil {
+			t.Fatal("Decode error", err)
+		}
+		return bytes.Equal(cmd, out) && !stream
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	roundTrip := func(v interface{}) interface{} {
+		buff := &bytes.Buffer{}
+		if err := NewEncoder(buff).Encode(v); err != nil {
+			t.Fatal("Encode error", err)
+		}
+
+		out, err := NewDecoder(buff).DecodeResponse()
+		if err != nil {
+			t.Fatal("Decode error", err)
+		}
+		return out
+	}
+
+	stringCase := func(data string) bool {
+		return roundTrip(data) == data
+	}
+
+	listCase := func(data []string) bool {
+		out := roundTrip(data).([]string)
+		return len(out) == len(data) && (len(data) == 0 || reflect.DeepEqual(out, data))
+	}
+
+	dictCase := func(data map[string]string) bool {
+		out := roundTrip(data).(map[string]string)
+		return len(out) == len(data) && (len(data) == 0 || reflect.DeepEqual(out, data))
+	}
+
+	for _, f := range []interface{}{stringCase, listCase, dictCase} {
+		if err := quick.Check(f, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out := roundTrip(nil); out != nil {
+		t.Fatal("Incorrect response", "expected nil", "got", out)
+	}
+}
+
+func TestErrorRoundTrip(t *testing.T) {
+	f := func(code byte, message string) bool {
+		buff := &bytes.Buffer{}
+		if err := NewEncoder(buff).EncodeError(code, message); err != nil {
+			t.Fatal("Encode error", err)
+		}
+
+		_, err := NewDecoder(buff).DecodeResponse()
+		e, ok := err.(*Error)
+		return ok && e.Code == code && e.Message == message
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	buff := &bytes.Buffer{}
+	NewEncoder(buff).EncodeNotFound()
+	if _, err := NewDecoder(buff).DecodeResponse(); err != ErrNotFound {
+		t.Fatal("Incorrect Error", "expected", ErrNotFound, "got", err)
+	}
+}
+
+func TestFrameSequence(t *testing.T) {
+	buff := &bytes.Buffer{}
+	e := NewEncoder(buff)
+	e.EncodeString("foo")
+	e.EncodeNotFound()
+	e.EncodeList([]string{"a", "b"})
+
+	d := NewDecoder(buff)
+	if out, err := d.DecodeResponse(); err != nil || out != "foo" {
+		t.Fatal("Incorrect response", out, err)
+	}
+	if _, err := d.DecodeResponse(); err != ErrNotFound {
+		t.Fatal("Incorrect Error", "expected", ErrNotFound, "got", err)
+	}
+	if out, err := d.DecodeResponse(); err != nil || !reflect.DeepEqual(out, []string{"a", "b"}) {
+		t.Fatal("Incorrect response", out, err)
+	}
+}
+
+func TestIncorrectHeader(t *testing.T) {
+	if _, _, err := NewDecoder(bytes.NewReader([]byte{0x01})).DecodeRequest(); err != ErrIncorrectHeader {
+		t.Fatal("Incorrect Error", "expected", ErrIncorrectHeader, "got", err)
+	}
+	if _, err := NewDecoder(bytes.NewReader([]byte{0x01})).DecodeResponse(); err != ErrIncorrectHeader {
+		t.Fatal("Incorrect Error", "expected", ErrIncorrectHeader, "got", err)
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	listCase := func(data []string) bool {
+		buff := &bytes.Buffer{}
+		e := NewEncoder(buff)
+		e.BeginList()
+		for _, elem := range data {
+			if err := e.EncodeElement(elem); err != nil {
+				t.Fatal("Encode error", err)
+			}
+		}
+		e.End()
+		e.EncodeString("next")
+
+		d := NewDecoder(buff)
+		s, err := d.DecodeStream()
+		if err != nil {
+			t.Fatal("Decode error", err)
+		}
+
+		out := []string{}
+		for s.Next() {
+			out = append(out, s.Elem())
+		}
+
+		next, err := d.DecodeResponse()
+		return s.Done() && !s.IsDict() && next == "next" && len(out) == len(data) && (len(data) == 0 || reflect.DeepEqual(out, data))
+	}
+
+	dictCase := func(data map[string]string) bool {
+		buff := &bytes.Buffer{}
+		e := NewEncoder(buff)
+		e.BeginDict()
+		for k, v := range data {
+			if err := e.EncodePair(k, v); err != nil {
+				t.Fatal("Encode error", err)
+			}
+		}
+		e.End()
+
+		out, err := NewDecoder(buff).DecodeResponse()
+		if err != nil {
+			t.Fatal("Decode error", err)
+		}
+
+		dict := out.(map[string]string)
+		return len(dict) == len(data) && (len(data) == 0 || reflect.DeepEqual(dict, data))
+	}
+
+	for _, f := range []interface{}{listCase, dictCase} {
+		if err := quick.Check(f, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buff := &bytes.Buffer{}
+	e := NewEncoder(buff)
+	e.BeginList()
+	elem := string(make([]byte, 1024))
+	for i := 0; i < 100; i++ {
+		e.EncodeElement(elem)
+	}
+
+	if buff.Len() == 0 {
+		t.Fatal("Expected flushed stream data")
+	}
+	e.End()
+
+	s, err := NewDecoder(buff).DecodeStream()
+	if err != nil {
+		t.Fatal("Decode error", err)
+	}
+
+	cnt := 0
+	for s.Next() {
+		cnt++
+	}
+
+	if cnt != 100 || !s.Done() {
+		t.Fatal("Incorrect elements count", "expected", 100, "got", cnt, s.Err())
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	buff := &bytes.Buffer{}
+	NewEncoder(buff).EncodeRequest([]byte("SET key value"))
+
+	d := NewDecoder(buff)
+	d.SetMaxLength(4)
+	if _, _, err := d.DecodeRequest(); err != ErrTooLarge {
+		t.Fatal("Incorrect Error", "expected", ErrTooLarge, "got", err)
+	}
+
+	//length prefix of default limit is not allocated before data is received
+	frame := append([]byte{RequestHeader}, Uint32ToBytes(DefaultMaxLength)...)
+	if _, _, err := NewDecoder(bytes.NewReader(frame)).DecodeRequest(); err != io.ErrUnexpectedEOF {
+		t.Fatal("Incorrect Error", "expected", io.ErrUnexpectedEOF, "got", err)
+	}
+
+	frame = append([]byte{RequestHeader}, Uint32ToBytes(DefaultMaxLength+1)...)
+	if _, _, err := NewDecoder(bytes.NewReader(frame)).DecodeRequest(); err != ErrTooLarge {
+		t.Fatal("Incorrect Error", "expected", ErrTooLarge, "got", err)
+	}
+}
+
+func TestPushRoundTrip(t *testing.T) {
+	f := func(data []string) bool {
+		buff := &bytes.Buffer{}
+		if err := NewEncoder(buff).EncodePush(data); err != nil {
+			t.Fatal("Encode error", err)
+		}
+
+		out, err := NewDecoder(buff).DecodeResponse()
+		if err != nil {
+			t.Fatal("Decode error", err)
+		}
+
+		push, ok := out.(Push)
+		return ok && len(push) == len(data) && (len(data) == 0 || reflect.DeepEqual([]string(push), data))
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeySlot(t *testing.T) {
+	type (
+		testCase struct {
+			key  string
+			slot uint16
+		}
+	)
+
+	testCases := []*testCase{
+		{"", 0},
+		{"123456789", 0x31c3},
+		{"foo", 12182},
+		{"{user1000}.following", KeySlot("user1000")},
+		{"{user1000}.followers", KeySlot("user1000")},
+		{"foo{}{bar}", KeySlot("foo{}{bar}")},
+		{"foo{{bar}}", KeySlot("{bar")},
+	}
+
+	for _, tc := range testCases {
+		if slot := KeySlot(tc.key); slot != tc.slot {
+			t.Fatal("Incorrect slot of", tc.key, "expected", tc.slot, "got", slot)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package protocol
+
+import "strings"
+
+const (
+	// ClusterSlots is a count of cluster hash slots
+	ClusterSlots = 16384
+)
+
+// KeySlot returns cluster hash slot of key. If key contains non empty "{tag}",
+// only tag is hashed, so keys with the same tag belong to one slot
+func KeySlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return crc16(key) % ClusterSlots
+}
+
+// crc16 is CRC-16/XMODEM checksum
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
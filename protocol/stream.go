@@ -0,0 +1,110 @@
+package protocol
+
+type (
+	// StreamReader reads list elements or dictionary pairs one by one
+	StreamReader struct {
+		d        *Decoder
+		dataType byte
+
+		key   string
+		value string
+		err   error
+		done  bool
+
+		buffered [][2]string
+	}
+)
+
+func newBufferedStreamReader(data interface{}) *StreamReader {
+	s := &StreamReader{}
+	switch v := data.(type) {
+	case []string:
+		s.dataType = TypeListStream
+		for _, elem := range v {
+			s.buffered = append(s.buffered, [2]string{elem, ""})
+		}
+	case map[string]string:
+		s.dataType = TypeDictStream
+		for key, value := range v {
+			s.buffered = append(s.buffered, [2]string{key, value})
+		}
+	}
+	return s
+}
+
+// IsDict returns true if response is a dictionary
+func (s *StreamReader) IsDict() bool {
+	return s.dataType == TypeDictStream
+}
+
+// Next reads next element, false is returned on response end or error
+func (s *StreamReader) Next() bool {
+	if s.done {
+		return false
+	}
+
+	if s.d == nil {
+		if len(s.buffered) == 0 {
+			s.done = true
+			return false
+		}
+		s.key, s.value = s.buffered[0][0], s.buffered[0][1]
+		s.buffered = s.buffered[1:]
+		return true
+	}
+
+	l, err := s.d.readUint32()
+	if err != nil {
+		return s.fail(err)
+	}
+
+	if l == streamEnd {
+		s.done = true
+		return false
+	}
+
+	key, err := s.d.readN(l)
+	if err != nil {
+		return s.fail(err)
+	}
+	s.key = string(key)
+
+	if s.dataType == TypeDictStream {
+		value, err := s.d.readBytes()
+		if err != nil {
+			return s.fail(err)
+		}
+		s.value = string(value)
+	}
+	return true
+}
+
+// Done returns true if response was read completely
+func (s *StreamReader) Done() bool {
+	return s.done && s.err == nil
+}
+
+// Elem returns current list element
+func (s *StreamReader) Elem() string {
+	return s.key
+}
+
+// Key returns current dictionary key
+func (s *StreamReader) Key() string {
+	return s.key
+}
+
+// Value returns current dictionary value
+func (s *StreamReader) Value() string {
+	return s.value
+}
+
+func (s *StreamReader) Err() error {
+	return s.err
+}
+
+func (s *StreamReader) fail(err error) bool {
+	s.err = err
+	s.done = true
+	return false
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	// acl is a permissions of user, nil categories and keys allow all
+	acl struct {
+		categories map[string]bool
+		keys       []string
+	}
+)
+
+const (
+	aclAll       = "all"
+	aclRead      = "read"
+	aclWrite     = "write"
+	aclPubSub    = "pubsub"
+	aclAdmin     = "admin"
+	aclDangerous = "dangerous"
+)
+
+var (
+	aclCategories = map[string]bool{aclRead: true, aclWrite: true, aclPubSub: true, aclAdmin: true, aclDangerous: true}
+
+	// commandCategories are categories required by command, user must be granted all of them.
+	// AUTH and ASKING have no categories, they are allowed to every user. Commands which are not listed are denied
+	commandCategories = map[string][]string{
+		cmdKeysLex:        {aclRead, aclDangerous},
+		cmdGetLex:         {aclRead},
+		cmdGetListLex:     {aclRead},
+		cmdGetListElemLex: {aclRead},
+		cmdGetDictLex:     {aclRead},
+		cmdGetDictElemLex: {aclRead},
+		cmdXRangeLex:      {aclRead},
+		cmdXRevRangeLex:   {aclRead},
+		cmdXLenLex:        {aclRead},
+		cmdXPendingLex:    {aclRead},
+		cmdDumpLex:        {aclRead},
+
+		cmdRemoveLex:        {aclWrite},
+		cmdSetLex:           {aclWrite},
+		cmdSetListLex:       {aclWrite},
+		cmdSetDictLex:       {aclWrite},
+		cmdLPushLex:         {aclWrite},
+		cmdRPushLex:         {aclWrite},
+		cmdLPopLex:          {aclRead, aclWrite},
+		cmdRPopLex:          {aclRead, aclWrite},
+		cmdBLPopLex:         {aclRead, aclWrite},
+		cmdBRPopLex:         {aclRead, aclWrite},
+		cmdXAddLex:          {aclWrite},
+		cmdXTrimLex:         {aclWrite},
+		cmdXGroupCreateLex:  {aclWrite},
+		cmdXGroupDestroyLex: {aclWrite},
+		cmdXReadGroupLex:    {aclRead, aclWrite},
+		cmdXAckLex:          {aclWrite},
+		cmdRestoreLex:       {aclWrite},
+		cmdRemoveIfLex:      {aclWrite},
+
+		cmdSetListElemLex:    {aclWrite},
+		cmdRemoveListElemLex: {aclWrite},
+		cmdSetDictElemLex:    {aclWrite},
+		cmdRemoveDictElemLex: {aclWrite},
+
+		cmdPublishLex:      {aclPubSub},
+		cmdSubscribeLex:    {aclPubSub},
+		cmdUnsubscribeLex:  {aclPubSub},
+		cmdPSubscribeLex:   {aclPubSub},
+		cmdPUnsubscribeLex: {aclPubSub},
+
+		cmdInfoLex:    {aclAdmin},
+		cmdStatsLex:   {aclAdmin},
+		cmdSlowLogLex: {aclAdmin},
+		cmdMonitorLex: {aclAdmin, aclDangerous},
+		cmdConfigLex:  {aclAdmin, aclDangerous},
+		cmdClusterLex: {aclAdmin, aclDangerous},
+		cmdSyncLex:    {aclAdmin, aclDangerous},
+
+		cmdAuthLex:   nil,
+		cmdAskingLex: nil,
+	}
+)
+
+// newACL returns permissions of commands categories and keys glob patterns of user, nil lists allow all
+func newACL(categories []string, keys []string) (*acl, error) {
+	a := &acl{keys: keys}
+	if categories == nil {
+		return a, nil
+	}
+
+	a.categories = map[string]bool{}
+	for _, category := range categories {
+		if category == aclAll {
+			a.categories = nil
+			break
+		}
+		if !aclCategories[category] {
+			names := []string{aclAll}
+			for name := range aclCategories {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown commands category %s, expected one of %s", category, strings.Join(names, ", "))
+		}
+		a.categories[category] = true
+	}
+	return a, nil
+}
+
+func (a *acl) allowsCategory(category string) bool {
+	return a.categories == nil || a.categories[category]
+}
+
+func (a *acl) allowsKey(key string) bool {
+	if a.keys == nil {
+		return true
+	}
+	for _, pattern := range a.keys {
+		if kv.Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsAllKeys returns true if keys are not restricted
+func (a *acl) allowsAllKeys() bool {
+	if a.keys == nil {
+		return true
+	}
+	for _, pattern := range a.keys {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func noPermission(user string, action string) error {
+	return kv.NewError(ErrNoPermission, fmt.Sprintf("User %s has no permission to %s", user, action))
+}
+
+// aclOf returns user and permissions of session of ctx, nil acl means that commands are not restricted
+func (inst *instance) aclOf(ctx context.Context) (string, *acl) {
+	u := inst.users.Load()
+	s := sessionOf(ctx)
+	if u == nil || s == nil {
+		return "", nil
+	}
+
+	user := s.user()
+	if user == clusterUser {
+		return user, nil
+	}
+	if a, ok := u.acls[user]; ok {
+		return user, a
+	}
+	//user removed by reload has no permissions
+	return user, &acl{categories: map[string]bool{}, keys: []string{}}
+}
+
+// checkPermission returns error if user of ctx is not granted categories of command or its keys
+func (inst *instance) checkPermission(ctx context.Context, parser *baseCommandParser) error {
+	user, a := inst.aclOf(ctx)
+	if a == nil || !parser.headerParsed {
+		return nil
+	}
+
+	categories, ok := commandCategories[parser.cmd]
+	if !ok {
+		return noPermission(user, "run "+parser.cmd)
+	}
+	for _, category := range categories {
+		if !a.allowsCategory(category) {
+			return noPermission(user, "run "+parser.cmd)
+		}
+	}
+
+	//KEYS pattern is not checked against key patterns of user
+	if parser.cmd == cmdKeysLex && !a.allowsAllKeys() {
+		return noPermission(user, "run KEYS without access to all keys")
+	}
+	for _, key := range commandKeys(parser) {
+		if !a.allowsKey(key) {
+			return noPermission(user, "access key "+key)
+		}
+	}
+	return nil
+}
+
+// checkCategories returns error if user of ctx is not granted categories of HTTP endpoint
+func (inst *instance) checkCategories(ctx context.Context, endpoint string, categories ...string) error {
+	user, a := inst.aclOf(ctx)
+	if a == nil {
+		return nil
+	}
+	for _, category := range categories {
+		if !a.allowsCategory(category) {
+			return noPermission(user, "access "+endpoint)
+		}
+	}
+	return nil
+}
+
+// keyFilter returns function which allows keys of user of ctx
+func (inst *instance) keyFilter(ctx context.Context) func(key string) bool {
+	_, a := inst.aclOf(ctx)
+	if a == nil {
+		return func(string) bool {
+			return true
+		}
+	}
+	return a.allowsKey
+}
+
+// notificationFilter returns function which allows keyspace notifications of keys of user of ctx,
+// notifications require read permission like events. Permissions are checked for every notification
+func (inst *instance) notificationFilter(ctx context.Context) func(key string) bool {
+	return func(key string) bool {
+		_, a := inst.aclOf(ctx)
+		return a == nil || (a.allowsCategory(aclRead) && a.allowsKey(key))
+	}
+}
+
+// certUser returns user of verified client certificate subject common name, empty if it is not a user of users file
+func (inst *instance) certUser(state *tls.ConnectionState) string {
+	u := inst.users.Load()
+	if u == nil || state == nil || len(state.VerifiedChains) == 0 {
+		return ""
+	}
+	cn := state.PeerCertificates[0].Subject.CommonName
+	if _, ok := u.acls[cn]; !ok {
+		return ""
+	}
+	return cn
+}
+
+// certLogin authenticates session of TLS connection by client certificate,
+// returns false if TLS handshake fails
+func (s *tcpServer) certLogin(ctx context.Context, conn net.Conn) bool {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return true
+	}
+
+	conn.SetDeadline(s.deadline())
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return false
+	}
+
+	inst := instanceOf(s.cache)
+	state := tlsConn.ConnectionState()
+	if user := inst.certUser(&state); user != "" {
+		sessionOf(ctx).login(user)
+		inst.loggerOf(ctx).Debug("Connection is authenticated by certificate", "user", user)
+	}
+	return true
+}
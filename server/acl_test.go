@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+func TestCommandCategories(t *testing.T) {
+	for cmd := range approvedCommands {
+		if _, ok := commandCategories[cmd]; !ok {
+			t.Fatal("Command has no ACL categories", cmd)
+		}
+	}
+}
+
+func TestACLSubscribe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	hash := hashPassword("secret", []byte("salt"), 1000)
+	os.WriteFile(path, []byte(fmt.Sprintf(`{"watcher": {"password": %q, "commands": ["read", "pubsub"], "keys": ["pub:*"]}}`, hash)), 0600)
+
+	cache := kv.NewCacheDb()
+	if err := LoadUsers(cache, path); err != nil {
+		t.Fatal("Load error", err.Error())
+	}
+	SetKeyspaceEvents(cache, "KEA")
+	ts := NewTcpServer(cache, "127.0.0.1", 4545)
+	go ts.Listen()
+	defer ts.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:4545")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer conn.Close()
+	e := protocol.NewEncoder(conn)
+	d := protocol.NewDecoder(conn)
+	request := func(cmd string) (interface{}, error) {
+		e.EncodeRequest([]byte(cmd))
+		return d.DecodeResponse()
+	}
+
+	request("AUTH watcher secret")
+	if out, err := request("PSUBSCRIBE __key*__:*"); err != nil || fmt.Sprint(out) != "[psubscribe __key*__:* 1]" {
+		t.Fatal("Incorrect subscribe response", out, err)
+	}
+	if out, err := request("SUBSCRIBE " + KeyspacePrefix + "secret:x"); err != nil || fmt.Sprint(out) != "[subscribe __keyspace__:secret:x 2]" {
+		t.Fatal("Incorrect subscribe response", out, err)
+	}
+
+	//notifications of keys which are not accessible by user are not delivered
+	cache.Set("secret:x", 0, []byte("1"))
+	cache.Set("pub:x", 0, []byte("1"))
+	for _, expected := range []string{"[pmessage __key*__:* __keyspace__:pub:x set]", "[pmessage __key*__:* __keyevent__:set pub:x]"} {
+		if out, err := d.DecodeResponse(); err != nil || fmt.Sprint(out) != expected {
+			t.Fatal("Incorrect notification", "expected", expected, "got", out, err)
+		}
+	}
+
+	//subscribe commands of subscribe mode are authorized by reloaded permissions
+	os.WriteFile(path, []byte(fmt.Sprintf(`{"watcher": {"password": %q, "commands": ["read"]}}`, hash)), 0600)
+	if err := LoadUsers(cache, path); err != nil {
+		t.Fatal("Load error", err.Error())
+	}
+	if _, err := request("SUBSCRIBE news"); !isErrorCode(err, protocol.CodeNoPermission) {
+		t.Fatal("Incorrect subscribe error", "expected", protocol.CodeNoPermission, "got", err)
+	}
+}
+
+func TestACL(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.json")
+	writeUsers := func(users string) {
+		os.WriteFile(path, []byte(users), 0600)
+	}
+	hash := hashPassword("secret", []byte("salt"), 1000)
+	writeUsers(fmt.Sprintf(`{
+		"alice": {"password": %q, "commands": ["read", "write"], "keys": ["alice:*"]},
+		"root": {"password": %q, "commands": ["all"]},
+		"client": {"commands": ["read"], "keys": ["pub:*"]}
+	}`, hash, hash))
+
+	cache := kv.NewCacheDb()
+	if err := LoadUsers(cache, path); err != nil {
+		t.Fatal("Load error", err.Error())
+	}
+	exeCommand(cache, "SET pub:news hello")
+
+	exe := func(user string, cmd string) error {
+		ctx := withSession(context.Background())
+		sessionOf(ctx).login(user)
+		parser := &baseCommandParser{}
+		parser.Write([]byte(cmd))
+		_, err := ExeContext(ctx, cache, parser)
+		return err
+	}
+
+	for _, tc := range []struct {
+		user string
+		cmd  string
+		err  error
+	}{
+		{"alice", "SET alice:x 1", nil},
+		{"alice", "GET alice:x", nil},
+		{"alice", "SET bob:x 1", ErrNoPermission},
+		{"alice", "BLPOP alice:l bob:l 1", ErrNoPermission},
+		{"alice", "KEYS alice:*", ErrNoPermission},
+		{"alice", "INFO", ErrNoPermission},
+		{"alice", "PUBLISH news hello", ErrNoPermission},
+		{"root", "KEYS *", nil},
+		{"root", "SET bob:x 1", nil},
+		{"root", "CONFIG GET *", nil},
+		{"client", "GET pub:news", nil},
+		{"client", "SET pub:news bye", ErrNoPermission},
+	} {
+		if err := exe(tc.user, tc.cmd); (tc.err == nil && err != nil) || (tc.err != nil && kindOf(err) != kindOf(tc.err)) {
+			t.Fatal("Incorrect ACL result", tc.user, tc.cmd, "expected", tc.err, "got", err)
+		}
+	}
+
+	//batch is not executed if any command is denied
+	ctx := withSession(context.Background())
+	sessionOf(ctx).login("alice")
+	_, errs := ExeAtomicContext(ctx, cache, []*baseCommandParser{
+		{cmd: cmdSetLex, key: "alice:y", value: []byte("1"), headerParsed: true},
+		{cmd: cmdSetLex, key: "bob:y", value: []byte("1"), headerParsed: true},
+	})
+	if kindOf(errs[0]) != kindOf(ErrNoPermission) {
+		t.Fatal("Incorrect batch error", "expected", ErrNoPermission, "got", errs[0])
+	}
+	if _, err := exeCommand(cache, "GET alice:y"); err != ErrNotFound {
+		t.Fatal("Incorrect batch result", "expected", ErrNotFound, "got", err)
+	}
+
+	//identity of TLS client certificate is the subject common name
+	certPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	clientCert := writeCA(t, dir, 300)
+	ts := NewTcpServer(cache, "127.0.0.1", 4536)
+	go ts.ListenSecure(certPath, keyPath)
+	defer ts.Close()
+	hs := NewHttpServer(cache, "127.0.0.1", 4537)
+	go hs.Listen()
+	defer hs.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	conn, err := tls.Dial("tcp", "127.0.0.1:4536", &tls.Config{Certificates: []tls.Certificate{clientCert}, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer conn.Close()
+	e := protocol.NewEncoder(conn)
+	d := protocol.NewDecoder(conn)
+	e.EncodeRequest([]byte("GET pub:news"))
+	if out, err := d.DecodeResponse(); out != "hello" || err != nil {
+		t.Fatal("Incorrect certificate user response", "expected", "hello", "got", out, err)
+	}
+	e.EncodeRequest([]byte("GET alice:x"))
+	if _, err := d.DecodeResponse(); !isErrorCode(err, protocol.CodeNoPermission) {
+		t.Fatal("Incorrect certificate user error", "expected", protocol.CodeNoPermission, "got", err)
+	}
+	//denied command is counted like executed one
+	if count := counter(&instanceOf(cache).metrics.commands, commandLabels{cmdGetLex, transportTCP}).Load(); count != 2 {
+		t.Fatal("Incorrect denied command count", "expected", 2, "got", count)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:4537/metrics", nil)
+	r.SetBasicAuth("alice", "secret")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal("Request error", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatal("Incorrect metrics status", "expected", http.StatusForbidden, "got", resp.StatusCode)
+	}
+
+	//reloaded permissions apply to open connections, removed user has no permissions
+	writeUsers(fmt.Sprintf(`{"root": {"password": %q}}`, hash))
+	if err := LoadUsers(cache, path); err != nil {
+		t.Fatal("Load error", err.Error())
+	}
+	e.EncodeRequest([]byte("GET pub:news"))
+	if _, err := d.DecodeResponse(); !isErrorCode(err, protocol.CodeNoPermission) {
+		t.Fatal("Incorrect removed user error", "expected", protocol.CodeNoPermission, "got", err)
+	}
+
+	//command without categories is denied
+	defer func(categories []string) {
+		commandCategories[cmdGetLex] = categories
+	}(commandCategories[cmdGetLex])
+	delete(commandCategories, cmdGetLex)
+	if err := exe("root", "GET pub:news"); kindOf(err) != kindOf(ErrNoPermission) {
+		t.Fatal("Incorrect not listed command error", "expected", ErrNoPermission, "got", err)
+	}
+	if err := exe("root", "AUTH root secret"); err != nil {
+		t.Fatal("Auth error", err.Error())
+	}
+
+	writeUsers(`{"alice": {"commands": ["sudo"]}}`)
+	if err := LoadUsers(cache, path); err == nil {
+		t.Fatal("Expected unknown category error")
+	}
+}
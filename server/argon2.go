@@ -0,0 +1,347 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+type (
+	// argon2Hash is an Argon2 hash of password: $argon2id$v=19$m=<memory KiB>,t=<passes>,p=<lanes>$<salt>$<hash>
+	argon2Hash struct {
+		mode   uint32
+		memory uint32
+		passes uint32
+		lanes  uint32
+		salt   []byte
+		hash   []byte
+	}
+
+	argon2Block [argon2BlockWords]uint64
+)
+
+const (
+	argon2i  uint32 = 1
+	argon2id uint32 = 2
+
+	argon2Version    = 0x13
+	argon2BlockWords = 128
+	argon2SyncPoints = 4
+	// argon2MaxMemory is a maximum memory of verified hash in KiB, argon2MaxPasses limits its work
+	argon2MaxMemory = 64 << 10
+	argon2MaxPasses = 10
+)
+
+var (
+	blake2bIV = [8]uint64{
+		0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+		0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+	}
+	blake2bSigma = [12][16]byte{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+		{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+		{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+		{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+		{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+		{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+		{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+		{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+		{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+		{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+		{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	}
+)
+
+func parseArgon2Hash(s string) (*argon2Hash, error) {
+	fields := strings.Split(s, "$")
+	if len(fields) != 6 || fields[0] != "" || fields[2] != fmt.Sprintf("v=%d", argon2Version) {
+		return nil, fmt.Errorf("incorrect argon2 hash format, expected $argon2id$v=19$m=<memory>,t=<passes>,p=<lanes>$<salt>$<hash>")
+	}
+
+	h := &argon2Hash{}
+	switch fields[1] {
+	case "argon2i":
+		h.mode = argon2i
+	case "argon2id":
+		h.mode = argon2id
+	default:
+		return nil, fmt.Errorf("incorrect argon2 variant %s, expected argon2id or argon2i", fields[1])
+	}
+
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &h.memory, &h.passes, &h.lanes); err != nil ||
+		h.passes < 1 || h.passes > argon2MaxPasses || h.lanes < 1 || h.lanes > 1<<24-1 || h.memory < 8*h.lanes || h.memory > argon2MaxMemory {
+		return nil, fmt.Errorf("incorrect argon2 parameters %s", fields[3])
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(fields[4]); err != nil || len(h.salt) < 8 {
+		return nil, fmt.Errorf("incorrect argon2 salt")
+	}
+	if h.hash, err = base64.RawStdEncoding.DecodeString(fields[5]); err != nil || len(h.hash) < 4 {
+		return nil, fmt.Errorf("incorrect argon2 hash")
+	}
+	return h, nil
+}
+
+func (h *argon2Hash) verify(password string) bool {
+	key := argon2Key(h.mode, []byte(password), h.salt, h.passes, h.memory, h.lanes, uint32(len(h.hash)))
+	return subtle.ConstantTimeCompare(key, h.hash) == 1
+}
+
+// argon2Key returns Argon2 version 1.3 tag of password (RFC 9106), memory is a count of 1 KiB blocks.
+// Lanes are filled one by one
+func argon2Key(mode uint32, password []byte, salt []byte, passes uint32, memory uint32, lanes uint32, length uint32) []byte {
+	h0 := make([]byte, 0, 256)
+	for _, v := range []uint32{lanes, length, memory, passes, argon2Version, mode} {
+		h0 = binary.LittleEndian.AppendUint32(h0, v)
+	}
+	for _, v := range [][]byte{password, salt, nil, nil} {
+		h0 = binary.LittleEndian.AppendUint32(h0, uint32(len(v)))
+		h0 = append(h0, v...)
+	}
+	h0 = blake2b(h0, 64)
+
+	segment := memory / (lanes * argon2SyncPoints)
+	columns := segment * argon2SyncPoints
+	blocks := make([]argon2Block, columns*lanes)
+
+	buff := make([]byte, 1024)
+	for lane := uint32(0); lane < lanes; lane++ {
+		for i := uint32(0); i < 2; i++ {
+			input := binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(append([]byte(nil), h0...), i), lane)
+			blake2bLong(buff, input)
+			for j := range blocks[lane*columns+i] {
+				blocks[lane*columns+i][j] = binary.LittleEndian.Uint64(buff[j*8:])
+			}
+		}
+	}
+
+	for pass := uint32(0); pass < passes; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			for lane := uint32(0); lane < lanes; lane++ {
+				argon2Segment(blocks, mode, pass, slice, lane, lanes, segment, passes)
+			}
+		}
+	}
+
+	final := blocks[columns-1]
+	for lane := uint32(1); lane < lanes; lane++ {
+		for i, word := range blocks[lane*columns+columns-1] {
+			final[i] ^= word
+		}
+	}
+	for i, word := range final {
+		binary.LittleEndian.PutUint64(buff[i*8:], word)
+	}
+	out := make([]byte, length)
+	blake2bLong(out, buff)
+	return out
+}
+
+// argon2Segment fills segment of lane in pass and slice
+func argon2Segment(blocks []argon2Block, mode uint32, pass uint32, slice uint32, lane uint32, lanes uint32, segment uint32, passes uint32) {
+	columns := segment * argon2SyncPoints
+	independent := mode == argon2i || (pass == 0 && slice < argon2SyncPoints/2)
+
+	var input, address, zero argon2Block
+	if independent {
+		input[0], input[1], input[2], input[3], input[4], input[5] =
+			uint64(pass), uint64(lane), uint64(slice), uint64(len(blocks)), uint64(passes), uint64(mode)
+	}
+
+	start := uint32(0)
+	if pass == 0 && slice == 0 {
+		start = 2
+		if independent {
+			input[6]++
+			argon2Compress(&address, &zero, &input, false)
+			argon2Compress(&address, &zero, &address, false)
+		}
+	}
+
+	for index := start; index < segment; index++ {
+		column := slice*segment + index
+		prev := column - 1
+		if column == 0 {
+			prev = columns - 1
+		}
+		current, previous := lane*columns+column, lane*columns+prev
+
+		var random uint64
+		if independent {
+			if index%argon2BlockWords == 0 {
+				input[6]++
+				argon2Compress(&address, &zero, &input, false)
+				argon2Compress(&address, &zero, &address, false)
+			}
+			random = address[index%argon2BlockWords]
+		} else {
+			random = blocks[previous][0]
+		}
+
+		refLane := uint32(random>>32) % lanes
+		if pass == 0 && slice == 0 {
+			refLane = lane
+		}
+
+		//reference area is finished segments and the current segment of the same lane before previous block
+		var area uint32
+		switch {
+		case pass == 0 && refLane == lane:
+			area = slice*segment + index - 1
+		case pass == 0:
+			area = slice * segment
+		case refLane == lane:
+			area = columns - segment + index - 1
+		default:
+			area = columns - segment
+		}
+		if refLane != lane && index == 0 {
+			area--
+		}
+
+		x := uint64(uint32(random)) * uint64(uint32(random)) >> 32
+		relative := area - 1 - uint32(uint64(area)*x>>32)
+		startColumn := uint32(0)
+		if pass > 0 && slice != argon2SyncPoints-1 {
+			startColumn = (slice + 1) * segment
+		}
+		ref := refLane*columns + (startColumn+relative)%columns
+
+		argon2Compress(&blocks[current], &blocks[previous], &blocks[ref], pass > 0)
+	}
+}
+
+// argon2Compress sets out to compression of x and y, result is xored to out if xor is set
+func argon2Compress(out *argon2Block, x *argon2Block, y *argon2Block, xor bool) {
+	var r, z argon2Block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	z = r
+
+	for i := 0; i < 8; i++ {
+		blamka(&z[16*i], &z[16*i+1], &z[16*i+2], &z[16*i+3], &z[16*i+4], &z[16*i+5], &z[16*i+6], &z[16*i+7],
+			&z[16*i+8], &z[16*i+9], &z[16*i+10], &z[16*i+11], &z[16*i+12], &z[16*i+13], &z[16*i+14], &z[16*i+15])
+	}
+	for i := 0; i < 8; i++ {
+		blamka(&z[2*i], &z[2*i+1], &z[2*i+16], &z[2*i+17], &z[2*i+32], &z[2*i+33], &z[2*i+48], &z[2*i+49],
+			&z[2*i+64], &z[2*i+65], &z[2*i+80], &z[2*i+81], &z[2*i+96], &z[2*i+97], &z[2*i+112], &z[2*i+113])
+	}
+
+	for i := range out {
+		if xor {
+			out[i] ^= z[i] ^ r[i]
+		} else {
+			out[i] = z[i] ^ r[i]
+		}
+	}
+}
+
+// blamka is a BLAKE2b round of Argon2 with multiplications
+func blamka(v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 *uint64) {
+	g := func(a, b, c, d *uint64) {
+		*a += *b + 2*uint64(uint32(*a))*uint64(uint32(*b))
+		*d = bits.RotateLeft64(*d^*a, -32)
+		*c += *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+		*b = bits.RotateLeft64(*b^*c, -24)
+		*a += *b + 2*uint64(uint32(*a))*uint64(uint32(*b))
+		*d = bits.RotateLeft64(*d^*a, -16)
+		*c += *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+		*b = bits.RotateLeft64(*b^*c, -63)
+	}
+	g(v0, v4, v8, v12)
+	g(v1, v5, v9, v13)
+	g(v2, v6, v10, v14)
+	g(v3, v7, v11, v15)
+	g(v0, v5, v10, v15)
+	g(v1, v6, v11, v12)
+	g(v2, v7, v8, v13)
+	g(v3, v4, v9, v14)
+}
+
+// blake2bLong is a variable length hash H' of Argon2, out is filled by hash of input
+func blake2bLong(out []byte, input []byte) {
+	input = append(binary.LittleEndian.AppendUint32(nil, uint32(len(out))), input...)
+	if len(out) <= 64 {
+		copy(out, blake2b(input, len(out)))
+		return
+	}
+
+	v := blake2b(input, 64)
+	for len(out) > 64 {
+		copy(out, v[:32])
+		out = out[32:]
+		v = blake2b(v, min(len(out), 64))
+	}
+	copy(out, v)
+}
+
+// blake2b returns BLAKE2b hash of data without key, size is 1-64 bytes (RFC 7693)
+func blake2b(data []byte, size int) []byte {
+	h := blake2bIV
+	h[0] ^= 0x01010000 ^ uint64(size)
+
+	var counter uint64
+	for {
+		block := make([]byte, 128)
+		n := copy(block, data)
+		data = data[n:]
+		counter += uint64(n)
+		last := len(data) == 0
+		blake2bCompress(&h, block, counter, last)
+		if last {
+			break
+		}
+	}
+
+	out := make([]byte, 0, 64)
+	for _, word := range h {
+		out = binary.LittleEndian.AppendUint64(out, word)
+	}
+	return out[:size]
+}
+
+func blake2bCompress(h *[8]uint64, block []byte, counter uint64, last bool) {
+	var m [16]uint64
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+
+	var v [16]uint64
+	copy(v[:8], h[:])
+	copy(v[8:], blake2bIV[:])
+	v[12] ^= counter
+	if last {
+		v[14] = ^v[14]
+	}
+
+	g := func(a, b, c, d int, x, y uint64) {
+		v[a] += v[b] + x
+		v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+		v[a] += v[b] + y
+		v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+	}
+	for _, s := range blake2bSigma {
+		g(0, 4, 8, 12, m[s[0]], m[s[1]])
+		g(1, 5, 9, 13, m[s[2]], m[s[3]])
+		g(2, 6, 10, 14, m[s[4]], m[s[5]])
+		g(3, 7, 11, 15, m[s[6]], m[s[7]])
+		g(0, 5, 10, 15, m[s[8]], m[s[9]])
+		g(1, 6, 11, 12, m[s[10]], m[s[11]])
+		g(2, 7, 8, 13, m[s[12]], m[s[13]])
+		g(3, 4, 9, 14, m[s[14]], m[s[15]])
+	}
+
+	for i := range h {
+		h[i] ^= v[i] ^ v[i+8]
+	}
+}
@@ -0,0 +1,471 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	// userConfig is a user of users file
+	userConfig struct {
+		// Password is a hash of password made by HashPassword
+		Password string `json:"password"`
+		// TokenSHA256 is a hex SHA-256 digest of HTTP Bearer token
+		TokenSHA256 string `json:"token_sha256"`
+		// Commands are granted commands categories, all categories if omitted
+		Commands []string `json:"commands"`
+		// Keys are glob patterns of accessible keys, all keys if omitted
+		Keys []string `json:"keys"`
+	}
+
+	// users are credentials and permissions of users file, verified passwords are cached
+	// to not derive hash of every HTTP request
+	users struct {
+		passwords map[string]passwordHash
+		tokens    map[[sha256.Size]byte]string
+		acls      map[string]*acl
+		verified  sync.Map
+	}
+
+	// passwordHash is a hash of password of users file
+	passwordHash interface {
+		verify(password string) bool
+	}
+
+	// pbkdf2Hash is a PBKDF2-SHA256 key of password
+	pbkdf2Hash struct {
+		iterations int
+		salt       []byte
+		key        []byte
+	}
+
+	// session is an authentication state of connection or HTTP request
+	session struct {
+		name atomic.Pointer[string]
+	}
+
+	// authThrottle delays password authentication of user and of client address after failures,
+	// delay is kept by reconnected clients
+	authThrottle struct {
+		lock     sync.Mutex
+		failures map[string]*authFailures
+	}
+
+	// authFailures are failed password authentications, next one is not verified until retry time
+	authFailures struct {
+		count int
+		retry time.Time
+	}
+
+	sessionKey struct{}
+)
+
+const (
+	passwordHashPrefix = "$pbkdf2-sha256$"
+	// passwordIterations is PBKDF2-SHA256 iterations count of HashPassword
+	passwordIterations = 600000
+	passwordSaltSize   = 16
+	// passwordMaxIterations limits work of verified PBKDF2-SHA256 hash
+	passwordMaxIterations = 5000000
+
+	// authFailureDelay is a delay of password authentication after failure, it is doubled by every next failure
+	authFailureDelay    = 100 * time.Millisecond
+	authMaxFailureDelay = 10 * time.Second
+	// authMaxThrottled is a count of throttled users and addresses, failures with passed retry time are forgotten over it
+	authMaxThrottled = 1 << 16
+)
+
+var (
+	authRequiredError       = kv.NewError(ErrUnauthorized, "Authentication required")
+	invalidCredentialsError = kv.NewError(ErrUnauthorized, "Invalid username or password")
+	invalidTokenError       = kv.NewError(ErrUnauthorized, "Invalid token")
+	authThrottledError      = kv.NewError(ErrUnauthorized, "Too many failed authentications, retry later")
+	authDisabledError       = badRequest("AUTH is called, but no users are configured")
+
+	// verifySlots limits concurrent verifications of password hashes by CPU count
+	verifySlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+	// dummyHash is verified for unknown users to not reveal user names by response time
+	dummyHash, _ = parsePasswordHash("$pbkdf2-sha256$600000$AAAAAAAAAAAAAAAAAAAAAA$AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+)
+
+// HashPassword returns PBKDF2-SHA256 hash of password for users file:
+// $pbkdf2-sha256$<iterations>$<salt>$<key>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashPassword(password, salt, passwordIterations), nil
+}
+
+func hashPassword(password string, salt []byte, iterations int) string {
+	key := pbkdf2Key(password, salt, iterations)
+	return fmt.Sprintf("%s%d$%s$%s", passwordHashPrefix, iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// parsePasswordHash parses PBKDF2-SHA256 hash of HashPassword, bcrypt hash or Argon2 hash
+func parsePasswordHash(s string) (passwordHash, error) {
+	switch {
+	case strings.HasPrefix(s, "$2"):
+		return parseBcryptHash(s)
+	case strings.HasPrefix(s, "$argon2"):
+		return parseArgon2Hash(s)
+	}
+
+	fields := strings.Split(strings.TrimPrefix(s, passwordHashPrefix), "$")
+	if !strings.HasPrefix(s, passwordHashPrefix) || len(fields) != 3 {
+		return nil, fmt.Errorf("incorrect password hash format, expected %s<iterations>$<salt>$<key>, bcrypt or argon2 hash", passwordHashPrefix)
+	}
+
+	iterations, err := strconv.Atoi(fields[0])
+	if err != nil || iterations < 1 || iterations > passwordMaxIterations {
+		return nil, fmt.Errorf("incorrect password hash iterations %s", fields[0])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("incorrect password hash salt: %s", err.Error())
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[2])
+	if err != nil || len(key) != sha256.Size {
+		return nil, fmt.Errorf("incorrect password hash key")
+	}
+	return &pbkdf2Hash{iterations: iterations, salt: salt, key: key}, nil
+}
+
+// pbkdf2Key returns the first block of PBKDF2-HMAC-SHA256 derived key (RFC 8018)
+func pbkdf2Key(password string, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, []byte(password))
+	prf.Write(salt)
+	prf.Write(binary.BigEndian.AppendUint32(nil, 1))
+	u := prf.Sum(nil)
+
+	key := append([]byte{}, u...)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+func (h *pbkdf2Hash) verify(password string) bool {
+	return subtle.ConstantTimeCompare(pbkdf2Key(password, h.salt, h.iterations), h.key) == 1
+}
+
+// verifyPassword verifies password by hash, verifications over CPU count wait for each other
+func verifyPassword(h passwordHash, password string) bool {
+	verifySlots <- struct{}{}
+	defer func() { <-verifySlots }()
+	return h.verify(password)
+}
+
+// LoadUsers enables authentication of cache connections by users file, file is a JSON object
+// of user names and users:
+//
+//	{"alice": {"password": "$pbkdf2-sha256$...", "token_sha256": "<hex>", "commands": ["read"], "keys": ["alice:*"]}}
+//
+// User without password and token is authenticated by TLS client certificate of the same subject common name.
+// Loaded users replace previous users, permissions of open connections are replaced too.
+// Previous users are kept on error
+func LoadUsers(cache *kv.CacheDb, path string) error {
+	u, err := readUsers(path)
+	if err != nil {
+		return err
+	}
+	instanceOf(cache).users.Store(u)
+	return nil
+}
+
+func readUsers(path string) (*users, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := map[string]userConfig{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&config); err != nil {
+		return nil, fmt.Errorf("Incorrect users file %s: %s", path, err.Error())
+	}
+	if len(config) == 0 {
+		return nil, fmt.Errorf("Users file %s has no users", path)
+	}
+
+	u := &users{passwords: map[string]passwordHash{}, tokens: map[[sha256.Size]byte]string{}, acls: map[string]*acl{}}
+	for name, user := range config {
+		if name == "" || strings.ContainsAny(name, " :") {
+			return nil, fmt.Errorf("Incorrect user name %q, it must not be empty or contain spaces and colons", name)
+		}
+
+		a, err := newACL(user.Commands, user.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("User %s: %s", name, err.Error())
+		}
+		u.acls[name] = a
+
+		if user.Password != "" {
+			h, err := parsePasswordHash(user.Password)
+			if err != nil {
+				return nil, fmt.Errorf("User %s: %s", name, err.Error())
+			}
+			u.passwords[name] = h
+		}
+
+		if user.TokenSHA256 != "" {
+			digest, err := hex.DecodeString(user.TokenSHA256)
+			if err != nil || len(digest) != sha256.Size {
+				return nil, fmt.Errorf("User %s: incorrect token_sha256, expected hex SHA-256 digest", name)
+			}
+			if other, ok := u.tokens[[sha256.Size]byte(digest)]; ok {
+				return nil, fmt.Errorf("Users %s and %s have the same token", other, name)
+			}
+			u.tokens[[sha256.Size]byte(digest)] = name
+		}
+	}
+	return u, nil
+}
+
+// authEnabled returns true if users are loaded
+func (inst *instance) authEnabled() bool {
+	return inst.users.Load() != nil
+}
+
+// authenticate verifies password of user, password of cluster node is a cluster secret
+func (inst *instance) authenticate(user string, password string) error {
+	if user == clusterUser {
+		if n := inst.cluster.Load(); n != nil && n.verifySecret(password) {
+			return nil
+		}
+		return invalidCredentialsError
+	}
+
+	u := inst.users.Load()
+	if u == nil {
+		return authDisabledError
+	}
+
+	credentials := sha256.Sum256([]byte(user + "\x00" + password))
+	if verified, ok := u.verified.Load(credentials); ok && verified.(string) == user {
+		return nil
+	}
+
+	h, ok := u.passwords[user]
+	if !ok {
+		verifyPassword(dummyHash, password)
+		return invalidCredentialsError
+	}
+	if !verifyPassword(h, password) {
+		return invalidCredentialsError
+	}
+	u.verified.Store(credentials, user)
+	return nil
+}
+
+// authenticateClient verifies password of user like authenticate, password is not verified
+// until delay after failed authentication of the same user or client address of ctx.
+// Embedded commands are not throttled. Cluster secret is not throttled too, it is not hashed by
+// password function, and failures of misconfigured node must not delay nodes of the same host
+func (inst *instance) authenticateClient(ctx context.Context, user string, password string) error {
+	client := clientOf(ctx)
+	if client == "" || user == clusterUser {
+		return inst.authenticate(user, password)
+	}
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+
+	keys := []string{"user:" + user, "addr:" + client}
+	if !inst.throttle.allow(keys) {
+		return authThrottledError
+	}
+	err := inst.authenticate(user, password)
+	inst.throttle.result(keys, err != invalidCredentialsError)
+	return err
+}
+
+// authenticateToken returns user of Bearer token
+func (inst *instance) authenticateToken(token string) (string, error) {
+	u := inst.users.Load()
+	if u == nil {
+		return "", authDisabledError
+	}
+	user, ok := u.tokens[sha256.Sum256([]byte(token))]
+	if !ok {
+		return "", invalidTokenError
+	}
+	return user, nil
+}
+
+// withSession marks ctx of connection or HTTP request with not authenticated session
+func withSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// sessionOf returns session of ctx, embedded commands have no session
+func sessionOf(ctx context.Context) *session {
+	s, _ := ctx.Value(sessionKey{}).(*session)
+	return s
+}
+
+// user returns authenticated user name, empty if session is not authenticated
+func (s *session) user() string {
+	if name := s.name.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+func (s *session) login(user string) {
+	s.name.Store(&user)
+}
+
+// allow returns false if password authentication of any key is retried before delay of failures
+func (t *authThrottle) allow(keys []string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		if f, ok := t.failures[key]; ok && now.Before(f.retry) {
+			return false
+		}
+	}
+	return true
+}
+
+// result resets failures of keys or postpones next password authentication of every key
+func (t *authThrottle) result(keys []string, ok bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if ok {
+		for _, key := range keys {
+			delete(t.failures, key)
+		}
+		return
+	}
+
+	now := time.Now()
+	if t.failures == nil {
+		t.failures = map[string]*authFailures{}
+	}
+	if len(t.failures) >= authMaxThrottled {
+		for key, f := range t.failures {
+			if !now.Before(f.retry) {
+				delete(t.failures, key)
+			}
+		}
+	}
+	for _, key := range keys {
+		f, found := t.failures[key]
+		if !found {
+			f = &authFailures{}
+			t.failures[key] = f
+		}
+		delay := authMaxFailureDelay
+		if f.count < 16 && authFailureDelay<<f.count < delay {
+			delay = authFailureDelay << f.count
+		}
+		f.count++
+		f.retry = now.Add(delay)
+	}
+}
+
+// checkAuth returns error if auth is enabled and session of ctx is not authenticated,
+// embedded commands are always allowed
+func (inst *instance) checkAuth(ctx context.Context) error {
+	if !inst.authEnabled() {
+		return nil
+	}
+	if s := sessionOf(ctx); s != nil && s.user() == "" {
+		return authRequiredError
+	}
+	return nil
+}
+
+// checkAccess returns error if session of ctx is not authenticated or its user has no permission of command
+func (inst *instance) checkAccess(ctx context.Context, parser *baseCommandParser) error {
+	if err := inst.checkAuth(ctx); err != nil {
+		return err
+	}
+	return inst.checkPermission(ctx, parser)
+}
+
+// authorize verifies credentials of AUTH command and authenticates session of ctx,
+// other commands are checked by checkAccess
+func (inst *instance) authorize(ctx context.Context, parser *baseCommandParser) error {
+	if parser.cmd != cmdAuthLex {
+		return inst.checkAccess(ctx, parser)
+	}
+
+	user, password := parser.key, string(bytes.TrimSpace(parser.value))
+	if err := inst.authenticateClient(ctx, user, password); err != nil {
+		inst.loggerOf(ctx).Warn("Authentication failed", "user", user)
+		return err
+	}
+	if s := sessionOf(ctx); s != nil {
+		s.login(user)
+	}
+	return nil
+}
+
+// authHandler authenticates every HTTP request by Basic or Bearer Authorization header
+// or by TLS client certificate when auth is enabled
+func (s *httpServer) authHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		inst := instanceOf(s.cache)
+		if !inst.authEnabled() {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		//failures of Basic authentication are throttled by user and client address
+		user, err := "", authRequiredError
+		if name, password, ok := request.BasicAuth(); ok {
+			user, err = name, inst.authenticateClient(request.Context(), name, password)
+		} else if token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer "); ok {
+			user, err = inst.authenticateToken(strings.TrimSpace(token))
+		} else if name := inst.certUser(request.TLS); name != "" {
+			user, err = name, nil
+		}
+		if err != nil {
+			if err != authRequiredError {
+				inst.loggerOf(request.Context()).Warn("Authentication failed", "user", user)
+			}
+			writer.Header().Set("WWW-Authenticate", `Basic realm="kv", charset="UTF-8"`)
+			writeError(writer, err)
+			return
+		}
+
+		//session of HTTP request is not shared by requests of keep-alive connection
+		ctx := withSession(request.Context())
+		sessionOf(ctx).login(user)
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
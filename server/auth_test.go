@@ -0,0 +1,212 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+func TestPasswordHash(t *testing.T) {
+	//RFC 7914 PBKDF2-HMAC-SHA256 test vector
+	expected := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"
+	if key := hex.EncodeToString(pbkdf2Key("passwd", []byte("salt"), 1)); key != expected {
+		t.Fatal("Incorrect derived key", "expected", expected, "got", key)
+	}
+
+	h, err := parsePasswordHash(hashPassword("secret", []byte("salt"), 10))
+	if err != nil {
+		t.Fatal("Parse error", err.Error())
+	}
+	if !h.verify("secret") || h.verify("wrong") {
+		t.Fatal("Incorrect password verification")
+	}
+
+	//RFC 7693 BLAKE2b-512 test vector
+	expected = "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"
+	if digest := hex.EncodeToString(blake2b([]byte("abc"), 64)); digest != expected {
+		t.Fatal("Incorrect BLAKE2b digest", "expected", expected, "got", digest)
+	}
+
+	//hashes of "secret" made by other implementations
+	for _, hash := range []string{
+		"$2a$04$zpX1PpyO/zIhKoSuaCC5g.XwRpM82WEHWzwZWzs.VXFvJDy4qZtt2",
+		"$2b$05$CCCCCCCCCCCCCCCCCCCCC.pIKrLVkBX9/OvQMSygY1pWEVn72t6na",
+		"$argon2id$v=19$m=64,t=3,p=4$c29tZXNhbHQ$0bDpotVYA3ponlDSTCIV2J2jbCkTN06MJGvTzYQXGe8",
+		"$argon2id$v=19$m=1024,t=1,p=1$c29tZXNhbHQ$PeqHSbzsF1xtFyTVR0t1iw",
+		"$argon2i$v=19$m=256,t=2,p=2$c29tZXNhbHQ$7k5cTnJGaYmSZzA2g8LxwI0lESOPCzJUPF7kX307LvzxypPKnJF3A8dlToR8IhTVSWEMGjbw4+EAVRHCK+ojqw",
+		"$argon2id$v=19$m=100,t=2,p=3$c29tZXNhbHQ$yiYRYjxSe0clDPvcYjFhbJ+WBIS/mRqBGu5GsqBqwynnPaGJd80yScnTvmpwWL32WoKACGGjX3DvewCYSae74o1ak6q6enpswO67LdRaPS4OyVZmnYSsWF2dkmec5K92MUWX9w",
+	} {
+		h, err := parsePasswordHash(hash)
+		if err != nil {
+			t.Fatal("Parse error", hash, err.Error())
+		}
+		if !h.verify("secret") || h.verify("secreT") {
+			t.Fatal("Incorrect password verification", hash)
+		}
+	}
+
+	for _, hash := range []string{"", "secret", "$2b$10$abcdefghijklmnopqrstuu", "$2b$03$CCCCCCCCCCCCCCCCCCCCC.pIKrLVkBX9/OvQMSygY1pWEVn72t6na",
+		"$argon2d$v=19$m=64,t=3,p=4$c29tZXNhbHQ$0bDpotVYA3ponlDSTCIV2J2jbCkTN06MJGvTzYQXGe8", "$argon2id$v=16$m=64,t=3,p=4$c29tZXNhbHQ$0bDpotVYA3ponlDSTCIV2J2jbCkTN06MJGvTzYQXGe8",
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$a2V5", "$argon2id$v=19$m=4,t=3,p=4$c29tZXNhbHQ$0bDpotVYA3ponlDSTCIV2J2jbCkTN06MJGvTzYQXGe8", "$pbkdf2-sha256$0$c2FsdA$a2V5",
+		"$2b$13$CCCCCCCCCCCCCCCCCCCCC.pIKrLVkBX9/OvQMSygY1pWEVn72t6na", "$argon2id$v=19$m=65537,t=1,p=1$c29tZXNhbHQ$PeqHSbzsF1xtFyTVR0t1iw",
+		"$argon2id$v=19$m=1024,t=11,p=1$c29tZXNhbHQ$PeqHSbzsF1xtFyTVR0t1iw", "$pbkdf2-sha256$5000001$c2FsdA$a2V5"} {
+		if _, err := parsePasswordHash(hash); err == nil {
+			t.Fatal("Expected hash error", hash)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	token := "0123456789abcdef"
+	digest := sha256.Sum256([]byte(token))
+	path := filepath.Join(t.TempDir(), "users.json")
+	os.WriteFile(path, []byte(fmt.Sprintf(`{"alice": {"password": %q}, "ci": {"token_sha256": %q}}`,
+		hashPassword("secret", []byte("salt"), 1000), hex.EncodeToString(digest[:]))), 0600)
+
+	cache := kv.NewCacheDb()
+	if _, err := exeCommand(cache, "AUTH alice secret"); err != authDisabledError {
+		t.Fatal("Incorrect disabled auth error", "expected", authDisabledError, "got", err)
+	}
+	if err := LoadUsers(cache, path); err != nil {
+		t.Fatal("Load error", err.Error())
+	}
+	SetSlowLog(cache, 0, 128)
+
+	//embedded commands are not authenticated
+	if _, err := exeCommand(cache, "SET foo bar"); err != nil {
+		t.Fatal("Set error", err.Error())
+	}
+
+	ts := NewTcpServer(cache, "127.0.0.1", 4533)
+	go ts.Listen()
+	defer ts.Close()
+	ncat := NewTcpServer(cache, "127.0.0.1", 4534)
+	ncat.IsHuman(true)
+	go ncat.Listen()
+	defer ncat.Close()
+	hs := NewHttpServer(cache, "127.0.0.1", 4535)
+	go hs.Listen()
+	defer hs.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:4533")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer conn.Close()
+	e := protocol.NewEncoder(conn)
+	d := protocol.NewDecoder(conn)
+	request := func(cmd string) (interface{}, error) {
+		e.EncodeRequest([]byte(cmd))
+		return d.DecodeResponse()
+	}
+
+	for _, cmd := range []string{"GET foo", "SUBSCRIBE news", "MONITOR", "AUTH alice wrong", "AUTH bob secret"} {
+		if _, err := request(cmd); !isErrorCode(err, protocol.CodeUnauthorized) {
+			t.Fatal("Incorrect not authenticated response", cmd, "expected", protocol.CodeUnauthorized, "got", err)
+		}
+	}
+	//password is not verified until delay of failed authentication, reconnected client keeps delay
+	if _, err := request("AUTH alice secret"); !strings.Contains(fmt.Sprint(err), authThrottledError.Error()) {
+		t.Fatal("Incorrect throttled auth response", "expected", authThrottledError, "got", err)
+	}
+	reconnected, err := net.Dial("tcp", "127.0.0.1:4533")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	protocol.NewEncoder(reconnected).EncodeRequest([]byte("AUTH alice secret"))
+	_, err = protocol.NewDecoder(reconnected).DecodeResponse()
+	reconnected.Close()
+	if !strings.Contains(fmt.Sprint(err), authThrottledError.Error()) {
+		t.Fatal("Incorrect throttled auth response of reconnected client", "expected", authThrottledError, "got", err)
+	}
+	time.Sleep(authFailureDelay + 50*time.Millisecond)
+	if out, err := request("AUTH alice secret"); out != nil || err != nil {
+		t.Fatal("Incorrect auth response", "expected", nil, "got", out, err)
+	}
+	if out, err := request("GET foo"); out != "bar" || err != nil {
+		t.Fatal("Incorrect authenticated response", "expected", "bar", "got", out, err)
+	}
+
+	ncatRequest := func(cmd string) string {
+		conn, err := net.Dial("tcp", "127.0.0.1:4534")
+		if err != nil {
+			t.Fatal("Dial error", err.Error())
+		}
+		defer conn.Close()
+		conn.Write([]byte(cmd))
+		conn.(*net.TCPConn).CloseWrite()
+		out, _ := io.ReadAll(conn)
+		return string(out)
+	}
+	if out := ncatRequest("GET foo"); out != "Error: "+authRequiredError.Error() {
+		t.Fatal("Incorrect ncat response", "expected", authRequiredError, "got", out)
+	}
+	if out := ncatRequest("AUTH alice secret\nGET foo"); out != "bar" {
+		t.Fatal("Incorrect ncat response", "expected", "bar", "got", out)
+	}
+
+	httpRequest := func(setAuth func(r *http.Request)) *http.Response {
+		r, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1:4535/", strings.NewReader("GET foo"))
+		setAuth(r)
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Request error", err.Error())
+		}
+		//drained response keeps connection alive
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+	for name, setAuth := range map[string]func(r *http.Request){
+		"none":  func(r *http.Request) {},
+		"basic": func(r *http.Request) { r.SetBasicAuth("alice", "wrong") },
+		"token": func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") },
+	} {
+		resp := httpRequest(setAuth)
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+			t.Fatal("Incorrect not authenticated status", name, "expected", http.StatusUnauthorized, "got", resp.StatusCode)
+		}
+	}
+	//failures of Basic authentication are throttled by user and client address
+	if resp := httpRequest(func(r *http.Request) { r.SetBasicAuth("alice", "secret") }); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("Incorrect throttled status", "expected", http.StatusUnauthorized, "got", resp.StatusCode)
+	}
+	time.Sleep(authFailureDelay + 50*time.Millisecond)
+	for name, setAuth := range map[string]func(r *http.Request){
+		"basic": func(r *http.Request) { r.SetBasicAuth("alice", "secret") },
+		"token": func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) },
+	} {
+		if resp := httpRequest(setAuth); resp.StatusCode != http.StatusOK {
+			t.Fatal("Incorrect authenticated status", name, "expected", http.StatusOK, "got", resp.StatusCode)
+		}
+	}
+
+	//passwords are not exposed by slow log
+	out, _ := exeCommand(cache, "SLOWLOG GET 100")
+	for _, entry := range out.([]string) {
+		if strings.Contains(entry, "secret") {
+			t.Fatal("Expected redacted password", "got", entry)
+		}
+	}
+
+	//failed reload keeps loaded users
+	os.WriteFile(path, []byte(`{"alice": {"password": "$2b$10$abcdefghijklmnopqrstuu"}}`), 0600)
+	if err := LoadUsers(cache, path); err == nil {
+		t.Fatal("Expected users file error")
+	}
+	if err := instanceOf(cache).authenticate("alice", "secret"); err != nil {
+		t.Fatal("Authentication error", err.Error())
+	}
+}
@@ -2,23 +2,169 @@ package server
 
 import (
 	"bytes"
-	"errors"
+	"context"
+	"encoding/base64"
 	"strconv"
+	"strings"
+	"time"
 	"unsafe"
 
 	"github.com/2tvenom/kv/kv"
 )
 
+type (
+	// ListStream produces list elements one by one to fn, stops on first fn error
+	ListStream func(fn func(elem string) error) error
+	// DictStream produces dictionary pairs one by one to fn, stops on first fn error
+	DictStream func(fn func(key string, value string) error) error
+)
+
+const maxBlockingTimeout = 24 * time.Hour
+
 var (
-	notFoundErr = errors.New("Not found")
+	incorrectListIndexError = badRequest("Incorrect list index")
+	incorrectTimeoutError   = badRequest("Incorrect timeout")
+	incorrectDumpError      = badRequest("Incorrect dump record")
 )
 
 func Exe(cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
-	parser.value = bytes.TrimSpace(parser.value)
+	return exe(context.Background(), cache, parser, false)
+}
+
+// ExeContext executes command like Exe, blocking commands are interrupted when ctx is done
+func ExeContext(ctx context.Context, cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
+	return exe(ctx, cache, parser, false)
+}
+
+// ExeStream executes command like Exe, but KEYS, GETLIST and GETDICT
+// results are returned as ListStream and DictStream
+func ExeStream(cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
+	return exe(context.Background(), cache, parser, true)
+}
+
+// ExeStreamContext executes command like ExeStream, blocking commands are interrupted when ctx is done
+func ExeStreamContext(ctx context.Context, cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
+	return exe(ctx, cache, parser, true)
+}
+
+func exe(ctx context.Context, cache *kv.CacheDb, parser *baseCommandParser, stream bool) (interface{}, error) {
+	inst := instanceOf(cache)
+	inst.monitors.feed(ctx, parser)
+	start := time.Now()
+	var out interface{}
+	err := inst.authorize(ctx, parser)
+	if err == nil {
+		out, err = dispatch(ctx, cache, parser, stream)
+	}
+	inst.observe(ctx, parser, time.Since(start), err)
+	return out, err
+}
+
+// dispatch executes command under instance lock or proposes it to Raft group
+func dispatch(ctx context.Context, cache *kv.CacheDb, parser *baseCommandParser, stream bool) (interface{}, error) {
+	if parser.cmd == cmdClusterLex {
+		//cluster commands do not access keys directly, slot migration must not hold atomic batches
+		return execute(ctx, cache, parser, stream)
+	}
+
+	inst := instanceOf(cache)
+	if r := inst.raft.Load(); r != nil && parser.headerParsed && writeCommands[parser.cmd] {
+		//write commands are applied by every member in log order, applied command can not wait for elements.
+		//Proposed command is not interrupted by server shutdown
+		if blockingCommands[parser.cmd] {
+			return nil, raftBlockingError
+		}
+		out, errs := r.propose(context.WithoutCancel(ctx), []*baseCommandParser{parser}, false)
+		return out[0], errs[0]
+	}
+
+	lock := inst.lock.RLock()
+	if !blockingCommands[parser.cmd] {
+		defer inst.lock.RUnlock(lock)
+		return execute(ctx, cache, parser, stream)
+	}
+
+	out, err := execute(nonBlocking(), cache, parser, stream)
+	inst.lock.RUnlock(lock)
+	if err != ErrNotFound {
+		return out, err
+	}
+
+	//lists are empty, call is parked out of lock to not hold atomic batches
+	return execute(ctx, cache, parser, stream)
+}
+
+// ExeAtomic executes commands one by one, no other command is executed in between.
+// Blocking commands do not wait for elements
+func ExeAtomic(cache *kv.CacheDb, parsers []*baseCommandParser) ([]interface{}, []error) {
+	return ExeAtomicContext(context.Background(), cache, parsers)
+}
+
+// ExeAtomicContext executes commands like ExeAtomic, ctx carries transport of commands
+func ExeAtomicContext(ctx context.Context, cache *kv.CacheDb, parsers []*baseCommandParser) ([]interface{}, []error) {
+	inst := instanceOf(cache)
+	for _, parser := range parsers {
+		inst.monitors.feed(ctx, parser)
+	}
+	//batch is not executed if any command is not authorized, AUTH authorizes the next commands
+	for _, parser := range parsers {
+		if err := inst.authorize(ctx, parser); err != nil {
+			errs := make([]error, len(parsers))
+			for i := range errs {
+				errs[i] = err
+			}
+			return make([]interface{}, len(parsers)), errs
+		}
+	}
+	if r := inst.raft.Load(); r != nil {
+		for _, parser := range parsers {
+			if writeCommands[parser.cmd] {
+				start := time.Now()
+				out, errs := r.propose(context.WithoutCancel(ctx), parsers, true)
+				for i, parser := range parsers {
+					inst.observe(ctx, parser, time.Since(start), errs[i])
+				}
+				return out, errs
+			}
+		}
+	}
+
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	nb := nonBlocking()
+	out := make([]interface{}, len(parsers))
+	errs := make([]error, len(parsers))
+	for i, parser := range parsers {
+		start := time.Now()
+		out[i], errs[i] = execute(nb, cache, parser, false)
+		inst.observe(ctx, parser, time.Since(start), errs[i])
+	}
+	return out, errs
+}
+
+// nonBlocking returns context of timed out blocking command
+func nonBlocking() context.Context {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Time{})
+	cancel()
+	return ctx
+}
+
+func execute(ctx context.Context, cache *kv.CacheDb, parser *baseCommandParser, stream bool) (interface{}, error) {
+	if !parser.raw {
+		parser.value = bytes.TrimSpace(parser.value)
+	}
 	if !parser.headerParsed {
-		return nil, errors.New("Incorrect command")
+		return nil, incompleteCommandError
+	}
+	if writeCommands[parser.cmd] && instanceOf(cache).readOnly.Load() {
+		return nil, ErrReadOnly
+	}
+	if node := instanceOf(cache).cluster.Load(); node != nil {
+		if err := node.checkKeys(ctx, parser); err != nil {
+			return nil, err
+		}
 	}
-	//log.Printf("CMD %+v", parser)
 	switch parser.cmd {
 	case cmdGetLex:
 		data, err := cache.Get(parser.key)
@@ -27,6 +173,21 @@ func Exe(cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
 		}
 		return string(data), nil
 	case cmdGetListLex:
+		if stream {
+			it, err := cache.ListIterator(parser.key)
+			if err != nil {
+				return nil, err
+			}
+			return ListStream(func(fn func(elem string) error) error {
+				for it.Next() {
+					if err := fn(string(it.Elem())); err != nil {
+						return err
+					}
+				}
+				return nil
+			}), nil
+		}
+
 		data, err := cache.GetList(parser.key)
 		if err != nil {
 			return nil, err
@@ -38,16 +199,32 @@ func Exe(cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
 		}
 		return out, nil
 	case cmdGetListElemLex:
-		i, err := strconv.Atoi(string(parser.value))
+		i, err := parseListIndex(parser.value)
 		if err != nil {
 			return nil, err
 		}
-		data, err := cache.GetListElement(parser.key, uint16(i))
+		data, err := cache.GetListElement(parser.key, i)
 		if err != nil {
 			return nil, err
 		}
 		return string(data), nil
 	case cmdGetDictLex:
+		if stream {
+			it, err := cache.DictIterator(parser.key)
+			if err != nil {
+				return nil, err
+			}
+			return DictStream(func(fn func(key string, value string) error) error {
+				for it.Next() {
+					k, v := it.Field()
+					if err := fn(string(k), string(v)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}), nil
+		}
+
 		data, err := cache.GetDict(parser.key)
 		if err != nil {
 			return nil, err
@@ -71,14 +248,166 @@ func Exe(cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
 		return nil, cache.SetList(parser.key, parser.ttl, bytes.Split(parser.value, []byte(" ")))
 	case cmdSetDictLex:
 		return nil, cache.SetDict(parser.key, parser.ttl, bytes.Split(parser.value, []byte(" ")))
+	case cmdSetListElemLex:
+		index, value, err := parseElement(parser.value)
+		if err != nil {
+			return nil, err
+		}
+		i, err := parseListIndex(index)
+		if err != nil {
+			return nil, err
+		}
+		return nil, cache.SetListElement(parser.key, i, value)
+	case cmdRemoveListElemLex:
+		i, err := parseListIndex(parser.value)
+		if err != nil {
+			return nil, err
+		}
+		return nil, cache.RemoveListElement(parser.key, i)
+	case cmdSetDictElemLex:
+		field, value, err := parseElement(parser.value)
+		if err != nil {
+			return nil, err
+		}
+		return nil, cache.SetDictElement(parser.key, field, value)
+	case cmdRemoveDictElemLex:
+		return nil, cache.RemoveDictElement(parser.key, parser.value)
 	case cmdKeysLex:
+		if stream {
+			return ListStream(cache.EachKey), nil
+		}
 		return cache.Keys(), nil
 	case cmdRemoveLex:
 		cache.Remove(parser.key)
 		return nil, nil
+	case cmdLPushLex, cmdRPushLex:
+		length, err := cache.Push(parser.key, parser.cmd == cmdLPushLex, bytes.Fields(parser.value))
+		if err != nil {
+			return nil, err
+		}
+		return strconv.Itoa(length), nil
+	case cmdLPopLex, cmdRPopLex:
+		data, err := cache.Pop(parser.key, parser.cmd == cmdLPopLex)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case cmdBLPopLex, cmdBRPopLex:
+		keys, timeout, err := parseBlockingPop(parser)
+		if err != nil {
+			return nil, err
+		}
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		key, data, err := cache.BlockingPop(ctx, keys, parser.cmd == cmdBLPopLex)
+		if err == context.DeadlineExceeded {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []string{key, string(data)}, nil
+	case cmdXAddLex, cmdXRangeLex, cmdXRevRangeLex, cmdXLenLex, cmdXTrimLex, cmdXGroupCreateLex,
+		cmdXGroupDestroyLex, cmdXReadGroupLex, cmdXAckLex, cmdXPendingLex:
+		return executeStream(ctx, cache, parser)
+	case cmdPublishLex:
+		return strconv.Itoa(instanceOf(cache).pubsub.publish(parser.key, string(parser.value))), nil
+	case cmdSubscribeLex, cmdUnsubscribeLex, cmdPSubscribeLex, cmdPUnsubscribeLex:
+		return nil, subscribeConnError
+	case cmdSyncLex:
+		return nil, syncConnError
+	case cmdDumpLex:
+		record, err := cache.Dump(parser.key)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(record), nil
+	case cmdRestoreLex:
+		record, err := base64.StdEncoding.DecodeString(string(parser.value))
+		if err != nil {
+			return nil, incorrectDumpError
+		}
+		return nil, cache.Restore(parser.key, record)
+	case cmdRemoveIfLex:
+		record, err := base64.StdEncoding.DecodeString(string(parser.value))
+		if err != nil {
+			return nil, incorrectDumpError
+		}
+		if !cache.CompareAndRemove(parser.key, record) {
+			return nil, ErrNotFound
+		}
+		return nil, nil
+	case cmdClusterLex:
+		return executeCluster(cache, parser)
+	case cmdAskingLex:
+		//ASKING is applied to next command by binary tcp connection
+		return nil, nil
+	case cmdInfoLex:
+		return executeInfo(cache, parser)
+	case cmdStatsLex:
+		if parser.key != "" {
+			return nil, incorrectInfoArgsError
+		}
+		return infoStats(&infoRequest{cache: cache}), nil
+	case cmdSlowLogLex:
+		return executeSlowLog(cache, parser)
+	case cmdMonitorLex:
+		return nil, monitorConnError
+	case cmdConfigLex:
+		return executeConfig(cache, parser)
+	case cmdAuthLex:
+		//credentials are verified before execution by authorize
+		return nil, nil
 	default:
-		return nil, notFoundErr
+		return nil, incorrectCommandError
+	}
+}
+
+// parseListIndex returns list element position
+func parseListIndex(value []byte) (uint16, error) {
+	i, err := strconv.ParseUint(string(value), 10, 16)
+	if err != nil {
+		return 0, incorrectListIndexError
+	}
+	return uint16(i), nil
+}
+
+// parseElement returns index or field and element of SETLISTELEM and SETDICTELEM value,
+// element can not be empty or contain whitespaces
+func parseElement(value []byte) ([]byte, []byte, error) {
+	fields := bytes.Fields(value)
+	if len(fields) != 2 {
+		return nil, nil, incorrectElementError
+	}
+	return fields[0], fields[1], nil
+}
+
+// parseBlockingPop returns keys and timeout of BLPOP/BRPOP key [key ...] timeout,
+// zero timeout blocks until element is pushed, timeout is not greater than maxBlockingTimeout
+func parseBlockingPop(parser *baseCommandParser) ([]string, time.Duration, error) {
+	fields := strings.Fields(string(parser.value))
+	if len(fields) == 0 {
+		return nil, 0, incompleteCommandError
+	}
+
+	//NaN fails every comparison, infinity is greater than max timeout
+	seconds, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+	if err != nil || !(seconds >= 0 && seconds <= maxBlockingTimeout.Seconds()) {
+		return nil, 0, incorrectTimeoutError
+	}
+
+	keys := append([]string{parser.key}, fields[:len(fields)-1]...)
+	for _, key := range keys {
+		if len(key) > maxKeyLength {
+			return nil, 0, longKeyNameError
+		}
 	}
+	return keys, time.Duration(seconds * float64(time.Second)), nil
 }
 
 func uint16UnsafeConvert(data []byte) uint16 {
@@ -0,0 +1,822 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+type (
+	// ClusterNode is a cluster membership of cache: owners of hash slots, known nodes and slot migrations.
+	// Commands of keys owned by other nodes are answered with MOVED and ASK errors
+	ClusterNode struct {
+		cache *kv.CacheDb
+		id    string
+		addr  string
+
+		lock   sync.RWMutex
+		secret string
+		nodes  map[string]*clusterPeer
+		// slots contains owner node id of every slot, empty for not served slot
+		slots [protocol.ClusterSlots]string
+		// migrating and importing contain target and source node id of migrating slots
+		migrating map[uint16]string
+		importing map[uint16]string
+
+		stop chan struct{}
+		done chan struct{}
+	}
+
+	// clusterPeer is a known cluster node, epoch is a version of node slots
+	clusterPeer struct {
+		addr  string
+		epoch uint64
+		fail  bool
+	}
+
+	// clusterView is a gossip message with nodes known by sender, sender is the first node
+	clusterView struct {
+		Nodes []clusterNodeView `json:"nodes"`
+	}
+
+	clusterNodeView struct {
+		ID    string      `json:"id"`
+		Addr  string      `json:"addr"`
+		Epoch uint64      `json:"epoch"`
+		Slots [][2]uint16 `json:"slots"`
+	}
+
+	// nodeConn is a binary tcp connection to other cluster node
+	nodeConn struct {
+		conn net.Conn
+		e    *protocol.Encoder
+		d    *protocol.Decoder
+	}
+
+	askingKey struct{}
+)
+
+const (
+	clusterGossipInterval = 500 * time.Millisecond
+	clusterTimeout        = 5 * time.Second
+
+	clusterMyID          = "MYID"
+	clusterKeySlot       = "KEYSLOT"
+	clusterSlots         = "SLOTS"
+	clusterNodes         = "NODES"
+	clusterMeet          = "MEET"
+	clusterAddSlots      = "ADDSLOTS"
+	clusterSetSlot       = "SETSLOT"
+	clusterMigrate       = "MIGRATE"
+	clusterGetKeysInSlot = "GETKEYSINSLOT"
+	clusterGossip        = "GOSSIP"
+
+	// clusterUser is AUTH user of node connections, it is not a valid name of users file
+	clusterUser = ":cluster"
+
+	slotImporting = "IMPORTING"
+	slotMigrating = "MIGRATING"
+	slotNode      = "NODE"
+	slotStable    = "STABLE"
+)
+
+var (
+	clusterDisabledError  = badRequest("Cluster mode is disabled")
+	incorrectSlotError    = badRequest("Incorrect slot")
+	incorrectClusterError = badRequest("Incorrect cluster command arguments")
+	crossSlotError        = badRequest("Keys of command belong to different slots")
+	slotNotServedError    = badRequest("Slot is not served by cluster")
+	slotOwnedError        = badRequest("Slot is owned by other node")
+	slotNotOwnedError     = badRequest("Slot is not owned by node")
+	unknownNodeError      = badRequest("Unknown cluster node")
+	migrateSelfError      = badRequest("Slot can not be migrated to the same node")
+	keysInSlotDone        = errors.New("")
+)
+
+// EnableCluster makes cache a cluster node without slots, addr is "host:port" of binary tcp listener
+// announced to other nodes and clients. Node of cache is returned if cluster mode is already enabled
+func EnableCluster(cache *kv.CacheDb, addr string) *ClusterNode {
+	n := &ClusterNode{
+		cache:     cache,
+		id:        newReplicationID(),
+		addr:      addr,
+		nodes:     map[string]*clusterPeer{},
+		migrating: map[uint16]string{},
+		importing: map[uint16]string{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	n.nodes[n.id] = &clusterPeer{addr: addr}
+
+	if !instanceOf(cache).cluster.CompareAndSwap(nil, n) {
+		return instanceOf(cache).cluster.Load()
+	}
+
+	go n.run()
+	return n
+}
+
+// Close stops gossip and disables cluster mode of cache
+func (n *ClusterNode) Close() {
+	select {
+	case <-n.stop:
+		return
+	default:
+		close(n.stop)
+	}
+
+	<-n.done
+	instanceOf(n.cache).cluster.CompareAndSwap(n, nil)
+}
+
+// ID returns node id
+func (n *ClusterNode) ID() string {
+	return n.id
+}
+
+// SetSecret sets secret shared by cluster nodes, connections of nodes are authenticated by it.
+// Secret is required to run cluster with users, connections of nodes have all permissions
+func (n *ClusterNode) SetSecret(secret string) {
+	n.lock.Lock()
+	n.secret = secret
+	n.lock.Unlock()
+}
+
+// verifySecret returns true if node has secret equal to secret
+func (n *ClusterNode) verifySecret(secret string) bool {
+	n.lock.RLock()
+	expected := sha256.Sum256([]byte(n.secret))
+	empty := n.secret == ""
+	n.lock.RUnlock()
+
+	given := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(given[:], expected[:]) == 1 && !empty
+}
+
+// Meet exchanges cluster views with node at addr, nodes known by both nodes are gossiped later
+func (n *ClusterNode) Meet(addr string) error {
+	return n.exchange(addr)
+}
+
+// AddSlots makes node owner of not served slots from..to
+func (n *ClusterNode) AddSlots(from uint16, to uint16) error {
+	if from > to || to >= protocol.ClusterSlots {
+		return incorrectSlotError
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for slot := int(from); slot <= int(to); slot++ {
+		if owner := n.slots[slot]; owner != "" && owner != n.id {
+			return slotOwnedError
+		}
+	}
+
+	n.bumpEpoch()
+	for slot := int(from); slot <= int(to); slot++ {
+		n.slots[slot] = n.id
+	}
+	return nil
+}
+
+// MigrateSlot moves keys of slot to node at addr and hands slot over, returns count of moved keys.
+// Keys missing on node are requested from target by ASK redirects while slot is migrating.
+// Failed migration keeps slot migrating until SETSLOT STABLE or next MigrateSlot
+func (n *ClusterNode) MigrateSlot(slot uint16, addr string) (int, error) {
+	if slot >= protocol.ClusterSlots {
+		return 0, incorrectSlotError
+	}
+
+	n.lock.RLock()
+	owner := n.slots[slot]
+	n.lock.RUnlock()
+	if owner != n.id {
+		return 0, slotNotOwnedError
+	}
+
+	c, err := n.dial(addr)
+	if err != nil {
+		return 0, err
+	}
+	defer c.conn.Close()
+
+	out, err := c.do(fmt.Sprintf("%s %s", cmdClusterLex, clusterMyID))
+	if err != nil {
+		return 0, err
+	}
+	target, _ := out[0].(string)
+	if target == n.id {
+		return 0, migrateSelfError
+	}
+
+	if _, err := c.do(fmt.Sprintf("%s %s %d %s %s", cmdClusterLex, clusterSetSlot, slot, slotImporting, n.id)); err != nil {
+		return 0, err
+	}
+
+	n.lock.Lock()
+	if _, ok := n.nodes[target]; !ok {
+		n.nodes[target] = &clusterPeer{addr: addr}
+	}
+	n.migrating[slot] = target
+	n.lock.Unlock()
+
+	//keys are not added to migrating slot, pass without moved keys leaves only expired keys
+	moved := 0
+	for {
+		passMoved := 0
+		for _, key := range n.keysInSlot(slot, 0) {
+			ok, err := n.migrateKey(c, key)
+			if err != nil {
+				return moved, err
+			}
+			if ok {
+				passMoved++
+			}
+		}
+
+		moved += passMoved
+		if passMoved == 0 {
+			break
+		}
+	}
+
+	out, err = c.do(fmt.Sprintf("%s %s %d %s %s", cmdClusterLex, clusterSetSlot, slot, slotNode, target))
+	if err != nil {
+		return moved, err
+	}
+	epochStr, _ := out[0].(string)
+	epoch, _ := strconv.ParseUint(epochStr, 10, 64)
+
+	n.lock.Lock()
+	if peer := n.nodes[target]; peer.epoch < epoch {
+		peer.epoch = epoch
+	}
+	n.slots[slot] = target
+	delete(n.migrating, slot)
+	n.lock.Unlock()
+	return moved, nil
+}
+
+// migrateKey copies key to target and removes it if key is not changed meanwhile.
+// Returns false if key is removed before it is copied
+func (n *ClusterNode) migrateKey(c *nodeConn, key string) (bool, error) {
+	for {
+		record, err := n.cache.Dump(key)
+		if err == ErrNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		_, err = c.do(cmdAskingLex, fmt.Sprintf("%s %s %s", cmdRestoreLex, key, base64.StdEncoding.EncodeToString(record)))
+		if err != nil {
+			return false, err
+		}
+
+		if n.cache.CompareAndRemove(key, record) {
+			return true, nil
+		}
+
+		if !n.cache.Exists(key) {
+			//key is removed after copy, removal is repeated on target
+			_, err = c.do(cmdAskingLex, fmt.Sprintf("%s %s", cmdRemoveLex, key))
+			return false, err
+		}
+	}
+}
+
+// checkKeys returns MOVED or ASK error if command keys are served by other node
+func (n *ClusterNode) checkKeys(ctx context.Context, parser *baseCommandParser) error {
+	keys := commandKeys(parser)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	slot := protocol.KeySlot(keys[0])
+	for _, key := range keys[1:] {
+		if protocol.KeySlot(key) != slot {
+			return crossSlotError
+		}
+	}
+
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	owner := n.slots[slot]
+	switch {
+	case owner == n.id:
+		target, ok := n.migrating[slot]
+		if !ok {
+			return nil
+		}
+		//migrated and new keys are served by target
+		for _, key := range keys {
+			if !n.cache.Exists(key) {
+				return kv.NewError(ErrAsk, fmt.Sprintf("ASK %d %s", slot, n.nodes[target].addr))
+			}
+		}
+		return nil
+	case n.importing[slot] != "" && asking(ctx):
+		return nil
+	case owner == "":
+		return slotNotServedError
+	default:
+		return kv.NewError(ErrMoved, fmt.Sprintf("MOVED %d %s", slot, n.nodes[owner].addr))
+	}
+}
+
+// commandKeys returns keys of command which are checked by cluster node
+func commandKeys(parser *baseCommandParser) []string {
+	switch parser.cmd {
+	case cmdKeysLex, cmdPublishLex, cmdSubscribeLex, cmdUnsubscribeLex, cmdPSubscribeLex, cmdPUnsubscribeLex,
+		cmdSyncLex, cmdClusterLex, cmdAskingLex, cmdInfoLex, cmdStatsLex, cmdSlowLogLex, cmdMonitorLex, cmdConfigLex, cmdAuthLex:
+		return nil
+	case cmdBLPopLex, cmdBRPopLex:
+		if keys, _, err := parseBlockingPop(parser); err == nil {
+			return keys
+		}
+	}
+	return []string{parser.key}
+}
+
+// withAsking marks ctx of command sent after ASKING
+func withAsking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, askingKey{}, true)
+}
+
+func asking(ctx context.Context) bool {
+	v, _ := ctx.Value(askingKey{}).(bool)
+	return v
+}
+
+// executeCluster executes cluster commands:
+//
+//	CLUSTER MYID
+//	CLUSTER KEYSLOT key
+//	CLUSTER SLOTS
+//	CLUSTER NODES
+//	CLUSTER MEET host:port
+//	CLUSTER ADDSLOTS slot|from-to [slot|from-to ...]
+//	CLUSTER SETSLOT slot IMPORTING|MIGRATING|NODE id
+//	CLUSTER SETSLOT slot STABLE
+//	CLUSTER MIGRATE slot host:port
+//	CLUSTER GETKEYSINSLOT slot [count]
+//	CLUSTER GOSSIP view
+func executeCluster(cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
+	args := strings.Fields(string(parser.value))
+	if parser.key == clusterKeySlot {
+		if len(args) != 1 {
+			return nil, incorrectClusterError
+		}
+		return strconv.Itoa(int(protocol.KeySlot(args[0]))), nil
+	}
+
+	n := instanceOf(cache).cluster.Load()
+	if n == nil {
+		return nil, clusterDisabledError
+	}
+
+	switch parser.key {
+	case clusterMyID:
+		return n.id, nil
+	case clusterSlots:
+		return n.slotRanges(), nil
+	case clusterNodes:
+		return n.nodeList(), nil
+	case clusterMeet:
+		if len(args) != 1 {
+			return nil, incorrectClusterError
+		}
+		return nil, n.Meet(args[0])
+	case clusterAddSlots:
+		if len(args) == 0 {
+			return nil, incorrectClusterError
+		}
+		for _, arg := range args {
+			from, to, err := parseSlotRange(arg)
+			if err != nil {
+				return nil, err
+			}
+			if err := n.AddSlots(from, to); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case clusterSetSlot:
+		if len(args) != 2 && len(args) != 3 {
+			return nil, incorrectClusterError
+		}
+		slot, err := parseSlot(args[0])
+		if err != nil {
+			return nil, err
+		}
+		id := ""
+		if len(args) == 3 {
+			id = args[2]
+		}
+		return n.setSlot(slot, args[1], id)
+	case clusterMigrate:
+		if len(args) != 2 {
+			return nil, incorrectClusterError
+		}
+		slot, err := parseSlot(args[0])
+		if err != nil {
+			return nil, err
+		}
+		moved, err := n.MigrateSlot(slot, args[1])
+		if err != nil {
+			return nil, err
+		}
+		return strconv.Itoa(moved), nil
+	case clusterGetKeysInSlot:
+		if len(args) != 1 && len(args) != 2 {
+			return nil, incorrectClusterError
+		}
+		slot, err := parseSlot(args[0])
+		if err != nil {
+			return nil, err
+		}
+		count := 0
+		if len(args) == 2 {
+			if count, err = strconv.Atoi(args[1]); err != nil || count < 0 {
+				return nil, incorrectClusterError
+			}
+		}
+		return n.keysInSlot(slot, count), nil
+	case clusterGossip:
+		view := clusterView{}
+		if err := json.Unmarshal(parser.value, &view); err != nil || len(view.Nodes) == 0 {
+			return nil, incorrectClusterError
+		}
+		n.merge(view)
+
+		data, err := json.Marshal(n.view())
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	default:
+		return nil, incorrectClusterError
+	}
+}
+
+// setSlot changes slot state, NODE returns epoch of new owner
+func (n *ClusterNode) setSlot(slot uint16, state string, id string) (interface{}, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if state == slotStable {
+		if id != "" {
+			return nil, incorrectClusterError
+		}
+		delete(n.migrating, slot)
+		delete(n.importing, slot)
+		return nil, nil
+	}
+
+	peer, ok := n.nodes[id]
+	if !ok {
+		return nil, unknownNodeError
+	}
+
+	switch state {
+	case slotImporting:
+		if n.slots[slot] == n.id {
+			return nil, slotOwnedError
+		}
+		n.importing[slot] = id
+		return nil, nil
+	case slotMigrating:
+		if n.slots[slot] != n.id {
+			return nil, slotNotOwnedError
+		}
+		n.migrating[slot] = id
+		return nil, nil
+	case slotNode:
+		if id == n.id {
+			n.bumpEpoch()
+		}
+		n.slots[slot] = id
+		delete(n.migrating, slot)
+		delete(n.importing, slot)
+		return strconv.FormatUint(peer.epoch, 10), nil
+	default:
+		return nil, incorrectClusterError
+	}
+}
+
+// bumpEpoch makes node epoch the greatest known epoch, lock must be held
+func (n *ClusterNode) bumpEpoch() {
+	var epoch uint64
+	for _, peer := range n.nodes {
+		if peer.epoch > epoch {
+			epoch = peer.epoch
+		}
+	}
+	n.nodes[n.id].epoch = epoch + 1
+}
+
+// keysInSlot returns up to count keys of slot, zero count returns all keys
+func (n *ClusterNode) keysInSlot(slot uint16, count int) []string {
+	out := []string{}
+	n.cache.EachKey(func(key string) error {
+		if protocol.KeySlot(key) == slot {
+			out = append(out, key)
+		}
+		if count > 0 && len(out) == count {
+			return keysInSlotDone
+		}
+		return nil
+	})
+	return out
+}
+
+// slotRanges returns served slot ranges as "from-to id host:port"
+func (n *ClusterNode) slotRanges() []string {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	out := []string{}
+	for id, ranges := range n.ranges() {
+		for _, r := range ranges {
+			out = append(out, fmt.Sprintf("%d-%d %s %s", r[0], r[1], id, n.nodes[id].addr))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return slotRangeStart(out[i]) < slotRangeStart(out[j])
+	})
+	return out
+}
+
+// nodeList returns known nodes as "id host:port epoch myself|ok|fail [from-to ...]"
+func (n *ClusterNode) nodeList() []string {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	ranges := n.ranges()
+	out := []string{}
+	for id, peer := range n.nodes {
+		state := "ok"
+		switch {
+		case id == n.id:
+			state = "myself"
+		case peer.fail:
+			state = "fail"
+		}
+
+		elems := []string{id, peer.addr, strconv.FormatUint(peer.epoch, 10), state}
+		for _, r := range ranges[id] {
+			elems = append(elems, fmt.Sprintf("%d-%d", r[0], r[1]))
+		}
+		out = append(out, strings.Join(elems, " "))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ranges returns slot ranges of nodes, lock must be held
+func (n *ClusterNode) ranges() map[string][][2]uint16 {
+	out := map[string][][2]uint16{}
+	for from := 0; from < protocol.ClusterSlots; {
+		to := from
+		for to+1 < protocol.ClusterSlots && n.slots[to+1] == n.slots[from] {
+			to++
+		}
+		if id := n.slots[from]; id != "" {
+			out[id] = append(out[id], [2]uint16{uint16(from), uint16(to)})
+		}
+		from = to + 1
+	}
+	return out
+}
+
+// view returns gossip message of node
+func (n *ClusterNode) view() clusterView {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	ranges := n.ranges()
+	ids := make([]string, 0, len(n.nodes))
+	for id := range n.nodes {
+		if id != n.id {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ids = append([]string{n.id}, ids...)
+
+	view := clusterView{}
+	for _, id := range ids {
+		peer := n.nodes[id]
+		view.Nodes = append(view.Nodes, clusterNodeView{ID: id, Addr: peer.addr, Epoch: peer.epoch, Slots: ranges[id]})
+	}
+	return view
+}
+
+// merge applies gossip message. Slots are claimed by node with greater epoch
+func (n *ClusterNode) merge(view clusterView) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for i, node := range view.Nodes {
+		if node.ID == n.id {
+			continue
+		}
+
+		peer, ok := n.nodes[node.ID]
+		if !ok {
+			peer = &clusterPeer{addr: node.Addr}
+			n.nodes[node.ID] = peer
+		}
+		if i == 0 {
+			peer.addr, peer.fail = node.Addr, false
+		}
+		if node.Epoch < peer.epoch {
+			continue
+		}
+		peer.epoch = node.Epoch
+
+		for _, r := range node.Slots {
+			for slot := int(r[0]); slot <= int(r[1]) && slot < protocol.ClusterSlots; slot++ {
+				n.claim(uint16(slot), node.ID, node.Epoch)
+			}
+		}
+	}
+}
+
+// claim sets owner of slot if current owner has lower epoch, lock must be held
+func (n *ClusterNode) claim(slot uint16, id string, epoch uint64) {
+	owner := n.slots[slot]
+	if owner == id {
+		return
+	}
+	if owner != "" {
+		current := n.nodes[owner].epoch
+		if current > epoch || (current == epoch && owner > id) {
+			return
+		}
+	}
+	n.slots[slot] = id
+}
+
+// run gossips with random known node
+func (n *ClusterNode) run() {
+	defer close(n.done)
+
+	ticker := time.NewTicker(clusterGossipInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+
+		n.lock.RLock()
+		addrs := []string{}
+		for id, peer := range n.nodes {
+			if id != n.id {
+				addrs = append(addrs, peer.addr)
+			}
+		}
+		n.lock.RUnlock()
+
+		if len(addrs) > 0 {
+			n.exchange(addrs[rand.Intn(len(addrs))])
+		}
+	}
+}
+
+// exchange sends node view to node at addr and merges its view, node is marked failed on error
+func (n *ClusterNode) exchange(addr string) error {
+	err := func() error {
+		data, err := json.Marshal(n.view())
+		if err != nil {
+			return err
+		}
+
+		c, err := n.dial(addr)
+		if err != nil {
+			return err
+		}
+		defer c.conn.Close()
+
+		out, err := c.do(fmt.Sprintf("%s %s %s", cmdClusterLex, clusterGossip, data))
+		if err != nil {
+			return err
+		}
+
+		view := clusterView{}
+		answer, _ := out[0].(string)
+		if err := json.Unmarshal([]byte(answer), &view); err != nil || len(view.Nodes) == 0 {
+			return incorrectClusterError
+		}
+		n.merge(view)
+		return nil
+	}()
+
+	if err != nil {
+		n.lock.Lock()
+		for id, peer := range n.nodes {
+			if id != n.id && peer.addr == addr {
+				peer.fail = true
+			}
+		}
+		n.lock.Unlock()
+	}
+	return err
+}
+
+// dial connects to node at addr, connection is authenticated by secret of node
+func (n *ClusterNode) dial(addr string) (*nodeConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, clusterTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &nodeConn{conn: conn, e: protocol.NewEncoder(conn), d: protocol.NewDecoder(conn)}
+
+	n.lock.RLock()
+	secret := n.secret
+	n.lock.RUnlock()
+	if secret == "" {
+		return c, nil
+	}
+
+	if _, err := c.do(fmt.Sprintf("%s %s %s", cmdAuthLex, clusterUser, secret)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// do sends pipelined commands and returns responses, first error response is returned as error
+func (c *nodeConn) do(cmds ...string) ([]interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(clusterTimeout))
+	for _, cmd := range cmds {
+		if err := c.e.EncodeRequest([]byte(cmd)); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]interface{}, len(cmds))
+	var first error
+	for i := range cmds {
+		var err error
+		out[i], err = c.d.DecodeResponse()
+		if _, ok := err.(*protocol.Error); !ok && err != nil && err != protocol.ErrNotFound {
+			return nil, err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return out, first
+}
+
+func parseSlot(s string) (uint16, error) {
+	slot, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || slot >= protocol.ClusterSlots {
+		return 0, incorrectSlotError
+	}
+	return uint16(slot), nil
+}
+
+// parseSlotRange parses "slot" or "from-to"
+func parseSlotRange(s string) (uint16, uint16, error) {
+	fromStr, toStr, ok := strings.Cut(s, "-")
+	if !ok {
+		toStr = fromStr
+	}
+
+	from, err := parseSlot(fromStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseSlot(toStr)
+	if err != nil || to < from {
+		return 0, 0, incorrectSlotError
+	}
+	return from, to, nil
+}
+
+func slotRangeStart(s string) int {
+	start, _ := strconv.Atoi(s[:strings.IndexByte(s, '-')])
+	return start
+}
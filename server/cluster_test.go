@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+func TestCluster(t *testing.T) {
+	addrs := []string{"127.0.0.1:4520", "127.0.0.1:4521", "127.0.0.1:4522"}
+	caches := make([]*kv.CacheDb, len(addrs))
+	nodes := make([]*ClusterNode, len(addrs))
+	for i, addr := range addrs {
+		caches[i] = kv.NewCacheDb()
+		ts := NewTcpServer(caches[i], "127.0.0.1", 4520+i)
+		go ts.Listen()
+
+		nodes[i] = EnableCluster(caches[i], addr)
+		defer nodes[i].Close()
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	a, b, c := caches[0], caches[1], caches[2]
+	if _, err := exeCommand(a, "CLUSTER ADDSLOTS 0-8191"); err != nil {
+		t.Fatal("Add slots error", err.Error())
+	}
+	if _, err := exeCommand(b, "CLUSTER ADDSLOTS 8192-16000 16001-16383"); err != nil {
+		t.Fatal("Add slots error", err.Error())
+	}
+
+	if _, err := exeCommand(a, "CLUSTER MEET "+addrs[1]); err != nil {
+		t.Fatal("Meet error", err.Error())
+	}
+	if _, err := exeCommand(c, "CLUSTER MEET "+addrs[0]); err != nil {
+		t.Fatal("Meet error", err.Error())
+	}
+
+	//foo is in slot 12182 of b
+	moved := func(cache *kv.CacheDb, key string, addr string) func() bool {
+		return func() bool {
+			_, err := exeCommand(cache, "GET "+key)
+			return errors.Is(err, ErrMoved) && strings.HasSuffix(err.Error(), fmt.Sprintf("MOVED %d %s", protocol.KeySlot(key), addr))
+		}
+	}
+	waitFor(t, "moved to b", moved(a, "foo", addrs[1]))
+	waitFor(t, "gossiped slots", moved(c, "foo", addrs[1]))
+	waitFor(t, "gossiped nodes", func() bool {
+		out, _ := exeCommand(b, "CLUSTER NODES")
+		return len(out.([]string)) == 3
+	})
+	if _, err := exeCommand(b, "CLUSTER ADDSLOTS 0"); err != slotOwnedError {
+		t.Fatal("Incorrect add slots error", "expected", slotOwnedError, "got", err)
+	}
+
+	if _, err := exeCommand(b, "SET foo bar"); err != nil {
+		t.Fatal("Set error", err.Error())
+	}
+	exeCommand(b, "SET {foo}list bar")
+	if _, err := exeCommand(b, "BLPOP foo bar 0"); !errors.Is(err, crossSlotError) {
+		t.Fatal("Incorrect cross slot error", "expected", crossSlotError, "got", err)
+	}
+
+	out, err := exeCommand(b, fmt.Sprintf("CLUSTER MIGRATE %d %s", protocol.KeySlot("foo"), addrs[0]))
+	if err != nil || out != "2" {
+		t.Fatal("Incorrect migrate response", "expected", "2", "got", out, err)
+	}
+	if out, err := exeCommand(a, "GET foo"); err != nil || out != "bar" {
+		t.Fatal("Incorrect migrated key", "expected", "bar", "got", out, err)
+	}
+	if !moved(b, "foo", addrs[0])() {
+		t.Fatal("Expected moved migrated slot")
+	}
+	waitFor(t, "gossiped migration", moved(c, "foo", addrs[0]))
+
+	//keys missing on migrating slot are served by target after ASKING
+	slot := protocol.KeySlot("foo")
+	exeCommand(b, fmt.Sprintf("CLUSTER SETSLOT %d IMPORTING %s", slot, nodes[0].ID()))
+	exeCommand(a, fmt.Sprintf("CLUSTER SETSLOT %d MIGRATING %s", slot, nodes[1].ID()))
+
+	if out, err := exeCommand(a, "GET foo"); err != nil || out != "bar" {
+		t.Fatal("Incorrect migrating key", "expected", "bar", "got", out, err)
+	}
+	if _, err := exeCommand(a, "SET {foo}new value"); !errors.Is(err, ErrAsk) || !strings.HasSuffix(err.Error(), fmt.Sprintf("ASK %d %s", slot, addrs[1])) {
+		t.Fatal("Incorrect ask error", "got", err)
+	}
+	if !moved(b, "{foo}new", addrs[0])() {
+		t.Fatal("Expected moved without asking")
+	}
+
+	parser := &baseCommandParser{}
+	parser.Write([]byte("SET {foo}new value"))
+	if _, err := ExeContext(withAsking(context.Background()), b, parser); err != nil {
+		t.Fatal("Asking set error", err.Error())
+	}
+
+	exeCommand(a, fmt.Sprintf("CLUSTER SETSLOT %d STABLE", slot))
+	exeCommand(b, fmt.Sprintf("CLUSTER SETSLOT %d STABLE", slot))
+	if !moved(b, "{foo}new", addrs[0])() {
+		t.Fatal("Expected moved after stable")
+	}
+
+	if out, _ := exeCommand(c, "CLUSTER KEYSLOT foo"); out != "12182" {
+		t.Fatal("Incorrect key slot", "expected", "12182", "got", out)
+	}
+	if out, _ := exeCommand(a, "CLUSTER SLOTS"); len(out.([]string)) != 4 {
+		t.Fatal("Incorrect slot ranges", "expected", 4, "got", out)
+	}
+}
+
+func TestClusterAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	os.WriteFile(path, []byte(fmt.Sprintf(`{"alice": {"password": %q}}`, hashPassword("secret", []byte("salt"), 1000))), 0600)
+
+	addrs := []string{"127.0.0.1:4540", "127.0.0.1:4541", "127.0.0.1:4542"}
+	secrets := []string{"cluster secret", "cluster secret", "wrong secret"}
+	caches := make([]*kv.CacheDb, len(addrs))
+	for i, addr := range addrs {
+		caches[i] = kv.NewCacheDb()
+		if err := LoadUsers(caches[i], path); err != nil {
+			t.Fatal("Load error", err.Error())
+		}
+		ts := NewTcpServer(caches[i], "127.0.0.1", 4540+i)
+		go ts.Listen()
+		defer ts.Close()
+
+		node := EnableCluster(caches[i], addr)
+		node.SetSecret(secrets[i])
+		defer node.Close()
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	a, b, c := caches[0], caches[1], caches[2]
+	exeCommand(a, "CLUSTER ADDSLOTS 0-8191")
+	exeCommand(b, "CLUSTER ADDSLOTS 8192-16383")
+	if _, err := exeCommand(a, "CLUSTER MEET "+addrs[1]); err != nil {
+		t.Fatal("Meet error", err.Error())
+	}
+	if _, err := exeCommand(c, "CLUSTER MEET "+addrs[0]); !isErrorCode(err, protocol.CodeUnauthorized) {
+		t.Fatal("Incorrect meet error of wrong secret", "expected", protocol.CodeUnauthorized, "got", err)
+	}
+
+	//keys are migrated by authenticated node connection
+	exeCommand(b, "SET foo bar")
+	out, err := exeCommand(b, fmt.Sprintf("CLUSTER MIGRATE %d %s", protocol.KeySlot("foo"), addrs[0]))
+	if err != nil || out != "1" {
+		t.Fatal("Incorrect migrate response", "expected", "1", "got", out, err)
+	}
+	if out, err := exeCommand(a, "GET foo"); err != nil || out != "bar" {
+		t.Fatal("Incorrect migrated key", "expected", "bar", "got", out, err)
+	}
+
+	conn, err := net.Dial("tcp", addrs[0])
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer conn.Close()
+	e := protocol.NewEncoder(conn)
+	d := protocol.NewDecoder(conn)
+	request := func(cmd string) (interface{}, error) {
+		e.EncodeRequest([]byte(cmd))
+		return d.DecodeResponse()
+	}
+
+	gossip := `CLUSTER GOSSIP {"nodes": [{"id": "fake", "addr": "127.0.0.1:1", "epoch": 100, "slots": [[0, 16383]]}]}`
+	for _, cmd := range []string{gossip, "AUTH " + clusterUser + " wrong", "AUTH " + clusterUser + " wrong secret"} {
+		if _, err := request(cmd); !isErrorCode(err, protocol.CodeUnauthorized) {
+			t.Fatal("Incorrect not authenticated response", cmd, "expected", protocol.CodeUnauthorized, "got", err)
+		}
+	}
+	if _, err := request("AUTH " + clusterUser + " cluster secret"); err != nil {
+		t.Fatal("Node auth error", err.Error())
+	}
+	if _, err := request("CLUSTER MYID"); err != nil {
+		t.Fatal("Incorrect authenticated node response", err.Error())
+	}
+}
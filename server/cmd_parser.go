@@ -3,14 +3,15 @@ package server
 import (
 	"bytes"
 	"errors"
-	"io"
 	"strconv"
 	"text/scanner"
+	"unicode"
 )
 
 const (
-	maxKeyLength = 256
-	maxTTLLength = 19
+	maxKeyLength     = 256
+	maxTTLLength     = 19
+	maxRequestLength = 64 << 20
 
 	cmdKeys = iota
 	cmdRemove
@@ -22,6 +23,43 @@ const (
 	cmdSetDict
 	cmdGetListElem
 	cmdGetDictElem
+	cmdPublish
+	cmdSubscribe
+	cmdUnsubscribe
+	cmdPSubscribe
+	cmdPUnsubscribe
+	cmdLPush
+	cmdRPush
+	cmdLPop
+	cmdRPop
+	cmdBLPop
+	cmdBRPop
+	cmdXAdd
+	cmdXRange
+	cmdXRevRange
+	cmdXLen
+	cmdXTrim
+	cmdXGroupCreate
+	cmdXGroupDestroy
+	cmdXReadGroup
+	cmdXAck
+	cmdXPending
+	cmdSync
+	cmdDump
+	cmdRestore
+	cmdCluster
+	cmdAsking
+	cmdInfo
+	cmdStats
+	cmdSlowLog
+	cmdMonitor
+	cmdConfig
+	cmdAuth
+	cmdSetListElem
+	cmdRemoveListElem
+	cmdSetDictElem
+	cmdRemoveDictElem
+	cmdRemoveIf
 
 	cmdKeysLex        = "KEYS"
 	cmdRemoveLex      = "REMOVE"
@@ -33,14 +71,125 @@ const (
 	cmdSetLex         = "SET"
 	cmdSetListLex     = "SETLIST"
 	cmdSetDictLex     = "SETDICT"
+
+	cmdSetListElemLex    = "SETLISTELEM"
+	cmdRemoveListElemLex = "REMOVELISTELEM"
+	cmdSetDictElemLex    = "SETDICTELEM"
+	cmdRemoveDictElemLex = "REMOVEDICTELEM"
+
+	cmdPublishLex      = "PUBLISH"
+	cmdSubscribeLex    = "SUBSCRIBE"
+	cmdUnsubscribeLex  = "UNSUBSCRIBE"
+	cmdPSubscribeLex   = "PSUBSCRIBE"
+	cmdPUnsubscribeLex = "PUNSUBSCRIBE"
+
+	cmdLPushLex = "LPUSH"
+	cmdRPushLex = "RPUSH"
+	cmdLPopLex  = "LPOP"
+	cmdRPopLex  = "RPOP"
+	cmdBLPopLex = "BLPOP"
+	cmdBRPopLex = "BRPOP"
+
+	cmdXAddLex          = "XADD"
+	cmdXRangeLex        = "XRANGE"
+	cmdXRevRangeLex     = "XREVRANGE"
+	cmdXLenLex          = "XLEN"
+	cmdXTrimLex         = "XTRIM"
+	cmdXGroupCreateLex  = "XGROUPCREATE"
+	cmdXGroupDestroyLex = "XGROUPDESTROY"
+	cmdXReadGroupLex    = "XREADGROUP"
+	cmdXAckLex          = "XACK"
+	cmdXPendingLex      = "XPENDING"
+
+	cmdSyncLex    = "SYNC"
+	cmdDumpLex    = "DUMP"
+	cmdRestoreLex = "RESTORE"
+
+	cmdRemoveIfLex = "REMOVEIF"
+
+	cmdClusterLex = "CLUSTER"
+	cmdAskingLex  = "ASKING"
+
+	cmdInfoLex  = "INFO"
+	cmdStatsLex = "STATS"
+
+	cmdSlowLogLex = "SLOWLOG"
+	cmdMonitorLex = "MONITOR"
+	cmdConfigLex  = "CONFIG"
+
+	cmdAuthLex = "AUTH"
 )
 
 var (
-	approvedCommands      map[string]int
-	incorrectCommandError = errors.New("Incorrect command name")
-	longKeyNameError      = errors.New("Maximum key name length is 256")
-	notTTl                = errors.New("")
-	zeroTTl               = errors.New("TTL can not be zero")
+	approvedCommands map[string]int
+	// ttlCommands accept optional TTL before value
+	ttlCommands = map[string]bool{
+		cmdSetLex:     true,
+		cmdSetListLex: true,
+		cmdSetDictLex: true,
+	}
+	// noKeyCommands are allowed without key
+	noKeyCommands = map[string]bool{
+		cmdUnsubscribeLex:  true,
+		cmdPUnsubscribeLex: true,
+		cmdAskingLex:       true,
+		cmdInfoLex:         true,
+		cmdStatsLex:        true,
+		cmdMonitorLex:      true,
+	}
+	// noValueCommands are allowed without value
+	noValueCommands = map[string]bool{
+		cmdSubscribeLex:    true,
+		cmdUnsubscribeLex:  true,
+		cmdPSubscribeLex:   true,
+		cmdPUnsubscribeLex: true,
+		cmdLPopLex:         true,
+		cmdRPopLex:         true,
+		cmdXLenLex:         true,
+		cmdDumpLex:         true,
+		cmdClusterLex:      true,
+		cmdInfoLex:         true,
+		cmdStatsLex:        true,
+		cmdSlowLogLex:      true,
+		cmdMonitorLex:      true,
+	}
+	// writeCommands change keys, they are rejected by read only replica
+	writeCommands = map[string]bool{
+		cmdRemoveLex:        true,
+		cmdSetLex:           true,
+		cmdSetListLex:       true,
+		cmdSetDictLex:       true,
+		cmdLPushLex:         true,
+		cmdRPushLex:         true,
+		cmdLPopLex:          true,
+		cmdRPopLex:          true,
+		cmdBLPopLex:         true,
+		cmdBRPopLex:         true,
+		cmdXAddLex:          true,
+		cmdXTrimLex:         true,
+		cmdXGroupCreateLex:  true,
+		cmdXGroupDestroyLex: true,
+		cmdXReadGroupLex:    true,
+		cmdXAckLex:          true,
+		cmdRestoreLex:       true,
+		cmdRemoveIfLex:      true,
+
+		cmdSetListElemLex:    true,
+		cmdRemoveListElemLex: true,
+		cmdSetDictElemLex:    true,
+		cmdRemoveDictElemLex: true,
+	}
+	// blockingCommands wait for data until timeout
+	blockingCommands = map[string]bool{
+		cmdBLPopLex: true,
+		cmdBRPopLex: true,
+	}
+
+	incorrectCommandError  = badRequest("Incorrect command name")
+	incompleteCommandError = badRequest("Incomplete command")
+	longKeyNameError       = badRequest("Maximum key name length is 256")
+	notTTl                 = errors.New("")
+	zeroTTl                = badRequest("TTL can not be zero")
 )
 
 func init() {
@@ -55,6 +204,53 @@ func init() {
 		cmdSetDictLex:     cmdSetDict,
 		cmdGetListElemLex: cmdGetListElem,
 		cmdGetDictElemLex: cmdGetDictElem,
+
+		cmdSetListElemLex:    cmdSetListElem,
+		cmdRemoveListElemLex: cmdRemoveListElem,
+		cmdSetDictElemLex:    cmdSetDictElem,
+		cmdRemoveDictElemLex: cmdRemoveDictElem,
+
+		cmdPublishLex:      cmdPublish,
+		cmdSubscribeLex:    cmdSubscribe,
+		cmdUnsubscribeLex:  cmdUnsubscribe,
+		cmdPSubscribeLex:   cmdPSubscribe,
+		cmdPUnsubscribeLex: cmdPUnsubscribe,
+
+		cmdLPushLex: cmdLPush,
+		cmdRPushLex: cmdRPush,
+		cmdLPopLex:  cmdLPop,
+		cmdRPopLex:  cmdRPop,
+		cmdBLPopLex: cmdBLPop,
+		cmdBRPopLex: cmdBRPop,
+
+		cmdXAddLex:          cmdXAdd,
+		cmdXRangeLex:        cmdXRange,
+		cmdXRevRangeLex:     cmdXRevRange,
+		cmdXLenLex:          cmdXLen,
+		cmdXTrimLex:         cmdXTrim,
+		cmdXGroupCreateLex:  cmdXGroupCreate,
+		cmdXGroupDestroyLex: cmdXGroupDestroy,
+		cmdXReadGroupLex:    cmdXReadGroup,
+		cmdXAckLex:          cmdXAck,
+		cmdXPendingLex:      cmdXPending,
+
+		cmdSyncLex:    cmdSync,
+		cmdDumpLex:    cmdDump,
+		cmdRestoreLex: cmdRestore,
+
+		cmdRemoveIfLex: cmdRemoveIf,
+
+		cmdClusterLex: cmdCluster,
+		cmdAskingLex:  cmdAsking,
+
+		cmdInfoLex:  cmdInfo,
+		cmdStatsLex: cmdStats,
+
+		cmdSlowLogLex: cmdSlowLog,
+		cmdMonitorLex: cmdMonitor,
+		cmdConfigLex:  cmdConfig,
+
+		cmdAuthLex: cmdAuth,
 	}
 }
 
@@ -65,22 +261,27 @@ type (
 		ttl          int64
 		value        []byte
 		headerParsed bool
+		// raw value is stored as is, value of text command is trimmed
+		raw bool
 	}
 )
 
-//COMMAND key [TTL] value
+// COMMAND key [TTL] value
 func (r *baseCommandParser) Write(p []byte) (n int, err error) {
 	if !r.headerParsed {
 		var s scanner.Scanner
 		buff := bytes.NewBuffer(p)
 		s.Init(buff)
+		//command, key and ttl are whitespace separated tokens
+		s.Mode = scanner.ScanIdents
+		s.IsIdentRune = isTokenRune
 
 		//defer fmt.Printf("## %s\n", buff.String())
 
 		//scan command
 		tok := s.Scan()
 		if tok == scanner.EOF {
-			return 0, io.EOF
+			return 0, incompleteCommandError
 		}
 
 		//check command
@@ -101,7 +302,11 @@ func (r *baseCommandParser) Write(p []byte) (n int, err error) {
 		//scan key name
 		tok = s.Scan()
 		if tok == scanner.EOF {
-			return 0, io.EOF
+			if noKeyCommands[cmd] {
+				r.headerParsed = true
+				return len(p), nil
+			}
+			return 0, incompleteCommandError
 		}
 
 		r.key = s.TokenText()
@@ -115,12 +320,22 @@ func (r *baseCommandParser) Write(p []byte) (n int, err error) {
 			return len(p), nil
 		}
 
-		//scan ttl if exist
 		tok = s.Scan()
 		if tok == scanner.EOF {
-			return 0, io.EOF
+			if noValueCommands[cmd] {
+				r.headerParsed = true
+				return len(p), nil
+			}
+			return 0, incompleteCommandError
 		}
 
+		if !ttlCommands[cmd] {
+			r.value = p[s.Offset:]
+			r.headerParsed = true
+			return len(p), nil
+		}
+
+		//scan ttl if exist
 		ttlOffset := s.Offset + maxTTLLength + 2
 
 		if len(p) < ttlOffset {
@@ -134,7 +349,7 @@ func (r *baseCommandParser) Write(p []byte) (n int, err error) {
 			r.ttl = ttl
 			tok = s.Scan()
 			if tok == scanner.EOF {
-				return 0, io.EOF
+				return 0, incompleteCommandError
 			}
 		case notTTl:
 		case zeroTTl:
@@ -154,6 +369,10 @@ func (r *baseCommandParser) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+func isTokenRune(ch rune, i int) bool {
+	return ch != scanner.EOF && !unicode.IsSpace(ch)
+}
+
 func parseTTL(p []byte) (int64, int, error) {
 	var num []byte
 
@@ -177,7 +396,7 @@ loop:
 
 	ttl, err := strconv.Atoi(string(num))
 	if err != nil {
-		return 0, 0, errors.New("Incorrect ttl: " + err.Error())
+		return 0, 0, badRequest("Incorrect ttl: " + err.Error())
 	}
 
 	if ttl == 0 {
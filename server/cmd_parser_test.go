@@ -2,6 +2,7 @@ package server
 
 import (
 	"testing"
+	"time"
 )
 
 func TestCmdParserKeys(t *testing.T) {
@@ -77,6 +78,23 @@ func TestCmdFullParser(t *testing.T) {
 		{"KEYS", "KEYS", "", 0, "", false},
 		{"REMOVE", "REMOVE", "", 0, "", true},
 		{"REMOVE hhh", "REMOVE", "hhh", 0, "", false},
+		{"GET user:1", "GET", "user:1", 0, "", false},
+		{"GET a.b-c/d", "GET", "a.b-c/d", 0, "", false},
+		{"GET\tkey\tnext", "GET", "key", 0, "", false},
+		{"SET key-1 10 a b", "SET", "key-1", 10, "a b", false},
+		{"SETLIST list.1 a b", "SETLIST", "list.1", 0, "a b", false},
+		{"GETDICTELEM user:1 name", "GETDICTELEM", "user:1", 0, "name", false},
+		{"PUBLISH news.tech 10 hello", "PUBLISH", "news.tech", 0, "10 hello", false},
+		{"PUBLISH news", "PUBLISH", "news", 0, "", true},
+		{"PSUBSCRIBE news.*", "PSUBSCRIBE", "news.*", 0, "", false},
+		{"SUBSCRIBE a b", "SUBSCRIBE", "a", 0, "b", false},
+		{"UNSUBSCRIBE", "UNSUBSCRIBE", "", 0, "", false},
+		{"GETLISTELEM list 1", "GETLISTELEM", "list", 0, "1", false},
+		{"LPUSH queue 10 a", "LPUSH", "queue", 0, "10 a", false},
+		{"RPUSH queue", "RPUSH", "queue", 0, "", true},
+		{"LPOP queue", "LPOP", "queue", 0, "", false},
+		{"BLPOP a b 0", "BLPOP", "a", 0, "b 0", false},
+		{"BRPOP a", "BRPOP", "a", 0, "", true},
 	}
 
 	for _, tc := range testCases {
@@ -156,3 +174,34 @@ func TestCmdParserBigTTL(t *testing.T) {
 		t.Fatal("Expected Error, got nil")
 	}
 }
+
+func TestCmdParserBlockingPopTimeout(t *testing.T) {
+	testCases := []struct {
+		in      string
+		timeout time.Duration
+		err     error
+	}{
+		{"BLPOP a 0", 0, nil},
+		{"BLPOP a b 1.5", 1500 * time.Millisecond, nil},
+		{"BLPOP a 86400", maxBlockingTimeout, nil},
+		{"BLPOP a 86401", 0, incorrectTimeoutError},
+		{"BLPOP a 1e300", 0, incorrectTimeoutError},
+		{"BLPOP a -1", 0, incorrectTimeoutError},
+		{"BLPOP a NaN", 0, incorrectTimeoutError},
+		{"BLPOP a Inf", 0, incorrectTimeoutError},
+	}
+
+	for _, tc := range testCases {
+		parser := &baseCommandParser{}
+		if _, err := parser.Write([]byte(tc.in)); err != nil {
+			t.Fatal("Got Error:", err)
+		}
+		_, timeout, err := parseBlockingPop(parser)
+		if err != tc.err {
+			t.Fatal("Incorrect error", tc.in, "expected", tc.err, "got", err)
+		}
+		if timeout != tc.timeout {
+			t.Fatal("Incorrect timeout", tc.in, "expected", tc.timeout, "got", timeout)
+		}
+	}
+}
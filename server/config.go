@@ -0,0 +1,184 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	// ConfigParam is a runtime tunable parameter of CONFIG GET and CONFIG SET commands
+	ConfigParam struct {
+		Get func() string
+		// Set applies value or returns error of incorrect value
+		Set func(value string) error
+	}
+
+	// config is a registry of runtime tunable parameters by name
+	config struct {
+		lock   sync.RWMutex
+		params map[string]ConfigParam
+	}
+)
+
+const (
+	configGet = "GET"
+	configSet = "SET"
+)
+
+var (
+	incorrectConfigError      = badRequest("Incorrect config subcommand")
+	unknownConfigError        = badRequest("Unknown config parameter")
+	incorrectConfigValueError = badRequest("Incorrect config value")
+)
+
+// newConfig returns registry of parameters of cache slow log, request log and keyspace notifications
+func newConfig(cache *kv.CacheDb) *config {
+	return &config{params: map[string]ConfigParam{
+		"slowlog-threshold": {
+			Get: func() string {
+				threshold, _ := instanceOf(cache).slowLog.settings()
+				return threshold.String()
+			},
+			Set: func(value string) error {
+				threshold, err := time.ParseDuration(value)
+				if err != nil {
+					return incorrectConfigValueError
+				}
+				_, maxLen := instanceOf(cache).slowLog.settings()
+				SetSlowLog(cache, threshold, maxLen)
+				return nil
+			},
+		},
+		"slowlog-max-len": {
+			Get: func() string {
+				_, maxLen := instanceOf(cache).slowLog.settings()
+				return strconv.Itoa(maxLen)
+			},
+			Set: func(value string) error {
+				maxLen, err := strconv.Atoi(value)
+				if err != nil || maxLen < 0 {
+					return incorrectConfigValueError
+				}
+				threshold, _ := instanceOf(cache).slowLog.settings()
+				SetSlowLog(cache, threshold, maxLen)
+				return nil
+			},
+		},
+		"log-requests": {
+			Get: func() string {
+				return strconv.FormatBool(instanceOf(cache).logRequests.Load())
+			},
+			Set: func(value string) error {
+				enabled, err := strconv.ParseBool(value)
+				if err != nil {
+					return incorrectConfigValueError
+				}
+				SetLogRequests(cache, enabled)
+				return nil
+			},
+		},
+		"notify-keyspace-events": {
+			Get: func() string {
+				n := &instanceOf(cache).keyspace
+				n.lock.Lock()
+				defer n.lock.Unlock()
+				return n.names
+			},
+			Set: func(value string) error {
+				return SetKeyspaceEvents(cache, value)
+			},
+		},
+	}}
+}
+
+// SetConfigParam registers runtime tunable parameter of cache, it replaces parameter with the same name
+func SetConfigParam(cache *kv.CacheDb, name string, param ConfigParam) {
+	c := instanceOf(cache).config
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.params[name] = param
+}
+
+// GetConfig returns value of runtime tunable parameter, false if parameter is not registered
+func GetConfig(cache *kv.CacheDb, name string) (string, bool) {
+	c := instanceOf(cache).config
+	c.lock.RLock()
+	param, ok := c.params[name]
+	c.lock.RUnlock()
+	if !ok {
+		return "", false
+	}
+	return param.Get(), true
+}
+
+// SetConfig sets value of runtime tunable parameter like CONFIG SET
+func SetConfig(cache *kv.CacheDb, name string, value string) error {
+	c := instanceOf(cache).config
+	c.lock.RLock()
+	param, ok := c.params[name]
+	c.lock.RUnlock()
+	if !ok {
+		return unknownConfigError
+	}
+
+	if err := param.Set(value); err != nil {
+		//errors of registered setters are errors of value
+		if kindOf(err) == internalErrorKind {
+			return badRequest(err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// executeConfig executes config subcommands:
+//
+//	CONFIG GET pattern     - returns values of parameters matched by glob pattern
+//	CONFIG SET name value  - sets parameter value
+func executeConfig(cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
+	c := instanceOf(cache).config
+
+	switch strings.ToUpper(parser.key) {
+	case configGet:
+		pattern := string(parser.value)
+		if pattern == "" || strings.ContainsAny(pattern, " ") {
+			return nil, incorrectConfigError
+		}
+
+		c.lock.RLock()
+		names := []string{}
+		for name := range c.params {
+			if kv.Match(pattern, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		params := make([]ConfigParam, len(names))
+		for i, name := range names {
+			params[i] = c.params[name]
+		}
+		c.lock.RUnlock()
+
+		//getters are called out of registry lock, they may use locks of parameters
+		out := map[string]string{}
+		for i, name := range names {
+			out[name] = params[i].Get()
+		}
+		return out, nil
+	case configSet:
+		name, value, _ := strings.Cut(string(parser.value), " ")
+		if name == "" {
+			return nil, incorrectConfigError
+		}
+
+		return nil, SetConfig(cache, name, strings.TrimSpace(value))
+	default:
+		return nil, incorrectConfigError
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestConfig(t *testing.T) {
+	cache := kv.NewCacheDb()
+
+	out, err := exeCommand(cache, "CONFIG GET slowlog-*")
+	expected := map[string]string{"slowlog-threshold": "10ms", "slowlog-max-len": "128"}
+	if err != nil || !reflect.DeepEqual(out, expected) {
+		t.Fatal("Incorrect config", "expected", expected, "got", out, err)
+	}
+
+	for _, cmd := range []string{"CONFIG SET slowlog-threshold 0s", "CONFIG SET log-requests true", "CONFIG SET notify-keyspace-events KEA"} {
+		if _, err := exeCommand(cache, cmd); err != nil {
+			t.Fatal("Config set error", cmd, err.Error())
+		}
+	}
+	if threshold, maxLen := instanceOf(cache).slowLog.settings(); threshold != 0 || maxLen != 128 {
+		t.Fatal("Incorrect slowlog settings", "expected", 0, 128, "got", threshold, maxLen)
+	}
+	if !instanceOf(cache).logRequests.Load() {
+		t.Fatal("Expected enabled request log")
+	}
+	if out, _ := exeCommand(cache, "CONFIG GET notify-keyspace-events"); !reflect.DeepEqual(out, map[string]string{"notify-keyspace-events": "KEA"}) {
+		t.Fatal("Incorrect keyspace events config", "got", out)
+	}
+
+	timeout := time.Second
+	SetConfigParam(cache, "timeout", ConfigParam{
+		Get: func() string {
+			return timeout.String()
+		},
+		Set: func(value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.New("Incorrect timeout")
+			}
+			timeout = d
+			return nil
+		},
+	})
+	if _, err := exeCommand(cache, "CONFIG SET timeout 5s"); err != nil || timeout != time.Second*5 {
+		t.Fatal("Incorrect registered param", "expected", time.Second*5, "got", timeout, err)
+	}
+
+	if value, ok := GetConfig(cache, "timeout"); !ok || value != "5s" {
+		t.Fatal("Incorrect config value", "expected", "5s", "got", value, ok)
+	}
+	if _, ok := GetConfig(cache, "unknown"); ok {
+		t.Fatal("Expected unknown config param")
+	}
+	if err := SetConfig(cache, "slowlog-max-len", "64"); err != nil {
+		t.Fatal("Config set error", err.Error())
+	}
+
+	errs := map[string]error{
+		"CONFIG SET timeout foo":            ErrBadRequest,
+		"CONFIG SET slowlog-max-len -1":     incorrectConfigValueError,
+		"CONFIG SET unknown 1":              unknownConfigError,
+		"CONFIG SET notify-keyspace-events": nil,
+		"CONFIG FOO bar":                    incorrectConfigError,
+		"CONFIG GET a b":                    incorrectConfigError,
+	}
+	for cmd, expected := range errs {
+		_, err := exeCommand(cache, cmd)
+		if expected == nil && err != nil || expected != nil && !errors.Is(err, expected) {
+			t.Fatal("Incorrect config error", cmd, "expected", expected, "got", err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+type (
+	errorKind struct {
+		kind   error
+		code   byte
+		status int
+		name   string
+	}
+)
+
+var (
+	ErrNotFound   = kv.ErrNotFound
+	ErrWrongType  = kv.ErrWrongType
+	ErrBadRequest = kv.ErrBadRequest
+	ErrTooLarge   = kv.ErrTooLarge
+	ErrReadOnly   = errors.New("Read only replica")
+	ErrMoved      = errors.New("Moved")
+	ErrAsk        = errors.New("Ask")
+	ErrMaxClients = errors.New("Max clients")
+	// ErrUnauthorized is returned for commands of not authenticated connection and for incorrect credentials
+	ErrUnauthorized = errors.New("Unauthorized")
+	// ErrNoPermission is returned for commands and keys which are not granted to authenticated user
+	ErrNoPermission = errors.New("No permission")
+	// ErrServerClosed is returned by Listen and ListenSecure after Shutdown
+	ErrServerClosed = http.ErrServerClosed
+
+	errorKinds = []*errorKind{
+		{ErrBadRequest, protocol.CodeBadRequest, http.StatusBadRequest, "bad_request"},
+		{ErrNotFound, protocol.CodeNotFound, http.StatusNotFound, "not_found"},
+		{ErrWrongType, protocol.CodeWrongType, http.StatusConflict, "wrong_type"},
+		{ErrTooLarge, protocol.CodeTooLarge, http.StatusRequestEntityTooLarge, "too_large"},
+		{ErrReadOnly, protocol.CodeReadOnly, http.StatusForbidden, "read_only"},
+		{ErrMoved, protocol.CodeMoved, http.StatusMisdirectedRequest, "moved"},
+		{ErrAsk, protocol.CodeAsk, http.StatusMisdirectedRequest, "ask"},
+		{ErrMaxClients, protocol.CodeMaxClients, http.StatusServiceUnavailable, "max_clients"},
+		{ErrUnauthorized, protocol.CodeUnauthorized, http.StatusUnauthorized, "unauthorized"},
+		{ErrNoPermission, protocol.CodeNoPermission, http.StatusForbidden, "no_permission"},
+	}
+
+	internalErrorKind = &errorKind{nil, protocol.CodeInternal, http.StatusInternalServerError, "internal"}
+)
+
+func badRequest(message string) error {
+	return kv.NewError(ErrBadRequest, message)
+}
+
+func tooLarge(message string) error {
+	return kv.NewError(ErrTooLarge, message)
+}
+
+// kindOf returns transport codes of error, unknown errors are internal
+func kindOf(err error) *errorKind {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.kind) {
+			return kind
+		}
+	}
+	return internalErrorKind
+}
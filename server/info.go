@@ -0,0 +1,207 @@
+package server
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	infoSection struct {
+		name  string
+		title string
+		lines func(info *infoRequest) []string
+	}
+
+	// infoRequest is a state of INFO command, keyspace is scanned once for all sections
+	infoRequest struct {
+		cache *kv.CacheDb
+		stats *kv.Stats
+	}
+)
+
+var (
+	// Version is a server version reported by INFO, it is set by -ldflags "-X github.com/2tvenom/kv/server.Version=<version>"
+	Version = "dev"
+
+	startTime = time.Now()
+
+	infoSections = []*infoSection{
+		{"server", "Server", infoServer},
+		{"memory", "Memory", infoMemory},
+		{"keyspace", "Keyspace", infoKeyspace},
+		{"clients", "Clients", infoClients},
+		{"stats", "Stats", infoStats},
+		{"persistence", "Persistence", infoPersistence},
+	}
+
+	incorrectInfoSectionError = badRequest("Incorrect info section")
+	incorrectInfoArgsError    = badRequest("STATS does not accept arguments")
+)
+
+// executeInfo returns "name:value" lines of requested sections, every section starts with "# Title" line.
+// All sections are returned without arguments:
+//
+//	INFO [section ...]
+func executeInfo(cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
+	names := strings.Fields(string(parser.value))
+	if parser.key != "" {
+		names = append([]string{parser.key}, names...)
+	}
+
+	sections := infoSections
+	if len(names) > 0 && !(len(names) == 1 && strings.EqualFold(names[0], "all")) {
+		sections = []*infoSection{}
+		for _, name := range names {
+			section := findInfoSection(name)
+			if section == nil {
+				return nil, incorrectInfoSectionError
+			}
+			sections = append(sections, section)
+		}
+	}
+
+	info := &infoRequest{cache: cache}
+	out := []string{}
+	for _, section := range sections {
+		out = append(out, "# "+section.title)
+		out = append(out, section.lines(info)...)
+	}
+	return out, nil
+}
+
+// keyStats returns keyspace summary, keyspace is scanned on first call
+func (r *infoRequest) keyStats() kv.Stats {
+	if r.stats == nil {
+		stats := r.cache.Stats()
+		r.stats = &stats
+	}
+	return *r.stats
+}
+
+func findInfoSection(name string) *infoSection {
+	for _, section := range infoSections {
+		if strings.EqualFold(section.name, name) {
+			return section
+		}
+	}
+	return nil
+}
+
+func infoServer(info *infoRequest) []string {
+	return []string{
+		"version:" + Version,
+		"go_version:" + runtime.Version(),
+		fmt.Sprintf("uptime_seconds:%d", int64(time.Since(startTime).Seconds())),
+	}
+}
+
+// infoMemory returns size of stored keys and values and memory of go runtime
+func infoMemory(info *infoRequest) []string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return []string{
+		fmt.Sprintf("used_bytes:%d", info.keyStats().Bytes),
+		fmt.Sprintf("heap_alloc_bytes:%d", mem.HeapAlloc),
+		fmt.Sprintf("sys_bytes:%d", mem.Sys),
+	}
+}
+
+func infoKeyspace(info *infoRequest) []string {
+	stats := info.keyStats()
+
+	total := 0
+	for _, count := range stats.Keys {
+		total += count
+	}
+
+	out := []string{fmt.Sprintf("keys:%d", total)}
+	for _, keyType := range []string{"string", "list", "dict", "stream"} {
+		out = append(out, fmt.Sprintf("keys_%s:%d", keyType, stats.Keys[keyType]))
+	}
+	return append(out, fmt.Sprintf("expires:%d", stats.Expires))
+}
+
+// infoClients returns count of connected clients and "listener<n>:transport=<transport>,addr=<addr>,clients=<count>" lines
+func infoClients(info *infoRequest) []string {
+	listeners := []string{}
+	total := int64(0)
+	instanceOf(info.cache).metrics.clients.Range(func(key, value interface{}) bool {
+		labels := key.(listenerLabels)
+		count := value.(*atomic.Int64).Load()
+		total += count
+		listeners = append(listeners, fmt.Sprintf("transport=%s,addr=%s,clients=%d", labels.transport, labels.addr, count))
+		return true
+	})
+	sort.Strings(listeners)
+
+	out := []string{fmt.Sprintf("connected_clients:%d", total)}
+	for i, listener := range listeners {
+		out = append(out, fmt.Sprintf("listener%d:%s", i, listener))
+	}
+	return out
+}
+
+// infoStats returns counters of commands by name, errors by code and removed keys
+func infoStats(info *infoRequest) []string {
+	m := &instanceOf(info.cache).metrics
+
+	total := uint64(0)
+	commands := map[string]uint64{}
+	m.commands.Range(func(key, value interface{}) bool {
+		count := value.(*atomic.Uint64).Load()
+		commands[key.(commandLabels).command] += count
+		total += count
+		return true
+	})
+
+	stats := []string{}
+	for cmd, count := range commands {
+		stats = append(stats, fmt.Sprintf("commands_%s:%d", strings.ToLower(cmd), count))
+	}
+	m.errors.Range(func(key, value interface{}) bool {
+		stats = append(stats, fmt.Sprintf("errors_%s:%d", key, value.(*atomic.Uint64).Load()))
+		return true
+	})
+	sort.Strings(stats)
+
+	out := []string{fmt.Sprintf("commands_total:%d", total)}
+	out = append(out, stats...)
+	return append(out, fmt.Sprintf("expired_keys:%d", info.cache.Expired()))
+}
+
+// infoPersistence returns status of snapshot file, times are unix seconds, zero if snapshot is not loaded or saved
+func infoPersistence(info *infoRequest) []string {
+	p := &instanceOf(info.cache).persistence
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.path == "" {
+		return []string{"snapshot_enabled:0"}
+	}
+
+	status := "ok"
+	if p.lastErr != nil {
+		status = "err"
+	}
+	return []string{
+		"snapshot_enabled:1",
+		"snapshot_path:" + p.path,
+		fmt.Sprintf("snapshot_last_load:%d", unixOrZero(p.lastLoad)),
+		fmt.Sprintf("snapshot_last_save:%d", unixOrZero(p.lastSave)),
+		"snapshot_last_status:" + status,
+	}
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
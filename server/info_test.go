@@ -0,0 +1,80 @@
+package server
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestInfo(t *testing.T) {
+	cache := kv.NewCacheDb()
+	exeCommand(cache, "SET foo 100 bar")
+	exeCommand(cache, "SETLIST list a b")
+	exeCommand(cache, "GET missing")
+
+	out, err := exeCommand(cache, "INFO keyspace")
+	expected := []string{"# Keyspace", "keys:2", "keys_string:1", "keys_list:1", "keys_dict:0", "keys_stream:0", "expires:1"}
+	if err != nil || !reflect.DeepEqual(out, expected) {
+		t.Fatal("Incorrect keyspace info", "expected", expected, "got", out, err)
+	}
+
+	out, _ = exeCommand(cache, "STATS")
+	for _, line := range []string{"commands_set:1", "commands_get:1", "errors_not_found:1", "expired_keys:0"} {
+		if !contains(out.([]string), line) {
+			t.Fatal("Expected stats line", line, "got", out)
+		}
+	}
+
+	out, _ = exeCommand(cache, "INFO server clients")
+	if lines := out.([]string); lines[0] != "# Server" || !contains(lines, "version:"+Version) || !contains(lines, "# Clients") {
+		t.Fatal("Incorrect info sections", "got", out)
+	}
+
+	out, _ = exeCommand(cache, "INFO")
+	for _, section := range infoSections {
+		if !contains(out.([]string), "# "+section.title) {
+			t.Fatal("Expected info section", section.title, "got", out)
+		}
+	}
+
+	if _, err := exeCommand(cache, "INFO unknown"); err != incorrectInfoSectionError {
+		t.Fatal("Incorrect info error", "expected", incorrectInfoSectionError, "got", err)
+	}
+	if _, err := exeCommand(cache, "STATS foo"); err != incorrectInfoArgsError {
+		t.Fatal("Incorrect stats error", "expected", incorrectInfoArgsError, "got", err)
+	}
+
+	out, _ = exeCommand(cache, "INFO persistence")
+	if !reflect.DeepEqual(out, []string{"# Persistence", "snapshot_enabled:0"}) {
+		t.Fatal("Incorrect persistence info", "got", out)
+	}
+
+	path := filepath.Join(t.TempDir(), "kv.snapshot")
+	if err := SaveSnapshot(cache, path); err != nil {
+		t.Fatal("Save error", err.Error())
+	}
+	restored := kv.NewCacheDb()
+	if err := LoadSnapshot(restored, path); err != nil {
+		t.Fatal("Load error", err.Error())
+	}
+	if data, err := restored.Get("foo"); err != nil || string(data) != "bar" {
+		t.Fatal("Incorrect restored key", "expected", "bar", "got", string(data), err)
+	}
+
+	out, _ = exeCommand(cache, "INFO persistence")
+	if lines := out.([]string); !contains(lines, "snapshot_path:"+path) || !contains(lines, "snapshot_last_status:ok") || contains(lines, "snapshot_last_save:0") {
+		t.Fatal("Incorrect persistence info", "got", out)
+	}
+}
+
+func contains(lines []string, line string) bool {
+	for _, l := range lines {
+		if strings.TrimSpace(l) == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	// instance is a server state shared by all listeners of one cache
+	instance struct {
+		// lock is held for write by atomic command batches, by other commands for read
+		lock batchLock
+
+		pubsub      *pubSub
+		keyspace    keyspaceNotifier
+		replication *replication
+		// readOnly is set for replica cache
+		readOnly atomic.Bool
+		// cluster is set for cache of cluster node
+		cluster atomic.Pointer[ClusterNode]
+		// raft is set for cache of Raft group member
+		raft atomic.Pointer[RaftNode]
+
+		metrics     metrics
+		persistence persistence
+		slowLog     *slowLog
+		monitors    *monitors
+		config      *config
+		// users are set when authentication is enabled
+		users atomic.Pointer[users]
+		// throttle delays password authentication after failures
+		throttle authThrottle
+
+		logger      atomic.Pointer[slog.Logger]
+		logRequests atomic.Bool
+		// connID is the last id of connection logger
+		connID atomic.Uint64
+	}
+
+	// batchLock serializes atomic command batches with other commands.
+	// Command holds one of striped read locks, batch holds all of them,
+	// so commands do not contend on one lock until batch is executed
+	batchLock struct {
+		stripes [batchLockStripes]struct {
+			sync.RWMutex
+			//stripes are padded to separate cache lines
+			_ [40]byte
+		}
+	}
+)
+
+const (
+	batchLockStripes = 64
+)
+
+// instanceOf returns server state of cache, it is released with cache
+func instanceOf(cache *kv.CacheDb) *instance {
+	return cache.Attached(func() interface{} {
+		return newInstance(cache)
+	}).(*instance)
+}
+
+func newInstance(cache *kv.CacheDb) *instance {
+	return &instance{
+		pubsub:      newPubSub(),
+		replication: newReplication(),
+		slowLog:     newSlowLog(),
+		monitors:    newMonitors(),
+		config:      newConfig(cache),
+	}
+}
+
+// observe counts executed command in metrics, logs slow command and request
+func (inst *instance) observe(ctx context.Context, parser *baseCommandParser, duration time.Duration, err error) {
+	inst.metrics.observe(transportOf(ctx), parser.cmd, duration, err)
+	inst.slowLog.add(ctx, parser, duration)
+	inst.logRequest(ctx, parser, duration, err)
+}
+
+// RLock locks one of read locks and returns it for RUnlock
+func (l *batchLock) RLock() int {
+	i := rand.IntN(batchLockStripes)
+	l.stripes[i].RLock()
+	return i
+}
+
+func (l *batchLock) RUnlock(i int) {
+	l.stripes[i].RUnlock()
+}
+
+// Lock locks all read locks, it waits for commands in progress
+func (l *batchLock) Lock() {
+	for i := range l.stripes {
+		l.stripes[i].Lock()
+	}
+}
+
+func (l *batchLock) Unlock() {
+	for i := range l.stripes {
+		l.stripes[i].Unlock()
+	}
+}
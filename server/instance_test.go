@@ -0,0 +1,37 @@
+package server
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestInstanceRelease(t *testing.T) {
+	released := make(chan struct{})
+	func() {
+		cache := kv.NewCacheDb()
+		if _, err := exeCommand(cache, "SET key value"); err != nil {
+			t.Fatal("Incorrect set", err)
+		}
+		//instance and cache refer to each other, finalizer of cycle member is not guaranteed to run
+		runtime.SetFinalizer(instanceOf(cache).slowLog, func(*slowLog) {
+			close(released)
+		})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case <-released:
+			return
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected released instance of unused cache")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
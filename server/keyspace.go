@@ -0,0 +1,149 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	// keyspaceNotifier publishes cache events to keyspace and keyevent channels
+	keyspaceNotifier struct {
+		lock    sync.Mutex
+		watcher *kv.Watcher
+		classes int
+		// names are classes of the last SetKeyspaceEvents call
+		names string
+	}
+)
+
+const (
+	KeyspacePrefix = "__keyspace__:"
+	KeyeventPrefix = "__keyevent__:"
+
+	keyspaceBuffer = 64 * 1024
+)
+
+const (
+	notifyKeyspace = 1 << iota
+	notifyKeyevent
+	notifyGeneric
+	notifyString
+	notifyList
+	notifyDict
+	notifyStream
+	notifyExpired
+
+	notifyAll = notifyGeneric | notifyString | notifyList | notifyDict | notifyStream | notifyExpired
+)
+
+var (
+	incorrectNotifyClassError = badRequest("Incorrect keyspace notification class")
+)
+
+// parseNotifyClasses parses notification classes:
+// K - keyspace channels, E - keyevent channels, g - REMOVE, s - SET, l - SETLIST, d - SETDICT,
+// t - stream commands, x - expired keys, A - alias for "gsldtx"
+func parseNotifyClasses(classes string) (int, error) {
+	flags := 0
+	for _, c := range classes {
+		switch c {
+		case 'K':
+			flags |= notifyKeyspace
+		case 'E':
+			flags |= notifyKeyevent
+		case 'g':
+			flags |= notifyGeneric
+		case 's':
+			flags |= notifyString
+		case 'l':
+			flags |= notifyList
+		case 'd':
+			flags |= notifyDict
+		case 't':
+			flags |= notifyStream
+		case 'x':
+			flags |= notifyExpired
+		case 'A':
+			flags |= notifyAll
+		default:
+			return 0, incorrectNotifyClassError
+		}
+	}
+
+	//without channel type or event class nothing is published
+	if flags&(notifyKeyspace|notifyKeyevent) == 0 || flags&notifyAll == 0 {
+		return 0, nil
+	}
+	return flags, nil
+}
+
+// SetKeyspaceEvents enables publishing of cache events to "__keyspace__:<key>" channels
+// with event name message and "__keyevent__:<event>" channels with key message.
+// Empty classes disable notifications, see parseNotifyClasses for classes format
+func SetKeyspaceEvents(cache *kv.CacheDb, classes string) error {
+	flags, err := parseNotifyClasses(classes)
+	if err != nil {
+		return err
+	}
+
+	inst := instanceOf(cache)
+	n := &inst.keyspace
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.watcher != nil {
+		n.watcher.Close()
+		n.watcher = nil
+	}
+
+	n.classes = flags
+	n.names = classes
+	if flags == 0 {
+		return nil
+	}
+
+	n.watcher = cache.Watch("*", keyspaceBuffer)
+	go n.publish(n.watcher, flags, inst.pubsub)
+	return nil
+}
+
+func (n *keyspaceNotifier) publish(w *kv.Watcher, flags int, ps *pubSub) {
+	for event := range w.C {
+		name, class := keyspaceEvent(event)
+		if flags&class == 0 {
+			continue
+		}
+
+		if flags&notifyKeyspace != 0 {
+			ps.publish(KeyspacePrefix+event.Key, name)
+		}
+		if flags&notifyKeyevent != 0 {
+			ps.publish(KeyeventPrefix+name, event.Key)
+		}
+	}
+}
+
+// keyspaceEvent returns event name and notification class
+func keyspaceEvent(event kv.Event) (string, int) {
+	switch event.Type {
+	case kv.EventSet:
+		switch event.KeyType {
+		case "list":
+			return "setlist", notifyList
+		case "dict":
+			return "setdict", notifyDict
+		case "stream":
+			return "setstream", notifyStream
+		default:
+			return "set", notifyString
+		}
+	case kv.EventRemove:
+		return "remove", notifyGeneric
+	case kv.EventExpire:
+		return "expired", notifyExpired
+	default:
+		return event.Type.String(), 0
+	}
+}
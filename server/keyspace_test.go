@@ -0,0 +1,73 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestParseNotifyClasses(t *testing.T) {
+	testCases := map[string]int{
+		"":    0,
+		"K":   0,
+		"A":   0,
+		"KA":  notifyKeyspace | notifyAll,
+		"Egx": notifyKeyevent | notifyGeneric | notifyExpired,
+	}
+
+	for classes, flags := range testCases {
+		out, err := parseNotifyClasses(classes)
+		if err != nil {
+			t.Fatal("Got Error:", err)
+		}
+
+		if out != flags {
+			t.Fatal("Incorrect flags", classes, "expected", flags, "got", out)
+		}
+	}
+
+	if _, err := parseNotifyClasses("KZ"); err != incorrectNotifyClassError {
+		t.Fatal("Incorrect Error", "expected", incorrectNotifyClassError, "got", err)
+	}
+}
+
+func TestKeyspaceEvents(t *testing.T) {
+	cache := kv.NewCacheDb()
+	err := SetKeyspaceEvents(cache, "KEl")
+	if err != nil {
+		t.Fatal("Got Error:", err)
+	}
+
+	ps := instanceOf(cache).pubsub
+	sub := newSubscriber()
+	ps.subscribe(sub, []string{KeyspacePrefix + "*"}, true)
+	ps.subscribe(sub, []string{KeyeventPrefix + "setlist"}, false)
+
+	cache.Set("foo", 0, []byte("bar"))
+	cache.SetList("list", 0, [][]byte{[]byte("bar")})
+
+	expected := [][]string{
+		{pushPMessage, KeyspacePrefix + "*", KeyspacePrefix + "list", "setlist"},
+		{pushMessage, KeyeventPrefix + "setlist", "list"},
+	}
+
+	for _, e := range expected {
+		select {
+		case m := <-sub.c:
+			if len(m) != len(e) || m[len(m)-1] != e[len(e)-1] || m[1] != e[1] {
+				t.Fatal("Incorrect message", "expected", e, "got", m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected message", e)
+		}
+	}
+
+	SetKeyspaceEvents(cache, "")
+	cache.SetList("list", 0, [][]byte{[]byte("bar")})
+	time.Sleep(time.Millisecond * 100)
+
+	if len(sub.c) != 0 {
+		t.Fatal("Unexpected message", <-sub.c)
+	}
+}
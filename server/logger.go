@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	loggerKey struct{}
+)
+
+// SetLogger sets logger of servers, connections and commands of cache, slog.Default is used by default
+func SetLogger(cache *kv.CacheDb, logger *slog.Logger) {
+	instanceOf(cache).logger.Store(logger)
+}
+
+// SetLogRequests enables debug level log record of every executed command,
+// command values are redacted, only their length is logged
+func SetLogRequests(cache *kv.CacheDb, enabled bool) {
+	instanceOf(cache).logRequests.Store(enabled)
+}
+
+func (inst *instance) log() *slog.Logger {
+	if logger := inst.logger.Load(); logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// withConn marks ctx of connection commands with client address, not authenticated session
+// and logger with connection id
+func (inst *instance) withConn(ctx context.Context, client string) context.Context {
+	logger := inst.log().With("conn", inst.connID.Add(1), "client", client, "transport", transportOf(ctx))
+	return context.WithValue(withSession(withClient(ctx, client)), loggerKey{}, logger)
+}
+
+// loggerOf returns logger of connection or instance logger for embedded commands
+func (inst *instance) loggerOf(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return inst.log()
+}
+
+// logRequest writes debug record of executed command, value is replaced by its length
+func (inst *instance) logRequest(ctx context.Context, parser *baseCommandParser, duration time.Duration, err error) {
+	if !inst.logRequests.Load() {
+		return
+	}
+
+	logger := inst.loggerOf(ctx)
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("cmd", parser.cmd),
+		slog.String("key", parser.key),
+		slog.Int("value_bytes", len(parser.value)),
+		slog.Duration("duration", duration),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("err", err.Error()))
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "Command", attrs...)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestLogRequests(t *testing.T) {
+	cache := kv.NewCacheDb()
+	buff := &bytes.Buffer{}
+	SetLogger(cache, slog.New(slog.NewJSONHandler(buff, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	exeCommand(cache, "SET foo secret")
+	if buff.Len() != 0 {
+		t.Fatal("Expected no request log", "got", buff.String())
+	}
+
+	SetLogRequests(cache, true)
+	inst := instanceOf(cache)
+	ctx := inst.withConn(withTransport(context.Background(), transportTCP), "127.0.0.1:5000")
+	for _, cmd := range []string{"SET foo secret", "GET missing"} {
+		parser := &baseCommandParser{}
+		parser.Write([]byte(cmd))
+		ExeContext(ctx, cache, parser)
+	}
+
+	if strings.Contains(buff.String(), "secret") {
+		t.Fatal("Expected redacted value", "got", buff.String())
+	}
+
+	expected := []map[string]interface{}{
+		{"msg": "Command", "conn": 1.0, "client": "127.0.0.1:5000", "transport": transportTCP, "cmd": "SET", "key": "foo", "value_bytes": 6.0},
+		{"msg": "Command", "conn": 1.0, "client": "127.0.0.1:5000", "transport": transportTCP, "cmd": "GET", "key": "missing", "value_bytes": 0.0, "err": ErrNotFound.Error()},
+	}
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatal("Incorrect request log", "expected", len(expected), "got", lines)
+	}
+	for i, line := range lines {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal("Incorrect log record", line, err)
+		}
+		for k, v := range expected[i] {
+			if record[k] != v {
+				t.Fatal("Incorrect log record", k, "expected", v, "got", record[k])
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	// metrics are counters of instance commands and connections
+	metrics struct {
+		// commands are *atomic.Uint64 counters by commandLabels
+		commands sync.Map
+		// latency are *histogram of command execution duration by command name
+		latency sync.Map
+		// errors are *atomic.Uint64 counters by error code name
+		errors sync.Map
+		// clients are *atomic.Int64 gauges of connected clients by listenerLabels
+		clients sync.Map
+
+		// keys is a keyspace summary of last scrape, keyspace is scanned again after metricsStatsTTL
+		keysLock    sync.Mutex
+		keys        kv.Stats
+		keysScanned time.Time
+	}
+
+	commandLabels struct {
+		command   string
+		transport string
+	}
+
+	listenerLabels struct {
+		transport string
+		addr      string
+	}
+
+	histogram struct {
+		// buckets are not cumulative counts of observations of latencyBuckets
+		buckets [len(latencyBuckets) + 1]atomic.Uint64
+		// sum is a total duration in nanoseconds
+		sum atomic.Int64
+	}
+
+	transportKey struct{}
+)
+
+const (
+	transportTCP      = "tcp"
+	transportNcat     = "ncat"
+	transportHTTP     = "http"
+	transportEmbedded = "embedded"
+
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+	// metricsStatsTTL is a lifetime of keyspace summary of metrics, scan of keyspace is O(keys)
+	metricsStatsTTL = 10 * time.Second
+)
+
+var (
+	// latencyBuckets are upper bounds of command duration histogram in seconds
+	latencyBuckets = [...]float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+)
+
+// withTransport marks ctx of commands received by transport
+func withTransport(ctx context.Context, transport string) context.Context {
+	return context.WithValue(ctx, transportKey{}, transport)
+}
+
+func transportOf(ctx context.Context) string {
+	if transport, ok := ctx.Value(transportKey{}).(string); ok {
+		return transport
+	}
+	return transportEmbedded
+}
+
+// observe counts executed command, its duration and error
+func (m *metrics) observe(transport string, cmd string, duration time.Duration, err error) {
+	if cmd == "" {
+		cmd = "unknown"
+	}
+
+	counter(&m.commands, commandLabels{cmd, transport}).Add(1)
+
+	h, ok := m.latency.Load(cmd)
+	if !ok {
+		h, _ = m.latency.LoadOrStore(cmd, &histogram{})
+	}
+	h.(*histogram).observe(duration)
+
+	if err != nil {
+		counter(&m.errors, kindOf(err).name).Add(1)
+	}
+}
+
+// connected changes count of connected clients of listener by delta
+func (m *metrics) connected(transport string, addr string, delta int64) {
+	labels := listenerLabels{transport, addr}
+	g, ok := m.clients.Load(labels)
+	if !ok {
+		g, _ = m.clients.LoadOrStore(labels, &atomic.Int64{})
+	}
+	g.(*atomic.Int64).Add(delta)
+}
+
+func counter(m *sync.Map, key interface{}) *atomic.Uint64 {
+	c, ok := m.Load(key)
+	if !ok {
+		c, _ = m.LoadOrStore(key, &atomic.Uint64{})
+	}
+	return c.(*atomic.Uint64)
+}
+
+func (h *histogram) observe(duration time.Duration) {
+	seconds := duration.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets[:], seconds)
+	h.buckets[i].Add(1)
+	h.sum.Add(int64(duration))
+}
+
+// keyStats returns keyspace summary scanned not earlier than metricsStatsTTL ago,
+// concurrent scrapes wait for one scan
+func (m *metrics) keyStats(cache *kv.CacheDb) kv.Stats {
+	m.keysLock.Lock()
+	defer m.keysLock.Unlock()
+
+	if m.keysScanned.IsZero() || time.Since(m.keysScanned) >= metricsStatsTTL {
+		m.keys = cache.Stats()
+		m.keysScanned = time.Now()
+	}
+	return m.keys
+}
+
+// metricsHandler writes metrics in Prometheus text exposition format
+func (s *httpServer) metricsHandler(writer http.ResponseWriter, request *http.Request) {
+	if err := instanceOf(s.cache).checkCategories(request.Context(), "metrics", aclAdmin); err != nil {
+		writeError(writer, err)
+		return
+	}
+	writer.Header().Set("Content-Type", metricsContentType)
+	writeMetrics(writer, s.cache)
+}
+
+func writeMetrics(w io.Writer, cache *kv.CacheDb) {
+	m := &instanceOf(cache).metrics
+
+	writeHeader(w, "kv_commands_total", "counter", "Executed commands by command and transport")
+	samples := []string{}
+	m.commands.Range(func(key, value interface{}) bool {
+		labels := key.(commandLabels)
+		samples = append(samples, fmt.Sprintf("kv_commands_total{command=%q,transport=%q} %d", labels.command, labels.transport, value.(*atomic.Uint64).Load()))
+		return true
+	})
+	writeSamples(w, samples)
+
+	writeHeader(w, "kv_command_duration_seconds", "histogram", "Command execution duration")
+	commands := []string{}
+	m.latency.Range(func(key, value interface{}) bool {
+		commands = append(commands, key.(string))
+		return true
+	})
+	sort.Strings(commands)
+	for _, cmd := range commands {
+		h, _ := m.latency.Load(cmd)
+		h.(*histogram).write(w, cmd)
+	}
+
+	writeHeader(w, "kv_errors_total", "counter", "Command errors by error code")
+	samples = samples[:0]
+	m.errors.Range(func(key, value interface{}) bool {
+		samples = append(samples, fmt.Sprintf("kv_errors_total{code=%q} %d", key, value.(*atomic.Uint64).Load()))
+		return true
+	})
+	writeSamples(w, samples)
+
+	writeHeader(w, "kv_connected_clients", "gauge", "Connected clients by transport and listener address")
+	samples = samples[:0]
+	m.clients.Range(func(key, value interface{}) bool {
+		labels := key.(listenerLabels)
+		samples = append(samples, fmt.Sprintf("kv_connected_clients{transport=%q,listener=%q} %d", labels.transport, labels.addr, value.(*atomic.Int64).Load()))
+		return true
+	})
+	writeSamples(w, samples)
+
+	stats := m.keyStats(cache)
+	writeHeader(w, "kv_keys", "gauge", "Keys by type")
+	samples = samples[:0]
+	for keyType, count := range stats.Keys {
+		samples = append(samples, fmt.Sprintf("kv_keys{type=%q} %d", keyType, count))
+	}
+	writeSamples(w, samples)
+
+	writeHeader(w, "kv_keys_with_ttl", "gauge", "Keys with ttl")
+	fmt.Fprintf(w, "kv_keys_with_ttl %d\n", stats.Expires)
+	writeHeader(w, "kv_stored_bytes", "gauge", "Size of stored keys and values")
+	fmt.Fprintf(w, "kv_stored_bytes %d\n", stats.Bytes)
+	writeHeader(w, "kv_expired_keys_total", "counter", "Keys removed by expiration")
+	fmt.Fprintf(w, "kv_expired_keys_total %d\n", cache.Expired())
+
+	writeHeader(w, "kv_block_lock_contended_total", "counter", "Lock acquisitions of keys block which waited for other holder")
+	for id, count := range cache.LockContention() {
+		fmt.Fprintf(w, "kv_block_lock_contended_total{block=\"%d\"} %d\n", id, count)
+	}
+}
+
+// write writes cumulative buckets, sum and count of command histogram
+func (h *histogram) write(w io.Writer, cmd string) {
+	cumulative := uint64(0)
+	for i, bound := range latencyBuckets {
+		cumulative += h.buckets[i].Load()
+		fmt.Fprintf(w, "kv_command_duration_seconds_bucket{command=%q,le=\"%s\"} %d\n", cmd, formatFloat(bound), cumulative)
+	}
+	count := cumulative + h.buckets[len(latencyBuckets)].Load()
+	fmt.Fprintf(w, "kv_command_duration_seconds_bucket{command=%q,le=\"+Inf\"} %d\n", cmd, count)
+	fmt.Fprintf(w, "kv_command_duration_seconds_sum{command=%q} %s\n", cmd, formatFloat(time.Duration(h.sum.Load()).Seconds()))
+	fmt.Fprintf(w, "kv_command_duration_seconds_count{command=%q} %d\n", cmd, count)
+}
+
+func writeHeader(w io.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeSamples writes sample lines sorted by name and labels
+func writeSamples(w io.Writer, samples []string) {
+	sort.Strings(samples)
+	for _, sample := range samples {
+		fmt.Fprintln(w, sample)
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestMetrics(t *testing.T) {
+	cache := kv.NewCacheDb()
+	s := NewHttpServer(cache, "127.0.0.1", 0)
+	ts := httptest.NewUnstartedServer(s.server.Handler)
+	ts.Config.BaseContext = s.server.BaseContext
+	ts.Config.ConnState = s.server.ConnState
+	ts.Start()
+	defer ts.Close()
+
+	for _, cmd := range []string{"SET foo 100 bar", "GET missing", "SETLIST list a b"} {
+		response, err := http.Post(ts.URL, "text/plain", strings.NewReader(cmd))
+		if err != nil {
+			t.Fatal("Request error", err.Error())
+		}
+		response.Body.Close()
+	}
+	exeCommand(cache, "GET foo")
+
+	response, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal("Metrics error", err.Error())
+	}
+	defer response.Body.Close()
+	data, _ := io.ReadAll(response.Body)
+
+	if response.Header.Get("Content-Type") != metricsContentType {
+		t.Fatal("Incorrect content type", "expected", metricsContentType, "got", response.Header.Get("Content-Type"))
+	}
+
+	expected := []string{
+		`kv_commands_total{command="SET",transport="http"} 1`,
+		`kv_commands_total{command="GET",transport="http"} 1`,
+		`kv_commands_total{command="GET",transport="embedded"} 1`,
+		`kv_command_duration_seconds_bucket{command="GET",le="+Inf"} 2`,
+		`kv_command_duration_seconds_count{command="SETLIST"} 1`,
+		`kv_errors_total{code="not_found"} 1`,
+		`kv_connected_clients{transport="http",listener="127.0.0.1:0"} `,
+		`kv_keys{type="string"} 1`,
+		`kv_keys{type="list"} 1`,
+		`kv_keys_with_ttl 1`,
+		`kv_expired_keys_total 0`,
+		`# TYPE kv_command_duration_seconds histogram`,
+		`kv_block_lock_contended_total{block="255"} `,
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(data), line+"\n") && !strings.Contains(string(data), "\n"+line) {
+			t.Fatal("Expected metric", line, "got", string(data))
+		}
+	}
+}
+
+func TestMetricsKeyStats(t *testing.T) {
+	cache := kv.NewCacheDb()
+	m := &instanceOf(cache).metrics
+	exeCommand(cache, "SET foo bar")
+
+	if stats := m.keyStats(cache); stats.Keys["string"] != 1 {
+		t.Fatal("Incorrect keys", "expected", 1, "got", stats.Keys["string"])
+	}
+
+	//keyspace is not scanned until summary is expired
+	exeCommand(cache, "SET bar baz")
+	if stats := m.keyStats(cache); stats.Keys["string"] != 1 {
+		t.Fatal("Incorrect cached keys", "expected", 1, "got", stats.Keys["string"])
+	}
+
+	m.keysScanned = m.keysScanned.Add(-metricsStatsTTL)
+	if stats := m.keyStats(cache); stats.Keys["string"] != 2 {
+		t.Fatal("Incorrect scanned keys", "expected", 2, "got", stats.Keys["string"])
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// monitors are connections in monitor mode, they receive every executed command
+	monitors struct {
+		lock sync.RWMutex
+		subs map[*monitor]struct{}
+		// count is checked before command formatting, commands are not formatted without monitors
+		count atomic.Int32
+	}
+
+	// monitor is a connection in monitor mode, commands are buffered in c.
+	// Monitor with full buffer is marked slow and has to be disconnected
+	monitor struct {
+		c        chan string
+		slow     chan struct{}
+		slowOnce sync.Once
+	}
+)
+
+const (
+	monitorBuffer = 1024
+
+	pushMonitor = "monitor"
+)
+
+var (
+	monitorConnError = badRequest("MONITOR is supported by tcp and http connections only")
+	monitorModeError = badRequest("Commands are not allowed in monitor mode")
+)
+
+func newMonitors() *monitors {
+	return &monitors{subs: map[*monitor]struct{}{}}
+}
+
+func newMonitor() *monitor {
+	return &monitor{
+		c:    make(chan string, monitorBuffer),
+		slow: make(chan struct{}),
+	}
+}
+
+func (m *monitors) add(mon *monitor) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.subs[mon] = struct{}{}
+	m.count.Add(1)
+}
+
+func (m *monitors) remove(mon *monitor) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.subs[mon]; ok {
+		delete(m.subs, mon)
+		m.count.Add(-1)
+	}
+}
+
+// feed sends command to monitors as "<unix time>.<microseconds> [<client> <transport>] <command> [key] [value]",
+// client is "-" for embedded commands
+func (m *monitors) feed(ctx context.Context, parser *baseCommandParser) {
+	if m.count.Load() == 0 {
+		return
+	}
+
+	now := time.Now()
+	client := clientOf(ctx)
+	if client == "" {
+		client = "-"
+	}
+	line := fmt.Sprintf("%d.%06d [%s %s] %s", now.Unix(), now.Nanosecond()/1000, client, transportOf(ctx), strings.Join(commandArgs(parser), " "))
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for mon := range m.subs {
+		mon.push(line)
+	}
+}
+
+func (mon *monitor) push(line string) {
+	select {
+	case mon.c <- line:
+	default:
+		mon.slowOnce.Do(func() {
+			close(mon.slow)
+		})
+	}
+}
+
+// monitorHandler streams every executed command as text line until client disconnects
+func (s *httpServer) monitorHandler(writer http.ResponseWriter, request *http.Request) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, fmt.Errorf("Streaming is not supported"))
+		return
+	}
+
+	m := instanceOf(s.cache).monitors
+	mon := newMonitor()
+	m.add(mon)
+	defer m.remove(mon)
+
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-mon.slow:
+			return
+		case line := <-mon.c:
+			if _, err := fmt.Fprintln(writer, line); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
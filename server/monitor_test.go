@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+func TestMonitor(t *testing.T) {
+	cache := kv.NewCacheDb()
+	ts := NewTcpServer(cache, "127.0.0.1", 4525)
+	go ts.Listen()
+	defer ts.Close()
+	hs := NewHttpServer(cache, "127.0.0.1", 4526)
+	go hs.Listen()
+	defer hs.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:4525")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer conn.Close()
+	e := protocol.NewEncoder(conn)
+	d := protocol.NewDecoder(conn)
+	e.EncodeRequest([]byte("MONITOR"))
+	if out, err := d.DecodeResponse(); out != nil || err != nil {
+		t.Fatal("Incorrect monitor response", "expected", nil, "got", out, err)
+	}
+
+	resp, err := http.Post("http://127.0.0.1:4526/", "text/plain", strings.NewReader("MONITOR"))
+	if err != nil {
+		t.Fatal("Monitor error", err.Error())
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewReader(resp.Body)
+
+	waitFor(t, "monitors", func() bool {
+		return instanceOf(cache).monitors.count.Load() == 2
+	})
+
+	client, err := net.Dial("tcp", "127.0.0.1:4525")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer client.Close()
+	protocol.NewEncoder(client).EncodeRequest([]byte("SET foo bar"))
+	if _, err := protocol.NewDecoder(client).DecodeResponse(); err != nil {
+		t.Fatal("Set error", err.Error())
+	}
+	exeCommand(cache, "GET foo")
+
+	expected := []string{
+		"[" + client.LocalAddr().String() + " tcp] SET foo bar",
+		"[- embedded] GET foo",
+	}
+	for _, suffix := range expected {
+		out, err := d.DecodeResponse()
+		push, ok := out.(protocol.Push)
+		if err != nil || !ok || len(push) != 2 || push[0] != pushMonitor || !strings.HasSuffix(push[1], suffix) {
+			t.Fatal("Incorrect monitor push", "expected", suffix, "got", out, err)
+		}
+
+		line, err := lines.ReadString('\n')
+		if err != nil || !strings.HasSuffix(line, suffix+"\n") {
+			t.Fatal("Incorrect monitor line", "expected", suffix, "got", line, err)
+		}
+	}
+
+	//other commands are rejected in monitor mode
+	e.EncodeRequest([]byte("GET foo"))
+	if _, err := d.DecodeResponse(); !isErrorCode(err, protocol.CodeBadRequest) {
+		t.Fatal("Incorrect monitor mode error", "expected", monitorModeError, "got", err)
+	}
+
+	if _, err := exeCommand(cache, "MONITOR"); err != monitorConnError {
+		t.Fatal("Incorrect embedded monitor error", "expected", monitorConnError, "got", err)
+	}
+
+	conn.Close()
+	resp.Body.Close()
+	waitFor(t, "monitors removed", func() bool {
+		return instanceOf(cache).monitors.count.Load() == 0
+	})
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	// persistence is a status of cache snapshot file reported by INFO
+	persistence struct {
+		lock     sync.Mutex
+		path     string
+		lastLoad time.Time
+		lastSave time.Time
+		lastErr  error
+	}
+)
+
+// LoadSnapshot loads cache from snapshot file written by SaveSnapshot, missing file is not an error
+func LoadSnapshot(cache *kv.CacheDb, path string) error {
+	p := &instanceOf(cache).persistence
+	err := loadSnapshotFile(cache, path)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.path, p.lastErr = path, err
+	if err == nil {
+		p.lastLoad = time.Now()
+	}
+	return err
+}
+
+// SaveSnapshot writes cache snapshot to temporary file which replaces snapshot file
+func SaveSnapshot(cache *kv.CacheDb, path string) error {
+	p := &instanceOf(cache).persistence
+	err := saveSnapshotFile(cache, path)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.path, p.lastErr = path, err
+	if err == nil {
+		p.lastSave = time.Now()
+	}
+	return err
+}
+
+func loadSnapshotFile(cache *kv.CacheDb, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return cache.LoadSnapshot(bufio.NewReader(f))
+}
+
+func saveSnapshotFile(cache *kv.CacheDb, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	buff := bufio.NewWriter(f)
+	if err := cache.Snapshot(buff); err != nil {
+		return err
+	}
+	if err := buff.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	pubSub struct {
+		lock     sync.RWMutex
+		channels map[string]map[*subscriber]struct{}
+		patterns map[string]map[*subscriber]struct{}
+	}
+
+	// subscriber is a connection in subscribe mode, messages are buffered in c.
+	// Subscriber with full buffer is marked slow and has to be disconnected
+	subscriber struct {
+		c        chan []string
+		slow     chan struct{}
+		slowOnce sync.Once
+		channels map[string]struct{}
+		patterns map[string]struct{}
+		// allowed filters keys of keyspace notifications, nil allows all keys
+		allowed func(key string) bool
+	}
+)
+
+const (
+	subscriberBuffer = 1024
+
+	pushSubscribe    = "subscribe"
+	pushUnsubscribe  = "unsubscribe"
+	pushPSubscribe   = "psubscribe"
+	pushPUnsubscribe = "punsubscribe"
+	pushMessage      = "message"
+	pushPMessage     = "pmessage"
+)
+
+var (
+	subscribeModeError = badRequest("Only SUBSCRIBE, UNSUBSCRIBE, PSUBSCRIBE and PUNSUBSCRIBE are allowed in subscribe mode")
+	subscribeConnError = badRequest("Subscribe commands are supported by binary tcp connection only")
+)
+
+func newPubSub() *pubSub {
+	return &pubSub{
+		channels: map[string]map[*subscriber]struct{}{},
+		patterns: map[string]map[*subscriber]struct{}{},
+	}
+}
+
+func newSubscriber() *subscriber {
+	return &subscriber{
+		c:        make(chan []string, subscriberBuffer),
+		slow:     make(chan struct{}),
+		channels: map[string]struct{}{},
+		patterns: map[string]struct{}{},
+	}
+}
+
+// publish sends message to channel subscribers and returns receivers count
+func (p *pubSub) publish(channel string, message string) int {
+	key, notification := notificationKey(channel, message)
+
+	cnt := 0
+	p.lock.RLock()
+	for sub := range p.channels[channel] {
+		if notification && !sub.allows(key) {
+			continue
+		}
+		sub.push([]string{pushMessage, channel, message})
+		cnt++
+	}
+
+	for pattern, subs := range p.patterns {
+		if !kv.Match(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			if notification && !sub.allows(key) {
+				continue
+			}
+			sub.push([]string{pushPMessage, pattern, channel, message})
+			cnt++
+		}
+	}
+	p.lock.RUnlock()
+	return cnt
+}
+
+// subscribe adds channels or patterns subscriptions, returns acknowledge messages
+func (p *pubSub) subscribe(sub *subscriber, names []string, pattern bool) [][]string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	index, own, kind := p.channels, sub.channels, pushSubscribe
+	if pattern {
+		index, own, kind = p.patterns, sub.patterns, pushPSubscribe
+	}
+
+	out := [][]string{}
+	for _, name := range names {
+		if index[name] == nil {
+			index[name] = map[*subscriber]struct{}{}
+		}
+		index[name][sub] = struct{}{}
+		own[name] = struct{}{}
+		out = append(out, []string{kind, name, strconv.Itoa(sub.count())})
+	}
+	return out
+}
+
+// unsubscribe removes channels or patterns subscriptions, all of them if names are empty.
+// Returns acknowledge messages
+func (p *pubSub) unsubscribe(sub *subscriber, names []string, pattern bool) [][]string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	index, own, kind := p.channels, sub.channels, pushUnsubscribe
+	if pattern {
+		index, own, kind = p.patterns, sub.patterns, pushPUnsubscribe
+	}
+
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+	}
+
+	out := [][]string{}
+	for _, name := range names {
+		delete(own, name)
+		if subs, ok := index[name]; ok {
+			delete(subs, sub)
+			if len(subs) == 0 {
+				delete(index, name)
+			}
+		}
+		out = append(out, []string{kind, name, strconv.Itoa(sub.count())})
+	}
+
+	if len(out) == 0 {
+		out = append(out, []string{kind, "", strconv.Itoa(sub.count())})
+	}
+	return out
+}
+
+// remove drops all subscriptions of subscriber
+func (p *pubSub) remove(sub *subscriber) {
+	p.unsubscribe(sub, nil, false)
+	p.unsubscribe(sub, nil, true)
+}
+
+// notificationKey returns key of keyspace notification, false if channel is not a notifications channel
+func notificationKey(channel string, message string) (string, bool) {
+	if key, ok := strings.CutPrefix(channel, KeyspacePrefix); ok {
+		return key, true
+	}
+	if strings.HasPrefix(channel, KeyeventPrefix) {
+		return message, true
+	}
+	return "", false
+}
+
+func (s *subscriber) allows(key string) bool {
+	return s.allowed == nil || s.allowed(key)
+}
+
+func (s *subscriber) count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+func (s *subscriber) push(message []string) {
+	select {
+	case s.c <- message:
+	default:
+		s.slowOnce.Do(func() {
+			close(s.slow)
+		})
+	}
+}
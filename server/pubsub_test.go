@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestPubSub(t *testing.T) {
+	ps := newPubSub()
+	sub := newSubscriber()
+
+	acks := ps.subscribe(sub, []string{"foo", "bar"}, false)
+	if len(acks) != 2 || acks[1][2] != "2" {
+		t.Fatal("Incorrect acknowledge", acks)
+	}
+
+	ps.subscribe(sub, []string{"f*"}, true)
+	if n := ps.publish("foo", "hello"); n != 2 {
+		t.Fatal("Incorrect receivers count", "expected", 2, "got", n)
+	}
+
+	if m := <-sub.c; m[0] != pushMessage || m[2] != "hello" {
+		t.Fatal("Incorrect message", m)
+	}
+
+	if m := <-sub.c; m[0] != pushPMessage || m[1] != "f*" {
+		t.Fatal("Incorrect message", m)
+	}
+
+	acks = ps.unsubscribe(sub, nil, false)
+	if len(acks) != 2 || sub.count() != 1 {
+		t.Fatal("Incorrect unsubscribe", acks)
+	}
+
+	ps.remove(sub)
+	if n := ps.publish("foo", "hello"); n != 0 || len(ps.patterns) != 0 {
+		t.Fatal("Incorrect receivers count", "expected", 0, "got", n)
+	}
+}
+
+func TestPubSubSlowSubscriber(t *testing.T) {
+	ps := newPubSub()
+	sub := newSubscriber()
+	ps.subscribe(sub, []string{"foo"}, false)
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		ps.publish("foo", "hello")
+	}
+
+	select {
+	case <-sub.slow:
+	default:
+		t.Fatal("Expected slow subscriber")
+	}
+}
@@ -0,0 +1,1186 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/gob"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	// RaftNode is a member of Raft group which replicates write commands of cache.
+	// Write commands are proposed to group leader and applied to cache of every member in log order
+	// after majority of members stores them. Read commands are served by local cache.
+	// Term, vote, log and snapshot of member are stored in data directory before member answers request,
+	// restarted member restores cache from them
+	RaftNode struct {
+		cache   *kv.CacheDb
+		id      int
+		peers   []string
+		storage *raftStorage
+		// secret authenticates connections of members, tlsConfig is nil for not secure connections
+		secret    string
+		tlsConfig *tls.Config
+
+		lock      sync.Mutex
+		applyCond *sync.Cond
+		state     raftState
+		term      uint64
+		votedFor  int
+		// saved are term and vote of storage
+		saved  raftHardState
+		leader int
+		// log[0] is a last entry of snapshot
+		log             []raftEntry
+		snapshotIndex   uint64
+		snapshot        []byte
+		snapshotPending bool
+		commitIndex     uint64
+		lastApplied     uint64
+		nextIndex       []uint64
+		matchIndex      []uint64
+		electionTime    time.Time
+		waiters         map[uint64]*raftWaiter
+		stopped         bool
+
+		trigger   []chan struct{}
+		listener  net.Listener
+		connsLock sync.Mutex
+		idle      [][]*raftConn
+		accepted  map[net.Conn]struct{}
+		stop      chan struct{}
+		wg        sync.WaitGroup
+	}
+
+	raftState int
+
+	// raftEntry is a log entry, entry without commands is added by new leader
+	raftEntry struct {
+		Term uint64
+		// Time is unix milliseconds of leader when entry is proposed, it is used by time based commands
+		Time     int64
+		Commands []raftCommand
+		Atomic   bool
+	}
+
+	raftCommand struct {
+		Cmd   string
+		Key   string
+		TTL   int64
+		Value []byte
+		Raw   bool
+	}
+
+	// raftResult is a result of applied command returned to proposing member
+	raftResult struct {
+		Kind   byte
+		String string
+		List   []string
+		Err    string
+		// ErrKind is a name of error kind, see errorKinds
+		ErrKind string
+	}
+
+	raftWaiter struct {
+		term uint64
+		c    chan []raftResult
+	}
+
+	// raftAuth is the first message of member connection, requests are not decoded until secret is verified
+	raftAuth struct {
+		Secret string
+	}
+
+	raftRequest struct {
+		Vote     *raftVote
+		Append   *raftAppend
+		Snapshot *raftSnapshot
+		Forward  *raftEntry
+	}
+
+	raftResponse struct {
+		Term uint64
+		// Success means granted vote, appended entries or applied forwarded entry
+		Success       bool
+		ConflictIndex uint64
+		// Index is a log index of forwarded entry
+		Index     uint64
+		Results   []raftResult
+		Err       string
+		NotLeader bool
+	}
+
+	raftVote struct {
+		Term      uint64
+		Candidate int
+		LastIndex uint64
+		LastTerm  uint64
+	}
+
+	raftAppend struct {
+		Term      uint64
+		Leader    int
+		PrevIndex uint64
+		PrevTerm  uint64
+		Entries   []raftEntry
+		Commit    uint64
+	}
+
+	raftSnapshot struct {
+		Term      uint64
+		Leader    int
+		Index     uint64
+		IndexTerm uint64
+		Data      []byte
+	}
+
+	raftConn struct {
+		conn net.Conn
+		enc  *gob.Encoder
+		dec  *gob.Decoder
+	}
+
+	commandTimeKey struct{}
+)
+
+const (
+	raftFollower raftState = iota
+	raftCandidate
+	raftLeader
+)
+
+const (
+	raftResultNone byte = iota
+	raftResultString
+	raftResultList
+)
+
+const (
+	raftTick            = 10 * time.Millisecond
+	raftHeartbeat       = 50 * time.Millisecond
+	raftElectionTimeout = 300 * time.Millisecond
+	raftRPCTimeout      = time.Second
+	raftProposeTimeout  = 5 * time.Second
+	raftMaxEntries      = 512
+)
+
+var (
+	// raftSnapshotEntries is a count of applied entries which are compacted to snapshot
+	raftSnapshotEntries uint64 = 10000
+
+	raftNotLeaderError = errors.New("Raft member is not leader")
+	raftNoLeaderError  = errors.New("Raft group has no leader")
+	raftLostError      = errors.New("Raft leadership is lost before command is committed")
+	raftClosedError    = errors.New("Raft member is closed")
+	raftTimeoutError   = errors.New("Raft command is not committed in time")
+	raftUnknownError   = errors.New("Raft leader response is lost, command may be applied")
+	raftBlockingError  = badRequest("Blocking commands are not supported in Raft mode, use LPOP and RPOP")
+	raftPeerError      = badRequest("Incorrect raft member id")
+	raftDirError       = badRequest("Raft data directory is required")
+	raftAuthError      = errors.New("Raft member authentication failed")
+	raftEnabledError   = badRequest("Raft mode is already enabled")
+)
+
+// StartRaft makes cache a member of Raft group. Peers are "host:port" addresses of all group members,
+// id is index of this member in peers, member listens its address for other members requests.
+// State of member is stored in dir, cache has to be empty, it is restored from dir.
+// Connections of members are authenticated by secret shared by members, secret is required to run group with users.
+// Members listen and dial by TLS if tlsConfig is not nil, it has certificate of member and CA pools of other members
+func StartRaft(cache *kv.CacheDb, peers []string, id int, dir string, secret string, tlsConfig *tls.Config) (*RaftNode, error) {
+	if id < 0 || id >= len(peers) {
+		return nil, raftPeerError
+	}
+	if dir == "" {
+		return nil, raftDirError
+	}
+	if instanceOf(cache).raft.Load() != nil {
+		return nil, raftEnabledError
+	}
+
+	storage, state, snapshot, entries, err := openRaftStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", peers[id])
+	if err != nil {
+		storage.close()
+		return nil, err
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	r := &RaftNode{
+		cache:     cache,
+		id:        id,
+		peers:     peers,
+		storage:   storage,
+		secret:    secret,
+		tlsConfig: tlsConfig,
+		term:      state.Term,
+		votedFor:  state.VotedFor,
+		saved:     state,
+		leader:    -1,
+		log:       append([]raftEntry{{Term: snapshot.Term}}, entries...),
+		//snapshot is committed, entries after it are committed by leader
+		snapshotIndex:   snapshot.Index,
+		snapshot:        snapshot.Data,
+		snapshotPending: snapshot.Index > 0,
+		commitIndex:     snapshot.Index,
+		nextIndex:       make([]uint64, len(peers)),
+		matchIndex:      make([]uint64, len(peers)),
+		waiters:         map[uint64]*raftWaiter{},
+		trigger:         make([]chan struct{}, len(peers)),
+		listener:        l,
+		idle:            make([][]*raftConn, len(peers)),
+		accepted:        map[net.Conn]struct{}{},
+		stop:            make(chan struct{}),
+	}
+	r.applyCond = sync.NewCond(&r.lock)
+	r.resetElection()
+
+	if !instanceOf(cache).raft.CompareAndSwap(nil, r) {
+		l.Close()
+		storage.close()
+		return nil, raftEnabledError
+	}
+
+	r.wg.Add(3)
+	go r.serve()
+	go r.run()
+	go r.applyLoop()
+	for peer := range peers {
+		r.trigger[peer] = make(chan struct{}, 1)
+		if peer != id {
+			r.wg.Add(1)
+			go r.replicateLoop(peer)
+		}
+	}
+	return r, nil
+}
+
+// Close stops member, cache is writable without group after close
+func (r *RaftNode) Close() {
+	select {
+	case <-r.stop:
+		return
+	default:
+		close(r.stop)
+	}
+
+	r.listener.Close()
+	r.connsLock.Lock()
+	for conn := range r.accepted {
+		conn.Close()
+	}
+	for _, conns := range r.idle {
+		for _, c := range conns {
+			c.conn.Close()
+		}
+	}
+	r.idle = make([][]*raftConn, len(r.peers))
+	r.connsLock.Unlock()
+
+	r.lock.Lock()
+	r.stopped = true
+	r.applyCond.Broadcast()
+	r.lock.Unlock()
+
+	r.wg.Wait()
+	r.storage.close()
+	instanceOf(r.cache).raft.CompareAndSwap(r, nil)
+}
+
+// Leader returns address of group leader known by member, false if leader is unknown
+func (r *RaftNode) Leader() (string, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.leader < 0 {
+		return "", false
+	}
+	return r.peers[r.leader], true
+}
+
+// IsLeader returns true if member is group leader
+func (r *RaftNode) IsLeader() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.state == raftLeader
+}
+
+// propose replicates commands by leader and returns results of applied commands.
+// Follower forwards commands to leader, command may be applied after timeout error
+func (r *RaftNode) propose(ctx context.Context, parsers []*baseCommandParser, atomic bool) ([]interface{}, []error) {
+	entry := raftEntry{Atomic: atomic, Commands: make([]raftCommand, len(parsers))}
+	for i, parser := range parsers {
+		entry.Commands[i] = raftCommand{Cmd: parser.cmd, Key: parser.key, TTL: parser.ttl, Value: parser.value, Raw: parser.raw}
+	}
+
+	results, err := r.forward(ctx, entry)
+
+	out := make([]interface{}, len(parsers))
+	errs := make([]error, len(parsers))
+	for i := range parsers {
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		out[i], errs[i] = results[i].value()
+	}
+	return out, errs
+}
+
+// forward proposes entry to leader, waits for leader election
+func (r *RaftNode) forward(ctx context.Context, entry raftEntry) ([]raftResult, error) {
+	deadline := time.Now().Add(raftProposeTimeout)
+	for {
+		r.lock.Lock()
+		state, leader := r.state, r.leader
+		r.lock.Unlock()
+
+		if state == raftLeader {
+			results, _, err := r.proposeLocal(ctx, entry)
+			if err != raftNotLeaderError {
+				return results, err
+			}
+		} else if leader >= 0 {
+			//entry is sent once over new connection, it is not sent again if response is lost
+			if c, err := r.dial(leader, raftRPCTimeout); err == nil {
+				resp, err := c.roundTrip(raftRequest{Forward: &entry}, raftProposeTimeout+raftRPCTimeout)
+				c.conn.Close()
+				switch {
+				case err != nil:
+					return nil, raftUnknownError
+				case resp.Err != "":
+					return nil, errors.New(resp.Err)
+				case !resp.NotLeader:
+					//commands of client are visible for its next reads from this member
+					r.waitApplied(resp.Index, deadline)
+					return resp.Results, nil
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, raftNoLeaderError
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-r.stop:
+			return nil, raftClosedError
+		case <-time.After(raftHeartbeat):
+		}
+	}
+}
+
+// proposeLocal appends entry to leader log and waits until it is applied, log index of entry is returned
+func (r *RaftNode) proposeLocal(ctx context.Context, entry raftEntry) ([]raftResult, uint64, error) {
+	r.lock.Lock()
+	if r.state != raftLeader {
+		r.lock.Unlock()
+		return nil, 0, raftNotLeaderError
+	}
+
+	entry.Term = r.term
+	entry.Time = time.Now().UnixMilli()
+	index := r.lastIndex() + 1
+	if err := r.storage.append(index, []raftEntry{entry}); err != nil {
+		r.lock.Unlock()
+		return nil, 0, err
+	}
+	r.log = append(r.log, entry)
+	r.matchIndex[r.id] = index
+
+	w := &raftWaiter{term: entry.Term, c: make(chan []raftResult, 1)}
+	r.waiters[index] = w
+	r.advanceCommit()
+	r.lock.Unlock()
+	r.triggerAll()
+
+	timeout := time.NewTimer(raftProposeTimeout)
+	defer timeout.Stop()
+
+	var err error
+	select {
+	case results := <-w.c:
+		if results == nil {
+			return nil, index, raftLostError
+		}
+		return results, index, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout.C:
+		err = raftTimeoutError
+	case <-r.stop:
+		err = raftClosedError
+	}
+
+	r.lock.Lock()
+	delete(r.waiters, index)
+	r.lock.Unlock()
+	return nil, index, err
+}
+
+// waitApplied waits until entry of index is applied to cache or deadline
+func (r *RaftNode) waitApplied(index uint64, deadline time.Time) {
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		r.lock.Lock()
+		r.applyCond.Broadcast()
+		r.lock.Unlock()
+	})
+	defer timer.Stop()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for !r.stopped && r.lastApplied < index && time.Now().Before(deadline) {
+		r.applyCond.Wait()
+	}
+}
+
+// run starts election if leader does not send heartbeats
+func (r *RaftNode) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(raftTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		r.lock.Lock()
+		elect := r.state != raftLeader && time.Now().After(r.electionTime)
+		r.lock.Unlock()
+
+		if elect {
+			r.startElection()
+		}
+	}
+}
+
+func (r *RaftNode) startElection() {
+	r.lock.Lock()
+	r.state = raftCandidate
+	r.term++
+	r.votedFor = r.id
+	r.leader = -1
+	r.resetElection()
+	if r.saveState() != nil {
+		//vote is not stored, member does not vote for other candidates of term and retries election later
+		r.state = raftFollower
+		r.lock.Unlock()
+		return
+	}
+
+	term := r.term
+	vote := raftVote{Term: term, Candidate: r.id, LastIndex: r.lastIndex(), LastTerm: r.termAt(r.lastIndex())}
+	votes := 1
+	if votes*2 > len(r.peers) {
+		r.becomeLeader()
+	}
+	r.lock.Unlock()
+
+	for peer := range r.peers {
+		if peer == r.id {
+			continue
+		}
+
+		go func(peer int) {
+			resp, err := r.call(peer, raftRequest{Vote: &vote}, raftRPCTimeout)
+			if err != nil {
+				return
+			}
+
+			r.lock.Lock()
+			defer r.lock.Unlock()
+
+			if resp.Term > r.term {
+				r.becomeFollower(resp.Term)
+				return
+			}
+			if !resp.Success || r.state != raftCandidate || r.term != term {
+				return
+			}
+
+			votes++
+			if votes*2 > len(r.peers) {
+				r.becomeLeader()
+			}
+		}(peer)
+	}
+}
+
+// becomeLeader initializes leader state and appends empty entry of leader term, lock must be held
+func (r *RaftNode) becomeLeader() {
+	r.state = raftLeader
+	r.leader = r.id
+	for peer := range r.peers {
+		r.nextIndex[peer] = r.lastIndex() + 1
+		r.matchIndex[peer] = 0
+	}
+
+	//entries of previous terms are committed with entry of leader term
+	entry := raftEntry{Term: r.term, Time: time.Now().UnixMilli()}
+	if r.storage.append(r.lastIndex()+1, []raftEntry{entry}) != nil {
+		r.state = raftFollower
+		r.leader = -1
+		return
+	}
+	r.log = append(r.log, entry)
+	r.matchIndex[r.id] = r.lastIndex()
+	r.advanceCommit()
+	r.triggerAll()
+}
+
+// becomeFollower switches member to newer term, lock must be held.
+// Term is stored before member answers request, error is returned by next saveState call
+func (r *RaftNode) becomeFollower(term uint64) {
+	r.state = raftFollower
+	r.term = term
+	r.votedFor = -1
+	r.leader = -1
+	r.saveState()
+}
+
+// saveState stores changed term and vote, lock must be held
+func (r *RaftNode) saveState() error {
+	state := raftHardState{Term: r.term, VotedFor: r.votedFor}
+	if state == r.saved {
+		return nil
+	}
+	if err := r.storage.saveState(state); err != nil {
+		return err
+	}
+	r.saved = state
+	return nil
+}
+
+// resetElection postpones election by random timeout, lock must be held
+func (r *RaftNode) resetElection() {
+	r.electionTime = time.Now().Add(raftElectionTimeout + time.Duration(rand.Int63n(int64(raftElectionTimeout))))
+}
+
+// replicateLoop sends entries or heartbeats to peer while member is leader
+func (r *RaftNode) replicateLoop(peer int) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(raftHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-r.trigger[peer]:
+		case <-ticker.C:
+		}
+
+		r.replicate(peer)
+	}
+}
+
+func (r *RaftNode) replicate(peer int) {
+	r.lock.Lock()
+	if r.state != raftLeader {
+		r.lock.Unlock()
+		return
+	}
+
+	term := r.term
+	req := raftRequest{}
+	if next := r.nextIndex[peer]; next <= r.snapshotIndex {
+		req.Snapshot = &raftSnapshot{Term: term, Leader: r.id, Index: r.snapshotIndex, IndexTerm: r.log[0].Term, Data: r.snapshot}
+	} else {
+		entries := r.log[next-r.snapshotIndex:]
+		if len(entries) > raftMaxEntries {
+			entries = entries[:raftMaxEntries]
+		}
+		req.Append = &raftAppend{
+			Term:      term,
+			Leader:    r.id,
+			PrevIndex: next - 1,
+			PrevTerm:  r.termAt(next - 1),
+			Entries:   append([]raftEntry(nil), entries...),
+			Commit:    r.commitIndex,
+		}
+	}
+	r.lock.Unlock()
+
+	resp, err := r.call(peer, req, raftRPCTimeout)
+	if err != nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if resp.Term > r.term {
+		r.becomeFollower(resp.Term)
+		return
+	}
+	if r.state != raftLeader || r.term != term {
+		return
+	}
+
+	switch {
+	case req.Snapshot != nil:
+		if req.Snapshot.Index > r.matchIndex[peer] {
+			r.matchIndex[peer] = req.Snapshot.Index
+		}
+		r.nextIndex[peer] = r.matchIndex[peer] + 1
+	case resp.Success:
+		if match := req.Append.PrevIndex + uint64(len(req.Append.Entries)); match > r.matchIndex[peer] {
+			r.matchIndex[peer] = match
+		}
+		r.nextIndex[peer] = r.matchIndex[peer] + 1
+		r.advanceCommit()
+	default:
+		r.nextIndex[peer] = resp.ConflictIndex
+		if r.nextIndex[peer] < 1 {
+			r.nextIndex[peer] = 1
+		}
+	}
+
+	if r.nextIndex[peer] <= r.lastIndex() {
+		r.triggerPeer(peer)
+	}
+}
+
+// advanceCommit commits entries of leader term stored by majority, lock must be held
+func (r *RaftNode) advanceCommit() {
+	for index := r.lastIndex(); index > r.commitIndex && index > r.snapshotIndex; index-- {
+		if r.termAt(index) != r.term {
+			return
+		}
+
+		count := 0
+		for _, match := range r.matchIndex {
+			if match >= index {
+				count++
+			}
+		}
+		if count*2 > len(r.peers) {
+			r.commitIndex = index
+			r.applyCond.Broadcast()
+			//followers apply entries without waiting for heartbeat
+			r.triggerAll()
+			return
+		}
+	}
+}
+
+func (r *RaftNode) handleVote(vote *raftVote) raftResponse {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if vote.Term > r.term {
+		r.becomeFollower(vote.Term)
+	}
+
+	resp := raftResponse{Term: r.term}
+	lastIndex, lastTerm := r.lastIndex(), r.termAt(r.lastIndex())
+	upToDate := vote.LastTerm > lastTerm || (vote.LastTerm == lastTerm && vote.LastIndex >= lastIndex)
+	if vote.Term == r.term && (r.votedFor < 0 || r.votedFor == vote.Candidate) && upToDate {
+		r.votedFor = vote.Candidate
+		r.resetElection()
+		resp.Success = true
+	}
+	if r.saveState() != nil {
+		return raftResponse{Term: r.term}
+	}
+	return resp
+}
+
+func (r *RaftNode) handleAppend(a *raftAppend) raftResponse {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if a.Term < r.term {
+		return raftResponse{Term: r.term}
+	}
+	if a.Term > r.term {
+		r.becomeFollower(a.Term)
+	}
+	if r.saveState() != nil {
+		return raftResponse{Term: r.term}
+	}
+	r.state = raftFollower
+	r.leader = a.Leader
+	r.resetElection()
+
+	resp := raftResponse{Term: r.term}
+	if a.PrevIndex > r.lastIndex() {
+		resp.ConflictIndex = r.lastIndex() + 1
+		return resp
+	}
+	if a.PrevIndex > r.snapshotIndex {
+		if term := r.termAt(a.PrevIndex); term != a.PrevTerm {
+			//first entry of conflicting term
+			index := a.PrevIndex
+			for index > r.snapshotIndex+1 && r.termAt(index-1) == term {
+				index--
+			}
+			resp.ConflictIndex = index
+			return resp
+		}
+	}
+
+	for i, entry := range a.Entries {
+		index := a.PrevIndex + 1 + uint64(i)
+		if index <= r.snapshotIndex {
+			continue
+		}
+		if index <= r.lastIndex() && r.termAt(index) == entry.Term {
+			continue
+		}
+		if r.storage.append(index, a.Entries[i:]) != nil {
+			//entries which are not stored are not acknowledged
+			r.log = r.log[:index-r.snapshotIndex]
+			resp.ConflictIndex = index
+			return resp
+		}
+		r.log = append(r.log[:index-r.snapshotIndex], a.Entries[i:]...)
+		break
+	}
+
+	//entries after appended ones may be not leader entries yet
+	commit := a.Commit
+	if last := a.PrevIndex + uint64(len(a.Entries)); last < commit {
+		commit = last
+	}
+	if commit > r.commitIndex {
+		r.commitIndex = commit
+		r.applyCond.Broadcast()
+	}
+
+	resp.Success = true
+	return resp
+}
+
+func (r *RaftNode) handleSnapshot(s *raftSnapshot) raftResponse {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if s.Term < r.term {
+		return raftResponse{Term: r.term}
+	}
+	if s.Term > r.term {
+		r.becomeFollower(s.Term)
+	}
+	if r.saveState() != nil {
+		return raftResponse{Term: r.term}
+	}
+	r.state = raftFollower
+	r.leader = s.Leader
+	r.resetElection()
+
+	resp := raftResponse{Term: r.term, Success: true}
+	if s.Index <= r.commitIndex {
+		return resp
+	}
+
+	log := []raftEntry{{}}
+	if s.Index <= r.lastIndex() && r.termAt(s.Index) == s.IndexTerm {
+		log = append(log, r.log[s.Index-r.snapshotIndex+1:]...)
+	}
+	log[0] = raftEntry{Term: s.IndexTerm}
+	if r.storeSnapshot(raftSnapshotState{Index: s.Index, Term: s.IndexTerm, Data: s.Data}, log[1:]) != nil {
+		return raftResponse{Term: r.term}
+	}
+	r.log = log
+	r.snapshotIndex = s.Index
+	r.snapshot = s.Data
+	r.snapshotPending = true
+	r.commitIndex = s.Index
+	r.applyCond.Broadcast()
+	return resp
+}
+
+// applyLoop applies committed entries and installed snapshots to cache
+func (r *RaftNode) applyLoop() {
+	defer r.wg.Done()
+
+	inst := instanceOf(r.cache)
+	for {
+		r.lock.Lock()
+		for !r.stopped && !r.snapshotPending && r.lastApplied >= r.commitIndex {
+			r.applyCond.Wait()
+		}
+		if r.stopped {
+			r.lock.Unlock()
+			return
+		}
+
+		if r.snapshotPending || r.lastApplied < r.snapshotIndex {
+			data, index := r.snapshot, r.snapshotIndex
+			r.snapshotPending = false
+			r.lock.Unlock()
+
+			inst.lock.Lock()
+			r.cache.LoadSnapshot(bytes.NewReader(data))
+			inst.lock.Unlock()
+
+			r.lock.Lock()
+			if index > r.lastApplied {
+				r.lastApplied = index
+				r.applyCond.Broadcast()
+			}
+			r.lock.Unlock()
+			continue
+		}
+
+		from := r.lastApplied + 1
+		entries := append([]raftEntry(nil), r.log[from-r.snapshotIndex:r.commitIndex-r.snapshotIndex+1]...)
+		r.lock.Unlock()
+
+		for i, entry := range entries {
+			index := from + uint64(i)
+			results := r.apply(entry)
+
+			r.lock.Lock()
+			if index != r.lastApplied+1 {
+				//snapshot is installed meanwhile
+				r.lock.Unlock()
+				break
+			}
+			r.lastApplied = index
+			r.applyCond.Broadcast()
+			if w, ok := r.waiters[index]; ok {
+				delete(r.waiters, index)
+				if w.term != entry.Term {
+					results = nil
+				}
+				w.c <- results
+			}
+			compact := r.lastApplied-r.snapshotIndex >= raftSnapshotEntries
+			r.lock.Unlock()
+
+			if compact {
+				r.compact(index)
+			}
+		}
+	}
+}
+
+// apply executes commands of entry
+func (r *RaftNode) apply(entry raftEntry) []raftResult {
+	inst := instanceOf(r.cache)
+	if entry.Atomic {
+		inst.lock.Lock()
+		defer inst.lock.Unlock()
+	} else {
+		lock := inst.lock.RLock()
+		defer inst.lock.RUnlock(lock)
+	}
+
+	ctx := withCommandTime(nonBlocking(), time.UnixMilli(entry.Time))
+	results := make([]raftResult, len(entry.Commands))
+	for i, cmd := range entry.Commands {
+		parser := &baseCommandParser{cmd: cmd.Cmd, key: cmd.Key, ttl: cmd.TTL, value: cmd.Value, headerParsed: true, raw: cmd.Raw}
+		results[i] = newRaftResult(execute(ctx, r.cache, parser, false))
+	}
+	return results
+}
+
+// compact replaces log entries up to applied index by cache snapshot, it is called by apply loop only.
+// Snapshot is written out of lock
+func (r *RaftNode) compact(index uint64) {
+	buff := &bytes.Buffer{}
+	if r.cache.Snapshot(buff) != nil {
+		return
+	}
+
+	r.lock.Lock()
+	if index <= r.snapshotIndex {
+		//snapshot of leader is installed meanwhile
+		r.lock.Unlock()
+		return
+	}
+	term := r.termAt(index)
+	r.lock.Unlock()
+
+	path, err := r.storage.writeSnapshot(raftSnapshotState{Index: index, Term: term, Data: buff.Bytes()})
+	if err != nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if index <= r.snapshotIndex {
+		os.Remove(path)
+		return
+	}
+	log := append([]raftEntry{{Term: term}}, r.log[index-r.snapshotIndex+1:]...)
+	if r.storage.commitSnapshot(path, index, log[1:]) != nil {
+		return
+	}
+	r.log = log
+	r.snapshotIndex = index
+	r.snapshot = buff.Bytes()
+}
+
+// storeSnapshot stores snapshot and log entries after it, lock must be held
+func (r *RaftNode) storeSnapshot(snapshot raftSnapshotState, entries []raftEntry) error {
+	path, err := r.storage.writeSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	return r.storage.commitSnapshot(path, snapshot.Index, entries)
+}
+
+// lastIndex returns index of last log entry, lock must be held
+func (r *RaftNode) lastIndex() uint64 {
+	return r.snapshotIndex + uint64(len(r.log)) - 1
+}
+
+// termAt returns term of entry which is not compacted, lock must be held
+func (r *RaftNode) termAt(index uint64) uint64 {
+	return r.log[index-r.snapshotIndex].Term
+}
+
+func (r *RaftNode) triggerAll() {
+	for peer := range r.peers {
+		if peer != r.id {
+			r.triggerPeer(peer)
+		}
+	}
+}
+
+func (r *RaftNode) triggerPeer(peer int) {
+	select {
+	case r.trigger[peer] <- struct{}{}:
+	default:
+	}
+}
+
+// serve accepts requests of other members
+func (r *RaftNode) serve() {
+	defer r.wg.Done()
+
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		r.connsLock.Lock()
+		r.accepted[conn] = struct{}{}
+		r.connsLock.Unlock()
+
+		r.wg.Add(1)
+		go r.serveConn(conn)
+	}
+}
+
+func (r *RaftNode) serveConn(conn net.Conn) {
+	defer r.wg.Done()
+	defer func() {
+		r.connsLock.Lock()
+		delete(r.accepted, conn)
+		r.connsLock.Unlock()
+		conn.Close()
+	}()
+
+	dec := gob.NewDecoder(conn)
+	enc := gob.NewEncoder(conn)
+
+	//TLS handshake and secret are read in time, requests of not authenticated member are not decoded
+	conn.SetDeadline(time.Now().Add(raftRPCTimeout))
+	auth := raftAuth{}
+	if dec.Decode(&auth) != nil {
+		return
+	}
+	ok := r.verifySecret(auth.Secret)
+	if enc.Encode(raftResponse{Success: ok}) != nil || !ok {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	for {
+		req := raftRequest{}
+		if dec.Decode(&req) != nil {
+			return
+		}
+		if enc.Encode(r.handle(&req)) != nil {
+			return
+		}
+	}
+}
+
+func (r *RaftNode) handle(req *raftRequest) raftResponse {
+	switch {
+	case req.Vote != nil:
+		return r.handleVote(req.Vote)
+	case req.Append != nil:
+		return r.handleAppend(req.Append)
+	case req.Snapshot != nil:
+		return r.handleSnapshot(req.Snapshot)
+	case req.Forward != nil:
+		results, index, err := r.proposeLocal(context.Background(), *req.Forward)
+		switch {
+		case err == raftNotLeaderError:
+			return raftResponse{NotLeader: true}
+		case err != nil:
+			return raftResponse{Err: err.Error()}
+		default:
+			return raftResponse{Success: true, Index: index, Results: results}
+		}
+	default:
+		return raftResponse{}
+	}
+}
+
+// call sends request to peer over idle or new connection
+func (r *RaftNode) call(peer int, req raftRequest, timeout time.Duration) (raftResponse, error) {
+	r.connsLock.Lock()
+	var c *raftConn
+	if n := len(r.idle[peer]); n > 0 {
+		c = r.idle[peer][n-1]
+		r.idle[peer] = r.idle[peer][:n-1]
+	}
+	r.connsLock.Unlock()
+
+	if c == nil {
+		var err error
+		if c, err = r.dial(peer, timeout); err != nil {
+			return raftResponse{}, err
+		}
+	}
+
+	resp, err := c.roundTrip(req, timeout)
+	if err != nil {
+		c.conn.Close()
+		return resp, err
+	}
+
+	r.connsLock.Lock()
+	select {
+	case <-r.stop:
+		c.conn.Close()
+	default:
+		r.idle[peer] = append(r.idle[peer], c)
+	}
+	r.connsLock.Unlock()
+	return resp, nil
+}
+
+// dial connects to peer and authenticates connection by secret
+func (r *RaftNode) dial(peer int, timeout time.Duration) (*raftConn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if r.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.peers[peer], r.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", r.peers[peer])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &raftConn{conn: conn, enc: gob.NewEncoder(conn), dec: gob.NewDecoder(conn)}
+	resp := raftResponse{}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := c.enc.Encode(raftAuth{Secret: r.secret}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := c.dec.Decode(&resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !resp.Success {
+		conn.Close()
+		return nil, raftAuthError
+	}
+	return c, nil
+}
+
+// verifySecret returns true if secret is equal to secret of member, any secret is accepted by member without secret
+func (r *RaftNode) verifySecret(secret string) bool {
+	if r.secret == "" {
+		return true
+	}
+	expected := sha256.Sum256([]byte(r.secret))
+	given := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(given[:], expected[:]) == 1
+}
+
+// roundTrip sends request and reads response, connection is not usable after error
+func (c *raftConn) roundTrip(req raftRequest, timeout time.Duration) (raftResponse, error) {
+	resp := raftResponse{}
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	if err := c.enc.Encode(&req); err != nil {
+		return resp, err
+	}
+	err := c.dec.Decode(&resp)
+	return resp, err
+}
+
+func newRaftResult(out interface{}, err error) raftResult {
+	if err != nil {
+		return raftResult{Err: err.Error(), ErrKind: kindOf(err).name}
+	}
+
+	switch v := out.(type) {
+	case string:
+		return raftResult{Kind: raftResultString, String: v}
+	case []string:
+		return raftResult{Kind: raftResultList, List: v}
+	default:
+		return raftResult{Kind: raftResultNone}
+	}
+}
+
+// value returns command result and error of the same kind as applied command error
+func (res raftResult) value() (interface{}, error) {
+	if res.ErrKind != "" {
+		if res.ErrKind == kindOf(ErrNotFound).name {
+			return nil, ErrNotFound
+		}
+		for _, kind := range errorKinds {
+			if kind.name == res.ErrKind {
+				return nil, kv.NewError(kind.kind, res.Err)
+			}
+		}
+		return nil, errors.New(res.Err)
+	}
+
+	switch res.Kind {
+	case raftResultString:
+		return res.String, nil
+	case raftResultList:
+		return res.List, nil
+	default:
+		return nil, nil
+	}
+}
+
+// withCommandTime sets time used by time based commands instead of current time
+func withCommandTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, commandTimeKey{}, t)
+}
+
+func commandTime(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(commandTimeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
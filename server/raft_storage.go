@@ -0,0 +1,317 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+type (
+	// raftStorage keeps term, vote, snapshot and log entries of member in directory.
+	// Every write is synced before member answers request, restarted member keeps its vote and stored entries.
+	//
+	// Log file starts with index of snapshot followed by records of entries, record of stored index replaces
+	// entries from its index. Snapshot is committed by rename of snapshot file, log file of the same snapshot index
+	// replaces previous log file after rename
+	raftStorage struct {
+		dir string
+		log *os.File
+	}
+
+	// raftHardState is a term and vote of member
+	raftHardState struct {
+		Term     uint64
+		VotedFor int
+	}
+
+	raftSnapshotState struct {
+		Index uint64
+		Term  uint64
+		Data  []byte
+	}
+
+	raftLogRecord struct {
+		Index uint64
+		Entry raftEntry
+	}
+)
+
+const (
+	raftStateFile       = "state"
+	raftSnapshotFile    = "snapshot"
+	raftLogFile         = "log"
+	raftLogTmpFile      = "log.tmp"
+	raftSnapshotPattern = "snapshot-*.tmp"
+	// raftRecordHeaderLen is a length and CRC-32 of record
+	raftRecordHeaderLen = 8
+)
+
+var (
+	raftStorageError = errors.New("Raft log is not opened after snapshot, member has to be restarted")
+)
+
+// openRaftStorage reads state of member from dir, not existing dir is created with empty state.
+// Entries of log are returned after snapshot entry
+func openRaftStorage(dir string) (*raftStorage, raftHardState, raftSnapshotState, []raftEntry, error) {
+	state := raftHardState{VotedFor: -1}
+	snapshot := raftSnapshotState{}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, state, snapshot, nil, err
+	}
+	s := &raftStorage{dir: dir}
+
+	if err := s.read(raftStateFile, &state); err != nil {
+		return nil, state, snapshot, nil, err
+	}
+	if err := s.read(raftSnapshotFile, &snapshot); err != nil {
+		return nil, state, snapshot, nil, err
+	}
+
+	//snapshot which is not renamed is not committed, log of committed snapshot is not renamed yet
+	tmp, _ := filepath.Glob(filepath.Join(dir, raftSnapshotPattern))
+	for _, path := range tmp {
+		os.Remove(path)
+	}
+	if f, err := os.Open(s.path(raftLogTmpFile)); err == nil {
+		index, err := readLogIndex(f)
+		f.Close()
+		if err == nil && index == snapshot.Index {
+			err = s.rename(s.path(raftLogTmpFile), raftLogFile)
+		} else {
+			err = os.Remove(s.path(raftLogTmpFile))
+		}
+		if err != nil {
+			return nil, state, snapshot, nil, err
+		}
+	}
+
+	entries, err := s.openLog(snapshot.Index)
+	if err != nil {
+		return nil, state, snapshot, nil, err
+	}
+	return s, state, snapshot, entries, nil
+}
+
+// openLog reads entries of log file and opens it for append, torn record of interrupted write is cut
+func (s *raftStorage) openLog(snapshotIndex uint64) ([]raftEntry, error) {
+	f, err := os.OpenFile(s.path(raftLogFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(f)
+	if err == nil && len(data) == 0 {
+		//new log
+		data = binary.BigEndian.AppendUint64(nil, snapshotIndex)
+		_, err = f.Write(data)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if len(data) < 8 || binary.BigEndian.Uint64(data) != snapshotIndex {
+		f.Close()
+		return nil, fmt.Errorf("Raft log %s does not follow snapshot", s.path(raftLogFile))
+	}
+
+	entries := []raftEntry{}
+	off := 8
+	for off+raftRecordHeaderLen <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[off:]))
+		if off+raftRecordHeaderLen+length > len(data) {
+			break
+		}
+		payload := data[off+raftRecordHeaderLen : off+raftRecordHeaderLen+length]
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[off+4:]) {
+			break
+		}
+
+		record := raftLogRecord{}
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("Incorrect raft log %s: %s", s.path(raftLogFile), err.Error())
+		}
+		if record.Index <= snapshotIndex || record.Index > snapshotIndex+uint64(len(entries))+1 {
+			f.Close()
+			return nil, fmt.Errorf("Raft log %s has incorrect entry index %d", s.path(raftLogFile), record.Index)
+		}
+		entries = append(entries[:record.Index-snapshotIndex-1], record.Entry)
+		off += raftRecordHeaderLen + length
+	}
+
+	if off < len(data) {
+		if err := f.Truncate(int64(off)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if _, err := f.Seek(int64(off), io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.log = f
+	return entries, nil
+}
+
+// saveState writes term and vote of member
+func (s *raftStorage) saveState(state raftHardState) error {
+	buff := &bytes.Buffer{}
+	if err := gob.NewEncoder(buff).Encode(&state); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, raftStateFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := writeSynced(f, buff.Bytes()); err != nil {
+		return err
+	}
+	return s.rename(f.Name(), raftStateFile)
+}
+
+// append stores entries from log index
+func (s *raftStorage) append(index uint64, entries []raftEntry) error {
+	data, err := appendLogRecords(nil, index, entries)
+	if err != nil {
+		return err
+	}
+	if s.log == nil {
+		return raftStorageError
+	}
+	if _, err := s.log.Write(data); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+// writeSnapshot writes snapshot to temporary file, snapshot is stored by commitSnapshot
+func (s *raftStorage) writeSnapshot(snapshot raftSnapshotState) (string, error) {
+	buff := &bytes.Buffer{}
+	if err := gob.NewEncoder(buff).Encode(&snapshot); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(s.dir, raftSnapshotPattern)
+	if err != nil {
+		return "", err
+	}
+	if err := writeSynced(f, buff.Bytes()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// commitSnapshot replaces snapshot by file of writeSnapshot and log by entries after snapshot index
+func (s *raftStorage) commitSnapshot(path string, index uint64, entries []raftEntry) error {
+	defer os.Remove(path)
+
+	data, err := appendLogRecords(binary.BigEndian.AppendUint64(nil, index), index+1, entries)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(s.path(raftLogTmpFile))
+	if err != nil {
+		return err
+	}
+	if err := writeSynced(f, data); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := s.rename(path, raftSnapshotFile); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	//snapshot is committed, log of previous snapshot must not be appended, it is replaced on next open
+	s.log.Close()
+	s.log = nil
+	if err := s.rename(f.Name(), raftLogFile); err != nil {
+		return err
+	}
+	s.log, err = os.OpenFile(s.path(raftLogFile), os.O_WRONLY|os.O_APPEND, 0600)
+	return err
+}
+
+func (s *raftStorage) close() {
+	if s.log != nil {
+		s.log.Close()
+	}
+}
+
+// read decodes file of dir to value, missing file is not an error
+func (s *raftStorage) read(name string, value interface{}) error {
+	data, err := os.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(value); err != nil {
+		return fmt.Errorf("Incorrect raft file %s: %s", s.path(name), err.Error())
+	}
+	return nil
+}
+
+// rename replaces file of dir and syncs dir
+func (s *raftStorage) rename(path string, name string) error {
+	if err := os.Rename(path, s.path(name)); err != nil {
+		return err
+	}
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func (s *raftStorage) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func readLogIndex(f *os.File) (uint64, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(header), nil
+}
+
+// appendLogRecords appends records of entries from log index to data
+func appendLogRecords(data []byte, index uint64, entries []raftEntry) ([]byte, error) {
+	for i, entry := range entries {
+		buff := &bytes.Buffer{}
+		if err := gob.NewEncoder(buff).Encode(&raftLogRecord{Index: index + uint64(i), Entry: entry}); err != nil {
+			return nil, err
+		}
+		data = binary.BigEndian.AppendUint32(data, uint32(buff.Len()))
+		data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(buff.Bytes()))
+		data = append(data, buff.Bytes()...)
+	}
+	return data, nil
+}
+
+// writeSynced writes data to file, syncs and closes it
+func writeSynced(f *os.File, data []byte) error {
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
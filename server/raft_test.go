@@ -0,0 +1,331 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestRaft(t *testing.T) {
+	defer func(entries uint64) {
+		raftSnapshotEntries = entries
+	}(raftSnapshotEntries)
+	raftSnapshotEntries = 5
+
+	peers := []string{"127.0.0.1:4530", "127.0.0.1:4531", "127.0.0.1:4532"}
+	caches := make([]*kv.CacheDb, len(peers))
+	nodes := make([]*RaftNode, len(peers))
+	dirs := make([]string, len(peers))
+	for i := range peers {
+		caches[i] = kv.NewCacheDb()
+		dirs[i] = t.TempDir()
+		node, err := StartRaft(caches[i], peers, i, dirs[i], "", nil)
+		if err != nil {
+			t.Fatal("Start error", err.Error())
+		}
+		nodes[i] = node
+		defer func(i int) {
+			nodes[i].Close()
+		}(i)
+	}
+
+	if _, err := StartRaft(caches[0], peers, 0, dirs[0], "", nil); err != raftEnabledError {
+		t.Fatal("Incorrect start error", "expected", raftEnabledError, "got", err)
+	}
+	if _, err := StartRaft(kv.NewCacheDb(), peers, 0, "", "", nil); err != raftDirError {
+		t.Fatal("Incorrect start error", "expected", raftDirError, "got", err)
+	}
+
+	leader := func() int {
+		for i, node := range nodes {
+			if node != nil && node.IsLeader() {
+				return i
+			}
+		}
+		return -1
+	}
+	waitFor(t, "leader election", func() bool {
+		return leader() >= 0
+	})
+	first := leader()
+	follower := (first + 1) % len(nodes)
+
+	//follower forwards writes to leader
+	if _, err := exeCommand(caches[follower], "SET foo bar"); err != nil {
+		t.Fatal("Set error", err.Error())
+	}
+	if out, err := exeCommand(caches[follower], "GET foo"); err != nil || out != "bar" {
+		t.Fatal("Incorrect response", "expected", "bar", "got", out, err)
+	}
+	if _, err := exeCommand(caches[follower], "LPOP missing"); err != ErrNotFound {
+		t.Fatal("Incorrect response", "expected", ErrNotFound, "got", err)
+	}
+	if _, err := exeCommand(caches[follower], "BLPOP missing 1"); err != raftBlockingError {
+		t.Fatal("Incorrect response", "expected", raftBlockingError, "got", err)
+	}
+	if _, err := exeCommand(caches[follower], "XADD events * user 1"); err != nil {
+		t.Fatal("Stream add error", err.Error())
+	}
+
+	parsers := make([]*baseCommandParser, 2)
+	for i, cmd := range []string{"RPUSH queue a b", "LPOP queue"} {
+		parsers[i] = &baseCommandParser{}
+		parsers[i].Write([]byte(cmd))
+	}
+	if out, errs := ExeAtomic(caches[follower], parsers); errs[0] != nil || errs[1] != nil || out[1] != "a" {
+		t.Fatal("Incorrect atomic response", "expected", "a", "got", out, errs)
+	}
+
+	//entries are applied in the same order with the same leader time
+	waitFor(t, "replicated commands", func() bool {
+		for _, cache := range caches {
+			if data, err := cache.Get("foo"); err != nil || string(data) != "bar" {
+				return false
+			}
+			if list, _ := cache.GetList("queue"); len(list) != 1 {
+				return false
+			}
+		}
+		return true
+	})
+	entries, _ := exeCommand(caches[first], "XRANGE events - +")
+	for _, cache := range caches {
+		if out, _ := exeCommand(cache, "XRANGE events - +"); !reflect.DeepEqual(out, entries) {
+			t.Fatal("Incorrect stream entries", "expected", entries, "got", out)
+		}
+	}
+
+	//group keeps working without leader
+	nodes[first].Close()
+	nodes[first] = nil
+	waitFor(t, "new leader election", func() bool {
+		return leader() >= 0
+	})
+	for i := 0; i < 20; i++ {
+		if _, err := exeCommand(caches[follower], fmt.Sprintf("SET key%d value%d", i, i)); err != nil {
+			t.Fatal("Set error", err.Error())
+		}
+	}
+
+	//restarted member restores term, vote and log and catches up by snapshot
+	state := func(node *RaftNode) (uint64, uint64) {
+		node.lock.Lock()
+		defer node.lock.Unlock()
+		return node.term, node.lastIndex()
+	}
+	term, _ := state(nodes[follower])
+	caches[first] = kv.NewCacheDb()
+	node, err := StartRaft(caches[first], peers, first, dirs[first], "", nil)
+	if err != nil {
+		t.Fatal("Restart error", err.Error())
+	}
+	nodes[first] = node
+	if term, last := state(node); term == 0 || last < 5 {
+		t.Fatal("Incorrect restored state", "term", term, "last index", last)
+	}
+	waitFor(t, "snapshot catch up", func() bool {
+		data, err := caches[first].Get("key19")
+		return err == nil && string(data) == "value19"
+	})
+	if out, err := exeCommand(caches[first], "GET foo"); err != nil || out != "bar" {
+		t.Fatal("Incorrect restored key", "expected", "bar", "got", out, err)
+	}
+
+	//the whole group restarts from stored logs and snapshots
+	for i := range nodes {
+		nodes[i].Close()
+	}
+	for i := range nodes {
+		caches[i] = kv.NewCacheDb()
+		if nodes[i], err = StartRaft(caches[i], peers, i, dirs[i], "", nil); err != nil {
+			t.Fatal("Restart error", err.Error())
+		}
+		if restored, _ := state(nodes[i]); restored < term {
+			t.Fatal("Incorrect restored term", "expected at least", term, "got", restored)
+		}
+	}
+	waitFor(t, "restored group", func() bool {
+		if leader() < 0 {
+			return false
+		}
+		for _, cache := range caches {
+			if data, err := cache.Get("key19"); err != nil || string(data) != "value19" {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestRaftAuth(t *testing.T) {
+	dir := t.TempDir()
+	writeCA(t, dir, 500)
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatal("Certificate error", err.Error())
+	}
+	caCert, _ := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caCert)
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+
+	peers := []string{"127.0.0.1:4549", "127.0.0.1:4550"}
+	caches := []*kv.CacheDb{kv.NewCacheDb(), kv.NewCacheDb()}
+	for i := range peers {
+		node, err := StartRaft(caches[i], peers, i, t.TempDir(), "secret", tlsConfig)
+		if err != nil {
+			t.Fatal("Start error", err.Error())
+		}
+		defer node.Close()
+	}
+
+	//members of the same secret elect leader and replicate commands over TLS
+	waitFor(t, "leader election", func() bool {
+		_, err := exeCommand(caches[0], "SET foo bar")
+		return err == nil
+	})
+	waitFor(t, "replicated command", func() bool {
+		data, err := caches[1].Get("foo")
+		return err == nil && string(data) == "bar"
+	})
+
+	//member of another secret and not secure member are not accepted
+	wrong := &RaftNode{peers: peers, secret: "wrong", tlsConfig: tlsConfig}
+	if _, err := wrong.dial(0, raftRPCTimeout); err != raftAuthError {
+		t.Fatal("Incorrect dial error", "expected", raftAuthError, "got", err)
+	}
+	plain := &RaftNode{peers: peers, secret: "secret"}
+	if _, err := plain.dial(0, raftRPCTimeout); err == nil {
+		t.Fatal("Incorrect dial error", "expected", "error", "got", err)
+	}
+	valid := &RaftNode{peers: peers, secret: "secret", tlsConfig: tlsConfig}
+	c, err := valid.dial(0, raftRPCTimeout)
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	c.conn.Close()
+}
+
+func TestRaftForwardUnknown(t *testing.T) {
+	//leader closes connection after request is read
+	l, err := net.Listen("tcp", "127.0.0.1:4544")
+	if err != nil {
+		t.Fatal("Listen error", err.Error())
+	}
+	defer l.Close()
+	requests := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			//leader accepts member and closes connection after forwarded request
+			if gob.NewDecoder(conn).Decode(&raftAuth{}) == nil && gob.NewEncoder(conn).Encode(raftResponse{Success: true}) == nil {
+				conn.Read(make([]byte, 1))
+				requests <- struct{}{}
+			}
+			conn.Close()
+		}
+	}()
+
+	cache := kv.NewCacheDb()
+	node, err := StartRaft(cache, []string{"127.0.0.1:4543", "127.0.0.1:4544"}, 0, t.TempDir(), "", nil)
+	if err != nil {
+		t.Fatal("Start error", err.Error())
+	}
+	defer node.Close()
+
+	node.lock.Lock()
+	node.leader = 1
+	node.electionTime = time.Now().Add(time.Hour)
+	node.lock.Unlock()
+
+	if _, err := exeCommand(cache, "LPUSH queue a"); err != raftUnknownError {
+		t.Fatal("Incorrect response", "expected", raftUnknownError, "got", err)
+	}
+	if len(requests) != 1 {
+		t.Fatal("Incorrect forwarded requests", "expected", 1, "got", len(requests))
+	}
+}
+
+func TestRaftStorage(t *testing.T) {
+	dir := t.TempDir()
+	entries := func(terms ...uint64) []raftEntry {
+		out := make([]raftEntry, len(terms))
+		for i, term := range terms {
+			out[i] = raftEntry{Term: term, Commands: []raftCommand{{Cmd: cmdSetLex, Key: fmt.Sprint("key", i)}}}
+		}
+		return out
+	}
+	terms := func(entries []raftEntry) string {
+		out := []uint64{}
+		for _, entry := range entries {
+			out = append(out, entry.Term)
+		}
+		return fmt.Sprint(out)
+	}
+
+	s, state, _, log, err := openRaftStorage(dir)
+	if err != nil || state.VotedFor != -1 || len(log) != 0 {
+		t.Fatal("Incorrect empty storage", state, log, err)
+	}
+	s.saveState(raftHardState{Term: 3, VotedFor: 1})
+	s.append(1, entries(1, 1, 2))
+	//conflicting entries are replaced
+	s.append(3, entries(3, 3))
+	s.close()
+
+	//torn record of interrupted write is cut
+	f, _ := os.OpenFile(filepath.Join(dir, raftLogFile), os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte{0, 0, 1, 0, 1, 2})
+	f.Close()
+
+	s, state, _, log, err = openRaftStorage(dir)
+	if err != nil || state != (raftHardState{Term: 3, VotedFor: 1}) || terms(log) != "[1 1 3 3]" {
+		t.Fatal("Incorrect restored storage", state, terms(log), err)
+	}
+	if log[2].Commands[0].Key != "key0" {
+		t.Fatal("Incorrect restored entry", "expected", "key0", "got", log[2].Commands[0].Key)
+	}
+
+	path, _ := s.writeSnapshot(raftSnapshotState{Index: 2, Term: 1, Data: []byte("data")})
+	if err := s.commitSnapshot(path, 2, log[2:]); err != nil {
+		t.Fatal("Snapshot error", err.Error())
+	}
+	s.append(5, entries(4))
+	//snapshot which is not committed is removed
+	s.writeSnapshot(raftSnapshotState{Index: 4, Term: 3})
+	s.close()
+
+	s, _, snapshot, log, err := openRaftStorage(dir)
+	if err != nil || snapshot.Index != 2 || string(snapshot.Data) != "data" || terms(log) != "[3 3 4]" {
+		t.Fatal("Incorrect restored snapshot", snapshot.Index, terms(log), err)
+	}
+
+	//log of committed snapshot replaces previous log
+	os.WriteFile(filepath.Join(dir, raftLogTmpFile), []byte{0, 0, 0, 0, 0, 0, 0, 2}, 0600)
+	s.close()
+	s, _, _, log, err = openRaftStorage(dir)
+	if err != nil || len(log) != 0 {
+		t.Fatal("Incorrect log of committed snapshot", terms(log), err)
+	}
+	s.close()
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmp) != 0 {
+		t.Fatal("Incorrect temporary files", tmp)
+	}
+}
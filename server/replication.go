@@ -0,0 +1,498 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+type (
+	// replication is a primary state: backlog of key changes streamed to connected replicas
+	replication struct {
+		lock sync.Mutex
+		id   string
+		// start is offset of first backlog command, offset is offset of last command
+		start   uint64
+		offset  uint64
+		backlog []replCommand
+		size    int
+
+		watcher  *kv.Watcher
+		dropped  uint64
+		replicas map[*replicaConn]struct{}
+	}
+
+	// replCommand is a key change, record is nil for removed key
+	replCommand struct {
+		key    string
+		record []byte
+	}
+
+	// replicaConn is a replica connected to primary
+	replicaConn struct {
+		notify chan struct{}
+		// stale replica lost changes and has to resync
+		stale bool
+	}
+
+	// Replica replicates primary cache to local cache, local cache is read only until replica is closed
+	Replica struct {
+		cache     *kv.CacheDb
+		addr      string
+		tlsConfig *tls.Config
+		// user and password authenticate replica connection to primary with users
+		user     string
+		password string
+
+		lock      sync.Mutex
+		id        string
+		offset    uint64
+		synced    bool
+		fullSyncs int
+		err       error
+		conn      net.Conn
+
+		stop chan struct{}
+		done chan struct{}
+	}
+
+	// snapshotWriter writes snapshot chunks as streamed list elements
+	snapshotWriter struct {
+		conn net.Conn
+		e    *protocol.Encoder
+	}
+
+	// snapshotReader reads snapshot chunks of streamed list
+	snapshotReader struct {
+		conn  net.Conn
+		s     *protocol.StreamReader
+		chunk []byte
+	}
+)
+
+const (
+	replBacklogSize    = 16 << 20
+	replWatcherBuffer  = 64 * 1024
+	replPingInterval   = 10 * time.Second
+	replTimeout        = time.Minute
+	replRetryInterval  = time.Second
+	replicationIDBytes = 20
+
+	replFullResync = "FULLRESYNC"
+	replContinue   = "CONTINUE"
+	replRestore    = "RESTORE"
+	replRemove     = "REMOVE"
+	replPing       = "PING"
+	// replNoID requests full resync
+	replNoID = "?"
+)
+
+var (
+	incorrectOffsetError       = badRequest("Incorrect replication offset")
+	syncConnError              = badRequest("SYNC is supported by binary tcp connection only")
+	incorrectReplicationFrame  = errors.New("Incorrect replication frame")
+	incorrectReplicationAnswer = errors.New("Incorrect replication answer")
+)
+
+func newReplication() *replication {
+	return &replication{
+		id:       newReplicationID(),
+		start:    1,
+		replicas: map[*replicaConn]struct{}{},
+	}
+}
+
+func newReplicationID() string {
+	id := make([]byte, replicationIDBytes)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// watch starts backlog feeding with first replica, lock must be held
+func (r *replication) watch(cache *kv.CacheDb) {
+	if r.watcher != nil {
+		return
+	}
+
+	r.watcher = cache.Watch("*", replWatcherBuffer)
+	go r.feed(cache, r.watcher)
+}
+
+// feed appends current key records of changed keys to backlog, replicas receive latest record of key
+// instead of commands changed it. Dropped event means lost change, replicas are resynced with new replication id
+func (r *replication) feed(cache *kv.CacheDb, w *kv.Watcher) {
+	for event := range w.C {
+		record, _ := cache.Dump(event.Key)
+
+		r.lock.Lock()
+		if dropped := w.Dropped(); dropped != r.dropped {
+			r.dropped = dropped
+			r.id = newReplicationID()
+			r.backlog, r.size = nil, 0
+			r.start = r.offset + 1
+			for rc := range r.replicas {
+				rc.stale = true
+			}
+		}
+
+		r.append(replCommand{key: event.Key, record: record})
+		r.lock.Unlock()
+	}
+}
+
+// append adds command to backlog and notifies replicas, lock must be held
+func (r *replication) append(cmd replCommand) {
+	r.backlog = append(r.backlog, cmd)
+	r.offset++
+	r.size += len(cmd.key) + len(cmd.record)
+
+	for r.size > replBacklogSize && len(r.backlog) > 1 {
+		r.size -= len(r.backlog[0].key) + len(r.backlog[0].record)
+		r.backlog[0] = replCommand{}
+		r.backlog = r.backlog[1:]
+		r.start++
+	}
+
+	for rc := range r.replicas {
+		select {
+		case rc.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// since returns backlog commands from offset next, false if replica has to resync
+func (r *replication) since(rc *replicaConn, next uint64) ([]replCommand, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if rc.stale || next < r.start {
+		return nil, false
+	}
+	return append([]replCommand(nil), r.backlog[next-r.start:]...), true
+}
+
+func (r *replication) remove(rc *replicaConn) {
+	r.lock.Lock()
+	delete(r.replicas, rc)
+	r.lock.Unlock()
+}
+
+func (cmd replCommand) push() []string {
+	if cmd.record == nil {
+		return []string{replRemove, cmd.key}
+	}
+	return []string{replRestore, cmd.key, string(cmd.record)}
+}
+
+// syncReplica serves replica connection: sends snapshot or continues from backlog
+// and streams key changes until connection is closed
+func (s *tcpServer) syncReplica(conn net.Conn, d *protocol.Decoder, e *protocol.Encoder, parser *baseCommandParser) {
+	offset, err := strconv.ParseUint(string(parser.value), 10, 64)
+	if err != nil {
+		encodeError(e, incorrectOffsetError)
+		return
+	}
+
+	r := instanceOf(s.cache).replication
+	rc := &replicaConn{notify: make(chan struct{}, 1)}
+
+	r.lock.Lock()
+	r.watch(s.cache)
+	full := parser.key != r.id || offset+1 < r.start || offset > r.offset
+	if full {
+		offset = r.offset
+	}
+	id := r.id
+	r.replicas[rc] = struct{}{}
+	r.lock.Unlock()
+	defer r.remove(rc)
+
+	conn.SetReadDeadline(time.Time{})
+	conn.SetWriteDeadline(time.Now().Add(replTimeout))
+	if full {
+		if e.EncodePush([]string{replFullResync, id, strconv.FormatUint(offset, 10)}) != nil {
+			return
+		}
+		e.BeginList()
+		if s.cache.Snapshot(snapshotWriter{conn, e}) != nil || e.End() != nil {
+			return
+		}
+	} else if e.EncodePush([]string{replContinue, id}) != nil {
+		return
+	}
+
+	//replica does not send requests, read error means replica is gone
+	closed := make(chan struct{})
+	go func() {
+		d.Peek()
+		close(closed)
+	}()
+
+	ping := time.NewTicker(replPingInterval)
+	defer ping.Stop()
+
+	next := offset + 1
+	for {
+		cmds, ok := r.since(rc, next)
+		if !ok {
+			return
+		}
+
+		for _, cmd := range cmds {
+			conn.SetWriteDeadline(time.Now().Add(replTimeout))
+			if e.EncodePush(cmd.push()) != nil {
+				return
+			}
+		}
+		next += uint64(len(cmds))
+
+		select {
+		case <-rc.notify:
+		case <-closed:
+			return
+		case <-s.ctx.Done():
+			return
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(replTimeout))
+			if e.EncodePush([]string{replPing}) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (w snapshotWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(replTimeout))
+	if err := w.e.EncodeElement(string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		r.conn.SetReadDeadline(time.Now().Add(replTimeout))
+		if !r.s.Next() {
+			if err := r.s.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		r.chunk = []byte(r.s.Elem())
+	}
+
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// ReplicaOf starts replication of primary binary tcp listener at addr to cache.
+// Cache is read only until replica is closed, tlsConfig is nil for not secure listener.
+// Connection is authenticated by AUTH of user and password if user is not empty,
+// user of primary requires admin and dangerous categories
+func ReplicaOf(cache *kv.CacheDb, addr string, tlsConfig *tls.Config, user string, password string) *Replica {
+	r := &Replica{
+		cache:     cache,
+		addr:      addr,
+		tlsConfig: tlsConfig,
+		user:      user,
+		password:  password,
+		id:        replNoID,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	instanceOf(cache).readOnly.Store(true)
+	go r.run()
+	return r
+}
+
+// Close stops replication and makes cache writable
+func (r *Replica) Close() {
+	r.lock.Lock()
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.lock.Unlock()
+
+	<-r.done
+	instanceOf(r.cache).readOnly.Store(false)
+}
+
+// Offset returns replication id and offset of last applied change
+func (r *Replica) Offset() (string, uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.id, r.offset
+}
+
+// Synced returns true if replica is connected to primary and receives changes
+func (r *Replica) Synced() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.synced
+}
+
+// Err returns last replication error
+func (r *Replica) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// run syncs replica and reconnects after errors until replica is closed
+func (r *Replica) run() {
+	defer close(r.done)
+
+	for {
+		err := r.sync()
+		if err != nil {
+			instanceOf(r.cache).log().Warn("Replication error", "primary", r.addr, "err", err)
+		}
+
+		r.lock.Lock()
+		r.synced, r.err, r.conn = false, err, nil
+		r.lock.Unlock()
+
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(replRetryInterval):
+		}
+	}
+}
+
+func (r *Replica) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: replTimeout}
+	if r.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", r.addr, r.tlsConfig)
+	}
+	return dialer.Dial("tcp", r.addr)
+}
+
+func (r *Replica) sync() error {
+	conn, err := r.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	r.lock.Lock()
+	select {
+	case <-r.stop:
+		r.lock.Unlock()
+		return nil
+	default:
+	}
+	r.conn = conn
+	id, offset := r.id, r.offset
+	r.lock.Unlock()
+
+	d := protocol.NewDecoder(conn)
+	e := protocol.NewEncoder(conn)
+
+	conn.SetDeadline(time.Now().Add(replTimeout))
+	if r.user != "" {
+		if err := e.EncodeRequest([]byte(fmt.Sprintf("%s %s %s", cmdAuthLex, r.user, r.password))); err != nil {
+			return err
+		}
+		if _, err := d.DecodeResponse(); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeRequest([]byte(fmt.Sprintf("%s %s %d", cmdSyncLex, id, offset))); err != nil {
+		return err
+	}
+
+	push, err := decodePush(d)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(push) == 3 && push[0] == replFullResync:
+		if offset, err = strconv.ParseUint(push[2], 10, 64); err != nil {
+			return incorrectReplicationAnswer
+		}
+
+		stream, err := d.DecodeStream()
+		if err != nil {
+			return err
+		}
+		if err := r.cache.LoadSnapshot(&snapshotReader{conn: conn, s: stream}); err != nil {
+			return err
+		}
+		for stream.Next() {
+		}
+		if err := stream.Err(); err != nil {
+			return err
+		}
+
+		r.lock.Lock()
+		r.fullSyncs++
+		r.lock.Unlock()
+	case len(push) == 2 && push[0] == replContinue:
+	default:
+		return incorrectReplicationAnswer
+	}
+
+	r.lock.Lock()
+	r.id, r.offset, r.synced = push[1], offset, true
+	r.lock.Unlock()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(replTimeout))
+		push, err := decodePush(d)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case len(push) == 3 && push[0] == replRestore:
+			err = r.cache.Restore(push[1], []byte(push[2]))
+		case len(push) == 2 && push[0] == replRemove:
+			r.cache.Remove(push[1])
+		case len(push) == 1 && push[0] == replPing:
+			continue
+		default:
+			return incorrectReplicationFrame
+		}
+
+		if err != nil {
+			return err
+		}
+
+		r.lock.Lock()
+		r.offset++
+		r.lock.Unlock()
+	}
+}
+
+func decodePush(d *protocol.Decoder) (protocol.Push, error) {
+	resp, err := d.DecodeResponse()
+	if err != nil {
+		return nil, err
+	}
+
+	push, ok := resp.(protocol.Push)
+	if !ok || len(push) == 0 {
+		return nil, incorrectReplicationFrame
+	}
+	return push, nil
+}
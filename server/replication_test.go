@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+func waitFor(t *testing.T, message string, fn func() bool) {
+	deadline := time.Now().Add(time.Second * 5)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout:", message)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func exeCommand(cache *kv.CacheDb, cmd string) (interface{}, error) {
+	parser := &baseCommandParser{}
+	if _, err := parser.Write([]byte(cmd)); err != nil {
+		return nil, err
+	}
+	return Exe(cache, parser)
+}
+
+func TestReplication(t *testing.T) {
+	primary := kv.NewCacheDb()
+	exeCommand(primary, "SET before snapshot")
+	exeCommand(primary, "SETLIST list a b")
+
+	ts := NewTcpServer(primary, "127.0.0.1", 4510)
+	go ts.Listen()
+	time.Sleep(time.Millisecond * 100)
+
+	cache := kv.NewCacheDb()
+	exeCommand(cache, "SET stale value")
+
+	replica := ReplicaOf(cache, "127.0.0.1:4510", nil, "", "")
+	defer replica.Close()
+
+	synced := func(keys ...string) func() bool {
+		return func() bool {
+			for _, key := range keys {
+				expected, _ := primary.Dump(key)
+				got, _ := cache.Dump(key)
+				if !bytes.Equal(expected, got) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	waitFor(t, "full resync", synced("before", "list", "stale"))
+
+	exeCommand(primary, "SET after snapshot")
+	exeCommand(primary, "XADD stream * f v")
+	exeCommand(primary, "REMOVE before")
+	waitFor(t, "replicated changes", synced("after", "stream", "before"))
+
+	if _, err := exeCommand(cache, "SET key value"); err != ErrReadOnly {
+		t.Fatal("Incorrect replica write error", "expected", ErrReadOnly, "got", err)
+	}
+	if out, err := exeCommand(cache, "GET after"); err != nil || out != "snapshot" {
+		t.Fatal("Incorrect replica read", "expected", "snapshot", "got", out, err)
+	}
+
+	//partial resync after disconnect
+	_, offset := replica.Offset()
+	replica.lock.Lock()
+	replica.conn.Close()
+	replica.lock.Unlock()
+	waitFor(t, "disconnect", func() bool { return !replica.Synced() })
+
+	exeCommand(primary, "SET offline change")
+	waitFor(t, "partial resync", synced("offline"))
+
+	if _, newOffset := replica.Offset(); newOffset != offset+1 {
+		t.Fatal("Incorrect offset", "expected", offset+1, "got", newOffset)
+	}
+	if replica.fullSyncs != 1 {
+		t.Fatal("Incorrect full resyncs", "expected", 1, "got", replica.fullSyncs)
+	}
+
+	replica.Close()
+	if _, err := exeCommand(cache, "SET key value"); err != nil {
+		t.Fatal("Expected writable cache after replica close", err)
+	}
+}
+
+func TestReplicationAuth(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.json")
+	os.WriteFile(path, []byte(fmt.Sprintf(`{
+		"client": {"commands": ["read"]},
+		"replica": {"password": %q, "commands": ["all"]}
+	}`, hashPassword("secret", []byte("salt"), 1000))), 0600)
+
+	primary := kv.NewCacheDb()
+	if err := LoadUsers(primary, path); err != nil {
+		t.Fatal("Load error", err.Error())
+	}
+	exeCommand(primary, "SET foo bar")
+
+	clientCert := writeCA(t, dir, 400)
+	ts := NewTcpServer(primary, "127.0.0.1", 4546)
+	go ts.ListenSecure(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	defer ts.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	caCert, _ := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert)
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{clientCert}, RootCAs: roots}
+
+	//user of client certificate has no permission of SYNC
+	denied := ReplicaOf(kv.NewCacheDb(), "127.0.0.1:4546", tlsConfig, "", "")
+	waitFor(t, "denied sync", func() bool { return denied.Err() != nil })
+	denied.Close()
+	if err := denied.Err(); !isErrorCode(err, protocol.CodeNoPermission) {
+		t.Fatal("Incorrect replica error", "expected", protocol.CodeNoPermission, "got", err)
+	}
+
+	cache := kv.NewCacheDb()
+	replica := ReplicaOf(cache, "127.0.0.1:4546", tlsConfig, "replica", "secret")
+	defer replica.Close()
+	waitFor(t, "authenticated sync", replica.Synced)
+	waitFor(t, "replicated key", func() bool {
+		out, _ := exeCommand(cache, "GET foo")
+		return out == "bar"
+	})
+}
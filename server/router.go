@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type (
+	// router dispatches HTTP requests by method and path without method and wildcard patterns of http.ServeMux,
+	// which are disabled by httpmuxgo121 setting of builds without go.mod.
+	// Requests of not registered paths are handled by fallback
+	router struct {
+		routes   []*route
+		fallback http.Handler
+	}
+
+	// route is a handler of method and path pattern, {name} segment matches one not empty
+	// path segment and is set as request path value
+	route struct {
+		method   string
+		segments []string
+		handler  http.HandlerFunc
+	}
+)
+
+func newRouter(fallback http.HandlerFunc) *router {
+	return &router{fallback: fallback}
+}
+
+// handle registers handler of method and path pattern like /keys/{key}
+func (rt *router) handle(method string, pattern string, handler http.HandlerFunc) {
+	rt.routes = append(rt.routes, &route{
+		method:   method,
+		segments: strings.Split(strings.TrimPrefix(pattern, "/"), "/"),
+		handler:  handler,
+	})
+}
+
+// ServeHTTP calls handler of the first matched route, GET routes match HEAD requests too.
+// Path matched by routes of other methods is not allowed
+func (rt *router) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(request.URL.EscapedPath(), "/"), "/")
+
+	allowed := []string{}
+	for _, r := range rt.routes {
+		values, ok := r.match(segments)
+		if !ok {
+			continue
+		}
+		if r.method != request.Method && !(r.method == http.MethodGet && request.Method == http.MethodHead) {
+			allowed = append(allowed, r.method)
+			continue
+		}
+
+		for name, value := range values {
+			request.SetPathValue(name, value)
+		}
+		r.handler(writer, request)
+		return
+	}
+
+	if len(allowed) > 0 {
+		writer.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	rt.fallback.ServeHTTP(writer, request)
+}
+
+// match returns unescaped wildcard values of escaped path segments
+func (r *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+
+	values := map[string]string{}
+	for i, segment := range r.segments {
+		name, ok := strings.CutPrefix(segment, "{")
+		if !ok {
+			if segments[i] != segment {
+				return nil, false
+			}
+			continue
+		}
+
+		value, err := url.PathUnescape(segments[i])
+		if err != nil || value == "" {
+			return nil, false
+		}
+		values[strings.TrimSuffix(name, "}")] = value
+	}
+	return values, true
+}
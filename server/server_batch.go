@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	emptyBatchError = badRequest("Empty commands batch")
+)
+
+// batchHandler executes JSON array or new line separated list of commands.
+// With atomic=true query parameter commands are executed without interleaving
+// with other commands, command parse error aborts whole batch
+func (s *httpServer) batchHandler(writer http.ResponseWriter, request *http.Request) {
+	var commands []string
+	err := readBody(request, func(body []byte) error {
+		return json.Unmarshal(body, &commands)
+	}, func(body []byte) error {
+		for _, line := range strings.Split(string(body), "\n") {
+			if strings.TrimSpace(line) != "" {
+				commands = append(commands, line)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	if len(commands) == 0 {
+		writeError(writer, emptyBatchError)
+		return
+	}
+
+	atomic, _ := strconv.ParseBool(request.URL.Query().Get("atomic"))
+
+	parsers := make([]*baseCommandParser, len(commands))
+	errs := make([]error, len(commands))
+	for i, cmd := range commands {
+		parsers[i] = &baseCommandParser{}
+		_, errs[i] = parsers[i].Write([]byte(cmd))
+		if errs[i] != nil && atomic {
+			writeError(writer, badRequest(fmt.Sprintf("Command %d: %s", i, errs[i].Error())))
+			return
+		}
+	}
+
+	out := make([]interface{}, len(commands))
+	if atomic {
+		out, errs = ExeAtomicContext(request.Context(), s.cache, parsers)
+	} else {
+		for i, parser := range parsers {
+			if errs[i] == nil {
+				out[i], errs[i] = ExeContext(request.Context(), s.cache, parser)
+			}
+		}
+	}
+
+	results := make([]*output, len(commands))
+	for i := range commands {
+		if errs[i] != nil {
+			results[i] = &output{Error: errs[i].Error(), Code: kindOf(errs[i]).name}
+			continue
+		}
+		results[i] = &output{Data: out[i]}
+	}
+
+	writer.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(writer).Encode(results)
+}
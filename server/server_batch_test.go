@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestBatch(t *testing.T) {
+	type (
+		testCase struct {
+			url         string
+			contentType string
+			body        string
+			code        int
+			response    string
+		}
+	)
+
+	testCases := []*testCase{
+		{"/batch", "application/json", `["SET foo bar","GET foo","GET baz","FOO"]`, http.StatusOK,
+			`[{},{"data":"bar"},{"error":"Not found","code":"not_found"},{"error":"Incorrect command name","code":"bad_request"}]`},
+		{"/batch", "", "SETLIST list a b\nGETLIST list\n", http.StatusOK, `[{},{"data":["a","b"]}]`},
+		{"/batch?atomic=true", "", "SET foo baz\nGET foo", http.StatusOK, `[{},{"data":"baz"}]`},
+		{"/batch?atomic=true", "", "SET foo bar\nFOO", http.StatusBadRequest, `{"error":"Command 1: Incorrect command name","code":"bad_request"}`},
+		{"/batch", "application/json", `[]`, http.StatusBadRequest, `{"error":"Empty commands batch","code":"bad_request"}`},
+	}
+
+	cache := kv.NewCacheDb()
+	s := NewHttpServer(cache, "127.0.0.1", 0)
+	for _, tc := range testCases {
+		request := httptest.NewRequest("POST", tc.url, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			request.Header.Set("Content-Type", tc.contentType)
+		}
+
+		writer := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(writer, request)
+
+		if writer.Code != tc.code {
+			t.Fatal("Incorrect status", tc.url, "expected", tc.code, "got", writer.Code)
+		}
+
+		if strings.TrimSpace(writer.Body.String()) != tc.response {
+			t.Fatal("Incorrect response", tc.url, "expected", tc.response, "got", writer.Body.String())
+		}
+	}
+
+	if data, _ := cache.Get("foo"); string(data) != "baz" {
+		t.Fatal("Aborted batch was executed", "got", string(data))
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	eventOutput struct {
+		Type    string `json:"type"`
+		Key     string `json:"key"`
+		KeyType string `json:"key_type"`
+	}
+)
+
+const (
+	eventsBuffer       = 1024
+	eventsPingInterval = 30 * time.Second
+)
+
+func newEventOutput(event kv.Event) *eventOutput {
+	return &eventOutput{Type: event.Type.String(), Key: event.Key, KeyType: event.KeyType}
+}
+
+// eventsPattern returns keys glob pattern from query, all keys by default
+func eventsPattern(request *http.Request) string {
+	if pattern := request.URL.Query().Get("pattern"); pattern != "" {
+		return pattern
+	}
+	return "*"
+}
+
+// eventsFilter returns filter of event keys accessible by user of request,
+// events require read permission
+func (s *httpServer) eventsFilter(request *http.Request) (func(key string) bool, error) {
+	inst := instanceOf(s.cache)
+	if err := inst.checkCategories(request.Context(), "events", aclRead); err != nil {
+		return nil, err
+	}
+	return inst.keyFilter(request.Context()), nil
+}
+
+// sseHandler sends keyspace events as Server-Sent Events
+func (s *httpServer) sseHandler(writer http.ResponseWriter, request *http.Request) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, fmt.Errorf("Streaming is not supported"))
+		return
+	}
+	allowed, err := s.eventsFilter(request)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	w := s.cache.Watch(eventsPattern(request), eventsBuffer)
+	defer w.Close()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ping := time.NewTicker(eventsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-ping.C:
+			if _, err := fmt.Fprint(writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case event := <-w.C:
+			if !allowed(event.Key) {
+				continue
+			}
+			data, _ := json.Marshal(newEventOutput(event))
+			if _, err := fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// websocketHandler sends keyspace events as websocket JSON text messages
+func (s *httpServer) websocketHandler(writer http.ResponseWriter, request *http.Request) {
+	allowed, err := s.eventsFilter(request)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	w := s.cache.Watch(eventsPattern(request), eventsBuffer)
+	defer w.Close()
+
+	conn, err := upgradeWebsocket(writer, request, s.wsOrigins)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		conn.readLoop()
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-request.Context().Done():
+			return
+		case event := <-w.C:
+			if !allowed(event.Key) {
+				continue
+			}
+			data, _ := json.Marshal(newEventOutput(event))
+			if conn.WriteText(data) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestSSE(t *testing.T) {
+	cache := kv.NewCacheDb()
+	ts := httptest.NewServer(NewHttpServer(cache, "127.0.0.1", 0).server.Handler)
+	defer ts.Close()
+
+	response, err := http.Get(ts.URL + "/events?pattern=foo*")
+	if err != nil {
+		t.Fatal("Request error", err)
+	}
+	defer response.Body.Close()
+
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("Incorrect content type", response.Header.Get("Content-Type"))
+	}
+
+	cache.Set("bar", 0, []byte("bar"))
+	cache.Set("foo", 0, []byte("bar"))
+
+	r := bufio.NewReader(response.Body)
+	expected := []string{"event: set", `data: {"type":"set","key":"foo","key_type":"string"}`}
+	for _, line := range expected {
+		data, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal("Read error", err)
+		}
+
+		if strings.TrimSpace(data) != line {
+			t.Fatal("Incorrect event", "expected", line, "got", data)
+		}
+	}
+}
+
+func TestWebsocket(t *testing.T) {
+	cache := kv.NewCacheDb()
+	ts := httptest.NewServer(NewHttpServer(cache, "127.0.0.1", 0).server.Handler)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal("Dial error", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /events/ws?pattern=foo HTTP/1.1\r\nHost: localhost\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+
+	r := bufio.NewReader(conn)
+	response, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal("Read error", err)
+	}
+
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("Incorrect handshake", response.Status, response.Header)
+	}
+
+	cache.Set("foo", 0, []byte("bar"))
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatal("Read error", err)
+	}
+
+	payload := make([]byte, header[1])
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal("Read error", err)
+	}
+
+	expected := `{"type":"set","key":"foo","key_type":"string"}`
+	if header[0] != 0x80|wsOpText || string(payload) != expected {
+		t.Fatal("Incorrect frame", "expected", expected, "got", header, string(payload))
+	}
+}
+
+func TestWebsocketOrigin(t *testing.T) {
+	s := NewHttpServer(kv.NewCacheDb(), "127.0.0.1", 0)
+	s.SetWebsocketOrigins([]string{"https://app.example.com"})
+	ts := httptest.NewServer(s.server.Handler)
+	defer ts.Close()
+
+	testCases := []struct {
+		origin string
+		code   int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{"http://localhost", http.StatusSwitchingProtocols},
+		{"https://app.example.com", http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+		if err != nil {
+			t.Fatal("Dial error", err)
+		}
+
+		origin := ""
+		if tc.origin != "" {
+			origin = "Origin: " + tc.origin + "\r\n"
+		}
+		conn.Write([]byte("GET /events/ws HTTP/1.1\r\nHost: localhost\r\n" + origin +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+
+		response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			t.Fatal("Read error", err)
+		}
+		if response.StatusCode != tc.code {
+			t.Fatal("Incorrect status", tc.origin, "expected", tc.code, "got", response.StatusCode)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/2tvenom/kv/kv"
 )
@@ -13,69 +17,241 @@ type (
 	httpServer struct {
 		cache  *kv.CacheDb
 		server *http.Server
+
+		// ctx of requests is done on server shutdown, it interrupts blocking commands and events streams
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		// certs are set by ListenSecure
+		certs atomic.Pointer[certReloader]
+		// wsOrigins are allowed origins of websocket requests of other hosts
+		wsOrigins []string
 	}
 
 	output struct {
 		Error string      `json:"error,omitempty"`
+		Code  string      `json:"code,omitempty"`
 		Data  interface{} `json:"data,omitempty"`
 	}
+
+	pair struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+)
+
+const (
+	jsonContentType   = "application/json"
+	ndjsonContentType = "application/x-ndjson"
+	octetContentType  = "application/octet-stream"
 )
 
 func NewHttpServer(cache *kv.CacheDb, addr string, port int) *httpServer {
+	ctx, cancel := context.WithCancel(withTransport(context.Background(), transportHTTP))
 	s := &httpServer{
-		cache: cache,
+		cache:  cache,
+		ctx:    ctx,
+		cancel: cancel,
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.handler)
+	routes := newRouter(s.handler)
+	routes.handle(http.MethodPost, "/batch", s.batchHandler)
+	routes.handle(http.MethodGet, "/events", s.sseHandler)
+	routes.handle(http.MethodGet, "/events/ws", s.websocketHandler)
+	routes.handle(http.MethodGet, "/metrics", s.metricsHandler)
+	s.restRoutes(routes)
 
-	s.server = &http.Server{Addr: fmt.Sprintf("%s:%d", addr, port), Handler: mux}
+	s.server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", addr, port),
+		Handler: http.MaxBytesHandler(s.authHandler(routes), maxRequestLength),
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return instanceOf(cache).withConn(ctx, conn.RemoteAddr().String())
+		},
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				instanceOf(cache).metrics.connected(transportHTTP, s.server.Addr, 1)
+			case http.StateHijacked, http.StateClosed:
+				instanceOf(cache).metrics.connected(transportHTTP, s.server.Addr, -1)
+			}
+		},
+	}
 	return s
 }
 
+// SetWebsocketOrigins sets origins allowed to open /events/ws in addition to origin of the same host,
+// "*" allows every origin. It is called before Listen
+func (s *httpServer) SetWebsocketOrigins(origins []string) {
+	s.wsOrigins = origins
+}
+
+// Shutdown stops accepting connections, interrupts blocking commands and events streams, closes idle connections
+// and waits for requests in progress until ctx is done
+func (s *httpServer) Shutdown(ctx context.Context) error {
+	s.cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// Close closes listener and all connections without waiting for requests in progress
+func (s *httpServer) Close() error {
+	s.cancel()
+	return s.server.Close()
+}
+
 func (s *httpServer) handler(writer http.ResponseWriter, request *http.Request) {
 	defer request.Body.Close()
-	e := json.NewEncoder(writer)
 
 	parser := &baseCommandParser{}
 	_, err := io.Copy(parser, request.Body)
 
-	//log.Printf("CMD %+v\n", parser)
-
 	if err != nil {
-		writer.WriteHeader(http.StatusInternalServerError)
-		e.Encode(&output{Error: err.Error()})
+		writeError(writer, requestBodyError(err))
 		return
 	}
 
-	out, err := Exe(s.cache, parser)
-	if err != nil {
-		if err == notFoundErr {
-			writer.WriteHeader(http.StatusNotFound)
+	if parser.cmd == cmdMonitorLex {
+		if err := instanceOf(s.cache).checkAccess(request.Context(), parser); err != nil {
+			writeError(writer, err)
 			return
 		}
-		writer.WriteHeader(http.StatusInternalServerError)
-		e.Encode(&output{Error: err.Error()})
+		s.monitorHandler(writer, request)
+		return
+	}
+
+	out, err := ExeStreamContext(request.Context(), s.cache, parser)
+	if err != nil {
+		writeError(writer, err)
 		return
 	}
 
-	e.Encode(&output{Data: out})
-	return
+	writeOutput(writer, request, out)
+}
+
+func writeError(writer http.ResponseWriter, err error) {
+	kind := kindOf(err)
+	writer.Header().Set("Content-Type", jsonContentType)
+	writer.WriteHeader(kind.status)
+	json.NewEncoder(writer).Encode(&output{Error: err.Error(), Code: kind.name})
+}
+
+// requestBodyError converts body read errors, exceeded body limit is ErrTooLarge
+func requestBodyError(err error) error {
+	if _, ok := err.(*http.MaxBytesError); ok {
+		return tooLarge(err.Error())
+	}
+	return err
+}
+
+func writeOutput(writer http.ResponseWriter, request *http.Request, out interface{}) {
+	e := json.NewEncoder(writer)
+	writer.Header().Set("Content-Type", jsonContentType)
+
+	switch data := out.(type) {
+	case ListStream:
+		if isNdjson(request) {
+			writer.Header().Set("Content-Type", ndjsonContentType)
+			data(func(elem string) error {
+				return e.Encode(elem)
+			})
+			return
+		}
+		writeJsonStream(writer, '[', ']', func(write func(v ...interface{}) error) error {
+			return data(func(elem string) error {
+				return write(elem)
+			})
+		})
+	case DictStream:
+		if isNdjson(request) {
+			writer.Header().Set("Content-Type", ndjsonContentType)
+			data(func(key string, value string) error {
+				return e.Encode(&pair{key, value})
+			})
+			return
+		}
+		writeJsonStream(writer, '{', '}', func(write func(v ...interface{}) error) error {
+			return data(func(key string, value string) error {
+				return write(key, value)
+			})
+		})
+	default:
+		e.Encode(&output{Data: out})
+	}
+}
+
+func isNdjson(request *http.Request) bool {
+	return request.URL.Query().Get("format") == "ndjson" || request.Header.Get("Accept") == ndjsonContentType
 }
 
+// writeJsonStream writes {"data":<open>...<close>} without buffering whole data,
+// values passed to write callback are separated by "," or ":" for dictionary pairs
+func writeJsonStream(writer io.Writer, open byte, close byte, fn func(write func(v ...interface{}) error) error) error {
+	_, err := writer.Write(append([]byte(`{"data":`), open))
+	if err != nil {
+		return err
+	}
+
+	first := true
+	err = fn(func(v ...interface{}) error {
+		buff := []byte{}
+		if !first {
+			buff = append(buff, ',')
+		}
+		first = false
+
+		for i, elem := range v {
+			if i > 0 {
+				buff = append(buff, ':')
+			}
+			data, err := json.Marshal(elem)
+			if err != nil {
+				return err
+			}
+			buff = append(buff, data...)
+		}
+		_, err := writer.Write(buff)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write([]byte{close, '}', '\n'})
+	return err
+}
+
+// ListenSecure serves TLS connections with client certificates verification, certificate and key files
+// are reloaded on modification or by ReloadTLS
 func (s *httpServer) ListenSecure(certPath string, keyPath string) error {
-	tlsConfig, err := getTLS(certPath)
+	r, err := newCertReloader(certPath, keyPath)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	tlsConfig.BuildNameToCertificate()
+	s.server.TLSConfig = r.tlsConfig()
+	s.certs.Store(r)
+	go r.watch(s.ctx, certWatchInterval, instanceOf(s.cache).log())
+	s.setLogger()
 
-	s.server.TLSConfig = tlsConfig
+	return s.server.ListenAndServeTLS("", "")
+}
 
-	return s.server.ListenAndServeTLS(certPath, keyPath)
+// ReloadTLS loads certificate, key and client CA pool of ListenSecure, open connections are not dropped.
+// Previous certificates are kept on error
+func (s *httpServer) ReloadTLS() error {
+	return reloadTLS(s.certs.Load())
 }
 
 func (s *httpServer) Listen() error {
+	s.setLogger()
 	return s.server.ListenAndServe()
 }
+
+// setLogger sets logger of http server errors and logs server start
+func (s *httpServer) setLogger() {
+	logger := instanceOf(s.cache).log()
+	s.server.ErrorLog = slog.NewLogLogger(logger.Handler(), slog.LevelWarn)
+	logger.Info("Server is listening", "addr", s.server.Addr, "transport", transportHTTP)
+}
@@ -0,0 +1,397 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	dictSeparator = ":"
+)
+
+var (
+	incorrectBodyError     = badRequest("Incorrect request body")
+	incorrectElementError  = badRequest("List and dictionary elements can not be empty or contain whitespaces")
+	incorrectDictKeyError  = badRequest("Dictionary key can not contain separator")
+	unsupportedContentType = badRequest("Unsupported content type")
+)
+
+func (s *httpServer) restRoutes(routes *router) {
+	routes.handle(http.MethodGet, "/keys", s.restKeys)
+
+	routes.handle(http.MethodGet, "/keys/{key}", s.restGet(cmdGetLex))
+	routes.handle(http.MethodPut, "/keys/{key}", s.restSet)
+	routes.handle(http.MethodDelete, "/keys/{key}", s.restRemove)
+
+	routes.handle(http.MethodGet, "/lists/{key}", s.restGet(cmdGetListLex))
+	routes.handle(http.MethodPut, "/lists/{key}", s.restSetList)
+	routes.handle(http.MethodDelete, "/lists/{key}", s.restRemove)
+	routes.handle(http.MethodGet, "/lists/{key}/{index}", s.restGetListElem)
+	routes.handle(http.MethodPut, "/lists/{key}/{index}", s.restSetListElem)
+	routes.handle(http.MethodDelete, "/lists/{key}/{index}", s.restRemoveListElem)
+
+	routes.handle(http.MethodGet, "/dicts/{key}", s.restGet(cmdGetDictLex))
+	routes.handle(http.MethodPut, "/dicts/{key}", s.restSetDict)
+	routes.handle(http.MethodDelete, "/dicts/{key}", s.restRemove)
+	routes.handle(http.MethodGet, "/dicts/{key}/{field}", s.restGetDictElem)
+	routes.handle(http.MethodPut, "/dicts/{key}/{field}", s.restSetDictElem)
+	routes.handle(http.MethodDelete, "/dicts/{key}/{field}", s.restRemoveDictElem)
+
+	routes.handle(http.MethodGet, "/streams/{key}", s.restStreamRange)
+	routes.handle(http.MethodPost, "/streams/{key}", s.restStreamAdd)
+	routes.handle(http.MethodDelete, "/streams/{key}", s.restRemove)
+}
+
+func (s *httpServer) restKeys(writer http.ResponseWriter, request *http.Request) {
+	s.restExe(writer, request, &baseCommandParser{cmd: cmdKeysLex})
+}
+
+func (s *httpServer) restGet(cmd string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		s.restExe(writer, request, &baseCommandParser{cmd: cmd, key: request.PathValue("key")})
+	}
+}
+
+func (s *httpServer) restGetListElem(writer http.ResponseWriter, request *http.Request) {
+	index := request.PathValue("index")
+	if _, err := strconv.ParseUint(index, 10, 16); err != nil {
+		writeError(writer, incorrectListIndexError)
+		return
+	}
+
+	s.restExe(writer, request, &baseCommandParser{cmd: cmdGetListElemLex, key: request.PathValue("key"), value: []byte(index)})
+}
+
+func (s *httpServer) restGetDictElem(writer http.ResponseWriter, request *http.Request) {
+	s.restExe(writer, request, &baseCommandParser{cmd: cmdGetDictElemLex, key: request.PathValue("key"), value: []byte(request.PathValue("field"))})
+}
+
+// restSetListElem replaces list element by raw value or JSON string
+func (s *httpServer) restSetListElem(writer http.ResponseWriter, request *http.Request) {
+	index := request.PathValue("index")
+	if _, err := strconv.ParseUint(index, 10, 16); err != nil {
+		writeError(writer, incorrectListIndexError)
+		return
+	}
+
+	value, err := readElement(request, index)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	s.restExe(writer, request, &baseCommandParser{cmd: cmdSetListElemLex, key: request.PathValue("key"), value: value})
+}
+
+func (s *httpServer) restRemoveListElem(writer http.ResponseWriter, request *http.Request) {
+	index := request.PathValue("index")
+	if _, err := strconv.ParseUint(index, 10, 16); err != nil {
+		writeError(writer, incorrectListIndexError)
+		return
+	}
+
+	s.restExe(writer, request, &baseCommandParser{cmd: cmdRemoveListElemLex, key: request.PathValue("key"), value: []byte(index)})
+}
+
+// restSetDictElem sets dictionary field by raw value or JSON string, dictionary is created if not exists
+func (s *httpServer) restSetDictElem(writer http.ResponseWriter, request *http.Request) {
+	field := request.PathValue("field")
+	if strings.Contains(field, dictSeparator) {
+		writeError(writer, incorrectDictKeyError)
+		return
+	}
+
+	value, err := readElement(request, field)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	s.restExe(writer, request, &baseCommandParser{cmd: cmdSetDictElemLex, key: request.PathValue("key"), value: value})
+}
+
+func (s *httpServer) restRemoveDictElem(writer http.ResponseWriter, request *http.Request) {
+	s.restExe(writer, request, &baseCommandParser{cmd: cmdRemoveDictElemLex, key: request.PathValue("key"), value: []byte(request.PathValue("field"))})
+}
+
+func (s *httpServer) restRemove(writer http.ResponseWriter, request *http.Request) {
+	s.restExe(writer, request, &baseCommandParser{cmd: cmdRemoveLex, key: request.PathValue("key")})
+}
+
+// restSet accepts raw value or JSON string
+func (s *httpServer) restSet(writer http.ResponseWriter, request *http.Request) {
+	value, err := readValue(request)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	s.restSetValue(writer, request, cmdSetLex, value)
+}
+
+// restSetList accepts JSON array of strings or new line separated raw elements
+func (s *httpServer) restSetList(writer http.ResponseWriter, request *http.Request) {
+	var values []string
+	err := readBody(request, func(body []byte) error {
+		return json.Unmarshal(body, &values)
+	}, func(body []byte) error {
+		values = splitLines(body)
+		return nil
+	})
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	value, err := joinElements(values)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	s.restSetValue(writer, request, cmdSetListLex, value)
+}
+
+// restSetDict accepts JSON object or new line separated raw "key:value" elements
+func (s *httpServer) restSetDict(writer http.ResponseWriter, request *http.Request) {
+	var values []string
+	err := readBody(request, func(body []byte) error {
+		dict := map[string]string{}
+		if err := json.Unmarshal(body, &dict); err != nil {
+			return err
+		}
+
+		for k, v := range dict {
+			if strings.Contains(k, dictSeparator) {
+				return incorrectDictKeyError
+			}
+			values = append(values, k+dictSeparator+v)
+		}
+		sort.Strings(values)
+		return nil
+	}, func(body []byte) error {
+		values = splitLines(body)
+		return nil
+	})
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	value, err := joinElements(values)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	s.restSetValue(writer, request, cmdSetDictLex, value)
+}
+
+// restStreamRange returns entries by start, end and count query parameters, reverse=true returns newest first
+func (s *httpServer) restStreamRange(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	start, end := query.Get("start"), query.Get("end")
+	if start == "" {
+		start = streamFirst
+	}
+	if end == "" {
+		end = streamLast
+	}
+
+	cmd := cmdXRangeLex
+	if reverse, _ := strconv.ParseBool(query.Get("reverse")); reverse {
+		cmd, start, end = cmdXRevRangeLex, end, start
+	}
+
+	value := start + " " + end
+	if count := query.Get("count"); count != "" {
+		value += " " + streamCount + " " + count
+	}
+
+	s.restExe(writer, request, &baseCommandParser{cmd: cmd, key: request.PathValue("key"), value: []byte(value)})
+}
+
+// restStreamAdd appends entry of JSON object or new line separated raw "field:value" pairs,
+// maxlen query parameter trims stream
+func (s *httpServer) restStreamAdd(writer http.ResponseWriter, request *http.Request) {
+	var values []string
+	err := readBody(request, func(body []byte) error {
+		fields := map[string]string{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return err
+		}
+
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values = append(values, k, fields[k])
+		}
+		return nil
+	}, func(body []byte) error {
+		for _, line := range splitLines(body) {
+			field, value, ok := strings.Cut(line, dictSeparator)
+			if !ok {
+				return incorrectBodyError
+			}
+			values = append(values, field, value)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	fields, err := joinElements(values)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	value := streamAutoID + " " + string(fields)
+	if maxLen := request.URL.Query().Get("maxlen"); maxLen != "" {
+		value = streamMaxLen + " " + maxLen + " " + value
+	}
+
+	s.restExe(writer, request, &baseCommandParser{cmd: cmdXAddLex, key: request.PathValue("key"), value: []byte(value)})
+}
+
+func (s *httpServer) restSetValue(writer http.ResponseWriter, request *http.Request, cmd string, value []byte) {
+	parser := &baseCommandParser{cmd: cmd, key: request.PathValue("key"), value: value}
+
+	if ttl := request.URL.Query().Get("ttl"); ttl != "" {
+		var err error
+		parser.ttl, _, err = parseTTL([]byte(ttl + " "))
+		if err == notTTl {
+			err = badRequest("Incorrect ttl: " + ttl)
+		}
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+	}
+
+	s.restExe(writer, request, parser)
+}
+
+func (s *httpServer) restExe(writer http.ResponseWriter, request *http.Request, parser *baseCommandParser) {
+	if len(parser.key) > maxKeyLength {
+		writeError(writer, longKeyNameError)
+		return
+	}
+	//REST value is not a part of text command, body is stored byte-for-byte
+	parser.headerParsed = true
+	parser.raw = true
+
+	out, err := ExeStreamContext(request.Context(), s.cache, parser)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	if out == nil {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if str, ok := out.(string); ok && request.Header.Get("Accept") == octetContentType {
+		writer.Header().Set("Content-Type", octetContentType)
+		io.WriteString(writer, str)
+		return
+	}
+
+	writeOutput(writer, request, out)
+}
+
+// readBody reads request body and passes it to decoder by content type,
+// body without content type is raw
+func readBody(request *http.Request, jsonDecoder func(body []byte) error, rawDecoder func(body []byte) error) error {
+	defer request.Body.Close()
+
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return requestBodyError(err)
+	}
+
+	contentType := request.Header.Get("Content-Type")
+	if contentType == "" {
+		return rawDecoder(body)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return unsupportedContentType
+	}
+
+	switch mediaType {
+	case jsonContentType:
+		if jsonDecoder(body) != nil {
+			return incorrectBodyError
+		}
+		return nil
+	case octetContentType, "text/plain":
+		return rawDecoder(body)
+	default:
+		return unsupportedContentType
+	}
+}
+
+// readValue reads raw value or JSON string of request body
+func readValue(request *http.Request) ([]byte, error) {
+	var value []byte
+	err := readBody(request, func(body []byte) error {
+		var str string
+		err := json.Unmarshal(body, &str)
+		value = []byte(str)
+		return err
+	}, func(body []byte) error {
+		value = body
+		return nil
+	})
+	return value, err
+}
+
+// readElement reads list or dictionary element of request body and returns command value of index or field and element
+func readElement(request *http.Request, position string) ([]byte, error) {
+	value, err := readValue(request)
+	if err != nil {
+		return nil, err
+	}
+	return joinElements([]string{position, string(bytes.TrimSpace(value))})
+}
+
+func splitLines(body []byte) []string {
+	out := []string{}
+	for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+		out = append(out, string(bytes.TrimSpace(line)))
+	}
+	return out
+}
+
+// joinElements joins list elements to command value, elements are separated by whitespace
+func joinElements(values []string) ([]byte, error) {
+	if len(values) == 0 {
+		return nil, incorrectBodyError
+	}
+
+	value := []byte{}
+	for i, elem := range values {
+		if elem == "" || bytes.ContainsAny([]byte(elem), " \t\r\n") {
+			return nil, incorrectElementError
+		}
+		if i > 0 {
+			value = append(value, ' ')
+		}
+		value = append(value, elem...)
+	}
+	return value, nil
+}
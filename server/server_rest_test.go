@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestRestRoutes(t *testing.T) {
+	type (
+		testCase struct {
+			method      string
+			url         string
+			contentType string
+			body        string
+			code        int
+			response    string
+		}
+	)
+
+	testCases := []*testCase{
+		{"PUT", "/keys/foo?ttl=10", "", "hello world", http.StatusNoContent, ""},
+		{"GET", "/keys/foo", "", "", http.StatusOK, `{"data":"hello world"}`},
+		{"PUT", "/keys/bar", "application/json", `"json value"`, http.StatusNoContent, ""},
+		{"GET", "/keys/bar", "", "", http.StatusOK, `{"data":"json value"}`},
+		{"PUT", "/keys/spaced", "application/octet-stream", "  a b \n", http.StatusNoContent, ""},
+		{"GET", "/keys/spaced", "", "", http.StatusOK, `{"data":"  a b \n"}`},
+		{"PUT", "/lists/list", "application/json", `["a","b","c"]`, http.StatusNoContent, ""},
+		{"PUT", "/lists/rawlist", "application/octet-stream", "a\nb\n", http.StatusNoContent, ""},
+		{"GET", "/lists/list", "", "", http.StatusOK, `{"data":["a","b","c"]}`},
+		{"GET", "/lists/rawlist/1", "", "", http.StatusOK, `{"data":"b"}`},
+		{"PUT", "/dicts/dict", "application/json", `{"z":"1","a":"2"}`, http.StatusNoContent, ""},
+		{"GET", "/dicts/dict", "", "", http.StatusOK, `{"data":{"a":"2","z":"1"}}`},
+		{"GET", "/dicts/dict/z", "", "", http.StatusOK, `{"data":"1"}`},
+		{"PUT", "/lists/list/1", "", "bb", http.StatusNoContent, ""},
+		{"DELETE", "/lists/list/0", "", "", http.StatusNoContent, ""},
+		{"GET", "/lists/list", "", "", http.StatusOK, `{"data":["bb","c"]}`},
+		{"PUT", "/lists/list/5", "", "x", http.StatusNotFound, `{"error":"Not found","code":"not_found"}`},
+		{"PUT", "/lists/list/0", "", "a b", http.StatusBadRequest, `{"error":"List and dictionary elements can not be empty or contain whitespaces","code":"bad_request"}`},
+		{"PUT", "/dicts/dict/m", "application/json", `"3"`, http.StatusNoContent, ""},
+		{"DELETE", "/dicts/dict/a", "", "", http.StatusNoContent, ""},
+		{"GET", "/dicts/dict", "", "", http.StatusOK, `{"data":{"m":"3","z":"1"}}`},
+		{"DELETE", "/dicts/dict/a", "", "", http.StatusNotFound, `{"error":"Not found","code":"not_found"}`},
+		{"PUT", "/dicts/newdict/a%2Fb", "", "1", http.StatusNoContent, ""},
+		{"GET", "/dicts/newdict/a%2Fb", "", "", http.StatusOK, `{"data":"1"}`},
+		{"PUT", "/dicts/dict/a:b", "", "1", http.StatusBadRequest, `{"error":"Dictionary key can not contain separator","code":"bad_request"}`},
+		{"POST", "/keys/foo", "", "", http.StatusMethodNotAllowed, "Method Not Allowed"},
+		{"DELETE", "/keys/foo", "", "", http.StatusNoContent, ""},
+		{"POST", "/", "", "GET bar", http.StatusOK, `{"data":"json value"}`},
+		{"GET", "/keys/foo", "", "", http.StatusNotFound, `{"error":"Not found","code":"not_found"}`},
+		{"GET", "/keys/list", "", "", http.StatusConflict, `{"error":"Incorrect select key type","code":"wrong_type"}`},
+		{"PUT", "/keys/foo?ttl=0", "", "value", http.StatusBadRequest, `{"error":"TTL can not be zero","code":"bad_request"}`},
+		{"GET", "/lists/list/x", "", "", http.StatusBadRequest, `{"error":"Incorrect list index","code":"bad_request"}`},
+		{"POST", "/", "", "FOO bar", http.StatusBadRequest, `{"error":"Incorrect command name","code":"bad_request"}`},
+		{"PUT", "/dicts/dict", "", "foo", http.StatusBadRequest, `{"error":"Incorrect dictionary element","code":"bad_request"}`},
+		{"POST", "/", "", "XADD stream 9999999999999-1 a 1", http.StatusOK, `{"data":"9999999999999-1"}`},
+		{"POST", "/streams/stream", "application/json", `{"b":"2","a":"1"}`, http.StatusOK, `{"data":"9999999999999-2"}`},
+		{"GET", "/streams/stream?start=9999999999999-2", "", "", http.StatusOK, `{"data":["9999999999999-2 a 1 b 2"]}`},
+		{"GET", "/streams/stream?reverse=true&count=1", "", "", http.StatusOK, `{"data":["9999999999999-2 a 1 b 2"]}`},
+		{"POST", "/streams/stream", "", "a", http.StatusBadRequest, `{"error":"Incorrect request body","code":"bad_request"}`},
+	}
+
+	s := NewHttpServer(kv.NewCacheDb(), "127.0.0.1", 0)
+	for _, tc := range testCases {
+		request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			request.Header.Set("Content-Type", tc.contentType)
+		}
+
+		writer := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(writer, request)
+
+		if writer.Code != tc.code {
+			t.Fatal("Incorrect status", tc.method, tc.url, "expected", tc.code, "got", writer.Code)
+		}
+
+		if strings.TrimSpace(writer.Body.String()) != tc.response {
+			t.Fatal("Incorrect response", tc.method, tc.url, "expected", tc.response, "got", writer.Body.String())
+		}
+	}
+
+	request := httptest.NewRequest("GET", "/keys/bar", nil)
+	request.Header.Set("Accept", octetContentType)
+	writer := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(writer, request)
+
+	if writer.Body.String() != "json value" || writer.Header().Get("Content-Type") != octetContentType {
+		t.Fatal("Incorrect raw response", "got", writer.Header().Get("Content-Type"), writer.Body.String())
+	}
+}
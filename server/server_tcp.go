@@ -1,16 +1,21 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/tls"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
-	"crypto/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
 )
 
 type (
@@ -19,47 +24,261 @@ type (
 		addr            string
 		port            int
 		isHumanListener bool
+		// idleTimeout limits wait of the next request and response write, zero disables timeout
+		idleTimeout atomic.Int64
+
+		// ctx is done on server shutdown, it interrupts blocking commands
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		lock     sync.Mutex
+		listener net.Listener
+		// conns are open connections, value is true for connection which executes request
+		conns    map[net.Conn]bool
+		shutdown bool
+		// maxConns is a maximum count of open connections, zero is unlimited
+		maxConns int
+
+		// certs are set by ListenSecure
+		certs atomic.Pointer[certReloader]
 	}
 )
 
 const (
-	clientHeader   = 0x11
-	okHeader       = 0x22
-	notFoundHeader = 0x44
-	errHeader      = 0x99
-
-	dataTypeNone   = 0x50
-	dataTypeString = 0x51
-	dataTypeList   = 0x52
-	dataTypeDict   = 0x53
+	shutdownPollInterval = 10 * time.Millisecond
+	defaultIdleTimeout   = time.Minute
+	maxAcceptDelay       = time.Second
+)
+
+var (
+	maxConnectionsError = kv.NewError(ErrMaxClients, "Maximum connections count is reached")
 )
 
 func NewTcpServer(cache *kv.CacheDb, addr string, port int) *tcpServer {
-	return &tcpServer{
-		addr:  addr,
-		port:  port,
-		cache: cache,
+	ctx, cancel := context.WithCancel(withTransport(context.Background(), transportTCP))
+	s := &tcpServer{
+		addr:   addr,
+		port:   port,
+		cache:  cache,
+		ctx:    ctx,
+		cancel: cancel,
+		conns:  map[net.Conn]bool{},
+	}
+	s.idleTimeout.Store(int64(defaultIdleTimeout))
+	return s
+}
+
+// SetIdleTimeout sets timeout of waiting for the next client request and of response write, zero disables timeout
+func (s *tcpServer) SetIdleTimeout(timeout time.Duration) {
+	s.idleTimeout.Store(int64(timeout))
+}
+
+func (s *tcpServer) IdleTimeout() time.Duration {
+	return time.Duration(s.idleTimeout.Load())
+}
+
+// SetMaxConnections limits count of open connections, exceeding connection receives error and is closed.
+// Zero is unlimited
+func (s *tcpServer) SetMaxConnections(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.maxConns = n
+}
+
+func (s *tcpServer) MaxConnections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.maxConns
+}
+
+// Close stops accepting connections and closes all connections without waiting for requests in progress
+func (s *tcpServer) Close() error {
+	err := s.stopListener()
+	s.cancel()
+	s.closeConns(true)
+	return err
+}
+
+// Shutdown stops accepting connections, interrupts blocking commands and closes idle connections.
+// Connections which execute requests are closed after response, connections left when ctx is done are closed
+func (s *tcpServer) Shutdown(ctx context.Context) error {
+	s.stopListener()
+	s.cancel()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeConns(false) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			s.closeConns(true)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopListener marks server as shutting down and closes listener
+func (s *tcpServer) stopListener() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.shutdown = true
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// closeConns closes idle or all connections, returns count of left connections
+func (s *tcpServer) closeConns(all bool) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	left := 0
+	for conn, active := range s.conns {
+		if active && !all {
+			left++
+			continue
+		}
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return left
+}
+
+// trackConn registers accepted connection as idle,
+// returns error if server shuts down or maximum connections count is reached
+func (s *tcpServer) trackConn(ctx context.Context, conn net.Conn) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	inst := instanceOf(s.cache)
+	if s.shutdown {
+		return ErrServerClosed
 	}
+	if s.maxConns > 0 && len(s.conns) >= s.maxConns {
+		inst.loggerOf(ctx).Warn("Connection is rejected", "err", maxConnectionsError)
+		return maxConnectionsError
+	}
+	s.conns[conn] = false
+	inst.metrics.connected(s.transport(), s.listenAddr(), 1)
+	inst.loggerOf(ctx).Debug("Connection is opened")
+	return nil
+}
+
+func (s *tcpServer) untrackConn(ctx context.Context, conn net.Conn) {
+	inst := instanceOf(s.cache)
+	inst.metrics.connected(s.transport(), s.listenAddr(), -1)
+	inst.loggerOf(ctx).Debug("Connection is closed")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.conns, conn)
+}
+
+// setActive marks connection which executes request, idle connection is closed on shutdown.
+// It returns false if connection becomes idle while server shuts down
+func (s *tcpServer) setActive(conn net.Conn, active bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.conns[conn]; !ok {
+		return false
+	}
+	if !active && s.shutdown {
+		return false
+	}
+	s.conns[conn] = active
+	return true
 }
 
 func (s *tcpServer) IsHuman(b bool) {
 	s.isHumanListener = b
+	s.ctx = withTransport(s.ctx, s.transport())
+}
+
+func (s *tcpServer) listenAddr() string {
+	return fmt.Sprintf("%s:%d", s.addr, s.port)
+}
+
+func (s *tcpServer) transport() string {
+	if s.isHumanListener {
+		return transportNcat
+	}
+	return transportTCP
 }
 
 func (s *tcpServer) humanHandler(conn net.Conn) {
 	defer conn.Close()
+	ctx := instanceOf(s.cache).withConn(s.ctx, conn.RemoteAddr().String())
+	if err := s.trackConn(ctx, conn); err != nil {
+		if err == maxConnectionsError {
+			conn.SetWriteDeadline(s.deadline())
+			conn.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
+		}
+		return
+	}
+	defer s.untrackConn(ctx, conn)
+	if !s.certLogin(ctx, conn) {
+		return
+	}
+
+	//command is read until client closes write side of connection
+	conn.SetReadDeadline(s.deadline())
+	r := bufio.NewReader(conn)
+	if instanceOf(s.cache).checkAuth(ctx) != nil {
+		//the first line authenticates command of the rest of input: "AUTH user password\nGET key"
+		line, err := r.ReadSlice('\n')
+		if err != nil && err != io.EOF {
+			conn.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
+			return
+		}
+		auth := &baseCommandParser{}
+		if _, err = auth.Write(bytes.TrimSpace(line)); err == nil {
+			_, err = ExeContext(ctx, s.cache, auth)
+		}
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
+			return
+		}
+	}
 
 	parser := &baseCommandParser{}
-	_, err := io.Copy(parser, conn)
+	_, err := io.Copy(parser, r)
 	if err != nil {
 		conn.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
 		return
 	}
-	//log.Printf("CMD: %+v", parser)
+	if !s.setActive(conn, true) {
+		return
+	}
+	conn.SetWriteDeadline(s.deadline())
 
-	out, err := Exe(s.cache, parser)
+	if parser.cmd == cmdMonitorLex {
+		if err := instanceOf(s.cache).checkAccess(ctx, parser); err != nil {
+			conn.Write([]byte(fmt.Sprintf("Error: %s", err.Error())))
+			return
+		}
+		if !s.setActive(conn, false) {
+			return
+		}
+		//closed client is detected by failed write
+		s.monitorMode(ctx, nil, func(line string) error {
+			conn.SetWriteDeadline(s.deadline())
+			_, err := conn.Write([]byte(line + "\n"))
+			return err
+		})
+		return
+	}
+
+	out, err := ExeContext(ctx, s.cache, parser)
 	if err != nil {
-		if err == notFoundErr {
+		if errors.Is(err, ErrNotFound) {
 			conn.Write([]byte("not found"))
 			return
 		}
@@ -85,132 +304,375 @@ func (s *tcpServer) humanHandler(conn net.Conn) {
 func (s *tcpServer) clientHandler(conn net.Conn) {
 	defer conn.Close()
 
-	conn.SetReadDeadline(time.Now().Add(time.Minute))
-	conn.SetWriteDeadline(time.Now().Add(time.Minute))
+	e := protocol.NewEncoder(conn)
+	connCtx := instanceOf(s.cache).withConn(s.ctx, conn.RemoteAddr().String())
+	if err := s.trackConn(connCtx, conn); err != nil {
+		if err == maxConnectionsError {
+			conn.SetWriteDeadline(s.deadline())
+			encodeError(e, err)
+		}
+		return
+	}
+	defer s.untrackConn(connCtx, conn)
+	if !s.certLogin(connCtx, conn) {
+		return
+	}
 
+	d := protocol.NewDecoder(conn)
+	d.SetMaxLength(maxRequestLength)
+
+	//asking is set by ASKING for the next command
+	asking := false
 	for {
-		header := make([]byte, 5)
-		n, err := conn.Read(header)
+		if !s.setActive(conn, false) {
+			return
+		}
+
+		conn.SetReadDeadline(s.deadline())
+		cmd, stream, err := d.DecodeRequest()
+		if err == protocol.ErrTooLarge {
+			instanceOf(s.cache).loggerOf(connCtx).Warn("Request is too large")
+			encodeError(e, tooLarge(fmt.Sprintf("Maximum request length is %d", maxRequestLength)))
+			return
+		}
 		if err != nil {
 			return
 		}
+		if !s.setActive(conn, true) {
+			return
+		}
+		conn.SetWriteDeadline(s.deadline())
 
-		if n != 5 {
-			_, err := conn.Write(errPack(errors.New(fmt.Sprintf("Incorrect length read header, expected 5 got %d", n))))
-			if err != nil {
+		parser := &baseCommandParser{}
+		_, err = parser.Write(cmd)
+		if err != nil {
+			if encodeError(e, err) != nil {
 				return
 			}
 			continue
 		}
 
-		if header[0] != clientHeader {
-			return
+		//commands of connection modes are not executed by ExeContext, they are authorized here,
+		//other commands are authorized by ExeContext
+		if isSubscribeCommand(parser.cmd) || parser.cmd == cmdSyncLex || parser.cmd == cmdMonitorLex {
+			if err := instanceOf(s.cache).checkAccess(connCtx, parser); err != nil {
+				if encodeError(e, err) != nil {
+					return
+				}
+				continue
+			}
 		}
 
-		requestLen := bytesToUint32Convert(header[1:])
-		parser := &baseCommandParser{}
-		n1, err := io.CopyN(parser, conn, int64(requestLen))
-		if n1 != int64(requestLen) {
-			_, err := conn.Write(errPack(errors.New("Incorrect length read body")))
-			if err != nil {
+		//subscribers and replicas wait for data as idle connections
+		if isSubscribeCommand(parser.cmd) {
+			if !s.setActive(conn, false) || !s.subscribeMode(connCtx, conn, d, e, parser) {
 				return
 			}
 			continue
 		}
 
-		//log.Printf("CMD LEN: %d %d [% x]", requestLen, n, header[1:5])
-		if err != nil {
-			_, err := conn.Write(errPack(err))
-			if err != nil {
+		if parser.cmd == cmdSyncLex {
+			if !s.setActive(conn, false) {
+				return
+			}
+			s.syncReplica(conn, d, e, parser)
+			return
+		}
+
+		if parser.cmd == cmdMonitorLex {
+			if !s.setActive(conn, false) {
+				return
+			}
+			s.binaryMonitor(connCtx, conn, d, e)
+			return
+		}
+
+		if parser.cmd == cmdAskingLex {
+			asking = true
+			if e.Encode(nil) != nil {
 				return
 			}
 			continue
 		}
 
-		//log.Printf("CMD: %+v %+v", parser, err)
+		ctx := connCtx
+		if asking {
+			ctx, asking = withAsking(ctx), false
+		}
+
+		var out interface{}
+		switch {
+		case blockingCommands[parser.cmd]:
+			out, err = s.exeBlocking(ctx, conn, d, parser)
+		case stream:
+			out, err = ExeStreamContext(ctx, s.cache, parser)
+		default:
+			out, err = ExeContext(ctx, s.cache, parser)
+		}
+
+		//response write deadline starts after command execution
+		conn.SetWriteDeadline(s.deadline())
+		if err != nil {
+			err = encodeError(e, err)
+		} else {
+			err = encodeResponse(e, out)
+		}
 
-		out, err := Exe(s.cache, parser)
 		if err != nil {
-			if err == notFoundErr {
-				_, err := conn.Write([]byte{notFoundHeader})
-				if err != nil {
+			return
+		}
+	}
+}
+
+// exeBlocking executes blocking command, command is interrupted if client disconnects
+func (s *tcpServer) exeBlocking(ctx context.Context, conn net.Conn, d *protocol.Decoder, parser *baseCommandParser) (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conn.SetReadDeadline(time.Time{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		//pipelined request is kept buffered, read error means client is gone
+		if d.Peek() != nil {
+			cancel()
+		}
+	}()
+
+	out, err := ExeContext(ctx, s.cache, parser)
+
+	//interrupt peek, read deadline is restored before the next request
+	conn.SetReadDeadline(time.Now())
+	<-done
+	return out, err
+}
+
+// subscribeMode serves connection in subscribe mode until all subscriptions are removed,
+// returns false if connection has to be closed
+func (s *tcpServer) subscribeMode(ctx context.Context, conn net.Conn, d *protocol.Decoder, e *protocol.Encoder, parser *baseCommandParser) bool {
+	inst := instanceOf(s.cache)
+	ps := inst.pubsub
+	sub := newSubscriber()
+	sub.allowed = inst.notificationFilter(ctx)
+	defer ps.remove(sub)
+
+	conn.SetReadDeadline(time.Time{})
+
+	lock := sync.Mutex{}
+	write := func(fn func() error) error {
+		lock.Lock()
+		defer lock.Unlock()
+		conn.SetWriteDeadline(s.deadline())
+		return fn()
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-sub.slow:
+				//slow consumer is disconnected
+				inst.loggerOf(ctx).Warn("Slow subscriber is disconnected")
+				conn.Close()
+				return
+			case message := <-sub.c:
+				if write(func() error { return e.EncodePush(message) }) != nil {
+					conn.Close()
 					return
 				}
-				continue
-			}
-			_, err = conn.Write(errPack(err))
-			if err != nil {
-				return
 			}
-			continue
 		}
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
 
-		switch data := out.(type) {
-		case string:
-			buff := []byte{okHeader, dataTypeString}
-			lenPack := uint32ToBytesConvert(uint32(len(data)))
-			buff = append(buff, lenPack...)
-			buff = append(buff, []byte(data)...)
-
-			_, err := conn.Write(buff)
+	for {
+		if parser != nil {
+			acks, err := subscribeCommand(ps, sub, parser)
 			if err != nil {
-				return
+				err = write(func() error { return encodeError(e, err) })
 			}
-		case []string:
-			lenPack := uint32ToBytesConvert(uint32(len(data)))
-			_, err := conn.Write(append([]byte{okHeader, dataTypeList}, lenPack...))
+			for _, ack := range acks {
+				if err == nil {
+					err = write(func() error { return e.EncodePush(ack) })
+				}
+			}
+
 			if err != nil {
-				return
+				return false
 			}
 
-			buff := []byte{}
-			for _, e := range data {
-				lenPack := uint32ToBytesConvert(uint32(len(e)))
-				buff = append(buff, lenPack...)
-				buff = append(buff, []byte(e)...)
+			if sub.count() == 0 {
+				return true
 			}
+		}
 
-			_, err = conn.Write(buff)
-			if err != nil {
-				return
+		cmd, _, err := d.DecodeRequest()
+		if err != nil {
+			return false
+		}
+
+		parser = &baseCommandParser{}
+		_, err = parser.Write(cmd)
+		if err == nil {
+			//permissions may be changed by users reload
+			err = inst.checkAccess(ctx, parser)
+		}
+		if err != nil {
+			parser = nil
+			if write(func() error { return encodeError(e, err) }) != nil {
+				return false
 			}
+		}
+	}
+}
 
-		case map[string]string:
-			lenPack := uint32ToBytesConvert(uint32(len(data)))
-			_, err := conn.Write(append([]byte{okHeader, dataTypeDict}, lenPack...))
-			if err != nil {
+// binaryMonitor answers MONITOR and pushes "monitor", command messages until connection is closed,
+// other requests are rejected
+func (s *tcpServer) binaryMonitor(ctx context.Context, conn net.Conn, d *protocol.Decoder, e *protocol.Encoder) {
+	conn.SetReadDeadline(time.Time{})
+
+	lock := sync.Mutex{}
+	write := func(fn func() error) error {
+		lock.Lock()
+		defer lock.Unlock()
+		conn.SetWriteDeadline(s.deadline())
+		return fn()
+	}
+
+	if write(func() error { return e.Encode(nil) }) != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		//read error means client is gone
+		for {
+			if _, _, err := d.DecodeRequest(); err != nil {
+				return
+			}
+			if write(func() error { return encodeError(e, monitorModeError) }) != nil {
 				return
 			}
+		}
+	}()
 
-			buff := []byte{}
-			for k, v := range data {
-				lenPack := uint32ToBytesConvert(uint32(len(k)))
-				buff = append(buff, lenPack...)
-				buff = append(buff, []byte(k)...)
+	s.monitorMode(ctx, closed, func(line string) error {
+		return write(func() error { return e.EncodePush([]string{pushMonitor, line}) })
+	})
+}
 
-				lenPack = uint32ToBytesConvert(uint32(len(v)))
-				buff = append(buff, lenPack...)
-				buff = append(buff, []byte(v)...)
-			}
+// monitorMode sends every executed command until send fails, closed is done, monitor is slow or server is shut down
+func (s *tcpServer) monitorMode(ctx context.Context, closed <-chan struct{}, send func(line string) error) {
+	inst := instanceOf(s.cache)
+	m := inst.monitors
+	mon := newMonitor()
+	m.add(mon)
+	defer m.remove(mon)
 
-			_, err = conn.Write(buff)
-			if err != nil {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			return
+		case <-mon.slow:
+			inst.loggerOf(ctx).Warn("Slow monitor is disconnected")
+			return
+		case line := <-mon.c:
+			if send(line) != nil {
 				return
 			}
-		default:
-			conn.Write([]byte{okHeader, dataTypeNone})
 		}
 	}
 }
 
+func isSubscribeCommand(cmd string) bool {
+	switch cmd {
+	case cmdSubscribeLex, cmdUnsubscribeLex, cmdPSubscribeLex, cmdPUnsubscribeLex:
+		return true
+	default:
+		return false
+	}
+}
+
+// subscribeCommand applies subscribe mode command and returns push messages for client
+func subscribeCommand(ps *pubSub, sub *subscriber, parser *baseCommandParser) ([][]string, error) {
+	names := []string{}
+	if parser.key != "" {
+		names = append(names, parser.key)
+	}
+	names = append(names, strings.Fields(string(parser.value))...)
+
+	switch parser.cmd {
+	case cmdSubscribeLex:
+		return ps.subscribe(sub, names, false), nil
+	case cmdPSubscribeLex:
+		return ps.subscribe(sub, names, true), nil
+	case cmdUnsubscribeLex:
+		return ps.unsubscribe(sub, names, false), nil
+	case cmdPUnsubscribeLex:
+		return ps.unsubscribe(sub, names, true), nil
+	default:
+		return nil, subscribeModeError
+	}
+}
+
+func encodeResponse(e *protocol.Encoder, out interface{}) error {
+	switch data := out.(type) {
+	case ListStream:
+		e.BeginList()
+		err := data(e.EncodeElement)
+		if err != nil {
+			return err
+		}
+		return e.End()
+	case DictStream:
+		e.BeginDict()
+		err := data(e.EncodePair)
+		if err != nil {
+			return err
+		}
+		return e.End()
+	default:
+		return e.Encode(out)
+	}
+}
+
+// listenServ accepts connections until listener is closed, temporary accept errors are retried with backoff
 func (s *tcpServer) listenServ(l net.Listener) error {
+	var delay time.Duration
 	for {
 		// Listen for an incoming connection.
 		conn, err := l.Accept()
 		if err != nil {
-			conn.Close()
+			if s.isShutdown() {
+				return ErrServerClosed
+			}
+
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Temporary() {
+				return err
+			}
+
+			//too many open files or similar errors, accept is retried after delay
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+			instanceOf(s.cache).log().Warn("Accept error", "addr", s.listenAddr(), "err", err, "retry", delay)
+			time.Sleep(delay)
 			continue
 		}
+		delay = 0
 		if s.isHumanListener {
 			go s.humanHandler(conn)
 		} else {
@@ -219,56 +681,73 @@ func (s *tcpServer) listenServ(l net.Listener) error {
 	}
 }
 
-func (s *tcpServer) ListenSecure(certPath string, keyPath string) error {
-	tlsConfig, err := getTLS(certPath)
-	if err != nil {
-		return nil
+// serve accepts connections of listener until shutdown
+func (s *tcpServer) serve(l net.Listener) error {
+	s.lock.Lock()
+	if s.shutdown {
+		s.lock.Unlock()
+		return ErrServerClosed
 	}
+	s.listener = l
+	s.lock.Unlock()
+
+	instanceOf(s.cache).log().Info("Server is listening", "addr", l.Addr().String(), "transport", s.transport())
+
+	return s.listenServ(l)
+}
 
-	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+// deadline returns deadline of idle timeout from now, zero time if timeout is disabled
+func (s *tcpServer) deadline() time.Time {
+	timeout := s.IdleTimeout()
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+func (s *tcpServer) isShutdown() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.shutdown
+}
+
+// ListenSecure serves TLS connections with client certificates verification, certificate and key files
+// are reloaded on modification or by ReloadTLS
+func (s *tcpServer) ListenSecure(certPath string, keyPath string) error {
+	r, err := newCertReloader(certPath, keyPath)
 	if err != nil {
 		return err
 	}
 
-	tlsConfig.Certificates = []tls.Certificate{cert}
-	tlsConfig.Rand = rand.Reader
-
-	l, err := tls.Listen("tcp", fmt.Sprintf("%s:%d", s.addr, s.port), tlsConfig)
+	l, err := tls.Listen("tcp", s.listenAddr(), r.tlsConfig())
 	if err != nil {
 		return err
 	}
+	s.certs.Store(r)
+	go r.watch(s.ctx, certWatchInterval, instanceOf(s.cache).log())
 
 	defer l.Close()
-	s.listenServ(l)
-	return nil
+	return s.serve(l)
+}
+
+// ReloadTLS loads certificate, key and client CA pool of ListenSecure, open connections are not dropped.
+// Previous certificates are kept on error
+func (s *tcpServer) ReloadTLS() error {
+	return reloadTLS(s.certs.Load())
 }
 
 func (s *tcpServer) Listen() error {
-	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.addr, s.port))
+	l, err := net.Listen("tcp", s.listenAddr())
 	if err != nil {
 		return err
 	}
 	defer l.Close()
-	s.listenServ(l)
-
-	return nil
+	return s.serve(l)
 }
 
-func errPack(err error) []byte {
-	errResponse := []byte(fmt.Sprintf("Error: %s", err.Error()))
-	errLength := uint32ToBytesConvert(uint32(len(errResponse)))
-
-	out := append([]byte{errHeader}, errLength...)
-	return append(out, errResponse...)
-}
-
-func bytesToUint32Convert(data []byte) uint32 {
-	return binary.LittleEndian.Uint32(data[0:4])
-}
-
-func uint32ToBytesConvert(v uint32) []byte {
-	out := make([]byte, 4)
-	binary.LittleEndian.PutUint32(out, v)
-
-	return out
+func encodeError(e *protocol.Encoder, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return e.EncodeNotFound()
+	}
+	return e.EncodeError(kindOf(err).code, fmt.Sprintf("Error: %s", err.Error()))
 }
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+func TestShutdown(t *testing.T) {
+	cache := kv.NewCacheDb()
+	ts := NewTcpServer(cache, "127.0.0.1", 4514)
+	tsErr := make(chan error, 1)
+	go func() {
+		tsErr <- ts.Listen()
+	}()
+	hs := NewHttpServer(cache, "127.0.0.1", 4515)
+	hsErr := make(chan error, 1)
+	go func() {
+		hsErr <- hs.Listen()
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	idle, err := net.Dial("tcp", "127.0.0.1:4514")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer idle.Close()
+
+	//blocking command is interrupted by shutdown and answered
+	blocked, err := net.Dial("tcp", "127.0.0.1:4514")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer blocked.Close()
+	protocol.NewEncoder(blocked).EncodeRequest([]byte("BLPOP queue 0"))
+
+	events, err := http.Get("http://127.0.0.1:4515/events")
+	if err != nil {
+		t.Fatal("Events error", err.Error())
+	}
+	defer events.Body.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := ts.Shutdown(ctx); err != nil {
+		t.Fatal("Shutdown error", err.Error())
+	}
+	if err := hs.Shutdown(ctx); err != nil {
+		t.Fatal("Http shutdown error", err.Error())
+	}
+
+	if err := <-tsErr; err != ErrServerClosed {
+		t.Fatal("Incorrect listen error", "expected", ErrServerClosed, "got", err)
+	}
+	if err := <-hsErr; err != ErrServerClosed {
+		t.Fatal("Incorrect http listen error", "expected", ErrServerClosed, "got", err)
+	}
+
+	d := protocol.NewDecoder(blocked)
+	if _, err := d.DecodeResponse(); err == nil || !strings.HasSuffix(err.Error(), context.Canceled.Error()) {
+		t.Fatal("Incorrect blocked response", "expected", context.Canceled, "got", err)
+	}
+	if _, err := d.DecodeResponse(); err == nil {
+		t.Fatal("Expected closed connection")
+	}
+	if _, err := protocol.NewDecoder(idle).DecodeResponse(); err == nil {
+		t.Fatal("Expected closed idle connection")
+	}
+	if _, err := net.Dial("tcp", "127.0.0.1:4514"); err == nil {
+		t.Fatal("Expected closed listener")
+	}
+	if err := ts.Listen(); err != ErrServerClosed {
+		t.Fatal("Incorrect listen after shutdown error", "expected", ErrServerClosed, "got", err)
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	ts := NewTcpServer(kv.NewCacheDb(), "127.0.0.1", 4516)
+	ts.SetMaxConnections(1)
+	ts.SetIdleTimeout(time.Millisecond * 200)
+	tsErr := make(chan error, 1)
+	go func() {
+		tsErr <- ts.Listen()
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	request := func(conn net.Conn) error {
+		if err := protocol.NewEncoder(conn).EncodeRequest([]byte("GET key")); err != nil {
+			return err
+		}
+		_, err := protocol.NewDecoder(conn).DecodeResponse()
+		return err
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:4516")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer conn.Close()
+
+	//idle timeout is refreshed by every request
+	for i := 0; i < 3; i++ {
+		if err := request(conn); err != protocol.ErrNotFound {
+			t.Fatal("Incorrect response", "expected", protocol.ErrNotFound, "got", err)
+		}
+		time.Sleep(time.Millisecond * 150)
+	}
+
+	rejected, err := net.Dial("tcp", "127.0.0.1:4516")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer rejected.Close()
+	d := protocol.NewDecoder(rejected)
+	if _, err := d.DecodeResponse(); !isErrorCode(err, protocol.CodeMaxClients) {
+		t.Fatal("Incorrect rejection", "expected", maxConnectionsError, "got", err)
+	}
+	if _, err := d.DecodeResponse(); err == nil {
+		t.Fatal("Expected closed rejected connection")
+	}
+
+	time.Sleep(time.Millisecond * 300)
+	if err := request(conn); err == nil {
+		t.Fatal("Expected closed idle connection")
+	}
+
+	accepted, err := net.Dial("tcp", "127.0.0.1:4516")
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer accepted.Close()
+	if err := request(accepted); err != protocol.ErrNotFound {
+		t.Fatal("Incorrect response", "expected", protocol.ErrNotFound, "got", err)
+	}
+
+	ts.Close()
+	if err := <-tsErr; err != ErrServerClosed {
+		t.Fatal("Incorrect listen error", "expected", ErrServerClosed, "got", err)
+	}
+	if err := request(accepted); err == nil {
+		t.Fatal("Expected closed connection")
+	}
+}
+
+func isErrorCode(err error, code byte) bool {
+	e, ok := err.(*protocol.Error)
+	return ok && e.Code == code
+}
+
+func TestListenSecureError(t *testing.T) {
+	if err := NewTcpServer(kv.NewCacheDb(), "127.0.0.1", 4517).ListenSecure("missing.crt", "missing.key"); err == nil {
+		t.Fatal("Expected tcp certificate error")
+	}
+	if err := NewHttpServer(kv.NewCacheDb(), "127.0.0.1", 4518).ListenSecure("missing.crt", "missing.key"); err == nil {
+		t.Fatal("Expected http certificate error")
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+type (
+	// slowLog keeps the latest commands which execution exceeded threshold, newest entry is the last
+	slowLog struct {
+		lock      sync.Mutex
+		threshold time.Duration
+		maxLen    int
+		entries   []slowLogEntry
+		nextID    uint64
+	}
+
+	slowLogEntry struct {
+		id        uint64
+		time      time.Time
+		duration  time.Duration
+		client    string
+		transport string
+		args      []string
+	}
+
+	clientKey struct{}
+)
+
+const (
+	defaultSlowLogThreshold = 10 * time.Millisecond
+	defaultSlowLogMaxLen    = 128
+	defaultSlowLogCount     = 10
+
+	// maxLoggedArg is a maximum length of command key and value in slow log and monitor
+	maxLoggedArg = 128
+
+	slowLogGet   = "GET"
+	slowLogLen   = "LEN"
+	slowLogReset = "RESET"
+)
+
+var (
+	incorrectSlowLogError = badRequest("Incorrect slowlog subcommand")
+)
+
+func newSlowLog() *slowLog {
+	return &slowLog{
+		threshold: defaultSlowLogThreshold,
+		maxLen:    defaultSlowLogMaxLen,
+	}
+}
+
+// SetSlowLog sets execution duration of logged commands and maximum count of kept entries.
+// Zero threshold logs every command, negative threshold disables slow log
+func SetSlowLog(cache *kv.CacheDb, threshold time.Duration, maxLen int) {
+	l := instanceOf(cache).slowLog
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.threshold = threshold
+	l.maxLen = maxLen
+	l.trim()
+}
+
+func (l *slowLog) settings() (time.Duration, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.threshold, l.maxLen
+}
+
+// withClient marks ctx of commands received from client address
+func withClient(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, clientKey{}, addr)
+}
+
+func clientOf(ctx context.Context) string {
+	if addr, ok := ctx.Value(clientKey{}).(string); ok {
+		return addr
+	}
+	return ""
+}
+
+// add logs command if duration exceeds threshold. Blocking commands are not logged,
+// their duration is mostly waiting for elements
+func (l *slowLog) add(ctx context.Context, parser *baseCommandParser, duration time.Duration) {
+	if blockingCommands[parser.cmd] {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.threshold < 0 || duration < l.threshold || l.maxLen <= 0 {
+		return
+	}
+
+	l.entries = append(l.entries, slowLogEntry{
+		id:        l.nextID,
+		time:      time.Now(),
+		duration:  duration,
+		client:    clientOf(ctx),
+		transport: transportOf(ctx),
+		args:      commandArgs(parser),
+	})
+	l.nextID++
+	l.trim()
+}
+
+// trim removes the oldest entries over maxLen
+func (l *slowLog) trim() {
+	if over := len(l.entries) - l.maxLen; over > 0 {
+		l.entries = l.entries[over:]
+	}
+}
+
+// commandArgs returns command, key and value for logs, long key and value are truncated, AUTH password is redacted
+func commandArgs(parser *baseCommandParser) []string {
+	args := []string{parser.cmd}
+	value := string(parser.value)
+	if parser.cmd == cmdAuthLex && value != "" {
+		value = "(redacted)"
+	}
+	for _, arg := range []string{parser.key, value} {
+		if arg == "" {
+			continue
+		}
+		if len(arg) > maxLoggedArg {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:maxLoggedArg], len(arg)-maxLoggedArg)
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// String returns "<id> <unix time> <duration microseconds> <client> <transport> <command> [key] [value]",
+// client is "-" for embedded commands
+func (e slowLogEntry) String() string {
+	client := e.client
+	if client == "" {
+		client = "-"
+	}
+	return fmt.Sprintf("%d %d %d %s %s %s", e.id, e.time.Unix(), e.duration.Microseconds(), client, e.transport, strings.Join(e.args, " "))
+}
+
+// executeSlowLog executes slow log subcommands:
+//
+//	SLOWLOG GET [count]
+//	SLOWLOG LEN
+//	SLOWLOG RESET
+func executeSlowLog(cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
+	l := instanceOf(cache).slowLog
+	args := strings.Fields(string(parser.value))
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	switch strings.ToUpper(parser.key) {
+	case slowLogGet:
+		count := defaultSlowLogCount
+		if len(args) > 1 {
+			return nil, incorrectSlowLogError
+		}
+		if len(args) == 1 {
+			var err error
+			if count, err = strconv.Atoi(args[0]); err != nil || count < 0 {
+				return nil, incorrectSlowLogError
+			}
+		}
+
+		//newest entries first
+		out := []string{}
+		for i := len(l.entries) - 1; i >= 0 && len(out) < count; i-- {
+			out = append(out, l.entries[i].String())
+		}
+		return out, nil
+	case slowLogLen:
+		if len(args) > 0 {
+			return nil, incorrectSlowLogError
+		}
+		return strconv.Itoa(len(l.entries)), nil
+	case slowLogReset:
+		if len(args) > 0 {
+			return nil, incorrectSlowLogError
+		}
+		l.entries = nil
+		return nil, nil
+	default:
+		return nil, incorrectSlowLogError
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestSlowLog(t *testing.T) {
+	cache := kv.NewCacheDb()
+	exeCommand(cache, "SET fast value")
+	if out, _ := exeCommand(cache, "SLOWLOG LEN"); out != "0" {
+		t.Fatal("Incorrect slowlog length", "expected", "0", "got", out)
+	}
+
+	SetSlowLog(cache, 0, 2)
+	exeCommand(cache, "SET first value")
+	exeCommand(cache, "GET first")
+
+	parser := &baseCommandParser{}
+	parser.Write([]byte("SET second " + strings.Repeat("a", maxLoggedArg+10)))
+	ctx := withClient(withTransport(context.Background(), transportTCP), "127.0.0.1:5000")
+	if _, err := ExeContext(ctx, cache, parser); err != nil {
+		t.Fatal("Set error", err.Error())
+	}
+
+	out, err := exeCommand(cache, "SLOWLOG GET")
+	if err != nil {
+		t.Fatal("Slowlog error", err.Error())
+	}
+	//the oldest entry is removed, newest entry is the first
+	entries := out.([]string)
+	if len(entries) != 2 {
+		t.Fatal("Incorrect slowlog entries", "expected", 2, "got", entries)
+	}
+
+	fields := strings.Fields(entries[0])
+	expected := fmt.Sprintf("SET second %s... (10 more bytes)", strings.Repeat("a", maxLoggedArg))
+	if fields[0] != "2" || fields[3] != "127.0.0.1:5000" || fields[4] != transportTCP || strings.Join(fields[5:], " ") != expected {
+		t.Fatal("Incorrect slow entry", "expected", expected, "got", entries[0])
+	}
+	if unix, _ := strconv.ParseInt(fields[1], 10, 64); unix > time.Now().Unix() || unix < time.Now().Add(-time.Minute).Unix() {
+		t.Fatal("Incorrect entry time", "got", fields[1])
+	}
+
+	fields = strings.Fields(entries[1])
+	if fields[0] != "1" || fields[3] != "-" || fields[4] != transportEmbedded || strings.Join(fields[5:], " ") != "GET first" {
+		t.Fatal("Incorrect embedded entry", "got", entries[1])
+	}
+
+	//SLOWLOG GET is logged after execution
+	if out, _ := exeCommand(cache, "SLOWLOG LEN"); out != "2" {
+		t.Fatal("Incorrect slowlog length", "expected", "2", "got", out)
+	}
+	if out, _ := exeCommand(cache, "SLOWLOG GET 1"); len(out.([]string)) != 1 || !strings.HasSuffix(out.([]string)[0], "SLOWLOG LEN") {
+		t.Fatal("Incorrect slowlog entries", "got", out)
+	}
+
+	SetSlowLog(cache, -1, 2)
+	exeCommand(cache, "SLOWLOG RESET")
+	exeCommand(cache, "GET second")
+	if out, _ := exeCommand(cache, "SLOWLOG GET"); len(out.([]string)) != 0 {
+		t.Fatal("Expected empty slowlog", "got", out)
+	}
+
+	for _, cmd := range []string{"SLOWLOG", "SLOWLOG FOO", "SLOWLOG GET -1", "SLOWLOG LEN 1"} {
+		if _, err := exeCommand(cache, cmd); err == nil {
+			t.Fatal("Expected slowlog error", cmd)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+const (
+	streamMaxLen   = "MAXLEN"
+	streamMinID    = "MINID"
+	streamMaxAge   = "MAXAGE"
+	streamCount    = "COUNT"
+	streamMkStream = "MKSTREAM"
+
+	// streamAutoID generates entry id
+	streamAutoID = "*"
+	// streamFirst and streamLast are range bounds
+	streamFirst = "-"
+	streamLast  = "+"
+	// streamNew is last stream id for group create, never delivered entries for group read
+	streamNew         = "$"
+	streamUndelivered = ">"
+)
+
+var (
+	incorrectStreamIDError   = badRequest("Incorrect stream ID")
+	incorrectStreamArgsError = badRequest("Incorrect stream command arguments")
+)
+
+// executeStream executes stream commands:
+//
+//	XADD key [MAXLEN count] *|id field value [field value ...]
+//	XRANGE key start end [COUNT count]
+//	XREVRANGE key end start [COUNT count]
+//	XLEN key
+//	XTRIM key MAXLEN count|MINID id|MAXAGE seconds
+//	XGROUPCREATE key group id|$ [MKSTREAM]
+//	XGROUPDESTROY key group
+//	XREADGROUP key group consumer [COUNT count] >|id
+//	XACK key group id [id ...]
+//	XPENDING key group [consumer]
+func executeStream(ctx context.Context, cache *kv.CacheDb, parser *baseCommandParser) (interface{}, error) {
+	args := strings.Fields(string(parser.value))
+
+	switch parser.cmd {
+	case cmdXAddLex:
+		maxLen := 0
+		if len(args) > 1 && args[0] == streamMaxLen {
+			var err error
+			if maxLen, err = parseCount(args[1]); err != nil {
+				return nil, err
+			}
+			args = args[2:]
+		}
+		if len(args) < 3 {
+			return nil, incompleteCommandError
+		}
+
+		fields := make([][]byte, len(args)-1)
+		for i, field := range args[1:] {
+			fields[i] = []byte(field)
+		}
+
+		var id kv.StreamID
+		var err error
+		if args[0] == streamAutoID {
+			id, err = cache.StreamAddAt(parser.key, commandTime(ctx), fields, maxLen)
+		} else {
+			if id, err = parseStreamID(args[0], 0); err != nil || id.IsZero() {
+				return nil, incorrectStreamIDError
+			}
+			id, err = cache.StreamAdd(parser.key, id, fields, maxLen)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return id.String(), nil
+	case cmdXRangeLex, cmdXRevRangeLex:
+		if len(args) != 2 && len(args) != 4 {
+			return nil, incorrectStreamArgsError
+		}
+
+		startArg, endArg := args[0], args[1]
+		if parser.cmd == cmdXRevRangeLex {
+			startArg, endArg = endArg, startArg
+		}
+
+		start, err := parseStreamID(startArg, 0)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseStreamID(endArg, math.MaxUint64)
+		if err != nil {
+			return nil, err
+		}
+
+		count := 0
+		if len(args) == 4 {
+			if args[2] != streamCount {
+				return nil, incorrectStreamArgsError
+			}
+			if count, err = parseCount(args[3]); err != nil {
+				return nil, err
+			}
+		}
+
+		entries, err := cache.StreamRange(parser.key, start, end, count, parser.cmd == cmdXRevRangeLex)
+		if err != nil {
+			return nil, err
+		}
+		return formatStreamEntries(entries), nil
+	case cmdXLenLex:
+		length, err := cache.StreamLen(parser.key)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.Itoa(length), nil
+	case cmdXTrimLex:
+		if len(args) != 2 {
+			return nil, incorrectStreamArgsError
+		}
+
+		var removed int
+		var err error
+		switch args[0] {
+		case streamMaxLen:
+			var maxLen int
+			if maxLen, err = parseCount(args[1]); err != nil {
+				return nil, err
+			}
+			removed, err = cache.StreamTrimLen(parser.key, maxLen)
+		case streamMinID:
+			var minID kv.StreamID
+			if minID, err = parseStreamID(args[1], 0); err != nil {
+				return nil, err
+			}
+			removed, err = cache.StreamTrimMinID(parser.key, minID)
+		case streamMaxAge:
+			var age int
+			if age, err = parseCount(args[1]); err != nil {
+				return nil, err
+			}
+			//age older than unix epoch keeps every entry
+			minID := kv.StreamID{}
+			if now := commandTime(ctx).UnixMilli(); int64(age) < now/1000 {
+				minID.Ms = uint64(now - int64(age)*1000)
+			}
+			removed, err = cache.StreamTrimMinID(parser.key, minID)
+		default:
+			return nil, incorrectStreamArgsError
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		return strconv.Itoa(removed), nil
+	case cmdXGroupCreateLex:
+		if len(args) != 2 && !(len(args) == 3 && args[2] == streamMkStream) {
+			return nil, incorrectStreamArgsError
+		}
+
+		start := kv.MaxStreamID
+		if args[1] != streamNew {
+			var err error
+			if start, err = parseStreamID(args[1], 0); err != nil {
+				return nil, err
+			}
+		}
+		return nil, cache.StreamGroupCreate(parser.key, args[0], start, len(args) == 3)
+	case cmdXGroupDestroyLex:
+		if len(args) != 1 {
+			return nil, incorrectStreamArgsError
+		}
+		return nil, cache.StreamGroupDestroy(parser.key, args[0])
+	case cmdXReadGroupLex:
+		if len(args) != 3 && !(len(args) == 5 && args[2] == streamCount) {
+			return nil, incorrectStreamArgsError
+		}
+
+		count := 0
+		if len(args) == 5 {
+			var err error
+			if count, err = parseCount(args[3]); err != nil {
+				return nil, err
+			}
+		}
+
+		var entries []kv.StreamEntry
+		var err error
+		if last := args[len(args)-1]; last == streamUndelivered {
+			entries, err = cache.StreamReadGroup(parser.key, args[0], args[1], count)
+		} else {
+			var after kv.StreamID
+			if after, err = parseStreamID(last, 0); err != nil {
+				return nil, err
+			}
+			entries, err = cache.StreamReadPending(parser.key, args[0], args[1], after, count)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		return formatStreamEntries(entries), nil
+	case cmdXAckLex:
+		if len(args) < 2 {
+			return nil, incompleteCommandError
+		}
+
+		ids := make([]kv.StreamID, len(args)-1)
+		for i, arg := range args[1:] {
+			var err error
+			if ids[i], err = parseStreamID(arg, 0); err != nil {
+				return nil, err
+			}
+		}
+
+		acked, err := cache.StreamAck(parser.key, args[0], ids)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.Itoa(acked), nil
+	case cmdXPendingLex:
+		if len(args) != 1 && len(args) != 2 {
+			return nil, incorrectStreamArgsError
+		}
+
+		consumer := ""
+		if len(args) == 2 {
+			consumer = args[1]
+		}
+
+		pending, err := cache.StreamPending(parser.key, args[0], consumer)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		out := make([]string, len(pending))
+		for i, p := range pending {
+			out[i] = fmt.Sprintf("%s %s %d %d", p.ID, p.Consumer, now.Sub(p.Delivered).Milliseconds(), p.Deliveries)
+		}
+		return out, nil
+	default:
+		return nil, incorrectCommandError
+	}
+}
+
+// parseStreamID parses stream id or range bound, seq is used for id without sequence part
+func parseStreamID(s string, seq uint64) (kv.StreamID, error) {
+	switch s {
+	case streamFirst:
+		return kv.StreamID{}, nil
+	case streamLast:
+		return kv.MaxStreamID, nil
+	}
+
+	id, err := kv.ParseStreamID(s, seq)
+	if err != nil {
+		return id, incorrectStreamIDError
+	}
+	return id, nil
+}
+
+func parseCount(s string) (int, error) {
+	count, err := strconv.Atoi(s)
+	if err != nil || count < 0 {
+		return 0, incorrectStreamArgsError
+	}
+	return count, nil
+}
+
+// formatStreamEntries returns entries as "id field value [field value ...]" strings
+func formatStreamEntries(entries []kv.StreamEntry) []string {
+	out := make([]string, len(entries))
+	for i, entry := range entries {
+		elems := make([]string, 0, len(entry.Fields)+1)
+		elems = append(elems, entry.ID.String())
+		for _, field := range entry.Fields {
+			elems = append(elems, string(field))
+		}
+		out[i] = strings.Join(elems, " ")
+	}
+	return out
+}
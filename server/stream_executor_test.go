@@ -0,0 +1,94 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+func TestStreamCommands(t *testing.T) {
+	type (
+		testCase struct {
+			cmd      string
+			expected interface{}
+			err      error
+		}
+	)
+
+	testCases := []*testCase{
+		{"XADD log 1 user a", "1-0", nil},
+		{"XADD log 1-5 user b", "1-5", nil},
+		{"XADD log 1-5 user c", nil, kv.ErrBadRequest},
+		{"XADD log 0-0 user c", nil, incorrectStreamIDError},
+		{"XADD log * user", nil, kv.ErrBadRequest},
+		{"XADD log 2 user c", "2-0", nil},
+		{"XLEN log", "3", nil},
+		{"XRANGE log - +", []string{"1-0 user a", "1-5 user b", "2-0 user c"}, nil},
+		{"XRANGE log 1 1", []string{"1-0 user a", "1-5 user b"}, nil},
+		{"XREVRANGE log + - COUNT 1", []string{"2-0 user c"}, nil},
+		{"XRANGE log - + LIMIT 1", nil, incorrectStreamArgsError},
+		{"XGROUPCREATE log workers 0", nil, nil},
+		{"XGROUPCREATE log workers 0", nil, kv.ErrBadRequest},
+		{"XGROUPCREATE unknown workers $", nil, ErrNotFound},
+		{"XGROUPCREATE new workers $ MKSTREAM", nil, nil},
+		{"XREADGROUP log workers alice COUNT 2 >", []string{"1-0 user a", "1-5 user b"}, nil},
+		{"XREADGROUP log workers bob >", []string{"2-0 user c"}, nil},
+		{"XREADGROUP log workers bob >", []string{}, nil},
+		{"XREADGROUP log unknown bob >", nil, ErrNotFound},
+		{"XACK log workers 1-0 3-0", "1", nil},
+		{"XREADGROUP log workers alice 0", []string{"1-5 user b"}, nil},
+		{"XTRIM log MAXLEN 1", "2", nil},
+		{"XTRIM log MINID 5", "1", nil},
+		{"XADD log 9 user d", "9-0", nil},
+		{"XTRIM log MAXAGE 9223372036854775807", "0", nil},
+		{"XLEN log", "1", nil},
+		{"XTRIM log MAXAGE 60", "1", nil},
+		{"XTRIM log COUNT 1", nil, incorrectStreamArgsError},
+		{"XGROUPDESTROY log workers", nil, nil},
+		{"XPENDING log workers", nil, ErrNotFound},
+		{"SET string value", nil, nil},
+		{"XLEN string", nil, ErrWrongType},
+	}
+
+	cache := kv.NewCacheDb()
+	for _, tc := range testCases {
+		parser := &baseCommandParser{}
+		if _, err := parser.Write([]byte(tc.cmd)); err != nil {
+			t.Fatal("Parse error", tc.cmd, err)
+		}
+
+		out, err := Exe(cache, parser)
+		if tc.err != nil {
+			if kindOf(err) != kindOf(tc.err) {
+				t.Fatal("Incorrect error", tc.cmd, "expected", tc.err, "got", err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal("Unexpected error", tc.cmd, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) && !(out == nil && tc.expected == nil) {
+			t.Fatal("Incorrect response", tc.cmd, "expected", tc.expected, "got", out)
+		}
+	}
+
+	parser := &baseCommandParser{}
+	parser.Write([]byte("XADD jobs * n 1"))
+	Exe(cache, parser)
+	parser = &baseCommandParser{}
+	parser.Write([]byte("XGROUPCREATE jobs workers 0"))
+	Exe(cache, parser)
+	parser = &baseCommandParser{}
+	parser.Write([]byte("XREADGROUP jobs workers alice >"))
+	Exe(cache, parser)
+
+	parser = &baseCommandParser{}
+	parser.Write([]byte("XPENDING jobs workers alice"))
+	out, err := Exe(cache, parser)
+	pending, _ := out.([]string)
+	if err != nil || len(pending) != 1 {
+		t.Fatal("Incorrect pending entries", pending, err)
+	}
+}
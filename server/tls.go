@@ -1,12 +1,48 @@
 package server
 
 import (
-	"io/ioutil"
-	"crypto/x509"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// certReloader serves certificate and client CA pool of the last successful load,
+	// connections established before reload keep their certificates
+	certReloader struct {
+		certPath string
+		keyPath  string
+
+		lock    sync.Mutex
+		modTime time.Time
+		state   atomic.Pointer[certState]
+	}
+
+	certState struct {
+		cert *tls.Certificate
+		// config is served to new connections
+		config *tls.Config
+	}
 )
 
-func getTLS(caCertPath string) (*tls.Config, error){
+var (
+	tlsDisabledError = errors.New("TLS is not enabled, server is not started by ListenSecure")
+)
+
+const (
+	// certWatchInterval is an interval of certificate files modification check
+	certWatchInterval = 10 * time.Second
+)
+
+func getTLS(caCertPath string) (*tls.Config, error) {
 	caCert, err := ioutil.ReadFile(caCertPath)
 	if err != nil {
 		return nil, err
@@ -21,4 +57,97 @@ func getTLS(caCertPath string) (*tls.Config, error){
 	}
 
 	return tlsConfig, nil
-}
\ No newline at end of file
+}
+
+// newCertReloader loads server certificate of certPath and keyPath, client CA pool is loaded from certPath
+func newCertReloader(certPath string, keyPath string) (*certReloader, error) {
+	r := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads certificate and client CA pool, previous state is kept on error
+func (r *certReloader) reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	modTime := r.filesModTime()
+	config, err := getTLS(r.certPath)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+
+	config.Certificates = []tls.Certificate{cert}
+	config.Rand = rand.Reader
+	r.state.Store(&certState{cert: &cert, config: config})
+	r.modTime = modTime
+	return nil
+}
+
+// tlsConfig returns config which serves the last loaded certificate and client CA pool to every new connection
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		Rand:       rand.Reader,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.state.Load().cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.state.Load().config, nil
+		},
+	}
+}
+
+// filesModTime returns the latest modification time of certificate and key files
+func (r *certReloader) filesModTime() time.Time {
+	latest := time.Time{}
+	for _, path := range []string{r.certPath, r.keyPath} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// reloadTLS reloads certificates of reloader r, servers started by Listen have no reloader
+func reloadTLS(r *certReloader) error {
+	if r == nil {
+		return tlsDisabledError
+	}
+	return r.reload()
+}
+
+// watch reloads certificates after files modification until ctx is done
+func (r *certReloader) watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.lock.Lock()
+		changed := !r.filesModTime().Equal(r.modTime)
+		r.lock.Unlock()
+		if !changed {
+			continue
+		}
+
+		//partially written files are loaded again on the next check
+		if err := r.reload(); err != nil {
+			logger.Warn("Certificate reload error", "cert", r.certPath, "err", err)
+			continue
+		}
+		logger.Info("Certificate is reloaded", "cert", r.certPath)
+	}
+}
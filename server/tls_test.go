@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+	"github.com/2tvenom/kv/protocol"
+)
+
+// writeCA writes self signed CA certificate and key files to dir, returns client certificate signed by CA
+func writeCA(t *testing.T, dir string, serial int64) tls.Certificate {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "kv"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal("Certificate error", err.Error())
+	}
+	caKeyDer, _ := x509.MarshalECPrivateKey(caKey)
+	os.WriteFile(filepath.Join(dir, "ca.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}), 0600)
+	os.WriteFile(filepath.Join(dir, "ca.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: caKeyDer}), 0600)
+
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	client := &x509.Certificate{
+		SerialNumber: big.NewInt(serial + 1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	caCert, _ := x509.ParseCertificate(caDer)
+	clientDer, err := x509.CreateCertificate(rand.Reader, client, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal("Certificate error", err.Error())
+	}
+	return tls.Certificate{Certificate: [][]byte{clientDer}, PrivateKey: clientKey}
+}
+
+func TestReloadTLS(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	oldClient := writeCA(t, dir, 100)
+
+	ts := NewTcpServer(kv.NewCacheDb(), "127.0.0.1", 4527)
+	go ts.ListenSecure(certPath, keyPath)
+	defer ts.Close()
+	time.Sleep(time.Millisecond * 100)
+
+	dial := func(cert tls.Certificate) (*tls.Conn, error) {
+		conn, err := tls.Dial("tcp", "127.0.0.1:4527", &tls.Config{Certificates: []tls.Certificate{cert}, InsecureSkipVerify: true})
+		if err != nil {
+			return nil, err
+		}
+		//client certificate is verified by the first read of TLS 1.3 client
+		if err := protocol.NewEncoder(conn).EncodeRequest([]byte("GET key")); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if _, err := protocol.NewDecoder(conn).DecodeResponse(); err != protocol.ErrNotFound {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	serial := func(conn *tls.Conn) int64 {
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	open, err := dial(oldClient)
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer open.Close()
+	if serial(open) != 100 {
+		t.Fatal("Incorrect server certificate", "expected", 100, "got", serial(open))
+	}
+
+	newClient := writeCA(t, dir, 200)
+	if err := ts.ReloadTLS(); err != nil {
+		t.Fatal("Reload error", err.Error())
+	}
+
+	conn, err := dial(newClient)
+	if err != nil {
+		t.Fatal("Dial error", err.Error())
+	}
+	defer conn.Close()
+	if serial(conn) != 200 {
+		t.Fatal("Incorrect reloaded certificate", "expected", 200, "got", serial(conn))
+	}
+
+	if conn, err := dial(oldClient); err == nil {
+		conn.Close()
+		t.Fatal("Expected rejected client of previous CA")
+	}
+
+	//open connection keeps previous certificate
+	protocol.NewEncoder(open).EncodeRequest([]byte("GET key"))
+	if _, err := protocol.NewDecoder(open).DecodeResponse(); err != protocol.ErrNotFound {
+		t.Fatal("Incorrect response of open connection", "expected", protocol.ErrNotFound, "got", err)
+	}
+
+	//broken files keep loaded certificate
+	os.WriteFile(keyPath, []byte("broken"), 0600)
+	if err := ts.ReloadTLS(); err == nil {
+		t.Fatal("Expected reload error")
+	}
+	if conn, err := dial(newClient); err != nil {
+		t.Fatal("Dial error", err.Error())
+	} else {
+		conn.Close()
+	}
+
+	if err := NewTcpServer(kv.NewCacheDb(), "127.0.0.1", 4528).ReloadTLS(); err != tlsDisabledError {
+		t.Fatal("Incorrect reload error", "expected", tlsDisabledError, "got", err)
+	}
+}
+
+func TestCertWatch(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	writeCA(t, dir, 100)
+
+	r, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatal("Load error", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.watch(ctx, time.Millisecond*10, slog.Default())
+
+	writeCA(t, dir, 200)
+	modTime := time.Now().Add(time.Second)
+	os.Chtimes(certPath, modTime, modTime)
+
+	waitFor(t, "certificate reload", func() bool {
+		cert, _ := x509.ParseCertificate(r.state.Load().cert.Certificate[0])
+		return cert.SerialNumber.Int64() == 200
+	})
+}
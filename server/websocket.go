@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2tvenom/kv/kv"
+)
+
+const (
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xa
+
+	// wsMaxControlPayload is maximum payload length of control frame
+	wsMaxControlPayload = 125
+	// wsWriteTimeout limits every frame write, client which does not read frames is disconnected
+	wsWriteTimeout = 10 * time.Second
+)
+
+var (
+	notWebsocketError   = badRequest("Websocket upgrade expected")
+	wsLargePayloadError = errors.New("Websocket frame is too large")
+	wsOriginError       = kv.NewError(ErrNoPermission, "Websocket origin is not allowed")
+)
+
+type (
+	// wsConn is a minimal server side websocket connection (RFC 6455),
+	// server writes text frames and handles control frames sent by client
+	wsConn struct {
+		conn net.Conn
+		r    *bufio.Reader
+		lock sync.Mutex
+	}
+)
+
+// upgradeWebsocket switches request connection to websocket, browser request is accepted from origin of the same host
+// or from one of allowed origins
+func upgradeWebsocket(writer http.ResponseWriter, request *http.Request, origins []string) (*wsConn, error) {
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(request.Header, "Connection", "upgrade") ||
+		!headerContains(request.Header, "Upgrade", "websocket") || key == "" {
+		return nil, notWebsocketError
+	}
+	if !allowedOrigin(request, origins) {
+		return nil, wsOriginError
+	}
+
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("Connection can not be hijacked")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// allowedOrigin checks Origin header of browser request, request without Origin is not sent by browser
+func allowedOrigin(request *http.Request, origins []string) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, request.Host)
+}
+
+func headerContains(header http.Header, name string, value string) bool {
+	for _, v := range header.Values(name) {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(wsOpText, data)
+}
+
+func (c *wsConn) writeFrame(opcode byte, data []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(data) <= wsMaxControlPayload:
+		frame = append(frame, byte(len(data)))
+	case len(data) <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(data)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(data)))
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(append(frame, data...))
+	return err
+}
+
+// readLoop reads client frames until connection is closed, answers ping and close frames.
+// Data frames sent by client are ignored
+func (c *wsConn) readLoop() error {
+	header := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(c.r, header); err != nil {
+			return err
+		}
+
+		opcode := header[0] & 0x0f
+		masked := header[1]&0x80 != 0
+		length := uint64(header[1] & 0x7f)
+
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(c.r, ext); err != nil {
+				return err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(c.r, ext); err != nil {
+				return err
+			}
+			length = binary.BigEndian.Uint64(ext)
+		}
+
+		if length > maxRequestLength {
+			return wsLargePayloadError
+		}
+
+		mask := make([]byte, 4)
+		if masked {
+			if _, err := io.ReadFull(c.r, mask); err != nil {
+				return err
+			}
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return err
+		}
+
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch opcode {
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return io.EOF
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}